@@ -15,8 +15,13 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
 )
 
 var encodetestBsonD D
@@ -559,3 +564,333 @@ func BenchmarkCodeMarshal(b *testing.B) {
 		b.SetBytes(int64(len(codeJSON)))
 	})
 }
+
+func BenchmarkMarshalStructSlice(b *testing.B) {
+	type elem struct {
+		ID    int64    `bson:"_id"`
+		Name  string   `bson:"name"`
+		Score float64  `bson:"score"`
+		Tags  []string `bson:"tags,omitempty"`
+	}
+
+	const n = 100000
+	structs := make([]elem, n)
+	anys := make([]any, n)
+	for i := range structs {
+		structs[i] = elem{ID: int64(i), Name: "name", Score: float64(i) / 2}
+		anys[i] = structs[i]
+	}
+
+	cases := []struct {
+		desc  string
+		value any
+	}{
+		{
+			desc:  "[]struct",
+			value: D{{"v", structs}},
+		},
+		{
+			desc:  "[]any",
+			value: D{{"v", anys}},
+		},
+	}
+	for _, tc := range cases {
+		tc := tc // Capture range variable.
+
+		b.Run(tc.desc, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := Marshal(tc.value)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMarshalLargeStructSlice(b *testing.B) {
+	type elem struct {
+		ID       int64     `bson:"_id"`
+		Name     string    `bson:"name"`
+		Email    string    `bson:"email"`
+		Age      int32     `bson:"age"`
+		Score    float64   `bson:"score"`
+		Active   bool      `bson:"active"`
+		Created  time.Time `bson:"created"`
+		Category string    `bson:"category"`
+		Count    int64     `bson:"count"`
+		Note     string    `bson:"note,omitempty"`
+	}
+
+	const n = 10000
+	structs := make([]elem, n)
+	array := new([n]elem)
+	anys := make([]any, n)
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range structs {
+		structs[i] = elem{
+			ID:       int64(i),
+			Name:     "name",
+			Email:    "name@example.com",
+			Age:      int32(i % 100),
+			Score:    float64(i) / 2,
+			Active:   i%2 == 0,
+			Created:  created,
+			Category: "category",
+			Count:    int64(i) * 3,
+		}
+		array[i] = structs[i]
+		anys[i] = structs[i]
+	}
+
+	// []any looks up the encoder and describes the struct for every element, while []T and [N]T
+	// resolve the struct description once for the whole slice.
+	cases := []struct {
+		desc  string
+		value any
+	}{
+		{desc: "[]struct", value: D{{"v", structs}}},
+		{desc: "[N]struct", value: D{{"v", array}}},
+		{desc: "[]any", value: D{{"v", anys}}},
+	}
+	for _, tc := range cases {
+		tc := tc // Capture range variable.
+
+		b.Run(tc.desc, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := Marshal(tc.value)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPackedSlice(b *testing.B) {
+	type series struct {
+		Points []float64 `bson:"points"`
+	}
+
+	points := make([]float64, 10000)
+	for i := range points {
+		points[i] = float64(i) / 3
+	}
+	reg := NewRegistry()
+	reg.RegisterPackedSlice(reflect.TypeOf(points), "le-f64")
+
+	for _, packArraysOver := range []int{0, 100} {
+		packArraysOver := packArraysOver // Capture range variable.
+
+		desc := "array"
+		if packArraysOver > 0 {
+			desc = "packed"
+		}
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetRegistry(reg)
+		enc.PackArraysOver(packArraysOver)
+		if err := enc.Encode(series{Points: points}); err != nil {
+			b.Fatal(err)
+		}
+		doc := append([]byte(nil), buf.Bytes()...)
+
+		b.Run(desc+"/marshal", func(b *testing.B) {
+			b.ReportAllocs()
+			b.ReportMetric(float64(len(doc)), "doc-bytes")
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				enc.Reset(NewDocumentWriter(buf))
+				if err := enc.Encode(series{Points: points}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(desc+"/unmarshal", func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(doc)))
+			for i := 0; i < b.N; i++ {
+				dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+				dec.SetRegistry(reg)
+				var got series
+				if err := dec.Decode(&got); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDescribeStructConcurrent(b *testing.B) {
+	type describeTest struct {
+		A string  `bson:"a"`
+		B int64   `bson:"b"`
+		C float64 `bson:"c"`
+		D []int32 `bson:"d"`
+	}
+
+	const goroutines = 64
+	var describes int64
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		// Use a new Registry so that every iteration describes the struct for the first time.
+		reg := NewRegistry()
+		reg.SetOnDescribe(func(reflect.Type, *StructDescriptionBuilder) {
+			atomic.AddInt64(&describes, 1)
+		})
+
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+
+				enc := NewEncoder(NewDocumentWriter(new(bytes.Buffer)))
+				enc.SetRegistry(reg)
+				if err := enc.Encode(describeTest{A: "a"}); err != nil {
+					b.Error(err)
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+	}
+	b.ReportMetric(float64(atomic.LoadInt64(&describes))/float64(b.N), "describes/op")
+}
+
+type benchRawPoint struct {
+	X, Y, Z float64
+}
+
+func (p benchRawPoint) MarshalRawBSON() ([]byte, error) {
+	idx, doc := bsoncore.AppendDocumentStart(make([]byte, 0, 40))
+	doc = bsoncore.AppendDoubleElement(doc, "x", p.X)
+	doc = bsoncore.AppendDoubleElement(doc, "y", p.Y)
+	doc = bsoncore.AppendDoubleElement(doc, "z", p.Z)
+	return bsoncore.AppendDocumentEnd(doc, idx)
+}
+
+func BenchmarkRawBSONMarshaler(b *testing.B) {
+	type point struct {
+		X float64 `bson:"x"`
+		Y float64 `bson:"y"`
+		Z float64 `bson:"z"`
+	}
+
+	reflected := make([]point, 1000)
+	raw := make([]benchRawPoint, 1000)
+	for i := range raw {
+		reflected[i] = point{X: float64(i), Y: 1, Z: 2}
+		raw[i] = benchRawPoint{X: float64(i), Y: 1, Z: 2}
+	}
+
+	benchmarks := []struct {
+		name string
+		val  any
+	}{
+		{"struct", struct{ Points []point }{reflected}},
+		{"raw", struct{ Points []benchRawPoint }{raw}},
+	}
+	for _, bm := range benchmarks {
+		bm := bm // Capture range variable.
+
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := Marshal(bm.val); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMarshalWideStruct(b *testing.B) {
+	type wide struct {
+		F01 int32   `bson:"f01"`
+		F02 int64   `bson:"f02,minsize"`
+		F03 string  `bson:"f03"`
+		F04 float64 `bson:"f04"`
+		F05 bool    `bson:"f05"`
+		F06 int32   `bson:"f06"`
+		F07 int64   `bson:"f07,minsize"`
+		F08 string  `bson:"f08"`
+		F09 float64 `bson:"f09"`
+		F10 bool    `bson:"f10"`
+		F11 int32   `bson:"f11"`
+		F12 int64   `bson:"f12,minsize"`
+		F13 string  `bson:"f13"`
+		F14 float64 `bson:"f14"`
+		F15 bool    `bson:"f15"`
+		F16 int32   `bson:"f16"`
+		F17 int64   `bson:"f17,minsize"`
+		F18 string  `bson:"f18"`
+		F19 float64 `bson:"f19"`
+		F20 bool    `bson:"f20"`
+	}
+
+	val := wide{F03: "a", F08: "b", F13: "c", F18: "d"}
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(NewDocumentWriter(buf))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		enc.Reset(NewDocumentWriter(buf))
+		if err := enc.Encode(val); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalOmitEmptyInts(b *testing.B) {
+	type sparse struct {
+		F01 int `bson:"f01,omitempty"`
+		F02 int `bson:"f02,omitempty"`
+		F03 int `bson:"f03,omitempty"`
+		F04 int `bson:"f04,omitempty"`
+		F05 int `bson:"f05,omitempty"`
+		F06 int `bson:"f06,omitempty"`
+		F07 int `bson:"f07,omitempty"`
+		F08 int `bson:"f08,omitempty"`
+		F09 int `bson:"f09,omitempty"`
+		F10 int `bson:"f10,omitempty"`
+		F11 int `bson:"f11,omitempty"`
+		F12 int `bson:"f12,omitempty"`
+		F13 int `bson:"f13,omitempty"`
+		F14 int `bson:"f14,omitempty"`
+		F15 int `bson:"f15,omitempty"`
+		F16 int `bson:"f16,omitempty"`
+		F17 int `bson:"f17,omitempty"`
+		F18 int `bson:"f18,omitempty"`
+		F19 int `bson:"f19,omitempty"`
+		F20 int `bson:"f20,omitempty"`
+		F21 int `bson:"f21,omitempty"`
+		F22 int `bson:"f22,omitempty"`
+		F23 int `bson:"f23,omitempty"`
+		F24 int `bson:"f24,omitempty"`
+		F25 int `bson:"f25,omitempty"`
+		F26 int `bson:"f26,omitempty"`
+		F27 int `bson:"f27,omitempty"`
+		F28 int `bson:"f28,omitempty"`
+		F29 int `bson:"f29,omitempty"`
+		F30 int `bson:"f30,omitempty"`
+	}
+
+	val := sparse{F01: 1, F10: 10, F20: 20, F30: 30}
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(NewDocumentWriter(buf))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		enc.Reset(NewDocumentWriter(buf))
+		if err := enc.Encode(val); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+)
+
+// ErrInexactDecimal128 is wrapped by the error returned when a *big.Rat or *big.Float value cannot
+// be represented exactly as a Decimal128 and the Encoder uses the DecimalRoundingError mode.
+var ErrInexactDecimal128 = errors.New("value cannot be represented exactly as a Decimal128")
+
+// DecimalRounding is how *big.Rat and *big.Float values that cannot be represented exactly as a
+// Decimal128 are encoded. It is set using Encoder.SetDecimalRounding.
+type DecimalRounding int
+
+// These constants are the supported DecimalRounding values.
+const (
+	// DecimalRoundingError causes encoding to fail with an error wrapping ErrInexactDecimal128. It
+	// is the default.
+	DecimalRoundingError DecimalRounding = iota
+
+	// DecimalRoundHalfEven causes values to be rounded to the nearest Decimal128 with 34
+	// significant digits, with ties rounded to an even last digit.
+	DecimalRoundHalfEven
+)
+
+// decimal128Digits is the number of significant decimal digits of a Decimal128.
+const decimal128Digits = 34
+
+// decimal128FloatPrec is the precision in bits of *big.Float values decoded from a Decimal128,
+// which is enough to hold 34 significant decimal digits.
+const decimal128FloatPrec = 113
+
+var tBigRat = reflect.TypeOf((*big.Rat)(nil))
+var tBigFloat = reflect.TypeOf((*big.Float)(nil))
+
+var (
+	bigOne  = big.NewInt(1)
+	bigTwo  = big.NewInt(2)
+	bigFive = big.NewInt(5)
+)
+
+// bigDecimalCodec is the Codec used for *big.Rat and *big.Float values. It encodes them as BSON
+// Decimal128, which holds at most 34 significant decimal digits and exponents between
+// MinDecimal128Exp and MaxDecimal128Exp. Values with more digits, such as 1/3, or with a
+// non-terminating decimal expansion are encoded according to the DecimalRounding mode of the
+// Encoder. A nil pointer is encoded as BSON null.
+type bigDecimalCodec struct{}
+
+// EncodeValue is the ValueEncoder for *big.Rat and *big.Float.
+func (bigDecimalCodec) EncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || (val.Type() != tBigRat && val.Type() != tBigFloat) {
+		return ValueEncoderError{Name: "BigDecimalEncodeValue", Types: []reflect.Type{tBigRat, tBigFloat}, Received: val}
+	}
+	if val.IsNil() {
+		return vw.WriteNull()
+	}
+
+	var r *big.Rat
+	switch v := val.Interface().(type) {
+	case *big.Rat:
+		r = v
+	case *big.Float:
+		if v.IsInf() {
+			if v.Signbit() {
+				return vw.WriteDecimal128(dNegInf)
+			}
+			return vw.WriteDecimal128(dPosInf)
+		}
+		// Finite binary floating-point values always have a terminating decimal expansion, so
+		// the conversion to *big.Rat is exact.
+		r, _ = v.Rat(nil)
+	}
+	d, err := ratToDecimal128(r, ec.decimalRounding)
+	if err != nil {
+		return err
+	}
+	return vw.WriteDecimal128(d)
+}
+
+// DecodeValue is the ValueDecoder for *big.Rat and *big.Float. BSON null and undefined values are
+// decoded as a nil pointer. A Decimal128 NaN cannot be decoded, and Decimal128 infinities can only
+// be decoded into a *big.Float.
+func (bigDecimalCodec) DecodeValue(_ DecodeContext, vr ValueReader, val reflect.Value) error {
+	if !val.CanSet() || (val.Type() != tBigRat && val.Type() != tBigFloat) {
+		return ValueDecoderError{Name: "BigDecimalDecodeValue", Types: []reflect.Type{tBigRat, tBigFloat}, Received: val}
+	}
+
+	var d Decimal128
+	switch vrType := vr.Type(); vrType {
+	case TypeDecimal128:
+		var err error
+		if d, err = vr.ReadDecimal128(); err != nil {
+			return err
+		}
+	case TypeNull:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadNull()
+	case TypeUndefined:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadUndefined()
+	default:
+		return fmt.Errorf("cannot decode %v into a %s", vrType, val.Type())
+	}
+
+	if inf := d.IsInf(); inf != 0 && val.Type() == tBigFloat {
+		val.Set(reflect.ValueOf(new(big.Float).SetInf(inf < 0)))
+		return nil
+	}
+	bi, exp, err := d.BigInt()
+	if err != nil {
+		return fmt.Errorf("cannot decode Decimal128 %s into a %s: %w", d, val.Type(), err)
+	}
+	r := new(big.Rat).SetInt(bi)
+	if exp > 0 {
+		r.Mul(r, new(big.Rat).SetInt(pow10(exp)))
+	} else if exp < 0 {
+		r.Quo(r, new(big.Rat).SetInt(pow10(-exp)))
+	}
+
+	if val.Type() == tBigRat {
+		val.Set(reflect.ValueOf(r))
+		return nil
+	}
+	val.Set(reflect.ValueOf(new(big.Float).SetPrec(decimal128FloatPrec).SetRat(r)))
+	return nil
+}
+
+// ratToDecimal128 converts r to a Decimal128. If r cannot be represented exactly, it returns an
+// error wrapping ErrInexactDecimal128, or the value rounded half to even if rounding is
+// DecimalRoundHalfEven. It returns an error if the exponent of r is out of the Decimal128 range.
+func ratToDecimal128(r *big.Rat, rounding DecimalRounding) (Decimal128, error) {
+	// A denominator with no prime factors other than 2 and 5 divides a power of ten, so r has a
+	// terminating decimal expansion.
+	if k, ok := decimalScale(r.Denom()); ok {
+		sig := new(big.Int).Mul(r.Num(), pow10(k))
+		sig.Quo(sig, r.Denom())
+		if d, ok := ParseDecimal128FromBigInt(sig, -k); ok {
+			return d, nil
+		}
+	}
+	if rounding != DecimalRoundHalfEven {
+		return Decimal128{}, fmt.Errorf("%w: %s", ErrInexactDecimal128, r.RatString())
+	}
+
+	// Scale |r| by 10^-exp so that its integer part has exactly 34 digits, then round the
+	// remainder half to even.
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+	exp := len(num.String()) - len(den.String()) - decimal128Digits
+	q, rem, m := new(big.Int), new(big.Int), new(big.Int)
+	for {
+		n := new(big.Int).Set(num)
+		m.Set(den)
+		if exp < 0 {
+			n.Mul(n, pow10(-exp))
+		} else {
+			m.Mul(m, pow10(exp))
+		}
+		q.QuoRem(n, m, rem)
+		digits := len(q.String())
+		if digits == decimal128Digits {
+			break
+		}
+		if digits > decimal128Digits {
+			exp++
+		} else {
+			exp--
+		}
+	}
+	if c := new(big.Int).Mul(rem, bigTwo).Cmp(m); c > 0 || c == 0 && q.Bit(0) == 1 {
+		q.Add(q, bigOne)
+	}
+	if len(q.String()) > decimal128Digits {
+		q.Quo(q, big.NewInt(10))
+		exp++
+	}
+	if r.Sign() < 0 {
+		q.Neg(q)
+	}
+	d, ok := ParseDecimal128FromBigInt(q, exp)
+	if !ok {
+		return Decimal128{}, fmt.Errorf("%s is out of the Decimal128 exponent range", r.RatString())
+	}
+	return d, nil
+}
+
+// decimalScale returns the smallest k such that den divides 10^k, and whether such a k exists.
+func decimalScale(den *big.Int) (int, bool) {
+	d := new(big.Int).Set(den)
+	var twos, fives int
+	mod := new(big.Int)
+	for {
+		if _, mod = new(big.Int).QuoRem(d, bigTwo, mod); mod.Sign() != 0 {
+			break
+		}
+		d.Quo(d, bigTwo)
+		twos++
+	}
+	for {
+		if _, mod = new(big.Int).QuoRem(d, bigFive, mod); mod.Sign() != 0 {
+			break
+		}
+		d.Quo(d, bigFive)
+		fives++
+	}
+	if d.Cmp(bigOne) != 0 {
+		return 0, false
+	}
+	if twos > fives {
+		return twos, true
+	}
+	return fives, true
+}
+
+// pow10 returns 10^n.
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(ten, big.NewInt(int64(n)), nil)
+}
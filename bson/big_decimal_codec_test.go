@@ -0,0 +1,146 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
+	"go.mongodb.org/mongo-driver/v2/internal/require"
+)
+
+type bigDecimalAccount struct {
+	Balance *big.Rat   `bson:"balance"`
+	Rate    *big.Float `bson:"rate"`
+}
+
+func TestBigDecimalCodec(t *testing.T) {
+	t.Parallel()
+
+	encode := func(t *testing.T, rounding DecimalRounding, val any) ([]byte, error) {
+		t.Helper()
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetDecimalRounding(rounding)
+		err := enc.Encode(val)
+		return buf.Bytes(), err
+	}
+	rat := func(s string) *big.Rat {
+		r, ok := new(big.Rat).SetString(s)
+		require.True(t, ok, "invalid rational %q", s)
+		return r
+	}
+
+	testCases := []struct {
+		name     string
+		val      *big.Rat
+		rounding DecimalRounding
+		want     string
+	}{
+		{"integer", rat("42"), DecimalRoundingError, "42"},
+		{"decimal", rat("-12.345"), DecimalRoundingError, "-12.345"},
+		{"fraction", rat("1/8"), DecimalRoundingError, "0.125"},
+		{"zero", rat("0"), DecimalRoundingError, "0"},
+		{"34 digits", rat("1234567890.123456789012345678901234"), DecimalRoundingError, "1234567890.123456789012345678901234"},
+		{"one third", rat("1/3"), DecimalRoundHalfEven, "0.3333333333333333333333333333333333"},
+		{"two thirds", rat("-2/3"), DecimalRoundHalfEven, "-0.6666666666666666666666666666666667"},
+		{"half even down", rat("1.0000000000000000000000000000000025"), DecimalRoundHalfEven, "1.000000000000000000000000000000002"},
+		{"half even up", rat("1.0000000000000000000000000000000035"), DecimalRoundHalfEven, "1.000000000000000000000000000000004"},
+		{"round up carry", rat("9.99999999999999999999999999999999999"), DecimalRoundHalfEven, "10.00000000000000000000000000000000"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc, err := encode(t, tc.rounding, bigDecimalAccount{Balance: tc.val})
+			require.NoError(t, err, "Encode error")
+			got, err := Raw(doc).LookupErr("balance")
+			require.NoError(t, err, "LookupErr error")
+			d, ok := got.Decimal128OK()
+			require.True(t, ok, "expected a Decimal128, got %s", got.Type)
+			assert.Equal(t, tc.want, d.String())
+		})
+	}
+
+	t.Run("inexact error", func(t *testing.T) {
+		t.Parallel()
+
+		for _, s := range []string{"1/3", "1.0000000000000000000000000000000025"} {
+			_, err := encode(t, DecimalRoundingError, bigDecimalAccount{Balance: rat(s)})
+			assert.ErrorIs(t, err, ErrInexactDecimal128, "expected an error for %s", s)
+		}
+	})
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		want := bigDecimalAccount{Balance: rat("-1234.5678"), Rate: big.NewFloat(0.375)}
+		doc, err := encode(t, DecimalRoundingError, want)
+		require.NoError(t, err, "Encode error")
+
+		var got bigDecimalAccount
+		require.NoError(t, Unmarshal(doc, &got), "Unmarshal error")
+		assert.Equal(t, 0, want.Balance.Cmp(got.Balance), "expected %s, got %s", want.Balance, got.Balance)
+		assert.Equal(t, 0, want.Rate.Cmp(got.Rate), "expected %s, got %s", want.Rate, got.Rate)
+	})
+	t.Run("rounded one third", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := encode(t, DecimalRoundHalfEven, bigDecimalAccount{Balance: rat("1/3")})
+		require.NoError(t, err, "Encode error")
+
+		var got bigDecimalAccount
+		require.NoError(t, Unmarshal(doc, &got), "Unmarshal error")
+		assert.Equal(t, "3333333333333333333333333333333333/10000000000000000000000000000000000", got.Balance.String())
+	})
+	t.Run("big.Float", func(t *testing.T) {
+		t.Parallel()
+
+		// 0.1 has no exact binary representation, so its exact decimal expansion has more than 34
+		// significant digits.
+		_, err := encode(t, DecimalRoundingError, bigDecimalAccount{Rate: big.NewFloat(0.1)})
+		assert.ErrorIs(t, err, ErrInexactDecimal128)
+
+		doc, err := encode(t, DecimalRoundHalfEven, bigDecimalAccount{Rate: big.NewFloat(0.1)})
+		require.NoError(t, err, "Encode error")
+		d := Raw(doc).Lookup("rate").Decimal128()
+		assert.Equal(t, "0.1000000000000000055511151231257827", d.String())
+
+		doc, err = encode(t, DecimalRoundingError, bigDecimalAccount{Rate: new(big.Float).SetInf(true)})
+		require.NoError(t, err, "Encode error")
+		var got bigDecimalAccount
+		require.NoError(t, Unmarshal(doc, &got), "Unmarshal error")
+		assert.True(t, got.Rate.IsInf() && got.Rate.Signbit(), "expected -Inf, got %s", got.Rate)
+	})
+	t.Run("nil", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := encode(t, DecimalRoundingError, bigDecimalAccount{})
+		require.NoError(t, err, "Encode error")
+		assert.Equal(t, mustMarshal(t, D{{"balance", nil}, {"rate", nil}}), doc)
+
+		got := bigDecimalAccount{Balance: rat("1"), Rate: big.NewFloat(1)}
+		require.NoError(t, Unmarshal(doc, &got), "Unmarshal error")
+		assert.Equal(t, bigDecimalAccount{}, got)
+	})
+	t.Run("decode errors", func(t *testing.T) {
+		t.Parallel()
+
+		var got bigDecimalAccount
+		err := Unmarshal(mustMarshal(t, D{{"balance", "1.5"}}), &got)
+		assert.Error(t, err, "expected an error decoding a string")
+
+		inf, err := ParseDecimal128("Infinity")
+		require.NoError(t, err, "ParseDecimal128 error")
+		err = Unmarshal(mustMarshal(t, D{{"balance", inf}}), &got)
+		assert.ErrorIs(t, err, ErrParseInf)
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+// bitsetCodec is the Codec used for []bool and [N]bool fields with the "bitset" struct tag option.
+// It encodes the elements as a BSON binary value holding the number of elements as a 4-byte
+// little-endian integer followed by one bit per element, least significant bit first.
+type bitsetCodec struct{}
+
+// isBitsetType reports whether t is a []bool or [N]bool type.
+func isBitsetType(t reflect.Type) bool {
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() == reflect.Bool
+}
+
+// EncodeValue encodes the bool slice or array val as a BSON binary bitset. A nil slice is encoded
+// as BSON null.
+func (bitsetCodec) EncodeValue(_ EncodeContext, vw ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || !isBitsetType(val.Type()) {
+		return ValueEncoderError{Name: "BitsetEncodeValue", Kinds: []reflect.Kind{reflect.Slice, reflect.Array}, Received: val}
+	}
+	if val.Kind() == reflect.Slice && val.IsNil() {
+		return vw.WriteNull()
+	}
+
+	n := val.Len()
+	data := make([]byte, 4+(n+7)/8)
+	binary.LittleEndian.PutUint32(data, uint32(n))
+	for i := 0; i < n; i++ {
+		if val.Index(i).Bool() {
+			data[4+i/8] |= 1 << (i % 8)
+		}
+	}
+	return vw.WriteBinary(data)
+}
+
+// DecodeValue decodes a BSON binary bitset into the bool slice or array val. The length of the
+// bitset must match the length of an array. BSON null and undefined values are decoded as a nil
+// slice or a zero array.
+func (bitsetCodec) DecodeValue(_ DecodeContext, vr ValueReader, val reflect.Value) error {
+	if !val.CanSet() || !isBitsetType(val.Type()) {
+		return ValueDecoderError{Name: "BitsetDecodeValue", Kinds: []reflect.Kind{reflect.Slice, reflect.Array}, Received: val}
+	}
+
+	switch vrType := vr.Type(); vrType {
+	case TypeBinary:
+	case TypeNull:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadNull()
+	case TypeUndefined:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadUndefined()
+	default:
+		return fmt.Errorf("cannot decode %v into a bitset %s", vrType, val.Type())
+	}
+
+	data, subtype, err := vr.ReadBinary()
+	if err != nil {
+		return err
+	}
+	if subtype != TypeBinaryGeneric && subtype != TypeBinaryBinaryOld {
+		return decodeBinaryError{subtype: subtype, typeName: "bitset " + val.Type().String()}
+	}
+	if len(data) < 4 {
+		return fmt.Errorf("bitset of %d bytes is missing its length header", len(data))
+	}
+	n := int(binary.LittleEndian.Uint32(data))
+	if len(data)-4 != (n+7)/8 {
+		return fmt.Errorf("bitset of %d bytes cannot hold %d bits", len(data), n)
+	}
+
+	var bits reflect.Value
+	if val.Kind() == reflect.Array {
+		if n != val.Len() {
+			return fmt.Errorf("bitset length %d does not match array length %d", n, val.Len())
+		}
+		bits = reflect.New(val.Type()).Elem()
+	} else {
+		bits = reflect.MakeSlice(val.Type(), n, n)
+	}
+	for i := 0; i < n; i++ {
+		bits.Index(i).SetBool(data[4+i/8]&(1<<(i%8)) != 0)
+	}
+	val.Set(bits)
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
+	"go.mongodb.org/mongo-driver/v2/internal/require"
+)
+
+func TestBitsetCodec(t *testing.T) {
+	t.Parallel()
+
+	type flags struct {
+		Slice []bool   `bson:"slice,bitset"`
+		Array [10]bool `bson:"array,bitset"`
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		in := flags{
+			Slice: []bool{true, false, true},
+			Array: [10]bool{0: true, 8: true, 9: true},
+		}
+		doc, err := Marshal(in)
+		require.NoError(t, err, "Marshal error")
+
+		subtype, data := Raw(doc).Lookup("slice").Binary()
+		assert.Equal(t, TypeBinaryGeneric, subtype)
+		assert.Equal(t, []byte{0x03, 0x00, 0x00, 0x00, 0x05}, data)
+		_, data = Raw(doc).Lookup("array").Binary()
+		assert.Equal(t, []byte{0x0a, 0x00, 0x00, 0x00, 0x01, 0x03}, data)
+
+		var got flags
+		err = Unmarshal(doc, &got)
+		require.NoError(t, err, "Unmarshal error")
+		assert.Equal(t, in, got)
+	})
+	t.Run("nil and empty slices", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(flags{})
+		require.NoError(t, err, "Marshal error")
+		assert.Equal(t, TypeNull, Raw(doc).Lookup("slice").Type)
+
+		doc, err = Marshal(flags{Slice: []bool{}})
+		require.NoError(t, err, "Marshal error")
+
+		var got flags
+		err = Unmarshal(doc, &got)
+		require.NoError(t, err, "Unmarshal error")
+		assert.Equal(t, []bool{}, got.Slice)
+	})
+
+	decodeErrs := []struct {
+		name    string
+		doc     D
+		wantKey string
+		wantErr string
+	}{
+		{
+			name:    "array length mismatch",
+			doc:     D{{"array", Binary{Data: []byte{0x03, 0x00, 0x00, 0x00, 0x05}}}},
+			wantKey: "array",
+			wantErr: "bitset length 3 does not match array length 10",
+		},
+		{
+			name:    "truncated bits",
+			doc:     D{{"slice", Binary{Data: []byte{0x09, 0x00, 0x00, 0x00, 0x05}}}},
+			wantKey: "slice",
+			wantErr: "bitset of 5 bytes cannot hold 9 bits",
+		},
+		{
+			name:    "missing header",
+			doc:     D{{"slice", Binary{Data: []byte{0x01}}}},
+			wantKey: "slice",
+			wantErr: "bitset of 1 bytes is missing its length header",
+		},
+	}
+	for _, tc := range decodeErrs {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc, err := Marshal(tc.doc)
+			require.NoError(t, err, "Marshal error")
+
+			var got flags
+			err = Unmarshal(doc, &got)
+			var de *DecodeError
+			require.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+			assert.Equal(t, []string{tc.wantKey}, de.Keys())
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+	t.Run("non-bool field", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := Marshal(struct {
+			V []int `bson:"v,bitset"`
+		}{})
+		assert.ErrorContains(t, err, "bitset requires a []bool or [N]bool field, but V is a []int")
+	})
+}
@@ -583,6 +583,33 @@ func TestMapCodec(t *testing.T) {
 		assert.Equal(t, mapObj, got, "expected result %v, got %v", mapObj, got)
 
 	})
+
+	t.Run("collision func receives original keys", func(t *testing.T) {
+		mapObj := map[keyStruct]int{{val: 7}: 1}
+
+		var gotKey reflect.Value
+		var gotEncoded string
+		collisionFn := func(key reflect.Value, encoded string) bool {
+			gotKey, gotEncoded = key, encoded
+			return key.Interface().(keyStruct).val == 7
+		}
+
+		dw := NewDocumentWriter(new(bytes.Buffer))
+		doc, err := dw.WriteDocument()
+		assert.Nil(t, err, "WriteDocument error: %v", err)
+		err = (&mapCodec{}).encodeMapElements(EncodeContext{Registry: defaultRegistry}, doc, reflect.ValueOf(mapObj), "p_", collisionFn)
+		assert.NotNil(t, err, "expected a collision error")
+		assert.Equal(t, keyStruct{val: 7}, gotKey.Interface(), "expected the original key")
+		assert.Equal(t, "p_7", gotEncoded, "expected the encoded key")
+	})
+
+	t.Run("string collision func", func(t *testing.T) {
+		assert.Nil(t, stringKeyCollision(nil), "expected a nil mapKeyCollisionFunc")
+
+		fn := stringKeyCollision(func(key string) bool { return key == "a" })
+		assert.True(t, fn(reflect.ValueOf(1), "a"), "expected a collision")
+		assert.False(t, fn(reflect.ValueOf("a"), "b"), "expected no collision")
+	})
 }
 
 func TestExtJSONEscapeKey(t *testing.T) {
@@ -0,0 +1,170 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// bsonTypeCodecs maps the BSON type names accepted by the "bsontype" struct tag option to a
+// function reporting whether a Go type can be stored as that BSON type and to the codec used to
+// do so.
+var bsonTypeCodecs = map[string]struct {
+	accepts func(reflect.Type) bool
+	codec   interface {
+		ValueEncoder
+		ValueDecoder
+	}
+}{
+	"datetime": {
+		accepts: func(t reflect.Type) bool {
+			switch t.Kind() {
+			case reflect.Int, reflect.Int32, reflect.Int64:
+				return true
+			}
+			return false
+		},
+		codec: datetimeIntCodec{},
+	},
+	"uuid": {
+		accepts: func(t reflect.Type) bool {
+			return t == tByteSlice || (t.Kind() == reflect.Array && t.Len() == 16 && t.Elem().Kind() == reflect.Uint8)
+		},
+		codec: uuidBytesCodec{},
+	},
+}
+
+// datetimeIntCodec is the Codec used for integer fields with the "bsontype=datetime" struct tag
+// option. The integer holds the number of milliseconds since the Unix epoch.
+type datetimeIntCodec struct{}
+
+// EncodeValue encodes the integer val as a BSON datetime.
+func (datetimeIntCodec) EncodeValue(_ EncodeContext, vw ValueWriter, val reflect.Value) error {
+	switch val.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+	default:
+		return ValueEncoderError{
+			Name:     "DatetimeIntEncodeValue",
+			Kinds:    []reflect.Kind{reflect.Int, reflect.Int32, reflect.Int64},
+			Received: val,
+		}
+	}
+	return vw.WriteDateTime(val.Int())
+}
+
+// DecodeValue decodes a BSON datetime into the integer val. BSON null and undefined values are
+// decoded as 0.
+func (datetimeIntCodec) DecodeValue(_ DecodeContext, vr ValueReader, val reflect.Value) error {
+	switch val.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+	default:
+		return ValueDecoderError{
+			Name:     "DatetimeIntDecodeValue",
+			Kinds:    []reflect.Kind{reflect.Int, reflect.Int32, reflect.Int64},
+			Received: val,
+		}
+	}
+	if !val.CanSet() {
+		return ValueDecoderError{Name: "DatetimeIntDecodeValue", Kinds: []reflect.Kind{val.Kind()}, Received: val}
+	}
+
+	var ms int64
+	switch vrType := vr.Type(); vrType {
+	case TypeDateTime:
+		var err error
+		if ms, err = vr.ReadDateTime(); err != nil {
+			return err
+		}
+	case TypeNull:
+		if err := vr.ReadNull(); err != nil {
+			return err
+		}
+	case TypeUndefined:
+		if err := vr.ReadUndefined(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("cannot decode %v into a datetime %s", vrType, val.Type())
+	}
+	if val.OverflowInt(ms) {
+		return fmt.Errorf("datetime %d overflows %s", ms, val.Type())
+	}
+	val.SetInt(ms)
+	return nil
+}
+
+// uuidBytesCodec is the Codec used for []byte and [16]byte fields with the "bsontype=uuid" struct
+// tag option.
+type uuidBytesCodec struct{}
+
+// EncodeValue encodes val as BSON binary with the UUID subtype set using Encoder.SetUUIDSubtype, or
+// TypeBinaryUUID by default. A nil slice is encoded as BSON null.
+func (uuidBytesCodec) EncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || (val.Type() != tByteSlice && val.Kind() != reflect.Array) {
+		return ValueEncoderError{Name: "UUIDBytesEncodeValue", Kinds: []reflect.Kind{reflect.Slice, reflect.Array}, Received: val}
+	}
+	if val.Kind() == reflect.Slice && val.IsNil() {
+		return vw.WriteNull()
+	}
+	subtype, err := uuidSubtype(ec)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, val.Len())
+	reflect.Copy(reflect.ValueOf(data), val)
+	return vw.WriteBinaryWithSubtype(data, subtype)
+}
+
+// DecodeValue decodes BSON binary with either UUID subtype into val. A [16]byte requires exactly 16
+// bytes. BSON null and undefined values are decoded as a nil slice or a zero array.
+func (uuidBytesCodec) DecodeValue(_ DecodeContext, vr ValueReader, val reflect.Value) error {
+	if !val.CanSet() || (val.Type() != tByteSlice && val.Kind() != reflect.Array) {
+		return ValueDecoderError{Name: "UUIDBytesDecodeValue", Kinds: []reflect.Kind{reflect.Slice, reflect.Array}, Received: val}
+	}
+
+	switch vrType := vr.Type(); vrType {
+	case TypeBinary:
+	case TypeNull:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadNull()
+	case TypeUndefined:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadUndefined()
+	default:
+		return fmt.Errorf("cannot decode %v into a uuid %s", vrType, val.Type())
+	}
+
+	data, subtype, err := vr.ReadBinary()
+	if err != nil {
+		return err
+	}
+	if subtype != TypeBinaryUUID && subtype != TypeBinaryUUIDOld {
+		return fmt.Errorf("only binary values with subtype 0x03 or 0x04 can be decoded into a uuid %s, but got subtype %v",
+			val.Type(), subtype)
+	}
+	if val.Kind() == reflect.Array {
+		if len(data) != val.Len() {
+			return fmt.Errorf("uuid of %d bytes does not fit in %s", len(data), val.Type())
+		}
+		reflect.Copy(val, reflect.ValueOf(data))
+		return nil
+	}
+	val.SetBytes(append([]byte(nil), data...))
+	return nil
+}
+
+// uuidSubtype returns the binary subtype that UUIDs are encoded with by ec.
+func uuidSubtype(ec EncodeContext) (byte, error) {
+	switch ec.uuidSubtype {
+	case 0:
+		return TypeBinaryUUID, nil
+	case TypeBinaryUUID, TypeBinaryUUIDOld:
+		return ec.uuidSubtype, nil
+	}
+	return 0, fmt.Errorf("invalid UUID binary subtype %#x, must be 0x03 or 0x04", ec.uuidSubtype)
+}
@@ -0,0 +1,202 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"bytes"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
+	"go.mongodb.org/mongo-driver/v2/internal/require"
+)
+
+func TestBSONTypeCodecs(t *testing.T) {
+	t.Parallel()
+
+	type event struct {
+		TS    int64    `bson:"ts,bsontype=datetime"`
+		ID    []byte   `bson:"id,bsontype=uuid"`
+		Trace [16]byte `bson:"trace,bsontype=uuid"`
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		in := event{
+			TS:    1700000000123,
+			ID:    []byte{0: 1, 15: 2},
+			Trace: [16]byte{0: 3, 15: 4},
+		}
+		doc, err := Marshal(in)
+		require.NoError(t, err, "Marshal error")
+
+		assert.Equal(t, int64(1700000000123), Raw(doc).Lookup("ts").DateTime())
+		subtype, data := Raw(doc).Lookup("id").Binary()
+		assert.Equal(t, TypeBinaryUUID, subtype)
+		assert.Equal(t, in.ID, data)
+		subtype, _ = Raw(doc).Lookup("trace").Binary()
+		assert.Equal(t, TypeBinaryUUID, subtype)
+
+		var got event
+		err = Unmarshal(doc, &got)
+		require.NoError(t, err, "Unmarshal error")
+		assert.Equal(t, in, got)
+	})
+
+	decodeErrs := []struct {
+		name    string
+		doc     D
+		wantErr string
+	}{
+		{
+			name:    "wrong BSON type",
+			doc:     D{{"ts", int64(1)}},
+			wantErr: "cannot decode 64-bit integer into a datetime int64",
+		},
+		{
+			name:    "wrong binary subtype",
+			doc:     D{{"id", Binary{Data: []byte{1}}}},
+			wantErr: "only binary values with subtype 0x03 or 0x04 can be decoded into a uuid []uint8, but got subtype 0",
+		},
+		{
+			name:    "wrong array length",
+			doc:     D{{"trace", Binary{Subtype: TypeBinaryUUID, Data: []byte{1, 2}}}},
+			wantErr: "uuid of 2 bytes does not fit in [16]uint8",
+		},
+	}
+	for _, tc := range decodeErrs {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc, err := Marshal(tc.doc)
+			require.NoError(t, err, "Marshal error")
+
+			var got event
+			err = Unmarshal(doc, &got)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+
+	describeErrs := []struct {
+		name    string
+		val     any
+		wantErr string
+	}{
+		{
+			name: "incompatible type",
+			val: struct {
+				TS string `bson:"ts,bsontype=datetime"`
+			}{},
+			wantErr: `bsontype "datetime" cannot be used with field TS of type string`,
+		},
+		{
+			name: "unknown type",
+			val: struct {
+				TS int64 `bson:"ts,bsontype=timestamp"`
+			}{},
+			wantErr: `unknown bsontype "timestamp" for field TS`,
+		},
+	}
+	for _, tc := range describeErrs {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Marshal(tc.val)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+// uuidLike is defined like the UUID types of common UUID packages.
+type uuidLike [16]byte
+
+func TestUUIDArrays(t *testing.T) {
+	t.Parallel()
+
+	type record struct {
+		ID    uuidLike `bson:"id"`
+		Trace [16]byte `bson:"trace"`
+		Tag   []byte   `bson:"tag,bsontype=uuid"`
+	}
+
+	id := uuidLike{0: 0xde, 1: 0xad, 14: 0xbe, 15: 0xef}
+
+	encode := func(t *testing.T, subtype byte, val any) (Raw, error) {
+		t.Helper()
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		if subtype != 0 {
+			enc.SetUUIDSubtype(subtype)
+		}
+		err := enc.Encode(val)
+		return buf.Bytes(), err
+	}
+
+	testCases := []struct {
+		name        string
+		subtype     byte
+		val         record
+		wantSubtype byte
+		wantTag     byte
+	}{
+		{"default", 0, record{ID: id, Trace: [16]byte(id), Tag: id[:]}, TypeBinaryGeneric, TypeBinaryUUID},
+		{"uuid", TypeBinaryUUID, record{ID: id, Trace: [16]byte(id), Tag: id[:]}, TypeBinaryUUID, TypeBinaryUUID},
+		{"legacy uuid", TypeBinaryUUIDOld, record{ID: id, Trace: [16]byte(id), Tag: id[:]}, TypeBinaryUUIDOld, TypeBinaryUUIDOld},
+		{"all zero", TypeBinaryUUID, record{Tag: make([]byte, 16)}, TypeBinaryUUID, TypeBinaryUUID},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc, err := encode(t, tc.subtype, tc.val)
+			require.NoError(t, err, "Encode error")
+			for _, key := range []string{"id", "trace"} {
+				subtype, data := doc.Lookup(key).Binary()
+				assert.Equal(t, tc.wantSubtype, subtype, "subtype of %s", key)
+				assert.Len(t, data, 16)
+			}
+			subtype, _ := doc.Lookup("tag").Binary()
+			assert.Equal(t, tc.wantTag, subtype)
+
+			var got record
+			err = Unmarshal(doc, &got)
+			require.NoError(t, err, "Unmarshal error")
+			assert.Equal(t, tc.val, got)
+		})
+	}
+
+	t.Run("wrong length", func(t *testing.T) {
+		t.Parallel()
+
+		doc := mustMarshal(t, D{{"id", Binary{Subtype: TypeBinaryUUID, Data: []byte{1, 2}}}})
+		err := Unmarshal(doc, &record{})
+		assert.ErrorContains(t, err, "uuid of 2 bytes does not fit in bson.uuidLike")
+	})
+	t.Run("other array lengths", func(t *testing.T) {
+		t.Parallel()
+
+		var got struct {
+			Hash [20]byte `bson:"hash"`
+		}
+		doc := mustMarshal(t, D{{"hash", Binary{Subtype: TypeBinaryUUID, Data: make([]byte, 16)}}})
+		err := Unmarshal(doc, &got)
+		assert.ErrorContains(t, err, "can only be used to decode subtype 0x00 or 0x02")
+	})
+	t.Run("invalid subtype", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := encode(t, TypeBinaryMD5, record{})
+		assert.ErrorContains(t, err, "invalid UUID binary subtype 0x5")
+	})
+}
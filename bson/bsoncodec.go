@@ -7,9 +7,12 @@
 package bson
 
 import (
+	"context"
 	"fmt"
+	"hash"
 	"reflect"
 	"strings"
+	"time"
 )
 
 var (
@@ -85,6 +88,11 @@ type EncodeContext struct {
 	// that can represent the integer value.
 	minSize bool
 
+	// round causes the Encoder to marshal Go float values (float32 or float64) rounded to
+	// roundDigits decimal places.
+	round       bool
+	roundDigits int
+
 	errorOnInlineDuplicates bool
 	stringifyMapKeysWithFmt bool
 	nilMapAsEmpty           bool
@@ -93,6 +101,85 @@ type EncodeContext struct {
 	omitZeroStruct          bool
 	omitEmpty               bool
 	useJSONStructTags       bool
+
+	// omitNilPointers causes the struct codec to omit nil pointer fields instead of writing them
+	// as BSON null, even without the "omitempty" struct tag option.
+	omitNilPointers bool
+
+	// encodeEmptyStringAsNull causes the struct codec to write empty string fields as BSON null
+	// instead of an empty BSON string.
+	encodeEmptyStringAsNull bool
+
+	// ipAsString causes net.IP values to be encoded as a BSON string holding their canonical
+	// representation instead of BSON binary.
+	ipAsString bool
+
+	// keepZeroStruct causes the struct codec to never consider zero structs empty, overriding
+	// the Registry default and the codec's configuration. It is mutually exclusive with
+	// omitZeroStruct.
+	keepZeroStruct bool
+
+	// nilInlineAsZero causes the struct codec to encode the fields of inline structs behind nil
+	// pointers as their zero values instead of omitting them.
+	nilInlineAsZero bool
+
+	// escapeKeys causes map and inline map keys to be escaped with escapeKey so that they are
+	// valid MongoDB field names.
+	escapeKeys bool
+
+	// sortMapKeys causes map and inline map elements to be written in ascending order of their
+	// keys instead of Go's randomized map iteration order.
+	sortMapKeys bool
+
+	// discriminator is the discriminator the struct codec writes as the first element of the
+	// document it encodes. It is set by discriminatorEncoder and only applies to the top-level
+	// struct being encoded.
+	discriminator string
+
+	// postEncodeValidate is called by the Encoder with the bytes of each top-level document it
+	// encodes.
+	postEncodeValidate func(raw []byte) error
+
+	// ctx is checked by the struct codec while encoding documents. Encoding is aborted with the
+	// context's error once it is done. It is ignored if nil.
+	ctx context.Context
+
+	// fieldHook is called by the struct codec before each struct field is encoded.
+	fieldHook FieldHook
+
+	// omitFunc is called by the struct codec with each struct field that is not omitted by its
+	// struct tag options. Fields for which it returns true are not encoded.
+	omitFunc OmitFunc
+
+	// nameTransformer derives the BSON keys of struct fields without a key in their struct tag.
+	nameTransformer NameTransformer
+
+	// ttl and now are used to compute the expiry written for struct fields with the "ttlkey"
+	// struct tag option. If now is nil, time.Now is used.
+	ttl time.Duration
+	now func() time.Time
+
+	// newHash returns the hash used to compute the values of fields with the "hashof" struct tag
+	// option. If it is nil, SHA-256 is used.
+	newHash func() hash.Hash
+
+	// uuidSubtype is the binary subtype used to encode [16]byte values and fields with the
+	// "bsontype=uuid" struct tag option. If it is zero, [16]byte values are encoded with the
+	// generic binary subtype and "bsontype=uuid" fields with TypeBinaryUUID.
+	uuidSubtype byte
+
+	// decimalRounding is how *big.Rat and *big.Float values that cannot be represented exactly
+	// as a Decimal128 are encoded.
+	decimalRounding DecimalRounding
+
+	// packArraysOver is the number of elements above which slices of types registered using
+	// Registry.RegisterPackedSlice are encoded as packed binary. It is disabled if not positive.
+	packArraysOver int
+
+	// owner and ownerField are the struct value and the name of its field being encoded. They
+	// are set by the struct codec and exposed by Owner.
+	owner      reflect.Value
+	ownerField string
 }
 
 // DecodeContext is the contextual information required for a Codec to decode a
@@ -106,6 +193,15 @@ type DecodeContext struct {
 	// BSON "decimal128" values.
 	truncate bool
 
+	// doubleToIntExactOnly, if true, instructs decoders to only unmarshal BSON "double" values into
+	// a Go integer type when they have no fractional part and fit in an int64. It takes precedence
+	// over truncate.
+	doubleToIntExactOnly bool
+
+	// wideningOnly, if true, instructs decoders to reject decoding BSON numeric values into Go
+	// numeric types that cannot represent every value of the BSON type.
+	wideningOnly bool
+
 	// defaultDocumentType specifies the Go type to decode top-level and nested BSON documents into. In particular, the
 	// usage for this field is restricted to data typed as "any" or "map[string]any". If DocumentType is
 	// set to a type that a BSON document cannot be unmarshaled into (e.g. "string"), unmarshalling will result in an
@@ -121,6 +217,137 @@ type DecodeContext struct {
 	useLocalTimeZone  bool
 	zeroMaps          bool
 	zeroStructs       bool
+
+	// preserveStructs causes the struct codec to keep any existing values of Go structs, overriding
+	// the Registry default and the codec's configuration. It is mutually exclusive with zeroStructs.
+	preserveStructs bool
+
+	// unescapeKeys causes map and inline map keys to be unescaped with unescapeKey, reversing
+	// the escaping applied by EncodeContext.escapeKeys.
+	unescapeKeys bool
+
+	// caseSensitive causes the struct codec to match BSON keys to struct fields only by their exact
+	// key, without falling back to the lowercased key.
+	caseSensitive bool
+
+	// caseSensitiveInline is like caseSensitive for structs with an inline map, so that keys
+	// that do not exactly match a field are stored in the map.
+	caseSensitiveInline bool
+
+	// disallowUnknownFields causes the struct codec to return an error for BSON keys that do not
+	// match a struct field when the struct has no inline map, instead of skipping them.
+	disallowUnknownFields bool
+
+	// strictNumbers causes numeric decoders to return errors wrapping ErrNumberOutOfRange for
+	// values that do not fit in the destination type, including values that would otherwise wrap.
+	strictNumbers bool
+
+	// ignoreNullFields causes the struct codec to skip BSON null values of struct fields, leaving
+	// the fields unchanged, instead of decoding them with the field's decoder.
+	ignoreNullFields bool
+
+	// stringTable interns the BSON strings decoded into values of a string kind if it is set.
+	stringTable *StringTable
+
+	// fallbackDecoder decodes the struct fields whose Go type has no registered decoder if it is
+	// set, instead of the struct codec returning an error.
+	fallbackDecoder ValueDecoder
+
+	// reuseSliceElements causes the slice codec to decode BSON arrays into the elements of the
+	// backing array of the destination slice, zeroing each element first, instead of decoding
+	// each element into a new value.
+	reuseSliceElements bool
+
+	// unknownEnums is how enum decoders handle values that are not known values of the enum
+	// type. It is exposed by UnknownEnums.
+	unknownEnums UnknownEnumPolicy
+
+	// duplicateKeys is how the struct codec handles keys that occur more than once in a document.
+	duplicateKeys DuplicateKeyPolicy
+
+	// accumulateErrors causes the struct codec to continue decoding the remaining elements of a
+	// document after an element fails to decode and to return the errors of all elements.
+	accumulateErrors bool
+
+	// typeResolver returns the concrete types of interface struct fields given the value of the
+	// typeKey element of the document that holds them. typeKeyValue is that value in the
+	// document being decoded by the struct codec. It is not propagated to nested values.
+	typeKey      string
+	typeResolver TypeResolver
+	typeKeyValue RawValue
+
+	// discriminated is whether the document decoded by the struct codec was matched to its type
+	// using its "_type" discriminator, which is then not treated as an unknown key. It is not
+	// propagated to nested values.
+	discriminated bool
+
+	// emptyDocAsNil causes empty BSON documents to be decoded into pointers to structs and maps
+	// as nil instead of as allocated, empty values.
+	emptyDocAsNil bool
+
+	// orderedInlineMapValues causes the struct codec to decode documents in the values of inline
+	// maps as bson.D, regardless of defaultDocumentType, so that their order is preserved.
+	orderedInlineMapValues bool
+
+	// patchMode causes the struct codec to only modify struct fields that are present in the
+	// document being decoded. It takes precedence over zeroStructs and disables "onmissing"
+	// methods.
+	patchMode bool
+
+	// readRepair is called with each value decoded using a lenient conversion or from a
+	// deprecated BSON type.
+	readRepair func(LegacyValue)
+
+	// rawFieldSink is called with the key and raw value bytes of each element of the top-level
+	// document decoded into a struct. The struct codec clears it before decoding nested values.
+	rawFieldSink func(key string, raw []byte)
+
+	// verifyHashes causes the struct codec to compare the stored values of fields with the
+	// "hashof" struct tag option with the hashes of the fields they cover, computed by newHash or
+	// SHA-256 if newHash is nil.
+	verifyHashes bool
+	newHash      func() hash.Hash
+
+	// ctx is checked by the struct codec while decoding documents. Decoding is aborted with the
+	// context's error once it is done. It is ignored if nil.
+	ctx context.Context
+
+	// fieldHook is called by the struct codec before each struct field is decoded.
+	fieldHook FieldHook
+
+	// nameTransformer derives the BSON keys of struct fields without a key in their struct tag.
+	nameTransformer NameTransformer
+
+	// owner and ownerField are the struct value and the name of its field being decoded. They
+	// are set by the struct codec and exposed by Owner.
+	owner      reflect.Value
+	ownerField string
+}
+
+// FieldContext is implemented by EncodeContext and DecodeContext. It allows a ValueEncoder or
+// ValueDecoder to find the struct value and field that it is encoding or decoding a value for,
+// e.g. to read the values of sibling fields.
+type FieldContext interface {
+	// Owner returns the struct value and the name of the struct field that the current value is
+	// encoded from or decoded into. For fields of inlined structs, the struct value is the outer
+	// struct. ok is false if the value is not a struct field.
+	Owner() (owner reflect.Value, field string, ok bool)
+}
+
+var (
+	_ FieldContext = EncodeContext{}
+	_ FieldContext = DecodeContext{}
+)
+
+// Owner implements the FieldContext interface.
+func (ec EncodeContext) Owner() (reflect.Value, string, bool) {
+	return ec.owner, ec.ownerField, ec.owner.IsValid()
+}
+
+// Owner implements the FieldContext interface. When decoding, the struct value is addressable and
+// only the fields that precede the current field in the BSON document have been decoded.
+func (dc DecodeContext) Owner() (reflect.Value, string, bool) {
+	return dc.owner, dc.ownerField, dc.owner.IsValid()
 }
 
 // ValueEncoder is the interface implemented by types that can encode a provided Go type to BSON.
@@ -34,7 +34,7 @@ func (bsc *byteSliceCodec) EncodeValue(ec EncodeContext, vw ValueWriter, val ref
 	return vw.WriteBinary(val.Interface().([]byte))
 }
 
-func (bsc *byteSliceCodec) decodeType(_ DecodeContext, vr ValueReader, t reflect.Type) (reflect.Value, error) {
+func (bsc *byteSliceCodec) decodeType(dc DecodeContext, vr ValueReader, t reflect.Type) (reflect.Value, error) {
 	if t != tByteSlice {
 		return emptyValue, ValueDecoderError{
 			Name:     "ByteSliceDecodeValue",
@@ -42,6 +42,7 @@ func (bsc *byteSliceCodec) decodeType(_ DecodeContext, vr ValueReader, t reflect
 			Received: reflect.Zero(t),
 		}
 	}
+	checkLegacy(dc, vr.Type(), t)
 
 	var data []byte
 	var err error
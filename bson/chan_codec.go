@@ -0,0 +1,184 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// ChanMode determines how a channel registered using Registry.RegisterChanAdapter is sent to and
+// received from.
+type ChanMode int
+
+const (
+	// ChanBlocking causes decoding to block until each element can be sent to the channel and
+	// encoding to block until the channel is closed.
+	ChanBlocking ChanMode = iota
+
+	// ChanNonBlocking causes decoding to return an error if the channel is full and encoding to
+	// stop at the first receive that would block.
+	ChanNonBlocking
+)
+
+// chanCodec is the Codec registered for a channel type by Registry.RegisterChanAdapter. It
+// decodes a BSON array by sending each element to the channel and encodes a channel by draining
+// it into a BSON array.
+type chanCodec struct {
+	t    reflect.Type
+	mode ChanMode
+}
+
+// EncodeValue drains the channel val into a BSON array. A nil channel is encoded as BSON null.
+func (cc *chanCodec) EncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != cc.t {
+		return ValueEncoderError{Name: "ChanEncodeValue", Types: []reflect.Type{cc.t}, Received: val}
+	}
+	if val.IsNil() {
+		return vw.WriteNull()
+	}
+
+	encoder, err := ec.LookupEncoder(cc.t.Elem())
+	if err != nil && cc.t.Elem().Kind() != reflect.Interface {
+		return err
+	}
+
+	aw, err := vw.WriteArray()
+	if err != nil {
+		return err
+	}
+	for {
+		var elem reflect.Value
+		var ok bool
+		if cc.mode == ChanNonBlocking {
+			elem, ok = val.TryRecv()
+		} else {
+			elem, ok = val.Recv()
+		}
+		if !ok {
+			break
+		}
+
+		currEncoder, currVal, lookupErr := lookupElementEncoder(ec, encoder, elem)
+		if lookupErr != nil && !errors.Is(lookupErr, errInvalidValue) {
+			return lookupErr
+		}
+		vw, err := aw.WriteArrayElement()
+		if err != nil {
+			return err
+		}
+		if errors.Is(lookupErr, errInvalidValue) {
+			err = vw.WriteNull()
+		} else {
+			err = currEncoder.EncodeValue(ec, vw, currVal)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return aw.WriteArrayEnd()
+}
+
+// DecodeValue decodes a BSON array by sending each element to the channel val as it is decoded
+// and closing the channel when done, including when decoding fails. If val is nil, a channel
+// with a buffer large enough to hold every element is allocated. BSON null and undefined values
+// are decoded as an empty array.
+func (cc *chanCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != cc.t {
+		return ValueDecoderError{Name: "ChanDecodeValue", Types: []reflect.Type{cc.t}, Received: val}
+	}
+
+	switch vrType := vr.Type(); vrType {
+	case TypeArray:
+	case TypeNull, TypeUndefined:
+		var err error
+		if vrType == TypeNull {
+			err = vr.ReadNull()
+		} else {
+			err = vr.ReadUndefined()
+		}
+		if err != nil {
+			return err
+		}
+		if val.IsNil() {
+			val.Set(reflect.MakeChan(cc.t, 0))
+		}
+		closeChan(val)
+		return nil
+	default:
+		return fmt.Errorf("cannot decode %v into a %s", vrType, cc.t)
+	}
+
+	if val.IsNil() {
+		_, data, err := copyValueToBytes(vr)
+		if err != nil {
+			return err
+		}
+		elems, err := Raw(data).Elements()
+		if err != nil {
+			return err
+		}
+		val.Set(reflect.MakeChan(cc.t, len(elems)))
+		vr = newBufferedValueReader(TypeArray, data)
+	}
+	defer closeChan(val)
+
+	decoder, err := dc.LookupDecoder(cc.t.Elem())
+	if err != nil {
+		return err
+	}
+	ar, err := vr.ReadArray()
+	if err != nil {
+		return err
+	}
+	for idx := 0; ; idx++ {
+		vr, err := ar.ReadValue()
+		if errors.Is(err, ErrEOA) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		elem := reflect.New(cc.t.Elem()).Elem()
+		if err := decoder.DecodeValue(dc, vr, elem); err != nil {
+			return newDecodeError(strconv.Itoa(idx), err)
+		}
+		if err := cc.send(val, elem); err != nil {
+			return newDecodeError(strconv.Itoa(idx), err)
+		}
+	}
+}
+
+// send sends elem to the channel val according to the mode of cc. It returns an error instead of
+// panicking if the channel is closed.
+func (cc *chanCodec) send(val, elem reflect.Value) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = errors.New("send on closed channel")
+		}
+	}()
+
+	if cc.mode == ChanNonBlocking {
+		if !val.TrySend(elem) {
+			return fmt.Errorf("channel is full (capacity %d)", val.Cap())
+		}
+		return nil
+	}
+	val.Send(elem)
+	return nil
+}
+
+// closeChan closes the channel val unless it is already closed.
+func closeChan(val reflect.Value) {
+	defer func() {
+		_ = recover()
+	}()
+	val.Close()
+}
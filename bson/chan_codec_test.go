@@ -0,0 +1,140 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
+	"go.mongodb.org/mongo-driver/v2/internal/require"
+)
+
+func TestChanCodec(t *testing.T) {
+	t.Parallel()
+
+	type pipeline struct {
+		Items chan int32 `bson:"items"`
+	}
+
+	newRegistry := func(mode ChanMode) *Registry {
+		reg := NewRegistry()
+		reg.RegisterChanAdapter(reflect.TypeOf((chan int32)(nil)), mode)
+		return reg
+	}
+	decode := func(reg *Registry, doc []byte, val any) error {
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.SetRegistry(reg)
+		return dec.Decode(val)
+	}
+	encode := func(reg *Registry, val any) ([]byte, error) {
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetRegistry(reg)
+		err := enc.Encode(val)
+		return buf.Bytes(), err
+	}
+	drain := func(ch chan int32) []int32 {
+		var got []int32
+		for v := range ch {
+			got = append(got, v)
+		}
+		return got
+	}
+
+	doc, err := Marshal(D{{"items", A{int32(1), int32(2), int32(3)}}})
+	require.NoError(t, err, "Marshal error")
+
+	t.Run("decode into nil channel", func(t *testing.T) {
+		t.Parallel()
+
+		var got pipeline
+		err := decode(newRegistry(ChanBlocking), doc, &got)
+		require.NoError(t, err, "Decode error")
+		assert.Equal(t, 3, cap(got.Items))
+		assert.Equal(t, []int32{1, 2, 3}, drain(got.Items))
+	})
+	t.Run("decode into consumed channel", func(t *testing.T) {
+		t.Parallel()
+
+		got := pipeline{Items: make(chan int32)}
+		done := make(chan []int32)
+		go func() {
+			done <- drain(got.Items)
+		}()
+
+		err := decode(newRegistry(ChanBlocking), doc, &got)
+		require.NoError(t, err, "Decode error")
+		assert.Equal(t, []int32{1, 2, 3}, <-done)
+	})
+	t.Run("decode into full channel", func(t *testing.T) {
+		t.Parallel()
+
+		got := pipeline{Items: make(chan int32, 2)}
+		err := decode(newRegistry(ChanNonBlocking), doc, &got)
+		var de *DecodeError
+		require.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"items", "2"}, de.Keys())
+		assert.ErrorContains(t, err, "channel is full (capacity 2)")
+		assert.Equal(t, []int32{1, 2}, drain(got.Items), "expected channel to be closed")
+	})
+	t.Run("decode into closed channel", func(t *testing.T) {
+		t.Parallel()
+
+		got := pipeline{Items: make(chan int32, 3)}
+		close(got.Items)
+		err := decode(newRegistry(ChanBlocking), doc, &got)
+		assert.ErrorContains(t, err, "send on closed channel")
+	})
+	t.Run("decode null", func(t *testing.T) {
+		t.Parallel()
+
+		nullDoc, err := Marshal(D{{"items", nil}})
+		require.NoError(t, err, "Marshal error")
+
+		var got pipeline
+		err = decode(newRegistry(ChanBlocking), nullDoc, &got)
+		require.NoError(t, err, "Decode error")
+		assert.Nil(t, drain(got.Items))
+	})
+	t.Run("encode drains channel", func(t *testing.T) {
+		t.Parallel()
+
+		val := pipeline{Items: make(chan int32, 3)}
+		val.Items <- 1
+		val.Items <- 2
+		val.Items <- 3
+		close(val.Items)
+
+		got, err := encode(newRegistry(ChanBlocking), val)
+		require.NoError(t, err, "Encode error")
+		assert.Equal(t, doc, got)
+	})
+	t.Run("encode open channel without blocking", func(t *testing.T) {
+		t.Parallel()
+
+		val := pipeline{Items: make(chan int32, 3)}
+		val.Items <- 1
+		val.Items <- 2
+		val.Items <- 3
+
+		got, err := encode(newRegistry(ChanNonBlocking), val)
+		require.NoError(t, err, "Encode error")
+		assert.Equal(t, doc, got)
+	})
+	t.Run("receive-only channel", func(t *testing.T) {
+		t.Parallel()
+
+		defer func() {
+			err, _ := recover().(error)
+			assert.ErrorContains(t, err, "expects a bidirectional channel type")
+		}()
+		NewRegistry().RegisterChanAdapter(reflect.TypeOf((<-chan int32)(nil)), ChanBlocking)
+	})
+}
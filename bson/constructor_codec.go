@@ -0,0 +1,59 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// constructorDecoder is the ValueDecoder registered for a type by Registry.RegisterConstructor. It
+// decodes the BSON value into an intermediate value and passes it to the constructor.
+type constructorDecoder struct {
+	fn reflect.Value
+	in reflect.Type
+}
+
+// newConstructorDecoder validates that fn is a function with the signature func(In) (t, error) and
+// returns a constructorDecoder that calls it.
+func newConstructorDecoder(t reflect.Type, fn any) (*constructorDecoder, error) {
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func || fv.IsNil() {
+		return nil, fmt.Errorf("constructor for %s must be a function, got %T", t, fn)
+	}
+	ft := fv.Type()
+	if ft.NumIn() != 1 || ft.IsVariadic() || ft.NumOut() != 2 || ft.Out(0) != t || ft.Out(1) != tError {
+		return nil, fmt.Errorf("constructor for %s must have signature func(In) (%s, error), got %s", t, t, ft)
+	}
+	return &constructorDecoder{fn: fv, in: ft.In(0)}, nil
+}
+
+// DecodeValue decodes the BSON value read from vr into the constructor's input type, calls the
+// constructor and stores the result in val.
+func (cd *constructorDecoder) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	out := cd.fn.Type().Out(0)
+	if !val.CanSet() || val.Type() != out {
+		return ValueDecoderError{Name: "ConstructorDecodeValue", Types: []reflect.Type{out}, Received: val}
+	}
+
+	decoder, err := dc.LookupDecoder(cd.in)
+	if err != nil {
+		return err
+	}
+	in := reflect.New(cd.in).Elem()
+	if err := decoder.DecodeValue(dc, vr, in); err != nil {
+		return err
+	}
+
+	results := cd.fn.Call([]reflect.Value{in})
+	if err, _ := results[1].Interface().(error); err != nil {
+		return err
+	}
+
+	val.Set(results[0])
+	return nil
+}
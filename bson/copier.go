@@ -427,6 +427,12 @@ type bytesReader interface {
 	readValueBytes(dst []byte) (Type, []byte, error)
 }
 
+// internedStringReader is the interface used to read BSON strings from a valueReader using a
+// StringTable.
+type internedStringReader interface {
+	readInternedString(st *StringTable) (string, error)
+}
+
 // bytesWriter is the interface used to write BSON bytes to a valueWriter.
 type bytesWriter interface {
 	writeValueBytes(t Type, b []byte) error
@@ -7,8 +7,11 @@
 package bson
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"reflect"
 	"sync"
 )
@@ -16,6 +19,18 @@ import (
 // ErrDecodeToNil is the error returned when trying to decode to a nil value
 var ErrDecodeToNil = errors.New("cannot Decode to nil value")
 
+// ErrUnknownField is wrapped by the DecodeError returned when a Decoder with DisallowUnknownFields
+// set decodes a BSON key that does not match any field of the destination struct.
+var ErrUnknownField = errors.New("unknown field")
+
+// ErrNumberOutOfRange is wrapped by the error returned when a Decoder with StrictNumbers set decodes
+// a BSON numeric value that is out of the range of the destination Go numeric type.
+var ErrNumberOutOfRange = errors.New("number out of range")
+
+// ErrRequiredFieldMissing is wrapped by the DecodeError returned for each struct field with the
+// "required" struct tag option that is absent from the BSON document being decoded.
+var ErrRequiredFieldMissing = errors.New("required field is missing")
+
 // This pool is used to keep the allocations of Decoders down. This is only used for the Marshal*
 // methods and is not consumable from outside of this package. The Decoders retrieved from this pool
 // must have both Reset and SetRegistry called on them.
@@ -40,6 +55,17 @@ func NewDecoder(vr ValueReader) *Decoder {
 	}
 }
 
+// NewExtJSONDecoder returns a new decoder that reads Extended JSON from r. If canonicalOnly is
+// true, decoding returns an error if the Extended JSON was not marshaled in canonical mode. Values
+// are decoded by the same codecs as BSON, so struct tags and Decoder options apply.
+func NewExtJSONDecoder(r io.Reader, canonicalOnly bool) (*Decoder, error) {
+	vr, err := NewExtJSONValueReader(r, canonicalOnly)
+	if err != nil {
+		return nil, err
+	}
+	return NewDecoder(vr), nil
+}
+
 // Decode reads the next BSON document from the stream and decodes it into the
 // value pointed to by val.
 //
@@ -100,6 +126,34 @@ func (d *Decoder) AllowTruncatingDoubles() {
 	d.dc.truncate = true
 }
 
+// DoubleToIntExactOnly causes the Decoder to only unmarshal BSON "double" values into Go integer
+// types when the value has no fractional part, returning an error otherwise. It takes precedence
+// over AllowTruncatingDoubles and the "truncate" struct tag option.
+func (d *Decoder) DoubleToIntExactOnly() {
+	d.dc.doubleToIntExactOnly = true
+}
+
+// StrictNumbers causes the Decoder to return an error wrapping ErrNumberOutOfRange, which includes
+// the value and the destination Go type, when a BSON numeric value does not fit in the Go numeric
+// type it is unmarshaled into. This includes BSON doubles below the range of int64 or NaN decoded
+// into an integer type, which otherwise wrap silently when truncation is enabled, and BSON doubles
+// beyond the range of float32. Truncation takes precedence: fractional values are still truncated
+// and doubles beyond the range of float32 become infinities if AllowTruncatingDoubles or the
+// "truncate" struct tag option is set. Values of struct fields are reported in a *DecodeError with
+// the field's key.
+func (d *Decoder) StrictNumbers() {
+	d.dc.strictNumbers = true
+}
+
+// WideningOnly causes the Decoder to only unmarshal BSON numeric values into Go numeric types that
+// can represent every value of the BSON type, regardless of the actual value. For example, a BSON
+// int32 can be unmarshaled into an int64 or float64, but a BSON int64 cannot be unmarshaled into an
+// int32 even if the value fits. BSON doubles can only be unmarshaled into float64 and no BSON
+// numeric type can be unmarshaled into an unsigned integer type.
+func (d *Decoder) WideningOnly() {
+	d.dc.wideningOnly = true
+}
+
 // BinaryAsSlice causes the Decoder to unmarshal BSON binary field values that are the "Generic" or
 // "Old" BSON binary subtype as a Go byte slice instead of a bson.Binary.
 func (d *Decoder) BinaryAsSlice() {
@@ -117,6 +171,193 @@ func (d *Decoder) UseJSONStructTags() {
 	d.dc.useJSONStructTags = true
 }
 
+// CaseSensitive causes the Decoder to match the keys of BSON documents to Go struct fields only if
+// they are equal to the field's BSON key, e.g. "Name" does not match a field with the key "name".
+// Keys that do not match a field are stored in the struct's inline map, if any, or skipped.
+func (d *Decoder) CaseSensitive() {
+	d.dc.caseSensitive = true
+}
+
+// CaseSensitiveInline is like CaseSensitive for Go structs with an inline map only, e.g. so that
+// "Name" is stored in the inline map of a struct with a field with the key "name" instead of
+// being decoded into the field. Keys of structs without an inline map are still matched to fields
+// ignoring case.
+func (d *Decoder) CaseSensitiveInline() {
+	d.dc.caseSensitiveInline = true
+}
+
+// DisallowUnknownFields causes the Decoder to return an error when a BSON document has a key that
+// does not match any field of the destination Go struct and the struct has no inline map, instead
+// of skipping the value. The error is a *DecodeError wrapping ErrUnknownField whose keys are the
+// full path of the unknown key, e.g. "a.b.unexpected".
+func (d *Decoder) DisallowUnknownFields() {
+	d.dc.disallowUnknownFields = true
+}
+
+// IgnoreNullFields causes the Decoder to leave Go struct fields unchanged when their value in a
+// BSON document is null, e.g. when null is used as a tombstone in partial documents. By default, a
+// null value is decoded by the field's decoder, which sets most types, including pointers, to their
+// zero value and returns an error for some. Null values in maps, slices, and arrays are not
+// affected.
+func (d *Decoder) IgnoreNullFields() {
+	d.dc.ignoreNullFields = true
+}
+
+// AccumulateErrors causes the Decoder to continue decoding the remaining elements of a BSON
+// document into a Go struct after an element fails to decode, leaving the field of the failed
+// element unchanged. Decode then returns an error that holds the *DecodeError of every failed
+// element, including those of nested structs, each with its full key path. Like the errors
+// returned by errors.Join, the error can be unwrapped with Unwrap() []error and its message has
+// one line per failed element. Errors that leave the document unreadable are still returned
+// immediately.
+func (d *Decoder) AccumulateErrors() {
+	d.dc.accumulateErrors = true
+}
+
+// ReuseSliceElements causes the Decoder to unmarshal the elements of BSON arrays into the existing
+// backing array of a Go slice instead of allocating a new value for each element, which reduces
+// allocations when repeatedly decoding into the same slice, e.g. a []T of structs. Each reused
+// element is set to its zero value before it is decoded, so fields of a previously decoded element
+// that are not present in the new BSON element do not leak into it. The slice is only grown if the
+// BSON array has more elements than its capacity. Slices of interfaces and of bson.E are not
+// affected.
+func (d *Decoder) ReuseSliceElements() {
+	d.dc.reuseSliceElements = true
+}
+
+// EmptyDocAsNil causes the Decoder to unmarshal empty BSON documents into Go maps and pointers to
+// Go structs as nil instead of allocating empty values, so that a present but empty document can be
+// distinguished from a non-empty one. Non-empty documents are not affected.
+func (d *Decoder) EmptyDocAsNil() {
+	d.dc.emptyDocAsNil = true
+}
+
+// OrderedInlineMapValues causes the Decoder to unmarshal BSON documents in the values of inline
+// maps (struct fields with the "inline" struct tag option) as bson.D, preserving the order of
+// their elements, even if DefaultDocumentM is set. This behavior is restricted to inline map
+// values typed as "any".
+func (d *Decoder) OrderedInlineMapValues() {
+	d.dc.orderedInlineMapValues = true
+}
+
+// PatchMode causes the Decoder to decode documents onto existing Go structs as partial updates.
+// Struct fields that are not present in the BSON document are never modified: they are not zeroed
+// (ZeroStructs is ignored for structs), nil pointers are not allocated, and "onmissing" methods are
+// not called. Fields that are present are decoded as usual, so a present embedded document is
+// merged onto the existing nested struct and a present BSON null sets the field to its zero value.
+func (d *Decoder) PatchMode() {
+	d.dc.patchMode = true
+}
+
+// PreserveStructs causes the Decoder to keep any existing values of Go structs in the destination
+// value passed to Decode, only overwriting the fields present in the BSON documents. It takes
+// precedence over the default set using Registry.SetZeroStructs and overrides any previous call to
+// ZeroStructs.
+func (d *Decoder) PreserveStructs() {
+	d.dc.preserveStructs = true
+	d.dc.zeroStructs = false
+}
+
+// ReadRepair sets a function that is called with each value the Decoder unmarshals using a lenient
+// conversion (e.g. a BSON double into a Go integer or a BSON object ID into a Go string) or from a
+// deprecated BSON type (e.g. undefined or symbol). It allows callers to detect documents stored in
+// legacy formats and re-marshal them to upgrade the stored data.
+func (d *Decoder) ReadRepair(fn func(LegacyValue)) {
+	d.dc.readRepair = fn
+}
+
+// SetNameTransformer sets a function that derives the BSON keys of Go struct fields from their
+// names when their struct tag does not set a key, e.g. to use snake_case keys without tagging every
+// field. Keys set by struct tags are not transformed. See NameTransformer for details.
+func (d *Decoder) SetNameTransformer(fn NameTransformer) {
+	d.dc.nameTransformer = fn
+}
+
+// SetContext sets a context that is checked periodically while BSON documents are decoded into Go
+// structs, so that decoding a very large or deeply nested document can be cancelled. Once ctx is
+// done, Decode stops and returns an error wrapping the context's error. The context is checked
+// when each document starts to be decoded into a struct and every 64 elements within a document.
+func (d *Decoder) SetContext(ctx context.Context) {
+	d.dc.ctx = ctx
+}
+
+// SetFieldHook sets a function that is called before each struct field present in a BSON
+// document is decoded, e.g. to compare the stored fields and types with the ones an application
+// expects. If fn returns an error, Decode returns a *DecodeError wrapping it. See FieldHook for
+// details.
+func (d *Decoder) SetFieldHook(fn FieldHook) {
+	d.dc.fieldHook = fn
+}
+
+// SetUnknownEnumPolicy sets how the Decoder handles BSON values that are not known values of the
+// enum type they are unmarshaled into. It applies to string enum types registered using
+// Registry.RegisterStringEnum without a fallback value, and custom decoders can read it using
+// DecodeContext.UnknownEnums. The default is UnknownEnumError.
+func (d *Decoder) SetUnknownEnumPolicy(policy UnknownEnumPolicy) {
+	d.dc.unknownEnums = policy
+}
+
+// SetDuplicateKeyPolicy sets how the Decoder handles BSON documents decoded into Go structs that
+// contain the same key more than once, e.g. to reject documents that repeat a key to override a
+// validated value. Keys that match the same struct field, such as "name" and "Name" when matching
+// is not case-sensitive, are the same key. The default is DuplicateKeyLast.
+func (d *Decoder) SetDuplicateKeyPolicy(policy DuplicateKeyPolicy) {
+	d.dc.duplicateKeys = policy
+}
+
+// SetFallbackDecoder sets a ValueDecoder used to decode the BSON values of struct fields whose Go
+// type has no registered decoder, such as a chan or func field, instead of returning an error. It
+// is called with the value reader positioned at the element and the settable field value, e.g. to
+// skip the value using vr.Skip or to store it as a RawValue elsewhere. By default, decoding such a
+// field returns an error.
+func (d *Decoder) SetFallbackDecoder(dec ValueDecoder) {
+	d.dc.fallbackDecoder = dec
+}
+
+// SetStringTable causes the Decoder to intern BSON strings decoded into values of a string kind,
+// such as string struct fields, using st, so that repeated values such as status or category names
+// share one allocation across decoded documents. This includes BSON strings decoded into
+// interface values, e.g. in a D or M, as Go strings. Passing nil disables interning, which is the
+// default.
+func (d *Decoder) SetStringTable(st *StringTable) {
+	d.dc.stringTable = st
+}
+
+// SetTypeResolver sets a function that selects the concrete Go type that the interface fields of
+// a struct are decoded into, given the value of the element with the given key in the same BSON
+// document, e.g. a "type" element describing a "payload" field. The key may appear before or after
+// the fields it describes. Documents without the key and fields for which fn returns nil are
+// decoded as usual. See TypeResolver for details.
+func (d *Decoder) SetTypeResolver(key string, fn TypeResolver) {
+	d.dc.typeKey = key
+	d.dc.typeResolver = fn
+}
+
+// RawFieldSink sets a function that is called with the key and the raw BSON value bytes of each
+// element of a document the Decoder unmarshals into a Go struct, before the element is decoded.
+// Only the elements of the top-level document are reported. The raw slice must not be modified or
+// retained after fn returns; fn must copy it if needed. The type of the value is not included, so
+// callers that need to interpret the bytes should also record the decoded field.
+func (d *Decoder) RawFieldSink(fn func(key string, raw []byte)) {
+	d.dc.rawFieldSink = fn
+}
+
+// VerifyHashes causes the Decoder to check the stored values of struct fields with the
+// "hashof=<key>|<key>" struct tag option against the hashes of the fields they cover, computed as
+// described for Encoder.SetHashFunc using newHash, or SHA-256 if newHash is nil. If a stored hash
+// does not match, Decode returns an error wrapping ErrHashMismatch. Documents without a stored
+// hash are not verified.
+func (d *Decoder) VerifyHashes(newHash func() hash.Hash) {
+	d.dc.verifyHashes = true
+	d.dc.newHash = newHash
+}
+
+// UnescapeKeys causes the Decoder to reverse the escaping applied to Go map keys, including inline
+// map keys, by Encoder.EscapeKeys.
+func (d *Decoder) UnescapeKeys() {
+	d.dc.unescapeKeys = true
+}
+
 // UseLocalTimeZone causes the Decoder to unmarshal time.Time values in the local timezone instead
 // of the UTC timezone.
 func (d *Decoder) UseLocalTimeZone() {
@@ -131,6 +372,10 @@ func (d *Decoder) ZeroMaps() {
 
 // ZeroStructs causes the Decoder to delete any existing values from Go structs in the destination
 // value passed to Decode before unmarshaling BSON documents into them.
+//
+// ZeroStructs takes precedence over the default set using Registry.SetZeroStructs and overrides
+// any previous call to PreserveStructs.
 func (d *Decoder) ZeroStructs() {
 	d.dc.zeroStructs = true
+	d.dc.preserveStructs = false
 }
@@ -8,7 +8,10 @@ package bson
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"math"
 	"reflect"
 	"testing"
 	"time"
@@ -474,6 +477,30 @@ func TestDecoderConfiguration(t *testing.T) {
 		MyInt    int
 	}
 
+	type emptyDocAsNilTest struct {
+		MyStruct     *zeroStructsTest `bson:"myStruct"`
+		MyMap        map[string]int   `bson:"myMap"`
+		MyFullStruct *zeroStructsTest `bson:"myFullStruct"`
+	}
+	type orderedInlineTest struct {
+		Inline map[string]any `bson:",inline"`
+	}
+	type unescapeKeysTest struct {
+		Map    map[string]int `bson:"map"`
+		Inline map[string]int `bson:",inline"`
+	}
+	type caseSensitiveTest struct {
+		Name   string         `bson:"name"`
+		Inline map[string]any `bson:",inline"`
+	}
+	type caseSensitiveInlineTest struct {
+		Nested struct {
+			Title string `bson:"title"`
+		} `bson:"nested"`
+		Name   string         `bson:"name"`
+		Inline map[string]any `bson:",inline"`
+	}
+
 	testCases := []struct {
 		description string
 		configure   func(*Decoder)
@@ -632,6 +659,113 @@ func TestDecoderConfiguration(t *testing.T) {
 			},
 			want: &zeroStructsTest{MyString: "test value"},
 		},
+		// Test that EmptyDocAsNil causes the Decoder to unmarshal empty documents into pointers to
+		// structs and maps as nil, and non-empty documents as usual.
+		{
+			description: "EmptyDocAsNil",
+			configure: func(dec *Decoder) {
+				dec.EmptyDocAsNil()
+			},
+			input: bsoncore.NewDocumentBuilder().
+				AppendDocument("myStruct", bsoncore.NewDocumentBuilder().Build()).
+				AppendDocument("myMap", bsoncore.NewDocumentBuilder().Build()).
+				AppendDocument("myFullStruct", bsoncore.NewDocumentBuilder().
+					AppendString("MyString", "test value").
+					Build()).
+				Build(),
+			decodeInto: func() any {
+				return &emptyDocAsNilTest{
+					MyStruct: &zeroStructsTest{MyInt: 1},
+					MyMap:    map[string]int{"a": 1},
+				}
+			},
+			want: &emptyDocAsNilTest{
+				MyFullStruct: &zeroStructsTest{MyString: "test value"},
+			},
+		},
+		// Test that CaseSensitive causes the Decoder to treat keys that only match a field's key
+		// case-insensitively as unknown fields.
+		{
+			description: "CaseSensitive",
+			configure: func(dec *Decoder) {
+				dec.CaseSensitive()
+			},
+			input: bsoncore.NewDocumentBuilder().
+				AppendString("Name", "wrong case").
+				AppendString("name", "right case").
+				Build(),
+			decodeInto: func() any { return &caseSensitiveTest{} },
+			want: &caseSensitiveTest{
+				Name:   "right case",
+				Inline: map[string]any{"Name": "wrong case"},
+			},
+		},
+		// Test that CaseSensitiveInline causes the Decoder to store keys that only match a field's
+		// key case-insensitively in the inline map, while still matching keys case-insensitively
+		// for structs without an inline map.
+		{
+			description: "CaseSensitiveInline",
+			configure: func(dec *Decoder) {
+				dec.CaseSensitiveInline()
+			},
+			input: bsoncore.NewDocumentBuilder().
+				AppendString("Foo", "metadata").
+				AppendString("Name", "wrong case").
+				AppendString("name", "right case").
+				AppendDocument("nested", bsoncore.NewDocumentBuilder().
+					AppendString("Title", "matched").
+					Build()).
+				Build(),
+			decodeInto: func() any { return &caseSensitiveInlineTest{} },
+			want: func() *caseSensitiveInlineTest {
+				want := &caseSensitiveInlineTest{
+					Name:   "right case",
+					Inline: map[string]any{"Foo": "metadata", "Name": "wrong case"},
+				}
+				want.Nested.Title = "matched"
+				return want
+			}(),
+		},
+		// Test that OrderedInlineMapValues causes the Decoder to unmarshal documents in inline
+		// map values as bson.D even if DefaultDocumentM is set.
+		{
+			description: "OrderedInlineMapValues",
+			configure: func(dec *Decoder) {
+				dec.DefaultDocumentM()
+				dec.OrderedInlineMapValues()
+			},
+			input: bsoncore.NewDocumentBuilder().
+				AppendDocument("myDocument", bsoncore.NewDocumentBuilder().
+					AppendString("b", "first").
+					AppendString("a", "second").
+					Build()).
+				Build(),
+			decodeInto: func() any { return &orderedInlineTest{} },
+			want: &orderedInlineTest{
+				Inline: map[string]any{
+					"myDocument": D{{Key: "b", Value: "first"}, {Key: "a", Value: "second"}},
+				},
+			},
+		},
+		// Test that UnescapeKeys reverses the escaping of map and inline map keys applied by
+		// Encoder.EscapeKeys.
+		{
+			description: "UnescapeKeys",
+			configure: func(dec *Decoder) {
+				dec.UnescapeKeys()
+			},
+			input: bsoncore.NewDocumentBuilder().
+				AppendDocument("map", bsoncore.NewDocumentBuilder().
+					AppendInt32("a%2Eb", 1).
+					Build()).
+				AppendInt32("%24c%25", 2).
+				Build(),
+			decodeInto: func() any { return &unescapeKeysTest{} },
+			want: &unescapeKeysTest{
+				Map:    map[string]int{"a.b": 1},
+				Inline: map[string]int{"$c%": 2},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -719,4 +853,641 @@ func TestDecoderConfiguration(t *testing.T) {
 		}
 		assert.Equal(t, want, got, "expected and actual decode results do not match")
 	})
+	t.Run("PatchMode", func(t *testing.T) {
+		t.Parallel()
+
+		type address struct {
+			City string `bson:"city"`
+			Zip  string `bson:"zip"`
+		}
+		type patchTest struct {
+			Name    string         `bson:"name"`
+			Age     int            `bson:"age"`
+			Tags    []string       `bson:"tags"`
+			Address address        `bson:"address"`
+			Manager *address       `bson:"manager"`
+			Labels  map[string]int `bson:"labels"`
+		}
+
+		input := bsoncore.NewDocumentBuilder().
+			AppendString("name", "new name").
+			AppendDocument("address", bsoncore.NewDocumentBuilder().
+				AppendString("city", "new city").
+				Build()).
+			Build()
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(input)))
+		dec.ZeroStructs()
+		dec.PatchMode()
+
+		got := patchTest{
+			Name:    "old name",
+			Age:     42,
+			Tags:    []string{"a"},
+			Address: address{City: "old city", Zip: "12345"},
+			Labels:  map[string]int{"x": 1},
+		}
+		err := dec.Decode(&got)
+		require.NoError(t, err, "Decode error")
+
+		want := patchTest{
+			Name:    "new name",
+			Age:     42,
+			Tags:    []string{"a"},
+			Address: address{City: "new city", Zip: "12345"},
+			Labels:  map[string]int{"x": 1},
+		}
+		assert.Equal(t, want, got, "expected and actual decode results do not match")
+		assert.Nil(t, got.Manager, "expected absent pointer field to not be allocated")
+	})
+	t.Run("ReadRepair", func(t *testing.T) {
+		t.Parallel()
+
+		type repairTest struct {
+			Count  int32   `bson:"count"`
+			Active bool    `bson:"active"`
+			Name   string  `bson:"name"`
+			Owner  string  `bson:"owner"`
+			Scores []int64 `bson:"scores"`
+			Ratio  float64 `bson:"ratio"`
+		}
+
+		oid := NewObjectID()
+		input := bsoncore.NewDocumentBuilder().
+			AppendDouble("count", 3).
+			AppendInt32("active", 1).
+			AppendSymbol("name", "legacy").
+			AppendObjectID("owner", oid).
+			AppendArray("scores", bsoncore.NewArrayBuilder().
+				AppendInt64(1).
+				AppendDouble(2).
+				Build()).
+			AppendDouble("ratio", 0.5).
+			Build()
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(input)))
+		dec.ObjectIDAsHexString()
+		var got []LegacyValue
+		dec.ReadRepair(func(lv LegacyValue) {
+			got = append(got, lv)
+		})
+
+		var val repairTest
+		err := dec.Decode(&val)
+		require.NoError(t, err, "Decode error")
+
+		want := []LegacyValue{
+			{Field: "Count", Type: TypeDouble, GoType: reflect.TypeOf(int32(0)), Reason: "double converted to integer"},
+			{Field: "Active", Type: TypeInt32, GoType: reflect.TypeOf(false), Reason: "number converted to boolean"},
+			{Field: "Name", Type: TypeSymbol, GoType: reflect.TypeOf(""), Reason: "deprecated BSON type symbol"},
+			{Field: "Owner", Type: TypeObjectID, GoType: reflect.TypeOf(""), Reason: "object ID converted to string"},
+			{Field: "Scores", Type: TypeDouble, GoType: reflect.TypeOf(int64(0)), Reason: "double converted to integer"},
+		}
+		assert.Equal(t, want, got, "expected and actual legacy values do not match")
+		assert.Equal(t, repairTest{
+			Count:  3,
+			Active: true,
+			Name:   "legacy",
+			Owner:  oid.Hex(),
+			Scores: []int64{1, 2},
+			Ratio:  0.5,
+		}, val, "expected and actual decode results do not match")
+	})
+	t.Run("DisallowUnknownFields", func(t *testing.T) {
+		t.Parallel()
+
+		type inner struct {
+			B struct {
+				Known int32 `bson:"known"`
+			} `bson:"b"`
+		}
+		type outer struct {
+			A      inner          `bson:"a"`
+			Extras map[string]int `bson:"extras"`
+		}
+
+		decode := func(input []byte) error {
+			dec := NewDecoder(NewDocumentReader(bytes.NewReader(input)))
+			dec.DisallowUnknownFields()
+			return dec.Decode(&outer{})
+		}
+
+		input := bsoncore.NewDocumentBuilder().
+			AppendDocument("a", bsoncore.NewDocumentBuilder().
+				AppendDocument("b", bsoncore.NewDocumentBuilder().
+					AppendInt32("known", 1).
+					AppendInt32("unexpected", 2).
+					Build()).
+				Build()).
+			Build()
+		err := decode(input)
+		var de *DecodeError
+		require.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"a", "b", "unexpected"}, de.Keys())
+		assert.ErrorIs(t, err, ErrUnknownField)
+		assert.EqualError(t, err, "error decoding key a.b.unexpected (field A.B.unexpected): unknown field")
+
+		// Keys of maps are not fields, so they are always allowed.
+		input = bsoncore.NewDocumentBuilder().
+			AppendDocument("extras", bsoncore.NewDocumentBuilder().
+				AppendInt32("anything", 1).
+				Build()).
+			Build()
+		assert.NoError(t, decode(input), "Decode error")
+	})
+	t.Run("StrictNumbers", func(t *testing.T) {
+		t.Parallel()
+
+		type ledgerTest struct {
+			Units  int32   `bson:"units"`
+			Cents  int64   `bson:"cents"`
+			Shares int32   `bson:"shares,truncate"`
+			Rate   float32 `bson:"rate,truncate"`
+			Ratio  float32 `bson:"ratio"`
+		}
+
+		decode := func(input []byte) (ledgerTest, error) {
+			var got ledgerTest
+			dec := NewDecoder(NewDocumentReader(bytes.NewReader(input)))
+			dec.StrictNumbers()
+			err := dec.Decode(&got)
+			return got, err
+		}
+
+		testCases := []struct {
+			name    string
+			input   []byte
+			wantKey string
+			wantErr string
+		}{
+			{
+				name:    "int64 overflows int32",
+				input:   bsoncore.NewDocumentBuilder().AppendInt64("units", 3000000000).Build(),
+				wantKey: "units",
+				wantErr: "3000000000 does not fit in int32",
+			},
+			{
+				name:    "double below int64",
+				input:   bsoncore.NewDocumentBuilder().AppendDouble("cents", -1e20).Build(),
+				wantKey: "cents",
+				wantErr: "-1e+20 does not fit in int64",
+			},
+			{
+				name:    "double overflows float32",
+				input:   bsoncore.NewDocumentBuilder().AppendDouble("ratio", 1e300).Build(),
+				wantKey: "ratio",
+				wantErr: "1e+300 does not fit in float32",
+			},
+		}
+		for _, tc := range testCases {
+			tc := tc // Capture range variable.
+
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+
+				_, err := decode(tc.input)
+				var de *DecodeError
+				require.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+				assert.Equal(t, []string{tc.wantKey}, de.Keys())
+				assert.ErrorIs(t, err, ErrNumberOutOfRange)
+				assert.ErrorContains(t, err, tc.wantErr)
+			})
+		}
+
+		// The "truncate" struct tag option still allows dropping the fractional part.
+		input := bsoncore.NewDocumentBuilder().
+			AppendDouble("shares", 12.75).
+			AppendDouble("rate", 0.1).
+			Build()
+		got, err := decode(input)
+		require.NoError(t, err, "Decode error")
+		assert.Equal(t, ledgerTest{Shares: 12, Rate: 0.1}, got)
+
+		// Truncation takes precedence over the float32 range check when both are set.
+		input = bsoncore.NewDocumentBuilder().AppendDouble("rate", 1e300).Build()
+		got, err = decode(input)
+		require.NoError(t, err, "Decode error")
+		assert.True(t, math.IsInf(float64(got.Rate), 1), "expected +Inf, got %v", got.Rate)
+	})
+	t.Run("IgnoreNullFields", func(t *testing.T) {
+		t.Parallel()
+
+		type tombstoneTest struct {
+			Name  string         `bson:"name"`
+			Count int32          `bson:"count"`
+			Ptr   *int32         `bson:"ptr"`
+			Tags  map[string]any `bson:"tags"`
+		}
+
+		input := bsoncore.NewDocumentBuilder().
+			AppendNull("name").
+			AppendInt32("count", 3).
+			AppendNull("ptr").
+			AppendDocument("tags", bsoncore.NewDocumentBuilder().AppendNull("color").Build()).
+			Build()
+
+		ptr := int32(1)
+		got := tombstoneTest{Name: "kept", Count: 1, Ptr: &ptr}
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(input)))
+		dec.IgnoreNullFields()
+		err := dec.Decode(&got)
+		require.NoError(t, err, "Decode error")
+
+		want := tombstoneTest{Name: "kept", Count: 3, Ptr: &ptr, Tags: map[string]any{"color": nil}}
+		assert.Equal(t, want, got)
+	})
+	t.Run("AccumulateErrors", func(t *testing.T) {
+		t.Parallel()
+
+		type innerTest struct {
+			Count int32  `bson:"count"`
+			Label string `bson:"label"`
+		}
+		type accumulateTest struct {
+			Name  string    `bson:"name"`
+			Age   int32     `bson:"age"`
+			Inner innerTest `bson:"inner"`
+			Ok    bool      `bson:"ok"`
+		}
+
+		inner := bsoncore.NewDocumentBuilder().
+			AppendString("count", "many").
+			AppendBoolean("label", true).
+			Build()
+		input := bsoncore.NewDocumentBuilder().
+			AppendInt32("name", 1).
+			AppendInt32("age", 42).
+			AppendDocument("inner", inner).
+			AppendBoolean("ok", true).
+			Build()
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(input)))
+		dec.AccumulateErrors()
+		got := accumulateTest{Name: "kept"}
+		err := dec.Decode(&got)
+		require.Error(t, err, "expected Decode error")
+
+		multi, ok := err.(interface{ Unwrap() []error })
+		require.True(t, ok, "expected an error with Unwrap() []error, got %T", err)
+		var keys [][]string
+		for _, err := range multi.Unwrap() {
+			var de *DecodeError
+			require.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+			keys = append(keys, de.Keys())
+		}
+		want := [][]string{{"name"}, {"inner", "count"}, {"inner", "label"}}
+		assert.Equal(t, want, keys)
+		assert.Equal(t, accumulateTest{Name: "kept", Age: 42, Ok: true}, got)
+
+		dec = NewDecoder(NewDocumentReader(bytes.NewReader(input)))
+		err = dec.Decode(&accumulateTest{})
+		var de *DecodeError
+		require.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"name"}, de.Keys())
+	})
+	t.Run("SetDuplicateKeyPolicy", func(t *testing.T) {
+		t.Parallel()
+
+		type innerTest struct {
+			Role string `bson:"role"`
+		}
+		type duplicateTest struct {
+			Name  string           `bson:"name"`
+			Tags  []string         `bson:"tags"`
+			Inner innerTest        `bson:"inner"`
+			Extra map[string]int32 `bson:",inline"`
+		}
+
+		inner := bsoncore.NewDocumentBuilder().
+			AppendString("role", "user").
+			AppendString("role", "admin").
+			Build()
+		input := bsoncore.NewDocumentBuilder().
+			AppendString("name", "a").
+			AppendString("Name", "b").
+			AppendArray("tags", bsoncore.NewArrayBuilder().AppendString("x").Build()).
+			AppendArray("tags", bsoncore.NewArrayBuilder().AppendString("y").Build()).
+			AppendInt32("n", 1).
+			AppendInt32("n", 2).
+			AppendDocument("inner", inner).
+			Build()
+
+		decode := func(policy DuplicateKeyPolicy, accumulate bool) (duplicateTest, error) {
+			dec := NewDecoder(NewDocumentReader(bytes.NewReader(input)))
+			dec.SetDuplicateKeyPolicy(policy)
+			if accumulate {
+				dec.AccumulateErrors()
+			}
+			var got duplicateTest
+			err := dec.Decode(&got)
+			return got, err
+		}
+
+		got, err := decode(DuplicateKeyLast, false)
+		require.NoError(t, err, "Decode error")
+		want := duplicateTest{
+			Name:  "b",
+			Tags:  []string{"y"},
+			Inner: innerTest{Role: "admin"},
+			Extra: map[string]int32{"n": 2},
+		}
+		assert.Equal(t, want, got)
+
+		got, err = decode(DuplicateKeyFirst, false)
+		require.NoError(t, err, "Decode error")
+		want = duplicateTest{
+			Name:  "a",
+			Tags:  []string{"x"},
+			Inner: innerTest{Role: "user"},
+			Extra: map[string]int32{"n": 1},
+		}
+		assert.Equal(t, want, got)
+
+		_, err = decode(DuplicateKeyError, false)
+		assert.ErrorIs(t, err, ErrDuplicateKey)
+		var de *DecodeError
+		require.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"Name"}, de.Keys())
+
+		_, err = decode(DuplicateKeyError, true)
+		multi, ok := err.(interface{ Unwrap() []error })
+		require.True(t, ok, "expected an error with Unwrap() []error, got %T", err)
+		var keys [][]string
+		for _, err := range multi.Unwrap() {
+			require.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+			keys = append(keys, de.Keys())
+		}
+		assert.Equal(t, [][]string{{"Name"}, {"tags"}, {"n"}, {"inner", "role"}}, keys)
+	})
+	t.Run("SetFallbackDecoder", func(t *testing.T) {
+		t.Parallel()
+
+		type job struct {
+			Name string   `bson:"name"`
+			Done chan int `bson:"done"`
+		}
+		doc := mustMarshal(t, D{{"name", "build"}, {"done", int32(1)}})
+		decode := func(fallback ValueDecoder) (job, error) {
+			dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+			if fallback != nil {
+				dec.SetFallbackDecoder(fallback)
+			}
+			var got job
+			err := dec.Decode(&got)
+			return got, err
+		}
+
+		_, err := decode(nil)
+		var nde errNoDecoder
+		assert.True(t, errors.As(err, &nde), "expected an errNoDecoder, got %v", err)
+
+		got, err := decode(ValueDecoderFunc(func(_ DecodeContext, vr ValueReader, _ reflect.Value) error {
+			return vr.Skip()
+		}))
+		require.NoError(t, err, "Decode error")
+		assert.Equal(t, job{Name: "build"}, got)
+
+		var raw RawValue
+		got, err = decode(ValueDecoderFunc(func(_ DecodeContext, vr ValueReader, val reflect.Value) error {
+			assert.Equal(t, reflect.TypeOf(make(chan int)), val.Type())
+			typ, data, err := copyValueToBytes(vr)
+			raw = RawValue{Type: typ, Value: data}
+			return err
+		}))
+		require.NoError(t, err, "Decode error")
+		assert.Equal(t, job{Name: "build"}, got)
+		assert.Equal(t, int32(1), raw.Int32())
+	})
+	t.Run("ReuseSliceElements", func(t *testing.T) {
+		t.Parallel()
+
+		type item struct {
+			Name  string         `bson:"name"`
+			Count int32          `bson:"count,omitempty"`
+			Tags  []string       `bson:"tags,omitempty"`
+			Meta  map[string]any `bson:"meta,omitempty"`
+		}
+		type batch struct {
+			Items []item `bson:"items"`
+		}
+
+		decode := func(t *testing.T, doc D, got *batch) {
+			t.Helper()
+
+			dec := NewDecoder(NewDocumentReader(bytes.NewReader(mustMarshal(t, doc))))
+			dec.ReuseSliceElements()
+			require.NoError(t, dec.Decode(got), "Decode error")
+		}
+
+		var got batch
+		decode(t, D{{"items", A{
+			D{{"name", "a"}, {"count", 1}, {"tags", A{"x"}}, {"meta", D{{"k", "v"}}}},
+			D{{"name", "b"}, {"count", 2}},
+			D{{"name", "c"}, {"count", 3}},
+		}}}, &got)
+		first, capacity := &got.Items[0], cap(got.Items)
+
+		decode(t, D{{"items", A{D{{"name", "d"}}, D{{"tags", A{"y"}}}}}}, &got)
+		assert.Equal(t, []item{{Name: "d"}, {Tags: []string{"y"}}}, got.Items)
+		assert.Equal(t, capacity, cap(got.Items), "expected the backing array to be reused")
+		assert.True(t, first == &got.Items[0], "expected the first element to be reused")
+
+		decode(t, D{{"items", A{D{{"name", "e"}}, D{{"name", "f"}}, D{{"name", "g"}}, D{{"name", "h"}}}}}, &got)
+		assert.Equal(t, []item{{Name: "e"}, {Name: "f"}, {Name: "g"}, {Name: "h"}}, got.Items)
+
+		decode(t, D{{"items", A{}}}, &got)
+		assert.Equal(t, []item{}, got.Items)
+
+		var empty batch
+		decode(t, D{{"items", A{}}}, &empty)
+		assert.Equal(t, []item{}, empty.Items)
+	})
+	t.Run("SetContext", func(t *testing.T) {
+		t.Parallel()
+
+		type cancelTrigger struct{}
+		type wide struct {
+			Trigger cancelTrigger    `bson:"trigger"`
+			Extra   map[string]int32 `bson:",inline"`
+		}
+
+		builder := bsoncore.NewDocumentBuilder().AppendDocument("trigger", bsoncore.NewDocumentBuilder().Build())
+		for i := 0; i < 200; i++ {
+			builder.AppendInt32(fmt.Sprintf("k%d", i), int32(i))
+		}
+		input := builder.Build()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		reg := NewRegistry()
+		reg.RegisterTypeDecoder(reflect.TypeOf(cancelTrigger{}), ValueDecoderFunc(func(_ DecodeContext, vr ValueReader, _ reflect.Value) error {
+			cancel()
+			return vr.Skip()
+		}))
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(input)))
+		dec.SetRegistry(reg)
+		dec.SetContext(ctx)
+		var got wide
+		err := dec.Decode(&got)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, len(got.Extra), 200, "expected decoding to stop before the end of the document")
+
+		dec = NewDecoder(NewDocumentReader(bytes.NewReader(input)))
+		dec.SetContext(context.Background())
+		got = wide{}
+		require.NoError(t, dec.Decode(&got), "Decode error")
+		assert.Len(t, got.Extra, 200)
+	})
+	t.Run("RawFieldSink", func(t *testing.T) {
+		t.Parallel()
+
+		type auditTest struct {
+			Name  string `bson:"name"`
+			Inner struct {
+				Count int32 `bson:"count"`
+			} `bson:"inner"`
+		}
+
+		inner := bsoncore.NewDocumentBuilder().AppendInt32("count", 7).Build()
+		input := bsoncore.NewDocumentBuilder().
+			AppendString("name", "widget").
+			AppendDocument("inner", inner).
+			AppendBoolean("unknown", true).
+			Build()
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(input)))
+		got := make(map[string][]byte)
+		dec.RawFieldSink(func(key string, raw []byte) {
+			got[key] = append([]byte(nil), raw...)
+		})
+
+		var val auditTest
+		err := dec.Decode(&val)
+		require.NoError(t, err, "Decode error")
+
+		want := map[string][]byte{
+			"name":    bsoncore.AppendString(nil, "widget"),
+			"inner":   inner,
+			"unknown": bsoncore.AppendBoolean(nil, true),
+		}
+		assert.Equal(t, want, got, "expected and actual raw fields do not match")
+		assert.Equal(t, "widget", val.Name)
+		assert.Equal(t, int32(7), val.Inner.Count)
+	})
+	t.Run("WideningOnly", func(t *testing.T) {
+		t.Parallel()
+
+		targets := []reflect.Type{
+			reflect.TypeOf(int8(0)),
+			reflect.TypeOf(int16(0)),
+			reflect.TypeOf(int32(0)),
+			reflect.TypeOf(int64(0)),
+			reflect.TypeOf(uint64(0)),
+			reflect.TypeOf(float32(0)),
+			reflect.TypeOf(float64(0)),
+		}
+		inputs := []struct {
+			name    string
+			doc     []byte
+			allowed []reflect.Kind
+		}{
+			{
+				name:    "int32",
+				doc:     bsoncore.NewDocumentBuilder().AppendInt32("v", 1).Build(),
+				allowed: []reflect.Kind{reflect.Int32, reflect.Int64, reflect.Float64},
+			},
+			{
+				name:    "int64",
+				doc:     bsoncore.NewDocumentBuilder().AppendInt64("v", 1).Build(),
+				allowed: []reflect.Kind{reflect.Int64},
+			},
+			{
+				name:    "double",
+				doc:     bsoncore.NewDocumentBuilder().AppendDouble("v", 1).Build(),
+				allowed: []reflect.Kind{reflect.Float64},
+			},
+		}
+
+		for _, in := range inputs {
+			for _, target := range targets {
+				in, target := in, target // Capture range variables.
+
+				t.Run(in.name+" into "+target.String(), func(t *testing.T) {
+					t.Parallel()
+
+					st := reflect.StructOf([]reflect.StructField{
+						{Name: "V", Type: target, Tag: `bson:"v"`},
+					})
+					got := reflect.New(st)
+
+					dec := NewDecoder(NewDocumentReader(bytes.NewReader(in.doc)))
+					dec.WideningOnly()
+					err := dec.Decode(got.Interface())
+
+					for _, k := range in.allowed {
+						if k == target.Kind() {
+							require.NoError(t, err, "Decode error")
+							assert.Equal(t, 1.0, got.Elem().Field(0).Convert(reflect.TypeOf(1.0)).Interface())
+							return
+						}
+					}
+					var de *DecodeError
+					require.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+					assert.Equal(t, []string{"v"}, de.Keys())
+					assert.ErrorContains(t, err, "into "+target.String()+": only widening")
+				})
+			}
+		}
+	})
+	t.Run("DoubleToIntExactOnly", func(t *testing.T) {
+		t.Parallel()
+
+		type exactTest struct {
+			ID    int64 `bson:"id"`
+			Count uint8 `bson:"count,truncate"`
+		}
+
+		testCases := []struct {
+			name    string
+			id      float64
+			count   float64
+			want    exactTest
+			wantErr string
+		}{
+			{name: "integral", id: 1.0, count: 255, want: exactTest{ID: 1, Count: 255}},
+			{name: "negative zero", id: math.Copysign(0, -1), want: exactTest{}},
+			{name: "min int64", id: math.MinInt64, want: exactTest{ID: math.MinInt64}},
+			{name: "fractional", id: 1.5, wantErr: "error decoding key id (field ID): 1.5 is not an integral value"},
+			{name: "wins over truncate", count: 2.5, wantErr: "error decoding key count (field Count): 2.5 is not an integral value"},
+			{name: "max int64 overflows", id: math.MaxInt64, wantErr: "error decoding key id (field ID): 9.223372036854776e+18 overflows int64"},
+			{name: "NaN", id: math.NaN(), wantErr: "error decoding key id (field ID): NaN is not an integral value"},
+			{name: "infinity", id: math.Inf(-1), wantErr: "error decoding key id (field ID): -Inf overflows int64"},
+		}
+
+		for _, tc := range testCases {
+			tc := tc // Capture range variable.
+
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+
+				input := bsoncore.NewDocumentBuilder().
+					AppendDouble("id", tc.id).
+					AppendDouble("count", tc.count).
+					Build()
+
+				dec := NewDecoder(NewDocumentReader(bytes.NewReader(input)))
+				dec.AllowTruncatingDoubles()
+				dec.DoubleToIntExactOnly()
+
+				var got exactTest
+				err := dec.Decode(&got)
+				if tc.wantErr != "" {
+					assert.EqualError(t, err, tc.wantErr)
+					return
+				}
+				require.NoError(t, err, "Decode error")
+				assert.Equal(t, tc.want, got, "expected and actual decode results do not match")
+			})
+		}
+	})
 }
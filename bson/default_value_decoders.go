@@ -60,7 +60,11 @@ func registerDefaultDecoders(reg *Registry) {
 	reg.RegisterTypeDecoder(tOID, decodeAdapter{objectIDDecodeValue, objectIDDecodeType})
 	reg.RegisterTypeDecoder(tDecimal, decodeAdapter{decimal128DecodeValue, decimal128DecodeType})
 	reg.RegisterTypeDecoder(tJSONNumber, decodeAdapter{jsonNumberDecodeValue, jsonNumberDecodeType})
+	reg.RegisterTypeDecoder(tBigRat, bigDecimalCodec{})
+	reg.RegisterTypeDecoder(tBigFloat, bigDecimalCodec{})
 	reg.RegisterTypeDecoder(tURL, decodeAdapter{urlDecodeValue, urlDecodeType})
+	reg.RegisterTypeDecoder(tIP, decodeAdapter{ipDecodeValue, ipDecodeType})
+	reg.RegisterTypeDecoder(tHardwareAddr, decodeAdapter{hardwareAddrDecodeValue, hardwareAddrDecodeType})
 	reg.RegisterTypeDecoder(tCoreDocument, ValueDecoderFunc(coreDocumentDecodeValue))
 	reg.RegisterTypeDecoder(tCodeWithScope, decodeAdapter{codeWithScopeDecodeValue, codeWithScopeDecodeType})
 	reg.RegisterKindDecoder(reflect.Bool, decodeAdapter{booleanDecodeValue, booleanDecodeType})
@@ -105,6 +109,7 @@ func registerDefaultDecoders(reg *Registry) {
 	reg.RegisterTypeMapEntry(TypeEmbeddedDocument, tD)
 	reg.RegisterInterfaceDecoder(tValueUnmarshaler, ValueDecoderFunc(valueUnmarshalerDecodeValue))
 	reg.RegisterInterfaceDecoder(tUnmarshaler, ValueDecoderFunc(unmarshalerDecodeValue))
+	reg.RegisterInterfaceDecoder(tLazyDecoder, ValueDecoderFunc(lazyDecodeValue))
 }
 
 // dDecodeValue is the ValueDecoderFunc for D instances.
@@ -163,7 +168,7 @@ func dDecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
 	return nil
 }
 
-func booleanDecodeType(_ DecodeContext, vr ValueReader, t reflect.Type) (reflect.Value, error) {
+func booleanDecodeType(dc DecodeContext, vr ValueReader, t reflect.Type) (reflect.Value, error) {
 	if t.Kind() != reflect.Bool {
 		return emptyValue, ValueDecoderError{
 			Name:     "BooleanDecodeValue",
@@ -171,6 +176,7 @@ func booleanDecodeType(_ DecodeContext, vr ValueReader, t reflect.Type) (reflect
 			Received: reflect.Zero(t),
 		}
 	}
+	checkLegacy(dc, vr.Type(), t)
 
 	var b bool
 	var err error
@@ -224,7 +230,96 @@ func booleanDecodeValue(dctx DecodeContext, vr ValueReader, val reflect.Value) e
 	return nil
 }
 
+// checkWidening returns an error if dc only allows widening numeric conversions and decoding a BSON
+// value of type bt into a Go value of type t could lose range or precision, regardless of the
+// actual value. Non-numeric BSON types are not checked.
+func checkWidening(dc DecodeContext, bt Type, t reflect.Type) error {
+	if !dc.wideningOnly {
+		return nil
+	}
+
+	var ok bool
+	switch bt {
+	case TypeInt32:
+		switch t.Kind() {
+		case reflect.Int32, reflect.Int64, reflect.Int, reflect.Float64:
+			ok = true
+		}
+	case TypeInt64:
+		switch t.Kind() {
+		case reflect.Int64:
+			ok = true
+		case reflect.Int:
+			ok = strconv.IntSize == 64
+		}
+	case TypeDouble:
+		ok = t.Kind() == reflect.Float64
+	default:
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("cannot decode BSON %v into %s: only widening numeric conversions are allowed", bt, t)
+	}
+	return nil
+}
+
+// doubleToInt64 converts a BSON "double" value to an int64 for decoding into a Go integer type,
+// applying the truncation rules configured on dc.
+func doubleToInt64(dc DecodeContext, f64 float64) (int64, error) {
+	if dc.doubleToIntExactOnly {
+		if math.Trunc(f64) != f64 {
+			return 0, fmt.Errorf("%g is not an integral value", f64)
+		}
+		if f64 < math.MinInt64 || f64 >= math.MaxInt64 {
+			return 0, overflowError(dc, f64, tInt64)
+		}
+		return int64(f64), nil
+	}
+	if !dc.truncate && math.Floor(f64) != f64 {
+		return 0, errCannotTruncate
+	}
+	if f64 > float64(math.MaxInt64) {
+		return 0, overflowError(dc, f64, tInt64)
+	}
+	if dc.strictNumbers && (math.IsNaN(f64) || f64 < math.MinInt64) {
+		return 0, overflowError(dc, f64, tInt64)
+	}
+	return int64(f64), nil
+}
+
+// overflowError returns the error for the numeric BSON value v that is out of the range of the Go
+// type t. It wraps ErrNumberOutOfRange if dc decodes numbers strictly.
+func overflowError(dc DecodeContext, v any, t reflect.Type) error {
+	if dc.strictNumbers {
+		return fmt.Errorf("%w: %v does not fit in %s", ErrNumberOutOfRange, v, t)
+	}
+	return fmt.Errorf("%v overflows %s", v, t.Kind())
+}
+
+// decodeEmptyDocAsNil sets val to its zero value and returns true if dc decodes empty BSON documents
+// as nil and vr holds an empty embedded document. Otherwise, it returns a ValueReader that must be
+// used in place of vr to read the value.
+func decodeEmptyDocAsNil(dc DecodeContext, vr ValueReader, val reflect.Value) (bool, ValueReader, error) {
+	if !dc.emptyDocAsNil || vr.Type() != TypeEmbeddedDocument {
+		return false, vr, nil
+	}
+
+	t, doc, err := copyValueToBytes(vr)
+	if err != nil {
+		return false, nil, err
+	}
+	if len(doc) == 5 {
+		val.Set(reflect.Zero(val.Type()))
+		return true, nil, nil
+	}
+	return false, newBufferedValueReader(t, doc), nil
+}
+
 func intDecodeType(dc DecodeContext, vr ValueReader, t reflect.Type) (reflect.Value, error) {
+	if err := checkWidening(dc, vr.Type(), t); err != nil {
+		return emptyValue, err
+	}
+	checkLegacy(dc, vr.Type(), t)
 	var i64 int64
 	var err error
 	switch vrType := vr.Type(); vrType {
@@ -244,13 +339,9 @@ func intDecodeType(dc DecodeContext, vr ValueReader, t reflect.Type) (reflect.Va
 		if err != nil {
 			return emptyValue, err
 		}
-		if !dc.truncate && math.Floor(f64) != f64 {
-			return emptyValue, errCannotTruncate
-		}
-		if f64 > float64(math.MaxInt64) {
-			return emptyValue, fmt.Errorf("%g overflows int64", f64)
+		if i64, err = doubleToInt64(dc, f64); err != nil {
+			return emptyValue, err
 		}
-		i64 = int64(f64)
 	case TypeBoolean:
 		b, err := vr.ReadBoolean()
 		if err != nil {
@@ -274,19 +365,19 @@ func intDecodeType(dc DecodeContext, vr ValueReader, t reflect.Type) (reflect.Va
 	switch t.Kind() {
 	case reflect.Int8:
 		if i64 < math.MinInt8 || i64 > math.MaxInt8 {
-			return emptyValue, fmt.Errorf("%d overflows int8", i64)
+			return emptyValue, overflowError(dc, i64, t)
 		}
 
 		return reflect.ValueOf(int8(i64)), nil
 	case reflect.Int16:
 		if i64 < math.MinInt16 || i64 > math.MaxInt16 {
-			return emptyValue, fmt.Errorf("%d overflows int16", i64)
+			return emptyValue, overflowError(dc, i64, t)
 		}
 
 		return reflect.ValueOf(int16(i64)), nil
 	case reflect.Int32:
 		if i64 < math.MinInt32 || i64 > math.MaxInt32 {
-			return emptyValue, fmt.Errorf("%d overflows int32", i64)
+			return emptyValue, overflowError(dc, i64, t)
 		}
 
 		return reflect.ValueOf(int32(i64)), nil
@@ -294,7 +385,7 @@ func intDecodeType(dc DecodeContext, vr ValueReader, t reflect.Type) (reflect.Va
 		return reflect.ValueOf(i64), nil
 	case reflect.Int:
 		if i64 > math.MaxInt { // Can we fit this inside of an int
-			return emptyValue, fmt.Errorf("%d overflows int", i64)
+			return emptyValue, overflowError(dc, i64, t)
 		}
 
 		return reflect.ValueOf(int(i64)), nil
@@ -327,6 +418,10 @@ func intDecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
 }
 
 func floatDecodeType(dc DecodeContext, vr ValueReader, t reflect.Type) (reflect.Value, error) {
+	if err := checkWidening(dc, vr.Type(), t); err != nil {
+		return emptyValue, err
+	}
+	checkLegacy(dc, vr.Type(), t)
 	var f float64
 	var err error
 	switch vrType := vr.Type(); vrType {
@@ -369,6 +464,10 @@ func floatDecodeType(dc DecodeContext, vr ValueReader, t reflect.Type) (reflect.
 
 	switch t.Kind() {
 	case reflect.Float32:
+		// Truncation takes precedence, so doubles beyond the range of float32 become infinities.
+		if dc.strictNumbers && !dc.truncate && !math.IsInf(f, 0) && math.Abs(f) > math.MaxFloat32 {
+			return emptyValue, overflowError(dc, f, t)
+		}
 		if !dc.truncate && float64(float32(f)) != f {
 			return emptyValue, errCannotTruncate
 		}
@@ -1169,9 +1268,13 @@ func arrayDecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error
 		if err != nil {
 			return err
 		}
-		if subtype != TypeBinaryGeneric && subtype != TypeBinaryBinaryOld {
+		isUUID := (subtype == TypeBinaryUUID || subtype == TypeBinaryUUIDOld) && val.Len() == 16
+		if subtype != TypeBinaryGeneric && subtype != TypeBinaryBinaryOld && !isUUID {
 			return fmt.Errorf("ArrayDecodeValue can only be used to decode subtype 0x00 or 0x02 for %s, got %v", TypeBinary, subtype)
 		}
+		if isUUID && len(data) != 16 {
+			return fmt.Errorf("uuid of %d bytes does not fit in %s", len(data), val.Type())
+		}
 
 		if len(data) > val.Len() {
 			return fmt.Errorf("more elements returned in array than can fit inside %s", val.Type())
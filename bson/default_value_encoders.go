@@ -12,6 +12,7 @@ import (
 	"math"
 	"net/url"
 	"reflect"
+	"strconv"
 	"sync"
 
 	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
@@ -66,7 +67,11 @@ func registerDefaultEncoders(reg *Registry) {
 	reg.RegisterTypeEncoder(tOID, ValueEncoderFunc(objectIDEncodeValue))
 	reg.RegisterTypeEncoder(tDecimal, ValueEncoderFunc(decimal128EncodeValue))
 	reg.RegisterTypeEncoder(tJSONNumber, ValueEncoderFunc(jsonNumberEncodeValue))
+	reg.RegisterTypeEncoder(tBigRat, bigDecimalCodec{})
+	reg.RegisterTypeEncoder(tBigFloat, bigDecimalCodec{})
 	reg.RegisterTypeEncoder(tURL, ValueEncoderFunc(urlEncodeValue))
+	reg.RegisterTypeEncoder(tIP, ValueEncoderFunc(ipEncodeValue))
+	reg.RegisterTypeEncoder(tHardwareAddr, ValueEncoderFunc(hardwareAddrEncodeValue))
 	reg.RegisterTypeEncoder(tJavaScript, ValueEncoderFunc(javaScriptEncodeValue))
 	reg.RegisterTypeEncoder(tSymbol, ValueEncoderFunc(symbolEncodeValue))
 	reg.RegisterTypeEncoder(tBinary, ValueEncoderFunc(binaryEncodeValue))
@@ -102,6 +107,7 @@ func registerDefaultEncoders(reg *Registry) {
 	reg.RegisterKindEncoder(reflect.Ptr, &pointerCodec{})
 	reg.RegisterInterfaceEncoder(tValueMarshaler, ValueEncoderFunc(valueMarshalerEncodeValue))
 	reg.RegisterInterfaceEncoder(tMarshaler, ValueEncoderFunc(marshalerEncodeValue))
+	reg.RegisterInterfaceEncoder(tLazyEncoder, ValueEncoderFunc(lazyEncodeValue))
 }
 
 // booleanEncodeValue is the ValueEncoderFunc for bool types.
@@ -143,15 +149,32 @@ func intEncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Value) error {
 }
 
 // floatEncodeValue is the ValueEncoderFunc for float types.
-func floatEncodeValue(_ EncodeContext, vw ValueWriter, val reflect.Value) error {
+func floatEncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Value) error {
 	switch val.Kind() {
 	case reflect.Float32, reflect.Float64:
-		return vw.WriteDouble(val.Float())
+		f64 := val.Float()
+		if ec.round {
+			f64 = roundFloat(f64, ec.roundDigits)
+		}
+		return vw.WriteDouble(f64)
 	}
 
 	return ValueEncoderError{Name: "FloatEncodeValue", Kinds: []reflect.Kind{reflect.Float32, reflect.Float64}, Received: val}
 }
 
+// roundFloat rounds the exact binary value of f to the nearest value with the given number of
+// decimal places, rounding ties to even. NaN and infinite values are returned unchanged.
+func roundFloat(f float64, digits int) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return f
+	}
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(f, 'f', digits, 64), 64)
+	if err != nil {
+		return f
+	}
+	return rounded
+}
+
 // objectIDEncodeValue is the ValueEncoderFunc for ObjectID.
 func objectIDEncodeValue(_ EncodeContext, vw ValueWriter, val reflect.Value) error {
 	if !val.IsValid() || val.Type() != tOID {
@@ -227,6 +250,13 @@ func arrayEncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Value) error
 		for idx := 0; idx < val.Len(); idx++ {
 			byteSlice = append(byteSlice, val.Index(idx).Interface().(byte))
 		}
+		if val.Len() == 16 && ec.uuidSubtype != 0 {
+			subtype, err := uuidSubtype(ec)
+			if err != nil {
+				return err
+			}
+			return vw.WriteBinaryWithSubtype(byteSlice, subtype)
+		}
 		return vw.WriteBinary(byteSlice)
 	}
 
@@ -241,10 +271,16 @@ func arrayEncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Value) error
 		return err
 	}
 
+	// Like slices, arrays of structs encoded by the struct codec resolve the struct description
+	// once for all elements.
+	if structEnc, ok := encoder.(*structCodec); ok && elemType.Kind() == reflect.Struct {
+		return structEnc.encodeSlice(ec, aw, val)
+	}
+
 	for idx := 0; idx < val.Len(); idx++ {
 		currEncoder, currVal, lookupErr := lookupElementEncoder(ec, encoder, val.Index(idx))
 		if lookupErr != nil && !errors.Is(lookupErr, errInvalidValue) {
-			return lookupErr
+			return newEncodeError(strconv.Itoa(idx), lookupErr)
 		}
 
 		vw, err := aw.WriteArrayElement()
@@ -262,7 +298,7 @@ func arrayEncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Value) error
 
 		err = currEncoder.EncodeValue(ec, vw, currVal)
 		if err != nil {
-			return err
+			return newEncodeError(strconv.Itoa(idx), err)
 		}
 	}
 	return aw.WriteArrayEnd()
@@ -278,7 +314,7 @@ func lookupElementEncoder(ec EncodeContext, origEncoder ValueEncoder, currVal re
 	}
 	currEncoder, err := ec.LookupEncoder(currVal.Type())
 
-	return currEncoder, currVal, err
+	return ec.withDiscriminator(currVal.Type(), currEncoder), currVal, err
 }
 
 // valueMarshalerEncodeValue is the ValueEncoderFunc for ValueMarshaler implementations.
@@ -251,7 +251,7 @@ func TestDefaultValueEncoders(t *testing.T) {
 					&EncodeContext{Registry: buildDefaultRegistry()},
 					&valueReaderWriter{Err: errors.New("ev error"), ErrAfter: writeString},
 					writeString,
-					errors.New("ev error"),
+					newEncodeError("foo", errors.New("ev error")),
 				},
 				{
 					"empty map/success",
@@ -331,7 +331,7 @@ func TestDefaultValueEncoders(t *testing.T) {
 					&EncodeContext{Registry: buildDefaultRegistry()},
 					&valueReaderWriter{Err: errors.New("ev error"), ErrAfter: writeString},
 					writeString,
-					errors.New("ev error"),
+					newEncodeError("0", errors.New("ev error")),
 				},
 				{
 					"[1]E/success",
@@ -409,7 +409,7 @@ func TestDefaultValueEncoders(t *testing.T) {
 					&EncodeContext{Registry: buildDefaultRegistry()},
 					&valueReaderWriter{Err: errors.New("ev error"), ErrAfter: writeString},
 					writeString,
-					errors.New("ev error"),
+					newEncodeError("0", errors.New("ev error")),
 				},
 				{
 					"D/success",
@@ -0,0 +1,105 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// OnDescribeFunc is called by the struct codec for each struct type it describes, allowing synthetic
+// fields to be added to the description using the StructDescriptionBuilder. Descriptions, including
+// their synthetic fields, are cached, so the function is only called when a type is first encoded
+// or first decoded. It is set using Registry.SetOnDescribe.
+type OnDescribeFunc func(t reflect.Type, b *StructDescriptionBuilder)
+
+// SyntheticField is a field that does not exist in a Go struct but is encoded and decoded as part
+// of it.
+type SyntheticField struct {
+	// Name is the BSON key of the field.
+	Name string
+
+	// Encoder encodes the value of the field. It is called with the struct value being encoded.
+	// If Encoder is nil, the field is not encoded.
+	Encoder ValueEncoder
+
+	// Decoder decodes the value of the field when the key is present in the document being
+	// decoded. It is called with the addressable struct value being decoded into. If Decoder is
+	// nil, the value is skipped.
+	Decoder ValueDecoder
+}
+
+// StructDescriptionBuilder is used by an OnDescribeFunc to add synthetic fields to the description
+// of a struct type.
+type StructDescriptionBuilder struct {
+	sd     *structDescription
+	fields []fieldDescription
+	err    error
+}
+
+// HasField reports whether the description already has a field with the BSON key name.
+func (b *StructDescriptionBuilder) HasField(name string) bool {
+	if _, ok := b.sd.fm[name]; ok {
+		return true
+	}
+	for _, fd := range b.fields {
+		if fd.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AddField adds a synthetic field to the description. It returns an error if the description
+// already has a field with the same BSON key. The error is also returned when the struct is
+// encoded or decoded.
+func (b *StructDescriptionBuilder) AddField(f SyntheticField) error {
+	var err error
+	switch {
+	case f.Name == "":
+		err = errors.New("synthetic field must have a name")
+	case b.HasField(f.Name):
+		err = fmt.Errorf("synthetic field %s collides with an existing field", f.Name)
+	}
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return err
+	}
+
+	b.fields = append(b.fields, fieldDescription{
+		name:      f.Name,
+		fieldName: f.Name,
+		idx:       -1,
+		pos:       -1,
+		order:     -1,
+		encoder:   f.Encoder,
+		decoder:   f.Decoder,
+		synthetic: true,
+	})
+	return nil
+}
+
+// describeSynthetic calls the OnDescribeFunc of r, if any, and adds the synthetic fields to sd.
+func describeSynthetic(r *Registry, t reflect.Type, sd *structDescription) error {
+	if r == nil || r.onDescribe == nil {
+		return nil
+	}
+
+	b := &StructDescriptionBuilder{sd: sd}
+	r.onDescribe(t, b)
+	if b.err != nil {
+		return fmt.Errorf("(struct %s) %w", t.String(), b.err)
+	}
+	for _, fd := range b.fields {
+		sd.fl = append(sd.fl, fd)
+		sd.fm[fd.name] = fd
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// discriminatorKey is the BSON key that holds the discriminator of a struct type registered using
+// Registry.RegisterTypeDiscriminator.
+const discriminatorKey = "_type"
+
+// discriminatorEncoder wraps the encoder for a struct type that has a registered discriminator. It
+// is used when a value of that type is encoded through an interface.
+type discriminatorEncoder struct {
+	name string
+	enc  ValueEncoder
+}
+
+// EncodeValue encodes val with the wrapped encoder, instructing the struct codec to write the
+// discriminator as the first element of the document.
+func (de discriminatorEncoder) EncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Value) error {
+	ec.discriminator = de.name
+	return de.enc.EncodeValue(ec, vw, val)
+}
+
+// withDiscriminator returns enc wrapped in a discriminatorEncoder if a discriminator is registered
+// for t or, if t is a pointer, the type t points to.
+func (r *Registry) withDiscriminator(t reflect.Type, enc ValueEncoder) ValueEncoder {
+	if r == nil || !r.hasDiscriminators || enc == nil {
+		return enc
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if name, ok := r.discriminators.Load(t); ok {
+		return discriminatorEncoder{name: name.(string), enc: enc}
+	}
+	return enc
+}
+
+// lookupDiscriminatedType returns the type registered for the discriminator held by the BSON
+// document doc, or nil if doc has no discriminator. It returns an error if the discriminator is not
+// registered.
+func (r *Registry) lookupDiscriminatedType(doc Raw) (reflect.Type, error) {
+	val, err := doc.LookupErr(discriminatorKey)
+	if errors.Is(err, bsoncore.ErrElementNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	name, ok := val.StringValueOK()
+	if !ok {
+		return nil, fmt.Errorf("discriminator %q must be a string, got %v", discriminatorKey, val.Type)
+	}
+	t, ok := r.discriminatedTypes.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown discriminator %q", name)
+	}
+	return t.(reflect.Type), nil
+}
+
+// decodeDiscriminated decodes the BSON document read from vr into the interface value val, using
+// the type registered for the document's discriminator. If the document has no discriminator, it
+// returns false and a ValueReader that reads the document so that it can be decoded normally.
+func decodeDiscriminated(dc DecodeContext, vr ValueReader, val reflect.Value) (bool, ValueReader, error) {
+	_, doc, err := copyValueToBytes(vr)
+	if err != nil {
+		return false, nil, err
+	}
+	vr = newBufferedValueReader(TypeEmbeddedDocument, doc)
+
+	t, err := dc.lookupDiscriminatedType(doc)
+	if err != nil || t == nil {
+		return false, vr, err
+	}
+
+	ptr := reflect.New(t)
+	decoder, err := dc.LookupDecoder(t)
+	if err != nil {
+		return false, nil, err
+	}
+	dc.discriminated = true
+	if err := decoder.DecodeValue(dc, vr, ptr.Elem()); err != nil {
+		return false, nil, err
+	}
+
+	return true, nil, setConcrete(val, ptr)
+}
+
+// setConcrete sets the interface value val to the value ptr points to if its type implements the
+// interface, or to ptr otherwise.
+func setConcrete(val, ptr reflect.Value) error {
+	switch {
+	case ptr.Elem().Type().AssignableTo(val.Type()):
+		val.Set(ptr.Elem())
+	case ptr.Type().AssignableTo(val.Type()):
+		val.Set(ptr)
+	default:
+		return fmt.Errorf("type %s does not implement %s", ptr.Elem().Type(), val.Type())
+	}
+	return nil
+}
+
+// TypeResolver returns the concrete type that the BSON value of the interface struct field named
+// fieldName is decoded into, given the value of the sibling discriminator key set using
+// Decoder.SetTypeResolver. It returns nil to decode the value as if no TypeResolver was set.
+type TypeResolver func(fieldName string, discriminator RawValue) (reflect.Type, error)
+
+// lookupTypeKey returns the value of the type key set using Decoder.SetTypeResolver in the BSON
+// document read from vr, or a zero RawValue if the document has no such key. If the struct type
+// t described by sd has interface fields, the document is buffered to read the type key before
+// any other element, and the returned ValueReader must be used in place of vr.
+func lookupTypeKey(dc DecodeContext, t reflect.Type, sd *structDescription, vr ValueReader) (RawValue, ValueReader, error) {
+	if dc.typeResolver == nil || !hasInterfaceField(t, sd) {
+		return RawValue{}, vr, nil
+	}
+
+	doc, err := copyDocumentToBytes(vr)
+	if err != nil {
+		return RawValue{}, nil, err
+	}
+	vr = newBufferedValueReader(TypeEmbeddedDocument, doc)
+
+	discriminator, err := Raw(doc).LookupErr(dc.typeKey)
+	if err != nil {
+		return RawValue{}, vr, nil
+	}
+	return discriminator, vr, nil
+}
+
+// hasInterfaceField reports whether a field of the struct type t described by sd is an interface.
+func hasInterfaceField(t reflect.Type, sd *structDescription) bool {
+	for _, fd := range sd.fl {
+		if !fd.synthetic && fieldType(t, fd).Kind() == reflect.Interface {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeResolved decodes the BSON value read from vr into the interface struct field val named
+// fieldName, using the type returned by the TypeResolver of dc for the document's type key. If the
+// TypeResolver returns nil, it returns false without reading from vr.
+func decodeResolved(dc DecodeContext, vr ValueReader, val reflect.Value, fieldName string) (bool, error) {
+	t, err := dc.typeResolver(fieldName, dc.typeKeyValue)
+	if err != nil || t == nil {
+		return false, err
+	}
+
+	ptr := reflect.New(t)
+	decoder, err := dc.LookupDecoder(t)
+	if err != nil {
+		return false, err
+	}
+	if err := decoder.DecodeValue(dc, vr, ptr.Elem()); err != nil {
+		return false, err
+	}
+
+	return true, setConcrete(val, ptr)
+}
+
+// InterfaceFactory allocates the value that a BSON value is decoded into when decoding into the
+// interface type the InterfaceFactory is registered for using Registry.RegisterInterfaceFactory. It
+// returns a pointer to a new value of a concrete type, or nil if the concrete type cannot be
+// determined from the BSON value.
+type InterfaceFactory func(RawValue) (any, error)
+
+// interfaceFactoryDecoder is the ValueDecoder registered for an interface type by
+// Registry.RegisterInterfaceFactory.
+type interfaceFactoryDecoder struct {
+	iface   reflect.Type
+	factory InterfaceFactory
+}
+
+// DecodeValue decodes a BSON value into a value allocated by the factory or, if the factory is nil
+// or returns nil, into a value of the type registered for the document's discriminator.
+func (ifd *interfaceFactoryDecoder) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != ifd.iface {
+		return ValueDecoderError{Name: "InterfaceFactoryDecodeValue", Types: []reflect.Type{ifd.iface}, Received: val}
+	}
+
+	switch vr.Type() {
+	case TypeNull:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadNull()
+	case TypeUndefined:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadUndefined()
+	}
+
+	t, data, err := copyValueToBytes(vr)
+	if err != nil {
+		return err
+	}
+
+	var ptr reflect.Value
+	if ifd.factory != nil {
+		v, err := ifd.factory(RawValue{Type: t, Value: data})
+		if err != nil {
+			return err
+		}
+		if v != nil {
+			ptr = reflect.ValueOf(v)
+			if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+				return fmt.Errorf("interface factory for %s must return a non-nil pointer, got %T", ifd.iface, v)
+			}
+		}
+	}
+	if !ptr.IsValid() && t == TypeEmbeddedDocument && dc.Registry != nil {
+		rt, err := dc.lookupDiscriminatedType(data)
+		if err != nil {
+			return err
+		}
+		if rt != nil {
+			ptr = reflect.New(rt)
+			dc.discriminated = true
+		}
+	}
+	if !ptr.IsValid() {
+		return fmt.Errorf("cannot determine the concrete type to decode %v into %s", t, ifd.iface)
+	}
+
+	decoder, err := dc.LookupDecoder(ptr.Elem().Type())
+	if err != nil {
+		return err
+	}
+	if err := decoder.DecodeValue(dc, newBufferedValueReader(t, data), ptr.Elem()); err != nil {
+		return err
+	}
+
+	return setConcrete(val, ptr)
+}
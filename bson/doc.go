@@ -70,6 +70,9 @@
 //     `bson:"fooField"` to generate key "fooField" instead).
 //
 //  3. An embedded struct field is marshaled as a subdocument. The key will be the lowercased name of the field's type.
+//     An embedded field of a non-struct type, such as a `type Tags []string` field, is marshaled like any other field
+//     and its key is also derived from the name of the field's type unless it is set by a struct tag, as with
+//     encoding/json. Embedded fields of unexported types are ignored.
 //
 //  4. A pointer field is marshaled as the underlying type if the pointer is non-nil. If the pointer is nil, it is
 //     marshaled as a BSON null value.
@@ -0,0 +1,32 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import "errors"
+
+// ErrDuplicateKey is wrapped by the DecodeError returned when a Decoder with the DuplicateKeyError
+// policy decodes a BSON document that repeats a key into a struct.
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// DuplicateKeyPolicy is how the struct codec handles BSON documents that contain the same key more
+// than once. It is set using Decoder.SetDuplicateKeyPolicy.
+type DuplicateKeyPolicy int
+
+// These constants are the supported DuplicateKeyPolicy values.
+const (
+	// DuplicateKeyLast causes every occurrence of a key to be decoded in document order, so the
+	// last occurrence wins for most types. It is the default.
+	DuplicateKeyLast DuplicateKeyPolicy = iota
+
+	// DuplicateKeyFirst causes only the first occurrence of a key to be decoded. Later occurrences
+	// are skipped.
+	DuplicateKeyFirst
+
+	// DuplicateKeyError causes decoding to fail with a DecodeError wrapping ErrDuplicateKey at the
+	// second occurrence of a key.
+	DuplicateKeyError
+)
@@ -35,6 +35,7 @@ func (eic *emptyInterfaceCodec) EncodeValue(ec EncodeContext, vw ValueWriter, va
 	if err != nil {
 		return err
 	}
+	encoder = ec.withDiscriminator(val.Elem().Type(), encoder)
 
 	return encoder.EncodeValue(ec, vw, val.Elem())
 }
@@ -7,8 +7,14 @@
 package bson
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"hash"
+	"io"
 	"reflect"
 	"sync"
+	"time"
 )
 
 // This pool is used to keep the allocations of Encoders down. This is only used for the Marshal*
@@ -20,6 +26,10 @@ var encPool = sync.Pool{
 	},
 }
 
+// ErrEncodeSkipped is returned by Encoder.Encode and Marshal when the value to encode implements
+// EncodeSkipper and its ShouldEncode method returns false. Nothing is written in that case.
+var ErrEncodeSkipped = errors.New("encoding skipped by ShouldEncode")
+
 // An Encoder writes a serialization format to an output stream. It writes to a ValueWriter
 // as the destination of BSON data.
 type Encoder struct {
@@ -35,17 +45,45 @@ func NewEncoder(vw ValueWriter) *Encoder {
 	}
 }
 
+// NewExtJSONEncoder returns a new encoder that writes Extended JSON to w, in canonical mode if
+// canonical is true and in relaxed mode otherwise. Values are encoded by the same codecs as BSON,
+// so struct tags and Encoder options apply, but no intermediate BSON document is created. Each
+// encoded value is followed by a newline.
+func NewExtJSONEncoder(w io.Writer, canonical, escapeHTML bool) *Encoder {
+	return NewEncoder(NewExtJSONValueWriter(w, canonical, escapeHTML))
+}
+
 // Encode writes the BSON encoding of val to the stream.
 //
 // See [Marshal] for details about BSON marshaling behavior.
 func (e *Encoder) Encode(val any) error {
+	if e.ec.postEncodeValidate == nil {
+		return e.encode(e.vw, val)
+	}
+
+	// Encode into a separate buffer so that the document can be validated before anything is
+	// written to the stream.
+	buf := new(bytes.Buffer)
+	if err := e.encode(NewDocumentWriter(buf), val); err != nil {
+		return err
+	}
+	if err := e.ec.postEncodeValidate(buf.Bytes()); err != nil {
+		return err
+	}
+	return copyDocumentFromBytes(e.vw, buf.Bytes())
+}
+
+func (e *Encoder) encode(vw ValueWriter, val any) error {
+	if skipper, ok := val.(EncodeSkipper); ok && !skipper.ShouldEncode() {
+		return ErrEncodeSkipped
+	}
 	if marshaler, ok := val.(Marshaler); ok {
 		// TODO(skriptble): Should we have a MarshalAppender interface so that we can have []byte reuse?
 		buf, err := marshaler.MarshalBSON()
 		if err != nil {
 			return err
 		}
-		return copyDocumentFromBytes(e.vw, buf)
+		return copyDocumentFromBytes(vw, buf)
 	}
 
 	encoder, err := e.ec.LookupEncoder(reflect.TypeOf(val))
@@ -53,7 +91,7 @@ func (e *Encoder) Encode(val any) error {
 		return err
 	}
 
-	return encoder.EncodeValue(e.ec, e.vw, reflect.ValueOf(val))
+	return encoder.EncodeValue(e.ec, vw, reflect.ValueOf(val))
 }
 
 // Reset will reset the state of the Encoder, using the same *EncodeContext used in
@@ -104,6 +142,14 @@ func (e *Encoder) NilByteSliceAsEmpty() {
 	e.ec.nilByteSliceAsEmpty = true
 }
 
+// NilInlineAsZero causes the Encoder to marshal the fields of inline structs that are behind nil
+// pointers (e.g. an embedded *Address that is nil) as the zero values of their types instead of
+// omitting them, so that documents have the same keys whether or not the pointer is set. The
+// "omitempty" and "omitzero" struct tag options still apply to those fields.
+func (e *Encoder) NilInlineAsZero() {
+	e.ec.nilInlineAsZero = true
+}
+
 // TODO(GODRIVER-2820): Update the description to remove the note about only examining exported
 // TODO struct fields once the logic is updated to also inspect private struct fields.
 
@@ -113,8 +159,22 @@ func (e *Encoder) NilByteSliceAsEmpty() {
 //
 // Note that the Encoder only examines exported struct fields when determining if a struct is the
 // zero value. It considers pointers to a zero struct value (e.g. &MyStruct{}) not empty.
+//
+// Fixed-size arrays whose elements are all empty (e.g. [4]byte{}) are also considered empty.
+//
+// OmitZeroStruct is equivalent to SetOmitZeroStruct(true).
 func (e *Encoder) OmitZeroStruct() {
-	e.ec.omitZeroStruct = true
+	e.SetOmitZeroStruct(true)
+}
+
+// SetOmitZeroStruct sets whether the Encoder considers the zero value for a struct empty, as
+// described for OmitZeroStruct. It takes precedence over the default set using
+// Registry.SetOmitZeroStruct and the configuration of the struct codec in either direction, e.g.
+// SetOmitZeroStruct(false) keeps zero structs when encoding through a registry constructed using
+// NewMgoRegistry.
+func (e *Encoder) SetOmitZeroStruct(omit bool) {
+	e.ec.omitZeroStruct = omit
+	e.ec.keepZeroStruct = !omit
 }
 
 // OmitEmpty causes the Encoder to omit empty values from the marshaled BSON as the "omitempty"
@@ -123,6 +183,122 @@ func (e *Encoder) OmitEmpty() {
 	e.ec.omitEmpty = true
 }
 
+// OmitNilPointers causes the Encoder to omit struct fields holding a nil pointer from the marshaled
+// BSON, as if they had the "omitempty" struct tag option. By default, nil pointer fields without
+// "omitempty" are marshaled as BSON null. Nil interface, slice, and map fields are not affected.
+func (e *Encoder) OmitNilPointers() {
+	e.ec.omitNilPointers = true
+}
+
+// EmptyStringAsNull causes the Encoder to marshal struct fields of a string kind holding an empty
+// string as BSON null, e.g. for systems that distinguish a missing value from an empty string.
+// Fields with the "omitempty" struct tag option are still omitted. Strings in slices, maps, and
+// interface values are not affected.
+func (e *Encoder) EmptyStringAsNull() {
+	e.ec.encodeEmptyStringAsNull = true
+}
+
+// IPAsString causes the Encoder to marshal net.IP values as a BSON string holding their canonical
+// representation, e.g. "192.0.2.1", instead of BSON binary holding their bytes. Fields with the
+// "binary" struct tag option are still marshaled as BSON binary. IPs are unmarshaled from either
+// form.
+func (e *Encoder) IPAsString() {
+	e.ec.ipAsString = true
+}
+
+// EscapeKeys causes the Encoder to escape characters that are not allowed in MongoDB field names
+// in the keys of Go maps, including inline maps. Keys are escaped using percent-encoding: every
+// "%" is written as "%25", every "." is written as "%2E" and a leading "$" is written as "%24".
+// The escaping is reversible using Decoder.UnescapeKeys.
+func (e *Encoder) EscapeKeys() {
+	e.ec.escapeKeys = true
+}
+
+// SortMapKeys causes the Encoder to write the elements of Go maps, including inline maps, in
+// ascending byte order of their BSON keys instead of Go's randomized map iteration order, so that
+// encoding the same map always produces the same bytes.
+func (e *Encoder) SortMapKeys() {
+	e.ec.sortMapKeys = true
+}
+
+// SetPostEncodeValidate causes the Encoder to call fn with the BSON bytes of each top-level
+// document it encodes before writing the document to the stream. If fn returns an error, nothing
+// is written and Encode returns the error. fn is not called for embedded documents.
+func (e *Encoder) SetPostEncodeValidate(fn func(raw []byte) error) {
+	e.ec.postEncodeValidate = fn
+}
+
+// SetNameTransformer sets a function that derives the BSON keys of Go struct fields from their
+// names when their struct tag does not set a key, e.g. to use snake_case keys without tagging every
+// field. Keys set by struct tags are not transformed. See NameTransformer for details.
+func (e *Encoder) SetNameTransformer(fn NameTransformer) {
+	e.ec.nameTransformer = fn
+}
+
+// SetContext sets a context that is checked periodically while Go structs are encoded, so that
+// encoding a very large value can be cancelled. Once ctx is done, Encode stops and returns the
+// context's error. The context is checked when each struct starts to be encoded and every 64
+// fields within a struct.
+func (e *Encoder) SetContext(ctx context.Context) {
+	e.ec.ctx = ctx
+}
+
+// SetFieldHook sets a function that is called before each struct field is encoded, e.g. to
+// collect the fields and types written by an application. If fn returns an error, Encode returns
+// it. See FieldHook for details.
+func (e *Encoder) SetFieldHook(fn FieldHook) {
+	e.ec.fieldHook = fn
+}
+
+// SetOmitFunc sets a function that decides whether each struct field is omitted, in addition to the
+// "omitempty" and "omitzero" struct tag options, e.g. to omit fields holding a sentinel value
+// across all structs. See OmitFunc for details.
+func (e *Encoder) SetOmitFunc(fn OmitFunc) {
+	e.ec.omitFunc = fn
+}
+
+// PackArraysOver causes the Encoder to encode slices of types registered using
+// Registry.RegisterPackedSlice as a single BSON binary value holding their elements as packed
+// numbers if they have more than n elements. Smaller slices are encoded as BSON arrays. If n is
+// not positive, which is the default, all such slices are encoded as BSON arrays.
+func (e *Encoder) PackArraysOver(n int) {
+	e.ec.packArraysOver = n
+}
+
+// SetUUIDSubtype causes the Encoder to encode [16]byte values, including named types such as UUID
+// types defined as [16]byte, as BSON binary with the given subtype, which must be TypeBinaryUUID or
+// TypeBinaryUUIDOld for compatibility with legacy drivers. It also sets the subtype of fields with
+// the "bsontype=uuid" struct tag option. By default, [16]byte values are encoded with the generic
+// binary subtype. Values with either UUID subtype are always decoded into [16]byte values.
+func (e *Encoder) SetUUIDSubtype(subtype byte) {
+	e.ec.uuidSubtype = subtype
+}
+
+// SetDecimalRounding sets how the Encoder encodes *big.Rat and *big.Float values that cannot be
+// represented exactly as a Decimal128, which holds at most 34 significant decimal digits. By
+// default, which is DecimalRoundingError, encoding such a value, e.g. 1/3, returns an error
+// wrapping ErrInexactDecimal128. DecimalRoundHalfEven rounds it to 34 significant digits instead.
+func (e *Encoder) SetDecimalRounding(rounding DecimalRounding) {
+	e.ec.decimalRounding = rounding
+}
+
+// SetHashFunc sets the hash used to compute the values of struct fields with the
+// "hashof=<key>|<key>" struct tag option. The hash is computed over a BSON document holding the
+// encoded elements of the listed fields in the listed order, skipping omitted fields. If newHash
+// is nil, which is the default, SHA-256 is used.
+func (e *Encoder) SetHashFunc(newHash func() hash.Hash) {
+	e.ec.newHash = newHash
+}
+
+// SetTTL causes the Encoder to write a companion expiry after each struct field that has the
+// "ttlkey=<key>" struct tag option. The expiry is a BSON datetime written under <key> holding the
+// time returned by now plus ttl. If now is nil, time.Now is used. If ttl is not positive, no
+// expiries are written and companion fields are marshaled as ordinary fields.
+func (e *Encoder) SetTTL(ttl time.Duration, now func() time.Time) {
+	e.ec.ttl = ttl
+	e.ec.now = now
+}
+
 // UseJSONStructTags causes the Encoder to fall back to using the "json" struct tag if a "bson"
 // struct tag is not specified.
 func (e *Encoder) UseJSONStructTags() {
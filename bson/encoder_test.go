@@ -8,6 +8,7 @@ package bson
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"reflect"
 	"testing"
@@ -135,6 +136,15 @@ func (stringerTest) String() string {
 	return "test key"
 }
 
+var errMissingID = errors.New("missing _id")
+
+func requireIDValidator(raw []byte) error {
+	if _, err := Raw(raw).LookupErr("_id"); err != nil {
+		return errMissingID
+	}
+	return nil
+}
+
 func TestEncoderConfiguration(t *testing.T) {
 	type inlineDuplicateInner struct {
 		Duplicate string
@@ -149,6 +159,16 @@ func TestEncoderConfiguration(t *testing.T) {
 		MyString string
 	}
 
+	type nilInlineLeaf struct {
+		City string `bson:"city"`
+		Zip  int32  `bson:"zip,omitempty"`
+	}
+
+	type nilInlineMiddle struct {
+		Street string         `bson:"street"`
+		Leaf   *nilInlineLeaf `bson:",inline"`
+	}
+
 	testCases := []struct {
 		description string
 		configure   func(*Encoder)
@@ -262,6 +282,25 @@ func TestEncoderConfiguration(t *testing.T) {
 			}{},
 			want: bsoncore.NewDocumentBuilder().Build(),
 		},
+		// Test that NilInlineAsZero marshals the fields of inline structs behind a chain of nil
+		// pointers as zero values, still applying "omitempty".
+		{
+			description: "NilInlineAsZero",
+			configure: func(enc *Encoder) {
+				enc.NilInlineAsZero()
+			},
+			input: struct {
+				Name   string           `bson:"name"`
+				Middle *nilInlineMiddle `bson:",inline"`
+			}{
+				Name: "test value",
+			},
+			want: bsoncore.NewDocumentBuilder().
+				AppendString("name", "test value").
+				AppendString("street", "").
+				AppendString("city", "").
+				Build(),
+		},
 		// Test that OmitEmpty omits empty values from the marshaled document.
 		{
 			description: "OmitEmpty",
@@ -285,6 +324,149 @@ func TestEncoderConfiguration(t *testing.T) {
 			},
 			want: bsoncore.NewDocumentBuilder().Build(),
 		},
+		// Test that nil pointer fields without "omitempty" are marshaled as BSON null by default.
+		{
+			description: "nil pointers as null",
+			configure:   func(*Encoder) {},
+			input: struct {
+				Pointer *int
+				Any     any
+			}{},
+			want: bsoncore.NewDocumentBuilder().
+				AppendNull("Pointer").
+				AppendNull("Any").
+				Build(),
+		},
+		// Test that OmitNilPointers omits nil pointer fields, including in nested structs, but
+		// not nil interface fields or non-nil pointers.
+		{
+			description: "OmitNilPointers",
+			configure: func(enc *Encoder) {
+				enc.OmitNilPointers()
+			},
+			input: struct {
+				Pointer *int
+				Set     *int
+				Any     any
+				Nested  struct {
+					Pointer *string
+					Name    string
+				}
+			}{
+				Set: new(int),
+			},
+			want: bsoncore.NewDocumentBuilder().
+				AppendInt32("Set", 0).
+				AppendNull("Any").
+				AppendDocument("Nested", bsoncore.NewDocumentBuilder().
+					AppendString("Name", "").
+					Build()).
+				Build(),
+		},
+		// Test that EmptyStringAsNull writes empty string fields as BSON null, including in nested
+		// structs, but omits empty fields with "omitempty".
+		{
+			description: "EmptyStringAsNull",
+			configure: func(enc *Encoder) {
+				enc.EmptyStringAsNull()
+			},
+			input: struct {
+				Empty     string
+				OmitEmpty string `bson:",omitempty"`
+				Set       string
+				Nested    struct {
+					Empty string
+				}
+			}{
+				Set: "a",
+			},
+			want: bsoncore.NewDocumentBuilder().
+				AppendNull("Empty").
+				AppendString("Set", "a").
+				AppendDocument("Nested", bsoncore.NewDocumentBuilder().
+					AppendNull("Empty").
+					Build()).
+				Build(),
+		},
+		// Test that EscapeKeys escapes reserved characters in map and inline map keys.
+		{
+			description: "EscapeKeys",
+			configure: func(enc *Encoder) {
+				enc.EscapeKeys()
+			},
+			input: struct {
+				Map    map[string]int `bson:"map"`
+				Inline map[string]int `bson:",inline"`
+			}{
+				Map:    map[string]int{"a.b": 1},
+				Inline: map[string]int{"$c%": 2},
+			},
+			want: bsoncore.NewDocumentBuilder().
+				AppendDocument("map", bsoncore.NewDocumentBuilder().
+					AppendInt32("a%2Eb", 1).
+					Build()).
+				AppendInt32("%24c%25", 2).
+				Build(),
+		},
+		// Test that SortMapKeys writes map and inline map elements in ascending key order.
+		{
+			description: "SortMapKeys",
+			configure: func(enc *Encoder) {
+				enc.SortMapKeys()
+			},
+			input: struct {
+				Map    map[string]any   `bson:"map"`
+				Ints   map[int]int      `bson:"ints"`
+				Inline map[string]int32 `bson:",inline"`
+			}{
+				Map:    map[string]any{"b": 1, "a": 2, "d": M{"z": 3, "y": 4}, "c": 5},
+				Ints:   map[int]int{3: 3, 10: 10, 1: 1, 2: 2},
+				Inline: map[string]int32{"x": 1, "w": 2, "v": 3},
+			},
+			want: bsoncore.NewDocumentBuilder().
+				AppendDocument("map", bsoncore.NewDocumentBuilder().
+					AppendInt32("a", 2).
+					AppendInt32("b", 1).
+					AppendInt32("c", 5).
+					AppendDocument("d", bsoncore.NewDocumentBuilder().
+						AppendInt32("y", 4).
+						AppendInt32("z", 3).
+						Build()).
+					Build()).
+				AppendDocument("ints", bsoncore.NewDocumentBuilder().
+					AppendInt32("1", 1).
+					AppendInt32("10", 10).
+					AppendInt32("2", 2).
+					AppendInt32("3", 3).
+					Build()).
+				AppendInt32("v", 3).
+				AppendInt32("w", 2).
+				AppendInt32("x", 1).
+				Build(),
+		},
+		// Test that SetPostEncodeValidate runs the validator on the top-level document only.
+		{
+			description: "SetPostEncodeValidate",
+			configure: func(enc *Encoder) {
+				enc.SetPostEncodeValidate(requireIDValidator)
+			},
+			input: D{{"_id", 1}, {"nested", D{{"a", 2}}}},
+			want: bsoncore.NewDocumentBuilder().
+				AppendInt32("_id", 1).
+				AppendDocument("nested", bsoncore.NewDocumentBuilder().
+					AppendInt32("a", 2).
+					Build()).
+				Build(),
+		},
+		// Test that an error returned by the SetPostEncodeValidate validator aborts the encode.
+		{
+			description: "SetPostEncodeValidate error",
+			configure: func(enc *Encoder) {
+				enc.SetPostEncodeValidate(requireIDValidator)
+			},
+			input:   D{{"a", 1}},
+			wantErr: errMissingID,
+		},
 		// Test that UseJSONStructTags causes the Encoder to fall back to "json" struct tags if
 		// "bson" struct tags are not available.
 		{
@@ -338,3 +520,125 @@ func TestEncoderConfiguration(t *testing.T) {
 		})
 	}
 }
+
+func TestEncoderSetContext(t *testing.T) {
+	t.Parallel()
+
+	type node struct {
+		Name     string `bson:"name"`
+		Children []node `bson:"children,omitempty"`
+	}
+
+	tree := node{Name: "root"}
+	for i := 0; i < 10; i++ {
+		tree.Children = append(tree.Children, node{Name: "child"})
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		enc := NewEncoder(NewDocumentWriter(new(bytes.Buffer)))
+		enc.SetContext(ctx)
+		err := enc.Encode(tree)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+	t.Run("cancelled while encoding", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var encoded int
+		enc := NewEncoder(NewDocumentWriter(new(bytes.Buffer)))
+		enc.SetContext(ctx)
+		enc.SetFieldHook(func(key, _ string, _ reflect.Type) error {
+			if key == "name" {
+				encoded++
+				if encoded == 3 {
+					cancel()
+				}
+			}
+			return nil
+		})
+		err := enc.Encode(tree)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 3, encoded)
+	})
+	t.Run("not cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetContext(context.Background())
+		require.NoError(t, enc.Encode(tree), "Encode error")
+		assert.Equal(t, mustMarshal(t, tree), buf.Bytes())
+	})
+}
+
+func TestExtJSONEncoderDecoder(t *testing.T) {
+	t.Parallel()
+
+	type item struct {
+		ID      ObjectID  `bson:"_id"`
+		Name    string    `bson:"name"`
+		Count   int64     `bson:"count"`
+		Ratio   float64   `bson:"ratio"`
+		Created time.Time `bson:"created"`
+		Note    string    `bson:"note,omitempty"`
+		Skipped string    `bson:"-"`
+	}
+
+	oid, err := ObjectIDFromHex("5ef7fdd91c19e3222b41b839")
+	require.NoError(t, err)
+	val := item{
+		ID:      oid,
+		Name:    "widget",
+		Count:   42,
+		Ratio:   1.5,
+		Created: time.Date(2020, 6, 28, 0, 0, 0, 0, time.UTC),
+		Skipped: "skipped",
+	}
+
+	testCases := []struct {
+		name      string
+		canonical bool
+		want      string
+	}{
+		{
+			name:      "canonical",
+			canonical: true,
+			want: `{"_id":{"$oid":"5ef7fdd91c19e3222b41b839"},"name":"widget",` +
+				`"count":{"$numberLong":"42"},"ratio":{"$numberDouble":"1.5"},` +
+				`"created":{"$date":{"$numberLong":"1593302400000"}}}` + "\n",
+		},
+		{
+			name:      "relaxed",
+			canonical: false,
+			want: `{"_id":{"$oid":"5ef7fdd91c19e3222b41b839"},"name":"widget",` +
+				`"count":42,"ratio":1.5,"created":{"$date":"2020-06-28T00:00:00Z"}}` + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := new(bytes.Buffer)
+			err := NewExtJSONEncoder(buf, tc.canonical, false).Encode(val)
+			require.NoError(t, err, "Encode error")
+			assert.Equal(t, tc.want, buf.String(), "expected and actual Extended JSON do not match")
+
+			dec, err := NewExtJSONDecoder(buf, tc.canonical)
+			require.NoError(t, err, "NewExtJSONDecoder error")
+			var got item
+			err = dec.Decode(&got)
+			require.NoError(t, err, "Decode error")
+
+			want := val
+			want.Skipped = ""
+			assert.Equal(t, want, got, "expected and actual decoded values do not match")
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// UnknownEnumPolicy is how decoders handle BSON values that are not known values of the enum type
+// they are decoded into. It is set using Decoder.SetUnknownEnumPolicy and can be read by custom
+// decoders using DecodeContext.UnknownEnums.
+type UnknownEnumPolicy int
+
+// These constants are the supported UnknownEnumPolicy values.
+const (
+	// UnknownEnumError causes decoding an unknown enum value to return an error. It is the
+	// default.
+	UnknownEnumError UnknownEnumPolicy = iota
+
+	// UnknownEnumZero causes an unknown enum value to be decoded as the zero value of the enum
+	// type.
+	UnknownEnumZero
+
+	// UnknownEnumSkip causes an unknown enum value to be skipped, leaving the destination
+	// unchanged.
+	UnknownEnumSkip
+)
+
+// UnknownEnums returns how an enum decoder should handle values that are not known values of its
+// enum type, e.g. strings that do not match a constant of an integer enum type.
+func (dc DecodeContext) UnknownEnums() UnknownEnumPolicy {
+	return dc.unknownEnums
+}
+
+// stringEnumCodec is the Codec registered for a string type by Registry.RegisterStringEnum. It only
+// encodes and decodes the registered values of the type.
+type stringEnumCodec struct {
+	t           reflect.Type
+	allowed     map[string]struct{}
+	fallback    string
+	hasFallback bool
+}
+
+// enumError returns the error for an invalid value of the enum type, naming the struct field that
+// holds the value if it is known.
+func (sec *stringEnumCodec) enumError(fc FieldContext, str string) error {
+	if _, field, ok := fc.Owner(); ok {
+		return fmt.Errorf("invalid value %q for enum %s in field %s", str, sec.t, field)
+	}
+	return fmt.Errorf("invalid value %q for enum %s", str, sec.t)
+}
+
+// EncodeValue is the ValueEncoder for string enum types. It returns an error if val is not one of
+// the registered values.
+func (sec *stringEnumCodec) EncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != sec.t {
+		return ValueEncoderError{Name: "StringEnumEncodeValue", Types: []reflect.Type{sec.t}, Received: val}
+	}
+
+	str := val.String()
+	if _, ok := sec.allowed[str]; !ok {
+		return sec.enumError(ec, str)
+	}
+	return vw.WriteString(str)
+}
+
+// DecodeValue is the ValueDecoder for string enum types. A string that is not one of the registered
+// values decodes to the fallback value if one is registered and is otherwise handled according to
+// the UnknownEnumPolicy of dc. BSON null and undefined values decode to the zero value.
+func (sec *stringEnumCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != sec.t {
+		return ValueDecoderError{Name: "StringEnumDecodeValue", Types: []reflect.Type{sec.t}, Received: val}
+	}
+
+	isNull := vr.Type() == TypeNull || vr.Type() == TypeUndefined
+	elem, err := (&stringCodec{}).decodeType(dc, vr, sec.t)
+	if err != nil {
+		return err
+	}
+
+	str := elem.String()
+	if _, ok := sec.allowed[str]; !ok && !isNull {
+		switch {
+		case sec.hasFallback:
+			str = sec.fallback
+		case dc.unknownEnums == UnknownEnumZero:
+			str = ""
+		case dc.unknownEnums == UnknownEnumSkip:
+			return nil
+		default:
+			return sec.enumError(dc, str)
+		}
+	}
+
+	val.SetString(str)
+	return nil
+}
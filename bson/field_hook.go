@@ -0,0 +1,43 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"reflect"
+)
+
+// FieldHook is called by the struct codec before each struct field is encoded or decoded, with the
+// BSON key of the field, the name of the Go struct field, and the type of the Go value. It is set
+// using Encoder.SetFieldHook or Decoder.SetFieldHook. If it returns an error, encoding or decoding
+// stops and the error is returned.
+//
+// Fields of nested structs are reported with their own key, not the full path. Fields encoded as
+// BSON null because they hold a nil value are reported with the type of the struct field, glob
+// fields with their pattern as the key, and synthetic fields added by an OnDescribeFunc with the
+// type of the struct being encoded. Elements of inline maps are not reported.
+type FieldHook func(key, fieldName string, t reflect.Type) error
+
+// encodeFieldHook calls the FieldHook of ec, if it is set, for the field described by desc
+// holding a value of type t.
+func encodeFieldHook(ec EncodeContext, desc fieldDescription, t reflect.Type) error {
+	if ec.fieldHook == nil {
+		return nil
+	}
+	if err := ec.fieldHook(desc.name, desc.fieldName, t); err != nil {
+		return newFieldEncodeError(desc.name, desc.fieldName, err)
+	}
+	return nil
+}
+
+// OmitFunc is called by the struct codec before each struct field is encoded, with the name of the
+// Go struct field and its value, after the "omitempty" and "omitzero" struct tag options have been
+// applied. It is set using Encoder.SetOmitFunc. If it returns true, the field is not encoded, e.g.
+// to omit every string equal to "N/A" without registering a codec for each field.
+//
+// Fields of nested structs are reported with their own name, not the full path. Elements of inline
+// maps and fields encoded as BSON null because they hold a nil value are not reported.
+type OmitFunc func(fieldName string, v reflect.Value) bool
@@ -0,0 +1,200 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
+	"go.mongodb.org/mongo-driver/v2/internal/require"
+)
+
+type fieldHookAddress struct {
+	City string `bson:"city"`
+}
+
+type fieldHookUser struct {
+	Name    string           `bson:"name"`
+	Age     int32            `bson:"age"`
+	Address fieldHookAddress `bson:"address"`
+}
+
+type fieldHookEvent struct {
+	key, fieldName string
+	t              reflect.Type
+}
+
+func TestFieldHook(t *testing.T) {
+	t.Parallel()
+
+	user := fieldHookUser{Name: "ada", Age: 36, Address: fieldHookAddress{City: "London"}}
+	want := []fieldHookEvent{
+		{"name", "Name", tString},
+		{"age", "Age", tInt32},
+		{"address", "Address", reflect.TypeOf(fieldHookAddress{})},
+		{"city", "City", tString},
+	}
+
+	t.Run("encode", func(t *testing.T) {
+		t.Parallel()
+
+		var got []fieldHookEvent
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetFieldHook(func(key, fieldName string, t reflect.Type) error {
+			got = append(got, fieldHookEvent{key, fieldName, t})
+			return nil
+		})
+		require.NoError(t, enc.Encode(user), "Encode error")
+		assert.Equal(t, want, got)
+	})
+	t.Run("decode", func(t *testing.T) {
+		t.Parallel()
+
+		var got []fieldHookEvent
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(mustMarshal(t, user))))
+		dec.SetFieldHook(func(key, fieldName string, t reflect.Type) error {
+			got = append(got, fieldHookEvent{key, fieldName, t})
+			return nil
+		})
+		var decoded fieldHookUser
+		require.NoError(t, dec.Decode(&decoded), "Decode error")
+		assert.Equal(t, want, got)
+		assert.Equal(t, user, decoded)
+	})
+	t.Run("encode abort", func(t *testing.T) {
+		t.Parallel()
+
+		errDrift := errors.New("unexpected field")
+		enc := NewEncoder(NewDocumentWriter(new(bytes.Buffer)))
+		enc.SetFieldHook(func(key, _ string, _ reflect.Type) error {
+			if key == "age" {
+				return errDrift
+			}
+			return nil
+		})
+		err := enc.Encode(user)
+		assert.ErrorIs(t, err, errDrift)
+	})
+	t.Run("encode special fields", func(t *testing.T) {
+		t.Parallel()
+
+		type record struct {
+			Name    *string            `bson:"name"`
+			Metrics map[string]float64 `bson:"metric_*,glob"`
+			Hash    string             `bson:"_hash,hashof=name"`
+		}
+
+		var got []fieldHookEvent
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetFieldHook(func(key, fieldName string, t reflect.Type) error {
+			got = append(got, fieldHookEvent{key, fieldName, t})
+			return nil
+		})
+		require.NoError(t, enc.Encode(record{Metrics: map[string]float64{"metric_avg": 1}}), "Encode error")
+		want := []fieldHookEvent{
+			{"name", "Name", reflect.TypeOf((*string)(nil))},
+			{"metric_*", "Metrics", reflect.TypeOf(map[string]float64{})},
+			{"_hash", "Hash", tString},
+		}
+		assert.Equal(t, want, got)
+	})
+	t.Run("decode abort", func(t *testing.T) {
+		t.Parallel()
+
+		errDrift := errors.New("unexpected field")
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(mustMarshal(t, user))))
+		dec.SetFieldHook(func(key, _ string, _ reflect.Type) error {
+			if key == "city" {
+				return errDrift
+			}
+			return nil
+		})
+		err := dec.Decode(&fieldHookUser{})
+		var de *DecodeError
+		require.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"address", "city"}, de.Keys())
+		assert.ErrorIs(t, err, errDrift)
+	})
+}
+
+func TestOmitFunc(t *testing.T) {
+	t.Parallel()
+
+	type contact struct {
+		Name  string  `bson:"name"`
+		Phone string  `bson:"phone"`
+		Email string  `bson:"email,omitempty"`
+		Score float64 `bson:"score"`
+	}
+
+	omitNA := func(_ string, v reflect.Value) bool {
+		return v.Kind() == reflect.String && v.String() == "N/A"
+	}
+
+	testCases := []struct {
+		name string
+		fn   OmitFunc
+		val  contact
+		want D
+	}{
+		{
+			name: "sentinel",
+			fn:   omitNA,
+			val:  contact{Name: "ada", Phone: "N/A", Email: "N/A", Score: 1},
+			want: D{{"name", "ada"}, {"score", 1.0}},
+		},
+		{
+			name: "omitempty applied first",
+			fn:   omitNA,
+			val:  contact{Name: "N/A"},
+			want: D{{"phone", ""}, {"score", 0.0}},
+		},
+		{
+			name: "field name",
+			fn:   func(fieldName string, _ reflect.Value) bool { return fieldName == "Score" },
+			val:  contact{Name: "ada", Phone: "1", Score: 1},
+			want: D{{"name", "ada"}, {"phone", "1"}},
+		},
+		{
+			name: "nil",
+			val:  contact{Name: "ada", Phone: "N/A"},
+			want: D{{"name", "ada"}, {"phone", "N/A"}, {"score", 0.0}},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := new(bytes.Buffer)
+			enc := NewEncoder(NewDocumentWriter(buf))
+			enc.SetOmitFunc(tc.fn)
+			require.NoError(t, enc.Encode(tc.val), "Encode error")
+			assert.Equal(t, mustMarshal(t, tc.want), buf.Bytes())
+		})
+	}
+	t.Run("nested", func(t *testing.T) {
+		t.Parallel()
+
+		type outer struct {
+			Contact contact `bson:"contact"`
+			Note    string  `bson:"note"`
+		}
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetOmitFunc(omitNA)
+		require.NoError(t, enc.Encode(outer{Contact: contact{Name: "N/A", Phone: "1"}, Note: "N/A"}), "Encode error")
+		want := D{{"contact", D{{"phone", "1"}, {"score", 0.0}}}}
+		assert.Equal(t, mustMarshal(t, want), buf.Bytes())
+	})
+}
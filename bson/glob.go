@@ -0,0 +1,87 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+// globToken is a single element of a glob pattern accepted by path.Match.
+type globToken struct {
+	star    bool // "*", which matches any sequence of characters
+	any     bool // "?" or a character class, which match a single character
+	literal rune
+}
+
+// tokenizeGlob splits a valid glob pattern into tokens. Character classes are treated as matching
+// any character.
+func tokenizeGlob(pattern string) []globToken {
+	var tokens []globToken
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '*':
+			tokens = append(tokens, globToken{star: true})
+		case '?':
+			tokens = append(tokens, globToken{any: true})
+		case '[':
+			for i < len(runes) && runes[i] != ']' {
+				if runes[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			tokens = append(tokens, globToken{any: true})
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+			tokens = append(tokens, globToken{literal: runes[i]})
+		default:
+			tokens = append(tokens, globToken{literal: runes[i]})
+		}
+	}
+	return tokens
+}
+
+// globsOverlap reports whether there may be a string matched by both of the glob patterns a and b.
+// Because character classes are treated as matching any character, it can report an overlap for
+// patterns that do not overlap, but it never misses one.
+func globsOverlap(a, b string) bool {
+	ta, tb := tokenizeGlob(a), tokenizeGlob(b)
+
+	// memo[i][j] caches the result for ta[i:] and tb[j:]: 0 if unknown, 1 if they overlap and
+	// 2 if they do not.
+	memo := make([][]uint8, len(ta)+1)
+	for i := range memo {
+		memo[i] = make([]uint8, len(tb)+1)
+	}
+
+	var overlap func(i, j int) bool
+	overlap = func(i, j int) bool {
+		if memo[i][j] != 0 {
+			return memo[i][j] == 1
+		}
+
+		var res bool
+		switch {
+		case i == len(ta) && j == len(tb):
+			res = true
+		case i < len(ta) && ta[i].star:
+			res = overlap(i+1, j) || (j < len(tb) && overlap(i, j+1))
+		case j < len(tb) && tb[j].star:
+			res = overlap(i, j+1) || (i < len(ta) && overlap(i+1, j))
+		case i == len(ta) || j == len(tb):
+			res = false
+		default:
+			res = (ta[i].any || tb[j].any || ta[i].literal == tb[j].literal) && overlap(i+1, j+1)
+		}
+
+		memo[i][j] = 2
+		if res {
+			memo[i][j] = 1
+		}
+		return res
+	}
+	return overlap(0, 0)
+}
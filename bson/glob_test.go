@@ -0,0 +1,43 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
+)
+
+func TestGlobsOverlap(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "metric_*", b: "metric_*", want: true},
+		{a: "metric_*", b: "*_max", want: true},
+		{a: "metric_*", b: "stat_*", want: false},
+		{a: "a?c", b: "abc", want: true},
+		{a: "a?c", b: "abd", want: false},
+		{a: "a*", b: "b*", want: false},
+		{a: "*x", b: "*y", want: false},
+		{a: "[ab]c", b: "zc", want: true},
+		{a: `a\*`, b: "ab", want: false},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // Capture range variable.
+
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.want, globsOverlap(tc.a, tc.b))
+			assert.Equal(t, tc.want, globsOverlap(tc.b, tc.a))
+		})
+	}
+}
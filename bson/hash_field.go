@@ -0,0 +1,125 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// ErrHashMismatch is wrapped by the error returned when a Decoder with VerifyHashes set decodes a
+// document whose stored "hashof" field does not match the hash of the fields it covers.
+var ErrHashMismatch = errors.New("stored hash does not match the hashed fields")
+
+// describeHashOf validates the fields hashed by fd, which has the "hashof" struct tag option, and
+// marks them as hashed so that their encoded values are captured. Each hashed field must be
+// written before fd.
+func describeHashOf(t reflect.Type, sd *structDescription, fi int, fd fieldDescription) error {
+	for _, key := range fd.hashOf {
+		other, ok := sd.fm[key]
+		if !ok {
+			return fmt.Errorf("(struct %s) hashof key %s of field %s does not exist", t.String(), key, fd.fieldName)
+		}
+		if other.projector != nil || other.synthetic || other.mirrored || other.ttlCompanion {
+			return fmt.Errorf("(struct %s) field %s cannot be hashed by field %s", t.String(), other.fieldName, fd.fieldName)
+		}
+		oi := -1
+		for i := range sd.fl {
+			if sd.fl[i].name == key {
+				oi = i
+			}
+		}
+		if oi >= fi {
+			return fmt.Errorf("(struct %s) hashed field %s must come before field %s", t.String(), other.fieldName, fd.fieldName)
+		}
+		sd.fl[oi].hashed = true
+		other.hashed = true
+		sd.fm[key] = other
+	}
+	return nil
+}
+
+// encodeToBytes encodes rv with encoder and returns the BSON type and bytes of the encoded value.
+func encodeToBytes(ec EncodeContext, encoder ValueEncoder, rv reflect.Value) (Type, []byte, error) {
+	buf := new(bytes.Buffer)
+	dw := newDocumentWriter(buf)
+	vw, err := dw.WriteDocumentElement("")
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := encoder.EncodeValue(ec, vw, rv); err != nil {
+		return 0, nil, err
+	}
+	if err := dw.Flush(); err != nil {
+		return 0, nil, err
+	}
+	// The buffer holds the value type, the empty element name, and the value bytes.
+	data := buf.Bytes()
+	return Type(data[0]), data[2:], nil
+}
+
+// fieldHash returns the BSON value of the "hashof" field described by fd. The hash is computed by
+// newHash, or SHA-256 if newHash is nil, over a BSON document holding the hashed elements present
+// in values in the order of the struct tag option. It is a hex string if the field is a string and
+// binary otherwise.
+func fieldHash(newHash func() hash.Hash, fd fieldDescription, values map[string]RawValue) (Type, []byte, error) {
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	for _, key := range fd.hashOf {
+		v, ok := values[key]
+		if !ok {
+			continue
+		}
+		doc = bsoncore.AppendHeader(doc, bsoncore.Type(v.Type), key)
+		doc = append(doc, v.Value...)
+	}
+	doc, err := bsoncore.AppendDocumentEnd(doc, idx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if newHash == nil {
+		newHash = sha256.New
+	}
+	h := newHash()
+	_, _ = h.Write(doc)
+	sum := h.Sum(nil)
+	if fd.hashString {
+		return TypeString, bsoncore.AppendString(nil, hex.EncodeToString(sum)), nil
+	}
+	return TypeBinary, bsoncore.AppendBinary(nil, TypeBinaryGeneric, sum), nil
+}
+
+// verifyHashes compares the stored values of the "hashof" fields of sd in values with the hashes
+// of the hashed fields in values. Fields without a stored value are not verified.
+func verifyHashes(dc DecodeContext, sd *structDescription, values map[string]RawValue) error {
+	for _, fd := range sd.fl {
+		if fd.hashOf == nil {
+			continue
+		}
+		stored, ok := values[fd.name]
+		if !ok {
+			continue
+		}
+		t, data, err := fieldHash(dc.newHash, fd, values)
+		if err != nil {
+			return newFieldDecodeError(fd.name, fd.fieldName, err)
+		}
+		if stored.Type != t || !bytes.Equal(stored.Value, data) {
+			err := fmt.Errorf("%w %s", ErrHashMismatch, strings.Join(fd.hashOf, ", "))
+			return newFieldDecodeError(fd.name, fd.fieldName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// inlineRawDocument accumulates the elements of a document that do not match a struct field into
+// the inline Raw field of the struct.
+type inlineRawDocument struct {
+	idx int32
+	doc []byte
+}
+
+// appendElement copies the value read from vr into the document under key without decoding it.
+func (ird *inlineRawDocument) appendElement(key string, vr ValueReader) error {
+	bt, data, err := copyValueToBytes(vr)
+	if err != nil {
+		return err
+	}
+	if ird.doc == nil {
+		ird.idx, ird.doc = bsoncore.AppendDocumentStart(nil)
+	}
+	ird.doc = bsoncore.AppendHeader(ird.doc, bsoncore.Type(bt), key)
+	ird.doc = append(ird.doc, data...)
+	return nil
+}
+
+// finish returns the accumulated document, or nil if no element was appended.
+func (ird *inlineRawDocument) finish() (Raw, error) {
+	if ird.doc == nil {
+		return nil, nil
+	}
+	return bsoncore.AppendDocumentEnd(ird.doc, ird.idx)
+}
+
+// encodeInlineRaw writes the elements of the inline Raw field raw to dw in order, copying their
+// values verbatim. It returns an error if the key of an element collides with a struct field.
+func encodeInlineRaw(dw DocumentWriter, raw Raw, collisionFn func(string) bool) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	elems, err := raw.Elements()
+	if err != nil {
+		return err
+	}
+	for _, elem := range elems {
+		key := elem.Key()
+		if collisionFn != nil && collisionFn(key) {
+			return fmt.Errorf("Key %s of inlined Raw conflicts with a struct field name", key)
+		}
+		vw, err := dw.WriteDocumentElement(key)
+		if err != nil {
+			return err
+		}
+		val := elem.Value()
+		if err := copyValueFromBytes(vw, val.Type, val.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
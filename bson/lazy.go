@@ -0,0 +1,126 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"reflect"
+)
+
+// Lazy holds a value of type T that is decoded from BSON only when it is first accessed. When a
+// Lazy is unmarshaled, the raw BSON value is stored without being decoded. The first call to Get
+// decodes the raw value into a T using the Registry and options that were used to unmarshal the
+// Lazy.
+//
+// When a Lazy is marshaled, the stored raw value is copied as-is if the value has not been
+// accessed or replaced with Set. Otherwise, the current value is encoded.
+//
+// Lazy is useful for large sub-documents that are rarely accessed. A Lazy is not safe for
+// concurrent use by multiple goroutines.
+type Lazy[T any] struct {
+	raw    RawValue
+	dc     DecodeContext
+	val    T
+	loaded bool
+}
+
+// lazyEncoder is implemented by Lazy values and lazyDecoder is implemented by pointers to Lazy
+// values. They allow Lazy values of any type parameter to be encoded and decoded by the same codec.
+type lazyEncoder interface {
+	encodeLazy(ec EncodeContext, vw ValueWriter) error
+}
+
+type lazyDecoder interface {
+	setRaw(dc DecodeContext, raw RawValue)
+}
+
+var tLazyEncoder = reflect.TypeOf((*lazyEncoder)(nil)).Elem()
+var tLazyDecoder = reflect.TypeOf((*lazyDecoder)(nil)).Elem()
+
+// NewLazy returns a Lazy that holds v.
+func NewLazy[T any](v T) Lazy[T] {
+	return Lazy[T]{val: v, loaded: true}
+}
+
+// Get returns the value held by l, decoding it from the stored raw BSON value on the first call.
+// If decoding fails, the error is returned and the next call to Get tries again.
+func (l *Lazy[T]) Get() (T, error) {
+	if l.loaded || l.raw.Type == Type(0) {
+		return l.val, nil
+	}
+
+	var v T
+	rval := reflect.ValueOf(&v).Elem()
+	dec, err := l.dc.LookupDecoder(rval.Type())
+	if err != nil {
+		return v, err
+	}
+	vr := newBufferedValueReader(l.raw.Type, l.raw.Value)
+	if err := dec.DecodeValue(l.dc, vr, rval); err != nil {
+		return v, err
+	}
+
+	l.val, l.loaded = v, true
+	l.raw = RawValue{}
+	return l.val, nil
+}
+
+// Set replaces the value held by l with v, discarding any stored raw BSON value.
+func (l *Lazy[T]) Set(v T) {
+	l.val, l.loaded = v, true
+	l.raw = RawValue{}
+}
+
+// Loaded reports whether the value held by l has been decoded or set.
+func (l *Lazy[T]) Loaded() bool {
+	return l.loaded
+}
+
+func (l *Lazy[T]) setRaw(dc DecodeContext, raw RawValue) {
+	var zero T
+	l.raw, l.dc = raw, dc
+	l.val, l.loaded = zero, false
+}
+
+func (l Lazy[T]) encodeLazy(ec EncodeContext, vw ValueWriter) error {
+	if !l.loaded && l.raw.Type != Type(0) {
+		return copyValueFromBytes(vw, l.raw.Type, l.raw.Value)
+	}
+
+	rval := reflect.ValueOf(&l.val).Elem()
+	enc, err := ec.LookupEncoder(rval.Type())
+	if err != nil {
+		return err
+	}
+	return enc.EncodeValue(ec, vw, rval)
+}
+
+// lazyEncodeValue is the ValueEncoderFunc for Lazy values.
+func lazyEncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || !val.Type().Implements(tLazyEncoder) {
+		return ValueEncoderError{Name: "LazyEncodeValue", Types: []reflect.Type{tLazyEncoder}, Received: val}
+	}
+	if val.Kind() == reflect.Ptr && val.IsNil() {
+		return vw.WriteNull()
+	}
+	return val.Interface().(lazyEncoder).encodeLazy(ec, vw)
+}
+
+// lazyDecodeValue is the ValueDecoderFunc for Lazy values. It stores the raw BSON value without
+// decoding it.
+func lazyDecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	if !val.IsValid() || !val.CanAddr() || !reflect.PtrTo(val.Type()).Implements(tLazyDecoder) {
+		return ValueDecoderError{Name: "LazyDecodeValue", Types: []reflect.Type{tLazyDecoder}, Received: val}
+	}
+
+	t, value, err := copyValueToBytes(vr)
+	if err != nil {
+		return err
+	}
+
+	val.Addr().Interface().(lazyDecoder).setRaw(dc, RawValue{Type: t, Value: value})
+	return nil
+}
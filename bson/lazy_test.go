@@ -0,0 +1,77 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
+	"go.mongodb.org/mongo-driver/v2/internal/require"
+)
+
+func TestLazy(t *testing.T) {
+	t.Parallel()
+
+	type details struct {
+		Color string `bson:"color"`
+	}
+	type record struct {
+		Name    string        `bson:"name"`
+		Details Lazy[details] `bson:"details"`
+	}
+
+	doc, err := Marshal(D{{"name", "widget"}, {"details", D{{"color", "red"}, {"extra", int32(1)}}}})
+	require.NoError(t, err, "Marshal error")
+
+	t.Run("decodes on first access", func(t *testing.T) {
+		t.Parallel()
+
+		var got record
+		err := Unmarshal(doc, &got)
+		require.NoError(t, err, "Unmarshal error")
+		assert.False(t, got.Details.Loaded(), "expected details to not be decoded yet")
+
+		d, err := got.Details.Get()
+		require.NoError(t, err, "Get error")
+		assert.Equal(t, details{Color: "red"}, d)
+		assert.True(t, got.Details.Loaded(), "expected details to be decoded")
+	})
+	t.Run("encodes raw value when not accessed", func(t *testing.T) {
+		t.Parallel()
+
+		var got record
+		err := Unmarshal(doc, &got)
+		require.NoError(t, err, "Unmarshal error")
+
+		out, err := Marshal(got)
+		require.NoError(t, err, "Marshal error")
+		assert.Equal(t, Raw(doc), Raw(out))
+	})
+	t.Run("encodes current value", func(t *testing.T) {
+		t.Parallel()
+
+		out, err := Marshal(record{Name: "widget", Details: NewLazy(details{Color: "blue"})})
+		require.NoError(t, err, "Marshal error")
+
+		want, err := Marshal(D{{"name", "widget"}, {"details", D{{"color", "blue"}}}})
+		require.NoError(t, err, "Marshal error")
+		assert.Equal(t, Raw(want), Raw(out))
+	})
+	t.Run("decode error on access", func(t *testing.T) {
+		t.Parallel()
+
+		bad, err := Marshal(D{{"details", "not a document"}})
+		require.NoError(t, err, "Marshal error")
+
+		var got record
+		err = Unmarshal(bad, &got)
+		require.NoError(t, err, "Unmarshal error")
+
+		_, err = got.Details.Get()
+		assert.Error(t, err)
+	})
+}
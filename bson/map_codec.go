@@ -11,7 +11,9 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 // mapCodec is the Codec used for map values.
@@ -68,17 +70,40 @@ func (mc *mapCodec) EncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Va
 		return err
 	}
 
-	err = mc.encodeMapElements(ec, dw, val, nil)
+	err = mc.encodeMapElements(ec, dw, val, "", nil)
 	if err != nil {
 		return err
 	}
 	return dw.WriteDocumentEnd()
 }
 
-// encodeMapElements handles encoding of the values of a map. The collisionFn returns
-// true if the provided key exists, this is mainly used for inline maps in the
-// struct codec.
-func (mc *mapCodec) encodeMapElements(ec EncodeContext, dw DocumentWriter, val reflect.Value, collisionFn func(string) bool) error {
+// mapKeyCollisionFunc reports whether a map key collides with another key of the document the
+// map elements are written to. It receives the map key as its original value and as the prefixed
+// string it is encoded as, so that keys of non-string types can be checked consistently with how
+// they are formatted.
+type mapKeyCollisionFunc func(key reflect.Value, encoded string) bool
+
+// stringKeyCollision returns a mapKeyCollisionFunc that calls fn with the encoded key only, or nil
+// if fn is nil.
+func stringKeyCollision(fn func(string) bool) mapKeyCollisionFunc {
+	if fn == nil {
+		return nil
+	}
+	return func(_ reflect.Value, encoded string) bool {
+		return fn(encoded)
+	}
+}
+
+// encodeMapElements handles encoding of the values of a map. The prefix is added to
+// each key before it is written. The collisionFn returns true if the provided
+// key exists, this is mainly used for inline maps in the struct codec.
+func (mc *mapCodec) encodeMapElements(
+	ec EncodeContext,
+	dw DocumentWriter,
+	val reflect.Value,
+	prefix string,
+	collisionFn mapKeyCollisionFunc,
+) error {
 
 	elemType := val.Type().Elem()
 	encoder, err := ec.LookupEncoder(elemType)
@@ -87,19 +112,32 @@ func (mc *mapCodec) encodeMapElements(ec EncodeContext, dw DocumentWriter, val r
 	}
 
 	keys := val.MapKeys()
-	for _, key := range keys {
+	keyStrs := make([]string, len(keys))
+	for i, key := range keys {
 		keyStr, err := mc.encodeKey(key, ec.stringifyMapKeysWithFmt)
 		if err != nil {
 			return err
 		}
+		if ec.escapeKeys {
+			keyStr = escapeKey(keyStr)
+		}
+		keyStr = prefix + keyStr
 
-		if collisionFn != nil && collisionFn(keyStr) {
+		if collisionFn != nil && collisionFn(key, keyStr) {
 			return fmt.Errorf("Key %s of inlined map conflicts with a struct field name", key)
 		}
+		keyStrs[i] = keyStr
+	}
+	if ec.sortMapKeys {
+		sort.Sort(mapKeysByString{keys: keys, strs: keyStrs})
+	}
+
+	for i, key := range keys {
+		keyStr := keyStrs[i]
 
 		currEncoder, currVal, lookupErr := lookupElementEncoder(ec, encoder, val.MapIndex(key))
 		if lookupErr != nil && !errors.Is(lookupErr, errInvalidValue) {
-			return lookupErr
+			return newEncodeError(keyStr, lookupErr)
 		}
 
 		vw, err := dw.WriteDocumentElement(keyStr)
@@ -117,13 +155,26 @@ func (mc *mapCodec) encodeMapElements(ec EncodeContext, dw DocumentWriter, val r
 
 		err = currEncoder.EncodeValue(ec, vw, currVal)
 		if err != nil {
-			return err
+			return newEncodeError(keyStr, err)
 		}
 	}
 
 	return nil
 }
 
+// mapKeysByString sorts the keys of a map together with their encoded strings by the strings.
+type mapKeysByString struct {
+	keys []reflect.Value
+	strs []string
+}
+
+func (mk mapKeysByString) Len() int           { return len(mk.keys) }
+func (mk mapKeysByString) Less(i, j int) bool { return mk.strs[i] < mk.strs[j] }
+func (mk mapKeysByString) Swap(i, j int) {
+	mk.keys[i], mk.keys[j] = mk.keys[j], mk.keys[i]
+	mk.strs[i], mk.strs[j] = mk.strs[j], mk.strs[i]
+}
+
 // DecodeValue is the ValueDecoder for map[string/decimal]* types.
 func (mc *mapCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
 	if val.Kind() != reflect.Map || (!val.CanSet() && val.IsNil()) {
@@ -142,6 +193,11 @@ func (mc *mapCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Va
 		return fmt.Errorf("cannot decode %v into a %s", vrType, val.Type())
 	}
 
+	isNil, vr, err := decodeEmptyDocAsNil(dc, vr, val)
+	if isNil || err != nil {
+		return err
+	}
+
 	dr, err := vr.ReadDocument()
 	if err != nil {
 		return err
@@ -172,6 +228,9 @@ func (mc *mapCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Va
 			return err
 		}
 
+		if dc.unescapeKeys {
+			key = unescapeKey(key)
+		}
 		k, err := mc.decodeKey(key, keyType)
 		if err != nil {
 			return err
@@ -187,6 +246,60 @@ func (mc *mapCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Va
 	return nil
 }
 
+// escapeKey escapes the characters of key that are not allowed in MongoDB field names using
+// percent-encoding. "%" is escaped as "%25" so that the escaping can be reversed by unescapeKey,
+// "." is escaped as "%2E" and a leading "$" is escaped as "%24".
+func escapeKey(key string) string {
+	if !strings.ContainsAny(key, "%.") && !strings.HasPrefix(key, "$") {
+		return key
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; {
+		case c == '%':
+			sb.WriteString("%25")
+		case c == '.':
+			sb.WriteString("%2E")
+		case c == '$' && i == 0:
+			sb.WriteString("%24")
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// unescapeKey reverses the escaping applied by escapeKey. Percent sequences other than the ones
+// produced by escapeKey are left as they are.
+func unescapeKey(key string) string {
+	if !strings.Contains(key, "%") {
+		return key
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(key); i++ {
+		if key[i] == '%' && i+2 < len(key) {
+			switch key[i+1 : i+3] {
+			case "25":
+				sb.WriteByte('%')
+				i += 2
+				continue
+			case "2E":
+				sb.WriteByte('.')
+				i += 2
+				continue
+			case "24":
+				sb.WriteByte('$')
+				i += 2
+				continue
+			}
+		}
+		sb.WriteByte(key[i])
+	}
+	return sb.String()
+}
+
 func clearMap(m reflect.Value) {
 	var none reflect.Value
 	for _, k := range m.MapKeys() {
@@ -239,6 +352,22 @@ func (mc *mapCodec) encodeKey(val reflect.Value, encodeKeysWithStringer bool) (s
 
 var keyUnmarshalerType = reflect.TypeOf((*KeyUnmarshaler)(nil)).Elem()
 var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+var keyMarshalerType = reflect.TypeOf((*KeyMarshaler)(nil)).Elem()
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// isStringKeyType reports whether map keys of type t are encoded as strings that can be decoded
+// back into t, i.e. whether t is a string type or implements KeyMarshaler or
+// encoding.TextMarshaler and has a pointer type that implements KeyUnmarshaler or
+// encoding.TextUnmarshaler.
+func isStringKeyType(t reflect.Type) bool {
+	if t.Kind() == reflect.String {
+		return true
+	}
+	pt := reflect.PtrTo(t)
+	marshals := t.Implements(keyMarshalerType) || t.Implements(textMarshalerType)
+	unmarshals := pt.Implements(keyUnmarshalerType) || pt.Implements(textUnmarshalerType)
+	return marshals && unmarshals
+}
 
 func (mc *mapCodec) decodeKey(key string, keyType reflect.Type) (reflect.Value, error) {
 	keyVal := reflect.ValueOf(key)
@@ -30,6 +30,15 @@ type Marshaler interface {
 	MarshalBSON() ([]byte, error)
 }
 
+// RawBSONMarshaler is the interface implemented by struct types that provide their own encoded
+// BSON document. The struct codec writes the returned bytes in place of the struct without
+// describing its fields, so the encoding of performance-critical types avoids reflection. The
+// returned bytes must be a valid BSON document; only their length prefix and trailing null byte
+// are checked. Types that implement Marshaler are encoded by MarshalBSON instead.
+type RawBSONMarshaler interface {
+	MarshalRawBSON() ([]byte, error)
+}
+
 // ValueMarshaler is the interface implemented by types that can marshal
 // themselves into a valid BSON value. The format of the returned bytes must
 // match the returned type.
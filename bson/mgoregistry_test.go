@@ -1109,7 +1109,10 @@ func TestGetterErrors(t *testing.T) {
 	enc := NewEncoder(vw)
 	enc.SetRegistry(NewMgoRegistry())
 	err := enc.Encode(obj1)
-	assert.Equal(t, e, err, "expected error: %v, got: %v", e, err)
+	assert.ErrorIs(t, err, e)
+	var ee *EncodeError
+	assert.True(t, errors.As(err, &ee), "expected an EncodeError, got: %v", err)
+	assert.Equal(t, []string{"_"}, ee.Keys())
 	assert.Nil(t, buf.Bytes(), "expected nil data, got: %v", buf.Bytes())
 
 	obj2 := &typeWithGetter{sampleItems[0].obj, e}
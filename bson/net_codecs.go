@@ -0,0 +1,176 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+)
+
+// ipEncodeValue is the ValueEncoderFunc for net.IP. Like other byte slices, IPs are encoded as BSON
+// binary by the encoder registered for slices unless the Encoder uses IPAsString.
+func ipEncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != tIP {
+		return ValueEncoderError{Name: "IPEncodeValue", Types: []reflect.Type{tIP}, Received: val}
+	}
+	if !ec.ipAsString {
+		if ec.Registry != nil {
+			if enc, ok := ec.Registry.kindEncoders.Load(reflect.Slice); ok {
+				return enc.EncodeValue(ec, vw, val)
+			}
+		}
+		return (&sliceCodec{}).EncodeValue(ec, vw, val)
+	}
+	if val.Len() == 0 {
+		return vw.WriteNull()
+	}
+	return vw.WriteString(val.Interface().(net.IP).String())
+}
+
+func ipDecodeType(_ DecodeContext, vr ValueReader, t reflect.Type) (reflect.Value, error) {
+	if t != tIP {
+		return emptyValue, ValueDecoderError{
+			Name:     "IPDecodeValue",
+			Types:    []reflect.Type{tIP},
+			Received: reflect.Zero(t),
+		}
+	}
+
+	var ip net.IP
+	switch vrType := vr.Type(); vrType {
+	case TypeString:
+		str, err := vr.ReadString()
+		if err != nil {
+			return emptyValue, err
+		}
+		if ip = net.ParseIP(str); ip == nil {
+			return emptyValue, fmt.Errorf("invalid IP address %q", str)
+		}
+	case TypeBinary:
+		data, _, err := vr.ReadBinary()
+		if err != nil {
+			return emptyValue, err
+		}
+		// An empty net.IP is encoded as zero-length binary, which decodes to a nil IP.
+		if len(data) != 0 && len(data) != net.IPv4len && len(data) != net.IPv6len {
+			return emptyValue, fmt.Errorf("invalid IP address length %d", len(data))
+		}
+		if len(data) > 0 {
+			ip = append(net.IP(nil), data...)
+		}
+	case TypeNull:
+		if err := vr.ReadNull(); err != nil {
+			return emptyValue, err
+		}
+	case TypeUndefined:
+		if err := vr.ReadUndefined(); err != nil {
+			return emptyValue, err
+		}
+	default:
+		return emptyValue, fmt.Errorf("cannot decode %v into a net.IP", vrType)
+	}
+
+	return reflect.ValueOf(ip), nil
+}
+
+// ipDecodeValue is the ValueDecoderFunc for net.IP.
+func ipDecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != tIP {
+		return ValueDecoderError{Name: "IPDecodeValue", Types: []reflect.Type{tIP}, Received: val}
+	}
+
+	elem, err := ipDecodeType(dc, vr, tIP)
+	if err != nil {
+		return err
+	}
+
+	val.Set(elem)
+	return nil
+}
+
+// hardwareAddrEncodeValue is the ValueEncoderFunc for net.HardwareAddr.
+func hardwareAddrEncodeValue(_ EncodeContext, vw ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != tHardwareAddr {
+		return ValueEncoderError{Name: "HardwareAddrEncodeValue", Types: []reflect.Type{tHardwareAddr}, Received: val}
+	}
+	if val.Len() == 0 {
+		return vw.WriteNull()
+	}
+	return vw.WriteString(val.Interface().(net.HardwareAddr).String())
+}
+
+func hardwareAddrDecodeType(_ DecodeContext, vr ValueReader, t reflect.Type) (reflect.Value, error) {
+	if t != tHardwareAddr {
+		return emptyValue, ValueDecoderError{
+			Name:     "HardwareAddrDecodeValue",
+			Types:    []reflect.Type{tHardwareAddr},
+			Received: reflect.Zero(t),
+		}
+	}
+
+	var addr net.HardwareAddr
+	switch vrType := vr.Type(); vrType {
+	case TypeString:
+		str, err := vr.ReadString()
+		if err != nil {
+			return emptyValue, err
+		}
+		if addr, err = net.ParseMAC(str); err != nil {
+			return emptyValue, err
+		}
+	case TypeBinary:
+		data, _, err := vr.ReadBinary()
+		if err != nil {
+			return emptyValue, err
+		}
+		addr = append(net.HardwareAddr(nil), data...)
+	case TypeNull:
+		if err := vr.ReadNull(); err != nil {
+			return emptyValue, err
+		}
+	case TypeUndefined:
+		if err := vr.ReadUndefined(); err != nil {
+			return emptyValue, err
+		}
+	default:
+		return emptyValue, fmt.Errorf("cannot decode %v into a net.HardwareAddr", vrType)
+	}
+
+	return reflect.ValueOf(addr), nil
+}
+
+// hardwareAddrDecodeValue is the ValueDecoderFunc for net.HardwareAddr.
+func hardwareAddrDecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != tHardwareAddr {
+		return ValueDecoderError{Name: "HardwareAddrDecodeValue", Types: []reflect.Type{tHardwareAddr}, Received: val}
+	}
+
+	elem, err := hardwareAddrDecodeType(dc, vr, tHardwareAddr)
+	if err != nil {
+		return err
+	}
+
+	val.Set(elem)
+	return nil
+}
+
+// netBinaryEncodeValue encodes a net.IP or net.HardwareAddr as a BSON binary value containing its
+// raw bytes. It is used for struct fields with the "binary" struct tag option.
+func netBinaryEncodeValue(_ EncodeContext, vw ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || (val.Type() != tIP && val.Type() != tHardwareAddr) {
+		return ValueEncoderError{
+			Name:     "NetBinaryEncodeValue",
+			Types:    []reflect.Type{tIP, tHardwareAddr},
+			Received: val,
+		}
+	}
+	if val.Len() == 0 {
+		return vw.WriteNull()
+	}
+	return vw.WriteBinary(val.Bytes())
+}
@@ -0,0 +1,131 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
+	"go.mongodb.org/mongo-driver/v2/internal/require"
+)
+
+func TestNetCodecs(t *testing.T) {
+	t.Parallel()
+
+	type host struct {
+		IP  net.IP           `bson:"ip"`
+		MAC net.HardwareAddr `bson:"mac"`
+	}
+	type binaryHost struct {
+		IP  net.IP           `bson:"ip,binary"`
+		MAC net.HardwareAddr `bson:"mac,binary"`
+	}
+
+	mac, err := net.ParseMAC("00:00:5e:00:53:01")
+	require.NoError(t, err, "ParseMAC error")
+	in := host{IP: net.ParseIP("192.0.2.1"), MAC: mac}
+
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(in)
+		require.NoError(t, err, "Marshal error")
+		_, data := Raw(doc).Lookup("ip").Binary()
+		assert.Equal(t, []byte(in.IP), data)
+		assert.Equal(t, "00:00:5e:00:53:01", Raw(doc).Lookup("mac").StringValue())
+
+		var got host
+		err = Unmarshal(doc, &got)
+		require.NoError(t, err, "Unmarshal error")
+		assert.Equal(t, in, got)
+	})
+	t.Run("string round trip", func(t *testing.T) {
+		t.Parallel()
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.IPAsString()
+		require.NoError(t, enc.Encode(in), "Encode error")
+		doc := buf.Bytes()
+		assert.Equal(t, "192.0.2.1", Raw(doc).Lookup("ip").StringValue())
+		assert.Equal(t, "00:00:5e:00:53:01", Raw(doc).Lookup("mac").StringValue())
+
+		var got host
+		err = Unmarshal(doc, &got)
+		require.NoError(t, err, "Unmarshal error")
+		assert.True(t, in.IP.Equal(got.IP), "expected IP %v, got %v", in.IP, got.IP)
+		assert.Equal(t, in.MAC, got.MAC)
+	})
+	t.Run("binary round trip", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(binaryHost(in))
+		require.NoError(t, err, "Marshal error")
+		_, data := Raw(doc).Lookup("mac").Binary()
+		assert.Equal(t, []byte(mac), data)
+
+		var got host
+		err = Unmarshal(doc, &got)
+		require.NoError(t, err, "Unmarshal error")
+		assert.True(t, in.IP.Equal(got.IP), "expected IP %v, got %v", in.IP, got.IP)
+		assert.Equal(t, in.MAC, got.MAC)
+	})
+	t.Run("nil encodes as null", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(host{})
+		require.NoError(t, err, "Marshal error")
+		assert.Equal(t, TypeNull, Raw(doc).Lookup("ip").Type)
+
+		var got host
+		err = Unmarshal(doc, &got)
+		require.NoError(t, err, "Unmarshal error")
+		assert.Nil(t, got.IP)
+	})
+	t.Run("empty IP round trip", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(host{IP: net.IP{}})
+		require.NoError(t, err, "Marshal error")
+		_, data := Raw(doc).Lookup("ip").Binary()
+		assert.Equal(t, 0, len(data))
+
+		var got host
+		err = Unmarshal(doc, &got)
+		require.NoError(t, err, "Unmarshal error")
+		assert.Nil(t, got.IP)
+
+		doc, err = Marshal(D{{"ip", Binary{Data: []byte{1, 2, 3}}}})
+		require.NoError(t, err, "Marshal error")
+		err = Unmarshal(doc, &got)
+		assert.ErrorContains(t, err, "invalid IP address length 3")
+	})
+	t.Run("parse failure", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"ip", "192.0.2.1"}, {"mac", "not a mac"}})
+		require.NoError(t, err, "Marshal error")
+
+		var got host
+		err = Unmarshal(doc, &got)
+		var de *DecodeError
+		require.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"mac"}, de.Keys())
+	})
+	t.Run("binary tag requires net type", func(t *testing.T) {
+		t.Parallel()
+
+		type bad struct {
+			Data []byte `bson:"data,binary"`
+		}
+		_, err := Marshal(bad{})
+		assert.ErrorContains(t, err, "binary requires a net.IP or net.HardwareAddr field")
+	})
+}
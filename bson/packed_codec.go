@@ -0,0 +1,194 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// packedCodec is the Codec used for numeric slice fields with the "packed" struct tag option. It
+// encodes the slice as a single BSON binary value holding the elements as fixed-size numbers in the
+// configured byte order.
+type packedCodec struct {
+	order binary.ByteOrder
+	kind  reflect.Kind
+	size  int
+}
+
+// packedKinds maps the element types accepted by the "packed" struct tag option to the kind of the
+// slice elements and their size in bytes.
+var packedKinds = map[string]struct {
+	kind reflect.Kind
+	size int
+}{
+	"i16": {reflect.Int16, 2},
+	"i32": {reflect.Int32, 4},
+	"i64": {reflect.Int64, 8},
+	"u16": {reflect.Uint16, 2},
+	"u32": {reflect.Uint32, 4},
+	"u64": {reflect.Uint64, 8},
+	"f32": {reflect.Float32, 4},
+	"f64": {reflect.Float64, 8},
+}
+
+// newPackedCodec parses a "packed" struct tag option value of the form "<order>-<type>", where
+// order is "le" or "be", and returns a packedCodec for slices of t.
+func newPackedCodec(spec string, t reflect.Type) (*packedCodec, error) {
+	orderName, kindName, _ := strings.Cut(spec, "-")
+
+	var pc packedCodec
+	switch orderName {
+	case "le":
+		pc.order = binary.LittleEndian
+	case "be":
+		pc.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid packed byte order %q, must be \"le\" or \"be\"", orderName)
+	}
+	pk, ok := packedKinds[kindName]
+	if !ok {
+		return nil, fmt.Errorf("invalid packed element type %q", kindName)
+	}
+	pc.kind, pc.size = pk.kind, pk.size
+
+	if t.Kind() != reflect.Slice || t.Elem().Kind() != pc.kind {
+		return nil, fmt.Errorf("packed %q requires a slice of %s", spec, pc.kind)
+	}
+	return &pc, nil
+}
+
+// EncodeValue encodes the slice val as BSON binary. A nil slice is encoded as BSON null.
+func (pc *packedCodec) EncodeValue(_ EncodeContext, vw ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Kind() != reflect.Slice || val.Type().Elem().Kind() != pc.kind {
+		return ValueEncoderError{Name: "PackedEncodeValue", Kinds: []reflect.Kind{reflect.Slice}, Received: val}
+	}
+	if val.IsNil() {
+		return vw.WriteNull()
+	}
+
+	data := make([]byte, val.Len()*pc.size)
+	for i := 0; i < val.Len(); i++ {
+		b := data[i*pc.size:]
+		elem := val.Index(i)
+		switch pc.kind {
+		case reflect.Int16:
+			pc.order.PutUint16(b, uint16(elem.Int()))
+		case reflect.Int32:
+			pc.order.PutUint32(b, uint32(elem.Int()))
+		case reflect.Int64:
+			pc.order.PutUint64(b, uint64(elem.Int()))
+		case reflect.Uint16:
+			pc.order.PutUint16(b, uint16(elem.Uint()))
+		case reflect.Uint32:
+			pc.order.PutUint32(b, uint32(elem.Uint()))
+		case reflect.Uint64:
+			pc.order.PutUint64(b, elem.Uint())
+		case reflect.Float32:
+			pc.order.PutUint32(b, math.Float32bits(float32(elem.Float())))
+		case reflect.Float64:
+			pc.order.PutUint64(b, math.Float64bits(elem.Float()))
+		}
+	}
+	return vw.WriteBinary(data)
+}
+
+// DecodeValue decodes BSON binary holding packed numbers into the slice val. BSON null and
+// undefined values are decoded as a nil slice.
+func (pc *packedCodec) DecodeValue(_ DecodeContext, vr ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Kind() != reflect.Slice || val.Type().Elem().Kind() != pc.kind {
+		return ValueDecoderError{Name: "PackedDecodeValue", Kinds: []reflect.Kind{reflect.Slice}, Received: val}
+	}
+
+	switch vrType := vr.Type(); vrType {
+	case TypeBinary:
+	case TypeNull:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadNull()
+	case TypeUndefined:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadUndefined()
+	default:
+		return fmt.Errorf("cannot decode %v into a packed %s", vrType, val.Type())
+	}
+
+	data, subtype, err := vr.ReadBinary()
+	if err != nil {
+		return err
+	}
+	if subtype != TypeBinaryGeneric && subtype != TypeBinaryBinaryOld {
+		return decodeBinaryError{subtype: subtype, typeName: "packed " + val.Type().String()}
+	}
+	if len(data)%pc.size != 0 {
+		return fmt.Errorf("packed binary length %d is not a multiple of the %s size %d", len(data), pc.kind, pc.size)
+	}
+
+	n := len(data) / pc.size
+	slice := reflect.MakeSlice(val.Type(), n, n)
+	for i := 0; i < n; i++ {
+		b := data[i*pc.size:]
+		elem := slice.Index(i)
+		switch pc.kind {
+		case reflect.Int16:
+			elem.SetInt(int64(int16(pc.order.Uint16(b))))
+		case reflect.Int32:
+			elem.SetInt(int64(int32(pc.order.Uint32(b))))
+		case reflect.Int64:
+			elem.SetInt(int64(pc.order.Uint64(b)))
+		case reflect.Uint16:
+			elem.SetUint(uint64(pc.order.Uint16(b)))
+		case reflect.Uint32:
+			elem.SetUint(uint64(pc.order.Uint32(b)))
+		case reflect.Uint64:
+			elem.SetUint(pc.order.Uint64(b))
+		case reflect.Float32:
+			elem.SetFloat(float64(math.Float32frombits(pc.order.Uint32(b))))
+		case reflect.Float64:
+			elem.SetFloat(math.Float64frombits(pc.order.Uint64(b)))
+		}
+	}
+	val.Set(slice)
+	return nil
+}
+
+// autoPackedCodec is the Codec registered for a slice type by Registry.RegisterPackedSlice. It
+// encodes slices with more elements than the threshold set using Encoder.PackArraysOver as packed
+// binary and other slices as BSON arrays, and decodes either form. BSON arrays are encoded and
+// decoded by the codec registered for slices on the Registry, so that its options apply.
+type autoPackedCodec struct {
+	packed *packedCodec
+}
+
+// EncodeValue encodes val as packed binary if it has more elements than the packing threshold of
+// ec and as a BSON array otherwise.
+func (ac *autoPackedCodec) EncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Value) error {
+	if ec.packArraysOver > 0 && val.IsValid() && val.Kind() == reflect.Slice && val.Len() > ec.packArraysOver {
+		return ac.packed.EncodeValue(ec, vw, val)
+	}
+	if ec.Registry != nil {
+		if enc, ok := ec.Registry.kindEncoders.Load(reflect.Slice); ok {
+			return enc.EncodeValue(ec, vw, val)
+		}
+	}
+	return (&sliceCodec{}).EncodeValue(ec, vw, val)
+}
+
+// DecodeValue decodes BSON binary holding packed numbers or a BSON array into the slice val.
+func (ac *autoPackedCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	if vr.Type() == TypeBinary {
+		return ac.packed.DecodeValue(dc, vr, val)
+	}
+	if dc.Registry != nil {
+		if dec, ok := dc.Registry.kindDecoders.Load(reflect.Slice); ok {
+			return dec.DecodeValue(dc, vr, val)
+		}
+	}
+	return (&sliceCodec{}).DecodeValue(dc, vr, val)
+}
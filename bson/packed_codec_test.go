@@ -0,0 +1,195 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
+	"go.mongodb.org/mongo-driver/v2/internal/require"
+)
+
+func TestPackedCodec(t *testing.T) {
+	t.Parallel()
+
+	type telemetry struct {
+		Samples []float32 `bson:"samples,packed=le-f32"`
+		Counts  []int16   `bson:"counts,packed=be-i16"`
+		Totals  []uint64  `bson:"totals,packed=le-u64"`
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		in := telemetry{
+			Samples: []float32{1.5, -2},
+			Counts:  []int16{1, -2},
+			Totals:  []uint64{1 << 63},
+		}
+		doc, err := Marshal(in)
+		require.NoError(t, err, "Marshal error")
+
+		subtype, data := Raw(doc).Lookup("samples").Binary()
+		assert.Equal(t, TypeBinaryGeneric, subtype)
+		assert.Equal(t, []byte{0x00, 0x00, 0xc0, 0x3f, 0x00, 0x00, 0x00, 0xc0}, data)
+		_, data = Raw(doc).Lookup("counts").Binary()
+		assert.Equal(t, []byte{0x00, 0x01, 0xff, 0xfe}, data)
+
+		var got telemetry
+		err = Unmarshal(doc, &got)
+		require.NoError(t, err, "Unmarshal error")
+		assert.Equal(t, in, got)
+	})
+	t.Run("nil and empty slices", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(telemetry{Counts: []int16{}})
+		require.NoError(t, err, "Marshal error")
+		assert.Equal(t, TypeNull, Raw(doc).Lookup("samples").Type)
+
+		var got telemetry
+		err = Unmarshal(doc, &got)
+		require.NoError(t, err, "Unmarshal error")
+		assert.Nil(t, got.Samples)
+		assert.Equal(t, []int16{}, got.Counts)
+	})
+	t.Run("corrupt binary", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"samples", Binary{Data: []byte{1, 2, 3}}}})
+		require.NoError(t, err, "Marshal error")
+
+		var got telemetry
+		err = Unmarshal(doc, &got)
+		var de *DecodeError
+		require.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"samples"}, de.Keys())
+		assert.ErrorContains(t, err, "packed binary length 3 is not a multiple of the float32 size 4")
+	})
+
+	describeErrs := []struct {
+		name    string
+		val     any
+		wantErr string
+	}{
+		{
+			name: "invalid byte order",
+			val: struct {
+				V []float32 `bson:"v,packed=me-f32"`
+			}{},
+			wantErr: `field V: invalid packed byte order "me"`,
+		},
+		{
+			name: "invalid element type",
+			val: struct {
+				V []float32 `bson:"v,packed=le-f16"`
+			}{},
+			wantErr: `field V: invalid packed element type "f16"`,
+		},
+		{
+			name: "mismatched element type",
+			val: struct {
+				V []float64 `bson:"v,packed=le-f32"`
+			}{},
+			wantErr: `field V: packed "le-f32" requires a slice of float32`,
+		},
+	}
+	for _, tc := range describeErrs {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Marshal(tc.val)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestAutoPackedCodec(t *testing.T) {
+	t.Parallel()
+
+	type series struct {
+		Points []float64 `bson:"points"`
+	}
+
+	reg := NewRegistry()
+	reg.RegisterPackedSlice(reflect.TypeOf([]float64(nil)), "le-f64")
+
+	encode := func(t *testing.T, n int, val any) []byte {
+		t.Helper()
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetRegistry(reg)
+		enc.PackArraysOver(n)
+		err := enc.Encode(val)
+		require.NoError(t, err, "Encode error")
+		return buf.Bytes()
+	}
+	decode := func(t *testing.T, doc []byte) series {
+		t.Helper()
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.SetRegistry(reg)
+		var got series
+		err := dec.Decode(&got)
+		require.NoError(t, err, "Decode error")
+		return got
+	}
+
+	testCases := []struct {
+		name     string
+		n        int
+		points   []float64
+		wantType Type
+	}{
+		{"disabled", 0, []float64{1, 2, 3}, TypeArray},
+		{"at threshold", 3, []float64{1, 2, 3}, TypeArray},
+		{"over threshold", 2, []float64{1, 2, 3}, TypeBinary},
+		{"nil slice", 2, nil, TypeNull},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			in := series{Points: tc.points}
+			doc := encode(t, tc.n, in)
+			assert.Equal(t, tc.wantType, Raw(doc).Lookup("points").Type)
+			assert.Equal(t, in, decode(t, doc))
+		})
+	}
+	t.Run("registry slice codec", func(t *testing.T) {
+		t.Parallel()
+
+		// Slices that are not packed use the slice codec registered on the Registry.
+		reg := NewRegistry()
+		reg.RegisterKindEncoder(reflect.Slice, &sliceCodec{encodeNilAsEmpty: true})
+		reg.RegisterPackedSlice(reflect.TypeOf([]float64(nil)), "le-f64")
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetRegistry(reg)
+		enc.PackArraysOver(2)
+		require.NoError(t, enc.Encode(series{}), "Encode error")
+		assert.Equal(t, mustMarshal(t, D{{"points", A{}}}), buf.Bytes())
+	})
+	t.Run("invalid spec", func(t *testing.T) {
+		t.Parallel()
+
+		defer func() {
+			err, _ := recover().(error)
+			assert.ErrorContains(t, err, `RegisterPackedSlice: packed "le-i32" requires a slice of int32`)
+		}()
+		NewRegistry().RegisterPackedSlice(reflect.TypeOf([]float64(nil)), "le-i32")
+	})
+}
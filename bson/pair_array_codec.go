@@ -0,0 +1,200 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// pairArrayCodec is the Codec used for map struct fields with the "pairarray" struct tag option. It
+// represents a map as a BSON array of two-element [key, value] arrays, which allows keys of any
+// type to be stored with their BSON type intact.
+type pairArrayCodec struct{}
+
+// EncodeValue encodes a map as a BSON array of [key, value] pairs.
+func (pac *pairArrayCodec) EncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Kind() != reflect.Map {
+		return ValueEncoderError{Name: "PairArrayEncodeValue", Kinds: []reflect.Kind{reflect.Map}, Received: val}
+	}
+
+	if val.IsNil() && !ec.nilMapAsEmpty {
+		return vw.WriteNull()
+	}
+
+	keyType, elemType := val.Type().Key(), val.Type().Elem()
+	keyEncoder, err := ec.LookupEncoder(keyType)
+	if err != nil && keyType.Kind() != reflect.Interface {
+		return err
+	}
+	elemEncoder, err := ec.LookupEncoder(elemType)
+	if err != nil && elemType.Kind() != reflect.Interface {
+		return err
+	}
+
+	aw, err := vw.WriteArray()
+	if err != nil {
+		return err
+	}
+
+	iter := val.MapRange()
+	for iter.Next() {
+		vw, err := aw.WriteArrayElement()
+		if err != nil {
+			return err
+		}
+		pw, err := vw.WriteArray()
+		if err != nil {
+			return err
+		}
+		for _, item := range []struct {
+			enc ValueEncoder
+			val reflect.Value
+		}{{keyEncoder, iter.Key()}, {elemEncoder, iter.Value()}} {
+			ivw, err := pw.WriteArrayElement()
+			if err != nil {
+				return err
+			}
+			currEncoder, currVal, lookupErr := lookupElementEncoder(ec, item.enc, item.val)
+			if errors.Is(lookupErr, errInvalidValue) {
+				if err := ivw.WriteNull(); err != nil {
+					return err
+				}
+				continue
+			}
+			if lookupErr != nil {
+				return lookupErr
+			}
+			if err := currEncoder.EncodeValue(ec, ivw, currVal); err != nil {
+				return err
+			}
+		}
+		if err := pw.WriteArrayEnd(); err != nil {
+			return err
+		}
+	}
+
+	return aw.WriteArrayEnd()
+}
+
+// DecodeValue decodes a BSON array of [key, value] pairs into a map.
+func (pac *pairArrayCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	if val.Kind() != reflect.Map || !val.CanSet() {
+		return ValueDecoderError{Name: "PairArrayDecodeValue", Kinds: []reflect.Kind{reflect.Map}, Received: val}
+	}
+
+	switch vrType := vr.Type(); vrType {
+	case TypeArray:
+	case TypeNull:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadNull()
+	case TypeUndefined:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadUndefined()
+	default:
+		return fmt.Errorf("cannot decode %v into a %s pair array", vrType, val.Type())
+	}
+
+	keyType, elemType := val.Type().Key(), val.Type().Elem()
+	keyDecoder, err := dc.LookupDecoder(keyType)
+	if err != nil {
+		return err
+	}
+	elemDecoder, err := dc.LookupDecoder(elemType)
+	if err != nil {
+		return err
+	}
+
+	ar, err := vr.ReadArray()
+	if err != nil {
+		return err
+	}
+
+	if val.IsNil() {
+		val.Set(reflect.MakeMap(val.Type()))
+	}
+	if val.Len() > 0 && dc.zeroMaps {
+		clearMap(val)
+	}
+
+	for idx := 0; ; idx++ {
+		vr, err := ar.ReadValue()
+		if errors.Is(err, ErrEOA) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		key, elem, err := decodePair(dc, vr, keyDecoder, keyType, elemDecoder, elemType)
+		if err != nil {
+			return newDecodeError(strconv.Itoa(idx), err)
+		}
+		// The keys of a map with interface keys can hold values of any type decoded from the pair,
+		// such as an A, but SetMapIndex panics if they are not comparable.
+		k := key
+		if k.Kind() == reflect.Interface && !k.IsNil() {
+			k = k.Elem()
+		}
+		if !k.Type().Comparable() {
+			return newDecodeError(strconv.Itoa(idx), fmt.Errorf("pair key of type %s is not comparable", k.Type()))
+		}
+		val.SetMapIndex(key, elem)
+	}
+	return nil
+}
+
+// decodePair decodes a single two-element [key, value] BSON array.
+func decodePair(
+	dc DecodeContext,
+	vr ValueReader,
+	keyDecoder ValueDecoder,
+	keyType reflect.Type,
+	elemDecoder ValueDecoder,
+	elemType reflect.Type,
+) (reflect.Value, reflect.Value, error) {
+	if vr.Type() != TypeArray {
+		return emptyValue, emptyValue, fmt.Errorf("pair must be a two-element array, got %v", vr.Type())
+	}
+	ar, err := vr.ReadArray()
+	if err != nil {
+		return emptyValue, emptyValue, err
+	}
+
+	var pair [2]reflect.Value
+	for i, item := range []struct {
+		dec ValueDecoder
+		typ reflect.Type
+	}{{keyDecoder, keyType}, {elemDecoder, elemType}} {
+		vr, err := ar.ReadValue()
+		if errors.Is(err, ErrEOA) {
+			return emptyValue, emptyValue, fmt.Errorf("pair must be a two-element array, got %d element(s)", i)
+		}
+		if err != nil {
+			return emptyValue, emptyValue, err
+		}
+		pair[i], err = decodeTypeOrValueWithInfo(item.dec, dc, vr, item.typ)
+		if err != nil {
+			return emptyValue, emptyValue, err
+		}
+	}
+
+	vr, err = ar.ReadValue()
+	if err == nil {
+		if err := vr.Skip(); err != nil {
+			return emptyValue, emptyValue, err
+		}
+		return emptyValue, emptyValue, errors.New("pair must be a two-element array, got more than two elements")
+	}
+	if !errors.Is(err, ErrEOA) {
+		return emptyValue, emptyValue, err
+	}
+
+	return pair[0], pair[1], nil
+}
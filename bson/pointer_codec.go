@@ -68,6 +68,14 @@ func (pc *pointerCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflec
 		return vr.ReadUndefined()
 	}
 
+	if typ.Elem().Kind() == reflect.Struct {
+		isNil, nvr, err := decodeEmptyDocAsNil(dc, vr, val)
+		if isNil || err != nil {
+			return err
+		}
+		vr = nvr
+	}
+
 	if val.IsNil() {
 		val.Set(reflect.New(typ.Elem()))
 	}
@@ -24,6 +24,23 @@ type Zeroer interface {
 	IsZero() bool
 }
 
+// EncodeSkipper allows struct types to veto their own encoding. If ShouldEncode returns false, a
+// value passed directly to Encoder.Encode or Marshal is not encoded and ErrEncodeSkipped is
+// returned, and a value nested in another value, such as a struct field or a slice element, is
+// encoded as an empty document.
+type EncodeSkipper interface {
+	ShouldEncode() bool
+}
+
+// MapSetter can be implemented by the type of a struct field with the "inline" struct tag option to
+// receive the elements that do not match another field when unmarshaling, instead of the field
+// being a map. SetKey is called with the key and value of each such element, e.g. to store them in
+// a sync.Map. The field may be a pointer, which is allocated before the first call to SetKey if it
+// is nil, or a value whose pointer implements MapSetter. The field is not marshaled.
+type MapSetter interface {
+	SetKey(key string, val RawValue)
+}
+
 // The following primitive types are similar to Go primitives for BSON types that
 // do not have direct Go primitive representations.
 
@@ -0,0 +1,81 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"reflect"
+)
+
+// LegacyValue describes a BSON value that was decoded using a lenient conversion or from a
+// deprecated BSON type. It is reported to the function set using Decoder.ReadRepair.
+type LegacyValue struct {
+	// Field is the name of the struct field the value was decoded into, or an empty string if the
+	// value was not decoded into a struct field. For values nested in a struct field, such as
+	// slice elements, it is the name of the enclosing struct field.
+	Field string
+
+	// Type is the BSON type of the value.
+	Type Type
+
+	// GoType is the Go type the value was decoded into.
+	GoType reflect.Type
+
+	// Reason describes the conversion, e.g. "double converted to integer".
+	Reason string
+}
+
+// legacyConversion returns the reason decoding a BSON value of type bt into a Go value of type t
+// is a legacy conversion, or an empty string if it is not.
+func legacyConversion(bt Type, t reflect.Type) string {
+	switch bt {
+	case TypeUndefined, TypeSymbol, TypeDBPointer, TypeCodeWithScope:
+		return "deprecated BSON type " + bt.String()
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch bt {
+		case TypeDouble:
+			return "double converted to integer"
+		case TypeBoolean:
+			return "boolean converted to integer"
+		}
+	case reflect.Float32, reflect.Float64:
+		if bt == TypeBoolean {
+			return "boolean converted to float"
+		}
+	case reflect.Bool:
+		switch bt {
+		case TypeInt32, TypeInt64, TypeDouble:
+			return "number converted to boolean"
+		}
+	case reflect.String:
+		switch bt {
+		case TypeObjectID:
+			return "object ID converted to string"
+		case TypeBinary:
+			return "binary converted to string"
+		}
+	case reflect.Slice:
+		if bt == TypeString {
+			return "string converted to []byte"
+		}
+	}
+	return ""
+}
+
+// checkLegacy reports a LegacyValue to the read repair function of dc, if one is set, if decoding
+// a BSON value of type bt into a Go value of type t is a legacy conversion.
+func checkLegacy(dc DecodeContext, bt Type, t reflect.Type) {
+	if dc.readRepair == nil {
+		return
+	}
+	if reason := legacyConversion(bt, t); reason != "" {
+		dc.readRepair(LegacyValue{Field: dc.ownerField, Type: bt, GoType: t, Reason: reason})
+	}
+}
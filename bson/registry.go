@@ -88,6 +88,27 @@ type Registry struct {
 	kindEncoders      *kindEncoderCache
 	kindDecoders      *kindDecoderCache
 	typeMap           sync.Map // map[Type]reflect.Type
+	textEncodings     sync.Map // map[string]TextEncoding
+	transforms        sync.Map // map[string]Transform
+	projectors        sync.Map // map[string]Projector
+	namedCodecs       sync.Map // map[string]namedCodec
+	stringEnums       sync.Map // map[reflect.Type]*stringEnumCodec
+	schemaAliases     sync.Map // map[reflect.Type]*schemaAliases
+	dominanceFunc     DominanceFunc
+	conflictRename    ConflictRenameFunc
+	onDescribe        OnDescribeFunc
+
+	zeroStructsDefault    bool
+	hasZeroStructsDefault bool
+
+	omitZeroStructDefault    bool
+	hasOmitZeroStructDefault bool
+
+	errorOnEmptyStruct bool
+
+	discriminators     sync.Map // map[reflect.Type]string
+	discriminatedTypes sync.Map // map[string]reflect.Type
+	hasDiscriminators  bool
 }
 
 // NewRegistry creates a new empty Registry.
@@ -101,6 +122,8 @@ func NewRegistry() *Registry {
 	registerDefaultEncoders(reg)
 	registerDefaultDecoders(reg)
 	registerPrimitiveCodecs(reg)
+	registerDefaultTextEncodings(reg)
+	registerDefaultTransforms(reg)
 	return reg
 }
 
@@ -223,6 +246,329 @@ func (r *Registry) RegisterTypeMapEntry(bt Type, rt reflect.Type) {
 	r.typeMap.Store(bt, rt)
 }
 
+// RegisterTextEncoding registers the provided TextEncoding under the given name. Struct fields
+// select a registered TextEncoding using the "encoding=<name>" struct tag option. Registries
+// constructed using NewRegistry have the "base64" (standard base64 encoding with padding) and
+// "hex" encodings registered.
+//
+// RegisterTextEncoding should not be called concurrently with any other Registry method.
+func (r *Registry) RegisterTextEncoding(name string, enc TextEncoding) {
+	r.textEncodings.Store(name, enc)
+}
+
+// RegisterTransform registers the provided Transform under the given name. Struct fields select a
+// pipeline of registered Transforms using the "transform=<name>|<name>" struct tag option.
+// Registries constructed using NewRegistry have the "trim", "lower", and "upper" transforms
+// registered.
+//
+// RegisterTransform should not be called concurrently with any other Registry method.
+func (r *Registry) RegisterTransform(name string, tr Transform) {
+	r.transforms.Store(name, tr)
+}
+
+// namedCodec is a ValueEncoder and ValueDecoder registered by name using RegisterNamedCodec.
+type namedCodec struct {
+	enc ValueEncoder
+	dec ValueDecoder
+}
+
+// RegisterNamedCodec registers the provided ValueEncoder and ValueDecoder under the given name.
+// Struct fields select a registered codec using the "codec=<name>" struct tag option, which
+// replaces the encoder and decoder looked up for the type of the field, e.g. to store a plain
+// string field in a domain-specific format without a wrapper type. If enc or dec is nil, the field
+// uses the encoder or decoder looked up for its type in that direction.
+//
+// RegisterNamedCodec should not be called concurrently with any other Registry method.
+func (r *Registry) RegisterNamedCodec(name string, enc ValueEncoder, dec ValueDecoder) {
+	r.namedCodecs.Store(name, namedCodec{enc: enc, dec: dec})
+}
+
+func (r *Registry) lookupNamedCodec(name string) (namedCodec, bool) {
+	v, ok := r.namedCodecs.Load(name)
+	if !ok {
+		return namedCodec{}, false
+	}
+	return v.(namedCodec), true
+}
+
+// Projector computes the value marshaled for a struct field from the whole struct value. Projectors
+// are registered by name on a Registry using RegisterProjector and are selected for a field using
+// the "project=<name>" struct tag option. For fields of inlined structs, the Projector receives the
+// outer struct being marshaled.
+type Projector func(structVal any) (any, error)
+
+// RegisterProjector registers the provided Projector under the given name.
+//
+// RegisterProjector should not be called concurrently with any other Registry method.
+func (r *Registry) RegisterProjector(name string, p Projector) {
+	r.projectors.Store(name, p)
+}
+
+func (r *Registry) lookupProjector(name string) (Projector, bool) {
+	v, ok := r.projectors.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return v.(Projector), true
+}
+
+// RegisterTypeDiscriminator registers name as the discriminator for the struct type t. When a value
+// of type t or *t is encoded through an interface, such as an interface-typed struct field or an
+// element of a []any, the discriminator is written as the first element of the document under the
+// "_type" key. When a document with a registered discriminator is decoded into an interface-typed
+// struct field, a value of the registered type is allocated and decoded into, and the "_type" key
+// is not treated as an unknown field. If t implements the field's interface type, the field is set
+// to a t, otherwise it is set to a *t.
+//
+// The struct type t must not have a field with the key "_type". If t is not a struct type, or if t
+// or name is already registered with a different name or type, this method will panic.
+//
+// RegisterTypeDiscriminator should not be called concurrently with any other Registry method.
+func (r *Registry) RegisterTypeDiscriminator(t reflect.Type, name string) {
+	if t.Kind() != reflect.Struct {
+		panicStr := fmt.Errorf("RegisterTypeDiscriminator expects a type with kind reflect.Struct, "+
+			"got type %s with kind %s", t, t.Kind())
+		panic(panicStr)
+	}
+	if other, ok := r.discriminators.Load(t); ok && other.(string) != name {
+		panic(fmt.Errorf("RegisterTypeDiscriminator: type %s is already registered with discriminator %q", t, other))
+	}
+	if other, ok := r.discriminatedTypes.Load(name); ok && other.(reflect.Type) != t {
+		panic(fmt.Errorf("RegisterTypeDiscriminator: discriminator %q is already registered for type %s", name, other))
+	}
+	r.discriminators.Store(t, name)
+	r.discriminatedTypes.Store(name, t)
+	r.hasDiscriminators = true
+}
+
+// RegisterInterfaceFactory registers factory to allocate the concrete values that BSON values are
+// decoded into when decoding into the interface type iface, including elements of slices and maps
+// of iface. If factory is nil or returns nil for a BSON document, the document's discriminator is
+// used to determine the concrete type (see RegisterTypeDiscriminator). If the concrete type cannot
+// be determined, decoding fails. If the provided type is not an interface (i.e. iface.Kind() !=
+// reflect.Interface), this method will panic.
+//
+// RegisterInterfaceFactory should not be called concurrently with any other Registry method.
+func (r *Registry) RegisterInterfaceFactory(iface reflect.Type, factory InterfaceFactory) {
+	if iface.Kind() != reflect.Interface {
+		panicStr := fmt.Errorf("RegisterInterfaceFactory expects a type with kind reflect.Interface, "+
+			"got type %s with kind %s", iface, iface.Kind())
+		panic(panicStr)
+	}
+	r.RegisterTypeDecoder(iface, &interfaceFactoryDecoder{iface: iface, factory: factory})
+}
+
+// RegisterConstructor registers fn as the constructor used to decode values of type t. It allows
+// decoding into types that cannot be decoded field by field, such as immutable types with only
+// unexported fields. fn must be a function with the signature func(In) (T, error), where T is t
+// and In is any type that can be decoded, such as bson.M or a struct that mirrors the BSON
+// document. When decoding into a t, the BSON value is decoded into a new In, which is passed to
+// fn, and the returned T is stored. An error returned by fn is returned from the decode.
+//
+// If fn does not have the required signature, this method will panic.
+//
+// RegisterConstructor should not be called concurrently with any other Registry method.
+func (r *Registry) RegisterConstructor(t reflect.Type, fn any) {
+	dec, err := newConstructorDecoder(t, fn)
+	if err != nil {
+		panic(err)
+	}
+	r.RegisterTypeDecoder(t, dec)
+}
+
+// RegisterStringEnum registers values as the allowed values of the string type t, such as a type
+// whose values are defined as string constants. Encoding a value of type t that is not one of the
+// allowed values returns an error. Decoding a string that is not one of the allowed values into a t
+// returns an error unless a fallback value is registered using RegisterStringEnumFallback or the
+// Decoder's UnknownEnumPolicy is not UnknownEnumError. Errors include the invalid value and, for struct fields, the name of the field. If t is not a string
+// type (i.e. t.Kind() != reflect.String), this method will panic.
+//
+// RegisterStringEnum should not be called concurrently with any other Registry method.
+func (r *Registry) RegisterStringEnum(t reflect.Type, values []string) {
+	if t.Kind() != reflect.String {
+		panicStr := fmt.Errorf("RegisterStringEnum expects a type with kind reflect.String, "+
+			"got type %s with kind %s", t, t.Kind())
+		panic(panicStr)
+	}
+	codec := &stringEnumCodec{t: t, allowed: make(map[string]struct{}, len(values))}
+	for _, v := range values {
+		codec.allowed[v] = struct{}{}
+	}
+	r.stringEnums.Store(t, codec)
+	r.RegisterTypeEncoder(t, codec)
+	r.RegisterTypeDecoder(t, codec)
+}
+
+// RegisterStringEnumFallback registers fallback as the value that strings which are not allowed
+// values of the string enum type t decode to. If t has not been registered using
+// RegisterStringEnum or fallback is not one of its allowed values, this method will panic.
+//
+// RegisterStringEnumFallback should not be called concurrently with any other Registry method.
+func (r *Registry) RegisterStringEnumFallback(t reflect.Type, fallback string) {
+	v, ok := r.stringEnums.Load(t)
+	if !ok {
+		panic(fmt.Errorf("RegisterStringEnumFallback expects a type registered using RegisterStringEnum, got %s", t))
+	}
+	codec := v.(*stringEnumCodec)
+	if _, ok := codec.allowed[fallback]; !ok {
+		panic(fmt.Errorf("RegisterStringEnumFallback fallback %q is not an allowed value of %s", fallback, t))
+	}
+	codec.fallback = fallback
+	codec.hasFallback = true
+}
+
+// RegisterChanAdapter registers a codec for the bidirectional channel type t. Decoding a BSON array
+// into a channel of type t sends each element to the channel as it is decoded and closes the
+// channel when done, so that a pipeline can consume the elements while the array is decoded. If
+// the channel is nil, a channel with a buffer large enough to hold every element is allocated.
+// Encoding a channel of type t drains it into a BSON array. mode determines whether sending and
+// receiving block (see ChanMode). If t is not a bidirectional channel type, this method will panic.
+//
+// RegisterChanAdapter should not be called concurrently with any other Registry method.
+func (r *Registry) RegisterChanAdapter(t reflect.Type, mode ChanMode) {
+	if t.Kind() != reflect.Chan || t.ChanDir() != reflect.BothDir {
+		panicStr := fmt.Errorf("RegisterChanAdapter expects a bidirectional channel type, got type %s", t)
+		panic(panicStr)
+	}
+	codec := &chanCodec{t: t, mode: mode}
+	r.RegisterTypeEncoder(t, codec)
+	r.RegisterTypeDecoder(t, codec)
+}
+
+// RegisterPackedSlice registers a codec for the numeric slice type t that encodes slices with more
+// elements than the threshold set using Encoder.PackArraysOver as a single BSON binary value in the
+// packing format spec, and other slices as BSON arrays. spec has the same form as the value of the
+// "packed" struct tag option, "<order>-<type>" (e.g. "le-f64"). Decoding accepts both BSON arrays
+// and packed binary, so the threshold can change without migrating stored documents. If spec is
+// invalid or does not match the element type of t, this method will panic.
+//
+// RegisterPackedSlice should not be called concurrently with any other Registry method.
+func (r *Registry) RegisterPackedSlice(t reflect.Type, spec string) {
+	packed, err := newPackedCodec(spec, t)
+	if err != nil {
+		panicStr := fmt.Errorf("RegisterPackedSlice: %w", err)
+		panic(panicStr)
+	}
+	codec := &autoPackedCodec{packed: packed}
+	r.RegisterTypeEncoder(t, codec)
+	r.RegisterTypeDecoder(t, codec)
+}
+
+// RegisterSchemaAliases registers aliases used when decoding BSON documents into the struct type
+// t, selected by the schema variant of each document. The variant is the string value of the
+// document's schemaKey element, which is read before any other element. aliases maps each variant
+// to a map from the keys used by documents of that variant to the BSON keys of the fields of t, so
+// that evolving documents can be decoded into a single struct type. Keys without an alias, and
+// documents without a schemaKey element or with an unregistered variant, are decoded as usual. If
+// the schemaKey element is not a string, decoding returns an error. If t is not a struct type,
+// this method will panic.
+//
+// RegisterSchemaAliases should not be called concurrently with any other Registry method.
+func (r *Registry) RegisterSchemaAliases(t reflect.Type, schemaKey string, aliases map[string]map[string]string) {
+	if t.Kind() != reflect.Struct {
+		panicStr := fmt.Errorf("RegisterSchemaAliases expects a type with kind reflect.Struct, "+
+			"got type %s with kind %s", t, t.Kind())
+		panic(panicStr)
+	}
+	r.schemaAliases.Store(t, &schemaAliases{key: schemaKey, variants: aliases})
+}
+
+// SetDominanceFunc sets the function used to choose which struct field is encoded and decoded
+// when multiple fields of a struct, including fields of inlined structs, have the same BSON key.
+// If fn is nil, Go's embedding rules are used: the shallowest field wins and fields at the same
+// depth are an error. PreferTaggedFields additionally lets a tagged field win over untagged fields
+// at the same depth.
+//
+// Struct descriptions are cached, so SetDominanceFunc must be called before the Registry is used
+// to encode or decode any struct. SetDominanceFunc should not be called concurrently with any other
+// Registry method.
+func (r *Registry) SetDominanceFunc(fn DominanceFunc) {
+	r.dominanceFunc = fn
+}
+
+// SetConflictRenameFunc sets the function used to rename struct fields whose BSON key conflicts
+// with the key of another field of the struct, including fields of inlined structs, instead of
+// dropping them or returning a duplicated key error. The field chosen by the DominanceFunc, or by
+// Go's embedding rules, keeps the key, and every other field with the key is encoded and decoded
+// under the key returned by fn. If no field dominates, the shallowest field that comes first in
+// declaration order keeps the key. PrefixFieldPath renames e.g. an "id" field of an inlined Parent
+// struct to "parent_id".
+//
+// Renaming changes the shape of the encoded BSON documents, so it should only be used for data
+// that is always decoded with the same setting. Struct descriptions are cached, so
+// SetConflictRenameFunc must be called before the Registry is used to encode or decode any
+// struct. SetConflictRenameFunc should not be called concurrently with any other Registry method.
+func (r *Registry) SetConflictRenameFunc(fn ConflictRenameFunc) {
+	r.conflictRename = fn
+}
+
+// SetOnDescribe sets the function called by the struct codec for each struct type it describes,
+// which can add synthetic fields that are encoded and decoded with every value of the type. If a
+// synthetic field has the same BSON key as a field of the struct, encoding and decoding values of
+// the struct type return an error. Synthetic fields are not added to structs that embed
+// PositionalArray.
+//
+// Struct descriptions are cached, so SetOnDescribe must be called before the Registry is used to
+// encode or decode any struct. SetOnDescribe should not be called concurrently with any other
+// Registry method.
+func (r *Registry) SetOnDescribe(fn OnDescribeFunc) {
+	r.onDescribe = fn
+}
+
+// SetErrorOnEmptyStruct sets whether encoding or decoding a struct type that has no fields mapped
+// to BSON keys and no inline map returns an error instead of producing or reading an empty
+// document. This catches structs whose fields were accidentally left unexported or are all
+// skipped using the "-" struct tag. It should not be set if empty marker structs are encoded or
+// decoded through the Registry.
+//
+// Struct descriptions are cached, so SetErrorOnEmptyStruct must be called before the Registry is
+// used to encode or decode any struct. SetErrorOnEmptyStruct should not be called concurrently
+// with any other Registry method.
+func (r *Registry) SetErrorOnEmptyStruct(on bool) {
+	r.errorOnEmptyStruct = on
+}
+
+// SetZeroStructs sets whether decoding into a Go struct through the Registry deletes any existing
+// values from the struct first, so that every struct decode starts from a clean struct. The
+// default applies to all struct decodes through the Registry and takes precedence over the
+// configuration of the struct codec (e.g. the struct codec in registries constructed using
+// NewMgoRegistry always zeroes structs). It can be overridden for a single Decoder using
+// Decoder.ZeroStructs or Decoder.PreserveStructs.
+//
+// SetZeroStructs should not be called concurrently with any other Registry method.
+func (r *Registry) SetZeroStructs(zero bool) {
+	r.zeroStructsDefault = zero
+	r.hasZeroStructsDefault = true
+}
+
+// SetOmitZeroStruct sets whether encoding through the Registry considers the zero value of a struct
+// empty, so that it is omitted by the "omitempty" struct tag option. The default applies to all
+// encodes through the Registry and takes precedence over the configuration of the struct codec
+// (e.g. the struct codec in registries constructed using NewMgoRegistry always omits zero
+// structs). It can be overridden for a single Encoder using Encoder.SetOmitZeroStruct.
+//
+// SetOmitZeroStruct should not be called concurrently with any other Registry method.
+func (r *Registry) SetOmitZeroStruct(omit bool) {
+	r.omitZeroStructDefault = omit
+	r.hasOmitZeroStructDefault = true
+}
+
+func (r *Registry) lookupTextEncoding(name string) (TextEncoding, bool) {
+	v, ok := r.textEncodings.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return v.(TextEncoding), true
+}
+
+func (r *Registry) lookupTransform(name string) (Transform, bool) {
+	v, ok := r.transforms.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return v.(Transform), true
+}
+
 // LookupEncoder returns the first matching encoder in the Registry. It uses the following lookup
 // order:
 //
@@ -0,0 +1,76 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// scalarAsCodec is the ValueDecoder used for struct and struct pointer fields with the "scalaras"
+// struct tag option. It decodes BSON documents with decoder and any other BSON value into the
+// designated primary field of a new struct value.
+type scalarAsCodec struct {
+	name           string // name of the primary field
+	idx            int    // index of the primary field
+	decoder        ValueDecoder
+	primaryDecoder ValueDecoder
+}
+
+// newScalarAsCodec returns a scalarAsCodec for fields of type t, which must be a struct or a
+// pointer to a struct with an exported field called name. decoder is used for BSON documents.
+func newScalarAsCodec(r *Registry, t reflect.Type, name string, decoder ValueDecoder) (*scalarAsCodec, error) {
+	st := t
+	if st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("scalaras requires a struct or struct pointer field, got %s", t)
+	}
+	sf, ok := st.FieldByName(name)
+	if !ok || sf.PkgPath != "" || len(sf.Index) != 1 {
+		return nil, fmt.Errorf("scalaras field %s does not exist in %s", name, st)
+	}
+	primaryDecoder, err := r.LookupDecoder(sf.Type)
+	if err != nil {
+		return nil, err
+	}
+	return &scalarAsCodec{name: name, idx: sf.Index[0], decoder: decoder, primaryDecoder: primaryDecoder}, nil
+}
+
+// DecodeValue decodes BSON documents, arrays, null, and undefined with the decoder of the field
+// type. Any other BSON value replaces the value of val with a new struct whose primary field is
+// set to the decoded value.
+func (sc *scalarAsCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	switch vr.Type() {
+	case Type(0), TypeEmbeddedDocument, TypeArray, TypeNull, TypeUndefined:
+		if sc.decoder == nil {
+			return errNoDecoder{Type: val.Type()}
+		}
+		return sc.decoder.DecodeValue(dc, vr, val)
+	}
+	if !val.CanSet() {
+		return ValueDecoderError{Name: "ScalarAsDecodeValue", Kinds: []reflect.Kind{reflect.Struct, reflect.Ptr}, Received: val}
+	}
+
+	var sv reflect.Value
+	if val.Kind() == reflect.Ptr {
+		sv = reflect.New(val.Type().Elem())
+	} else {
+		sv = reflect.New(val.Type())
+	}
+	vrType := vr.Type()
+	if err := sc.primaryDecoder.DecodeValue(dc, vr, sv.Elem().Field(sc.idx)); err != nil {
+		return fmt.Errorf("cannot decode %v into field %s of %s: %w", vrType, sc.name, sv.Elem().Type(), err)
+	}
+	if val.Kind() == reflect.Ptr {
+		val.Set(sv)
+	} else {
+		val.Set(sv.Elem())
+	}
+	return nil
+}
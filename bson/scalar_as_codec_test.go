@@ -0,0 +1,119 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
+	"go.mongodb.org/mongo-driver/v2/internal/require"
+)
+
+func TestScalarAsCodec(t *testing.T) {
+	t.Parallel()
+
+	type money struct {
+		Amount   int64  `bson:"amount"`
+		Currency string `bson:"currency"`
+	}
+	type order struct {
+		Price    money  `bson:"price,scalaras=Amount"`
+		Discount *money `bson:"discount,scalaras=Amount"`
+	}
+
+	testCases := []struct {
+		name string
+		doc  D
+		want order
+	}{
+		{
+			name: "documents",
+			doc: D{
+				{"price", D{{"amount", int64(5)}, {"currency", "EUR"}}},
+				{"discount", D{{"amount", int64(1)}}},
+			},
+			want: order{Price: money{Amount: 5, Currency: "EUR"}, Discount: &money{Amount: 1}},
+		},
+		{
+			name: "scalars",
+			doc:  D{{"price", int32(5)}, {"discount", int64(1)}},
+			want: order{Price: money{Amount: 5}, Discount: &money{Amount: 1}},
+		},
+		{
+			name: "null",
+			doc:  D{{"price", int32(5)}, {"discount", nil}},
+			want: order{Price: money{Amount: 5}},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc, err := Marshal(tc.doc)
+			require.NoError(t, err, "Marshal error")
+
+			got := order{Price: money{Currency: "USD"}}
+			err = Unmarshal(doc, &got)
+			require.NoError(t, err, "Unmarshal error")
+			assert.Equal(t, tc.want, got)
+		})
+	}
+	t.Run("encode is unchanged", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(order{Price: money{Amount: 5}})
+		require.NoError(t, err, "Marshal error")
+		assert.Equal(t, TypeEmbeddedDocument, Raw(doc).Lookup("price").Type)
+	})
+	t.Run("mismatched scalar type", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"price", "five"}})
+		require.NoError(t, err, "Marshal error")
+
+		var got order
+		err = Unmarshal(doc, &got)
+		var de *DecodeError
+		require.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"price"}, de.Keys())
+		assert.ErrorContains(t, err, "cannot decode string into field Amount of bson.money")
+	})
+
+	describeErrs := []struct {
+		name    string
+		val     any
+		wantErr string
+	}{
+		{
+			name: "missing field",
+			val: &struct {
+				Price money `bson:"price,scalaras=Value"`
+			}{},
+			wantErr: "field Price: scalaras field Value does not exist in bson.money",
+		},
+		{
+			name: "not a struct",
+			val: &struct {
+				Price int64 `bson:"price,scalaras=Amount"`
+			}{},
+			wantErr: "field Price: scalaras requires a struct or struct pointer field, got int64",
+		},
+	}
+	for _, tc := range describeErrs {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := Unmarshal([]byte{0x05, 0x00, 0x00, 0x00, 0x00}, tc.val)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
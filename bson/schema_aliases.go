@@ -0,0 +1,57 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// schemaAliases holds the aliases registered for a struct type using
+// Registry.RegisterSchemaAliases.
+type schemaAliases struct {
+	key      string
+	variants map[string]map[string]string
+}
+
+// lookupSchemaAliases returns the aliases for decoding the BSON document read from vr into the
+// struct type t, selected by the document's schema variant. If aliases are registered for t, the
+// document is buffered to read the schema key before any other element, and the returned
+// ValueReader must be used in place of vr. It returns nil aliases if none are registered for t or
+// the document has no schema key.
+func lookupSchemaAliases(dc DecodeContext, t reflect.Type, vr ValueReader) (map[string]string, ValueReader, error) {
+	if dc.Registry == nil {
+		return nil, vr, nil
+	}
+	v, ok := dc.schemaAliases.Load(t)
+	if !ok {
+		return nil, vr, nil
+	}
+	sa := v.(*schemaAliases)
+
+	doc, err := copyDocumentToBytes(vr)
+	if err != nil {
+		return nil, nil, err
+	}
+	vr = newBufferedValueReader(TypeEmbeddedDocument, doc)
+
+	schema, err := Raw(doc).LookupErr(sa.key)
+	if errors.Is(err, bsoncore.ErrElementNotFound) {
+		return nil, vr, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	variant, ok := schema.StringValueOK()
+	if !ok {
+		return nil, nil, fmt.Errorf("schema key %q must be a string, got %v", sa.key, schema.Type)
+	}
+	return sa.variants[variant], vr, nil
+}
@@ -0,0 +1,157 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SchemaReport describes the differences between a BSON document and the struct type it is
+// validated against by ValidateDocument.
+type SchemaReport struct {
+	// Missing holds the BSON keys of the struct fields that are not present in the document, in
+	// field order. Fields with the "omitempty", "omitzero", or "glob" struct tag options are not
+	// reported as missing.
+	Missing []string
+
+	// Unexpected holds the keys of the document that do not match a struct field, in document
+	// order. If the struct has an inline map, only keys without its prefix are unexpected. If
+	// the struct has an inline bson.Raw field, no keys are unexpected.
+	Unexpected []string
+
+	// Mismatches holds the values of the document that cannot be decoded into the type of their
+	// struct field, in document order.
+	Mismatches []SchemaMismatch
+}
+
+// SchemaMismatch describes a value of a BSON document that cannot be decoded into the type of its
+// struct field.
+type SchemaMismatch struct {
+	// Key is the key of the value in the document.
+	Key string
+
+	// Type is the BSON type of the value.
+	Type Type
+
+	// GoType is the Go type of the struct field.
+	GoType reflect.Type
+
+	// Err is the error returned when decoding the value into GoType.
+	Err error
+}
+
+// Valid reports whether the document matches the struct type, i.e. whether the report is empty.
+func (sr *SchemaReport) Valid() bool {
+	return len(sr.Missing) == 0 && len(sr.Unexpected) == 0 && len(sr.Mismatches) == 0
+}
+
+// ValidateDocument compares the BSON document raw with the struct type t as described by the struct
+// codec registered in r, and reports missing fields, unexpected keys, and values whose BSON type
+// cannot be decoded into the type of their field. Each value is decoded on its own using the
+// decoder of its field, so no value of type t is populated and all differences are reported
+// instead of only the first one. It returns an error if raw is not a valid BSON document, if t is
+// not encoded by the struct codec, or if t cannot be described (e.g. because of invalid struct tags).
+//
+// Values of struct fields added by an OnDescribeFunc are not type checked.
+func ValidateDocument(r *Registry, t reflect.Type, raw []byte) (*SchemaReport, error) {
+	if r == nil {
+		return nil, ErrNilRegistry
+	}
+	if err := Raw(raw).Validate(); err != nil {
+		return nil, err
+	}
+	decoder, err := r.LookupDecoder(t)
+	if err != nil {
+		return nil, err
+	}
+	sc, ok := decoder.(*structCodec)
+	if !ok {
+		return nil, fmt.Errorf("ValidateDocument requires a type decoded by the struct codec, got %s", t)
+	}
+	sd, err := sc.describeStruct(r, t, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if sd.positions != nil {
+		return nil, fmt.Errorf("ValidateDocument cannot validate %s, which is decoded from a BSON array", t)
+	}
+
+	elems, err := Raw(raw).Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SchemaReport{}
+	dc := DecodeContext{Registry: r}
+	seen := make(map[string]struct{}, len(elems))
+	for _, elem := range elems {
+		key := elem.Key()
+		val := elem.Value()
+
+		fd, exists := sd.fm[key]
+		if !exists {
+			// Match the struct codec, which also tries the key in lowercase.
+			fd, exists = sd.fm[strings.ToLower(key)]
+		}
+		if !exists {
+			if glob, ok := matchGlob(sd.globs, key); ok {
+				report.check(dc, key, val, fieldType(t, glob).Elem(), nil)
+				continue
+			}
+			if sd.inlineRaw >= 0 || sd.inlineSetter >= 0 {
+				continue
+			}
+			if sd.inlineMap >= 0 && strings.HasPrefix(key, sd.inlinePrefix) {
+				report.check(dc, key, val, t.Field(sd.inlineMap).Type.Elem(), nil)
+				continue
+			}
+			report.Unexpected = append(report.Unexpected, key)
+			continue
+		}
+
+		seen[fd.name] = struct{}{}
+		if fd.synthetic || fd.mirrored {
+			continue
+		}
+		report.check(dc, key, val, fieldType(t, fd), fd.decoder)
+	}
+
+	for _, fd := range sd.fl {
+		if fd.omitEmpty || fd.omitZero || fd.glob || fd.synthetic || fd.mirrored {
+			continue
+		}
+		if _, ok := seen[fd.name]; !ok {
+			report.Missing = append(report.Missing, fd.name)
+		}
+	}
+	return report, nil
+}
+
+// check decodes val into a new value of type t using decoder, or the decoder registered for t if
+// decoder is nil, and records a SchemaMismatch if decoding fails.
+func (sr *SchemaReport) check(dc DecodeContext, key string, val RawValue, t reflect.Type, decoder ValueDecoder) {
+	var err error
+	if decoder == nil {
+		decoder, err = dc.LookupDecoder(t)
+	}
+	if err == nil {
+		err = decoder.DecodeValue(dc, newBufferedValueReader(val.Type, val.Value), reflect.New(t).Elem())
+	}
+	if err != nil {
+		sr.Mismatches = append(sr.Mismatches, SchemaMismatch{Key: key, Type: val.Type, GoType: t, Err: err})
+	}
+}
+
+// fieldType returns the type of the field of the struct type t described by fd.
+func fieldType(t reflect.Type, fd fieldDescription) reflect.Type {
+	if fd.inline == nil {
+		return t.Field(fd.idx).Type
+	}
+	return t.FieldByIndex(fd.inline).Type
+}
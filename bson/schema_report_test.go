@@ -0,0 +1,120 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
+	"go.mongodb.org/mongo-driver/v2/internal/require"
+)
+
+func TestValidateDocument(t *testing.T) {
+	t.Parallel()
+
+	type address struct {
+		City string `bson:"city"`
+	}
+	type customer struct {
+		ID      int64             `bson:"_id"`
+		Name    string            `bson:"name"`
+		Email   string            `bson:"email,omitempty"`
+		Age     int32             `bson:"age"`
+		Address address           `bson:"address"`
+		Labels  map[string]string `bson:"label_*,glob"`
+	}
+	type withInline struct {
+		Name  string         `bson:"name"`
+		Extra map[string]int `bson:",inline"`
+	}
+
+	testCases := []struct {
+		name string
+		t    reflect.Type
+		doc  D
+		want SchemaReport
+	}{
+		{
+			name: "valid",
+			t:    reflect.TypeOf(customer{}),
+			doc: D{
+				{"_id", int64(1)},
+				{"name", "Ada"},
+				{"age", int32(36)},
+				{"address", D{{"city", "London"}}},
+				{"label_tier", "gold"},
+			},
+			want: SchemaReport{},
+		},
+		{
+			name: "missing, unexpected, and mismatched",
+			t:    reflect.TypeOf(customer{}),
+			doc: D{
+				{"_id", "one"},
+				{"nickname", "A"},
+				{"age", 36.5},
+				{"address", D{{"city", int32(1)}}},
+				{"label_tier", true},
+			},
+			want: SchemaReport{
+				Missing:    []string{"name"},
+				Unexpected: []string{"nickname"},
+				Mismatches: []SchemaMismatch{
+					{Key: "_id", Type: TypeString, GoType: reflect.TypeOf(int64(0))},
+					{Key: "age", Type: TypeDouble, GoType: reflect.TypeOf(int32(0))},
+					{Key: "address", Type: TypeEmbeddedDocument, GoType: reflect.TypeOf(address{})},
+					{Key: "label_tier", Type: TypeBoolean, GoType: reflect.TypeOf("")},
+				},
+			},
+		},
+		{
+			name: "inline map",
+			t:    reflect.TypeOf(withInline{}),
+			doc:  D{{"name", "x"}, {"a", int32(1)}, {"b", "two"}},
+			want: SchemaReport{
+				Mismatches: []SchemaMismatch{
+					{Key: "b", Type: TypeString, GoType: reflect.TypeOf(int(0))},
+				},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			raw, err := Marshal(tc.doc)
+			require.NoError(t, err, "Marshal error")
+
+			got, err := ValidateDocument(NewRegistry(), tc.t, raw)
+			require.NoError(t, err, "ValidateDocument error")
+			for i := range got.Mismatches {
+				assert.Error(t, got.Mismatches[i].Err, "expected an error for key %q", got.Mismatches[i].Key)
+				got.Mismatches[i].Err = nil
+			}
+			assert.Equal(t, tc.want, *got)
+			assert.Equal(t, len(tc.want.Missing)+len(tc.want.Unexpected)+len(tc.want.Mismatches) == 0, got.Valid())
+		})
+	}
+	t.Run("not a struct", func(t *testing.T) {
+		t.Parallel()
+
+		raw, err := Marshal(D{{"a", int32(1)}})
+		require.NoError(t, err, "Marshal error")
+
+		_, err = ValidateDocument(NewRegistry(), reflect.TypeOf(M{}), raw)
+		assert.ErrorContains(t, err, "requires a type decoded by the struct codec")
+	})
+	t.Run("invalid document", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ValidateDocument(NewRegistry(), reflect.TypeOf(customer{}), []byte{0x01})
+		assert.Error(t, err)
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
 )
 
 // sliceCodec is the Codec used for slice values.
@@ -66,10 +67,16 @@ func (sc *sliceCodec) EncodeValue(ec EncodeContext, vw ValueWriter, val reflect.
 		return err
 	}
 
+	// Slices of structs encoded by the struct codec use its specialized path, which resolves the
+	// struct description once for all elements.
+	if structEnc, ok := encoder.(*structCodec); ok && elemType.Kind() == reflect.Struct {
+		return structEnc.encodeSlice(ec, aw, val)
+	}
+
 	for idx := 0; idx < val.Len(); idx++ {
 		currEncoder, currVal, lookupErr := lookupElementEncoder(ec, encoder, val.Index(idx))
 		if lookupErr != nil && !errors.Is(lookupErr, errInvalidValue) {
-			return lookupErr
+			return newEncodeError(strconv.Itoa(idx), lookupErr)
 		}
 
 		vw, err := aw.WriteArrayElement()
@@ -87,7 +94,7 @@ func (sc *sliceCodec) EncodeValue(ec EncodeContext, vw ValueWriter, val reflect.
 
 		err = currEncoder.EncodeValue(ec, vw, currVal)
 		if err != nil {
-			return err
+			return newEncodeError(strconv.Itoa(idx), err)
 		}
 	}
 	return aw.WriteArrayEnd()
@@ -149,6 +156,10 @@ func (sc *sliceCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.
 		return fmt.Errorf("cannot decode %v into a slice", vrType)
 	}
 
+	if eType := val.Type().Elem(); dc.reuseSliceElements && eType != tE && eType.Kind() != reflect.Interface {
+		return decodeReusedElements(dc, vr, val)
+	}
+
 	var elemsFunc func(DecodeContext, ValueReader, reflect.Value) ([]reflect.Value, error)
 	switch val.Type().Elem() {
 	case tE:
@@ -171,3 +182,49 @@ func (sc *sliceCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.
 
 	return nil
 }
+
+// decodeReusedElements decodes the BSON array read from vr into the elements of the backing array
+// of the slice val, growing it only if the array has more elements than the capacity of val. Each
+// element is set to its zero value before it is decoded, so no field of a previously decoded
+// element is kept.
+func decodeReusedElements(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	ar, err := vr.ReadArray()
+	if err != nil {
+		return err
+	}
+	eType := val.Type().Elem()
+	decoder, err := dc.LookupDecoder(eType)
+	if err != nil {
+		return err
+	}
+
+	if val.IsNil() {
+		val.Set(reflect.MakeSlice(val.Type(), 0, 0))
+	}
+	zero := reflect.Zero(eType)
+	idx := 0
+	for {
+		evr, err := ar.ReadValue()
+		if errors.Is(err, ErrEOA) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if idx < val.Cap() {
+			val.SetLen(idx + 1)
+		} else {
+			val.Set(reflect.Append(val, zero))
+		}
+		elem := val.Index(idx)
+		elem.Set(zero)
+		if err := decoder.DecodeValue(dc, evr, elem); err != nil {
+			return newDecodeError(strconv.Itoa(idx), err)
+		}
+		idx++
+	}
+
+	val.SetLen(idx)
+	return nil
+}
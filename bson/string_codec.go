@@ -41,12 +41,21 @@ func (sc *stringCodec) decodeType(dc DecodeContext, vr ValueReader, t reflect.Ty
 			Received: reflect.Zero(t),
 		}
 	}
+	checkLegacy(dc, vr.Type(), t)
 
 	var str string
 	var err error
 	switch vr.Type() {
 	case TypeString:
-		str, err = vr.ReadString()
+		if dc.stringTable != nil {
+			if ir, ok := vr.(internedStringReader); ok {
+				str, err = ir.readInternedString(dc.stringTable)
+			} else if str, err = vr.ReadString(); err == nil {
+				str = dc.stringTable.Intern(str)
+			}
+		} else {
+			str, err = vr.ReadString()
+		}
 		if err != nil {
 			return emptyValue, err
 		}
@@ -91,7 +100,10 @@ func (sc *stringCodec) decodeType(dc DecodeContext, vr ValueReader, t reflect.Ty
 	return reflect.ValueOf(str), nil
 }
 
-// DecodeValue is the ValueDecoder for string types.
+// DecodeValue is the ValueDecoder for string types. Besides BSON strings, it accepts values of the
+// deprecated BSON symbol type, generic binary values, and object IDs if
+// Decoder.ObjectIDAsHexString is set. BSON null and undefined values are decoded as the empty
+// string. Use Decoder.ReadRepair to find values stored with the deprecated types.
 func (sc *stringCodec) DecodeValue(dctx DecodeContext, vr ValueReader, val reflect.Value) error {
 	if !val.CanSet() || val.Kind() != reflect.String {
 		return ValueDecoderError{Name: "StringDecodeValue", Kinds: []reflect.Kind{reflect.String}, Received: val}
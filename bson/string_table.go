@@ -0,0 +1,79 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import "sync"
+
+// StringTable interns the BSON string values decoded into Go values of a string kind, such as
+// struct fields holding status or category names, so that equal values share a single allocation.
+// It is set using Decoder.SetStringTable and can be shared by Decoders used concurrently.
+//
+// A StringTable holds at most the number of strings it was created with. Once it is full, values
+// that are not in the table are allocated as usual, so a table should be sized for the set of
+// repeated values and reset if that set changes.
+type StringTable struct {
+	mu      sync.Mutex
+	strs    map[string]string
+	maxSize int
+}
+
+// NewStringTable returns a StringTable that holds at most maxSize strings. If maxSize is not
+// positive, the number of strings is not limited.
+func NewStringTable(maxSize int) *StringTable {
+	return &StringTable{strs: make(map[string]string), maxSize: maxSize}
+}
+
+// Intern returns the string in st that is equal to s, adding s to st if there is none and st is
+// not full.
+func (st *StringTable) Intern(s string) string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if interned, ok := st.strs[s]; ok {
+		return interned
+	}
+	st.add(s)
+	return s
+}
+
+// internBytes is like Intern but does not allocate a string for b if it is in st.
+func (st *StringTable) internBytes(b []byte) string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	// The compiler does not allocate a string for a map lookup with a converted []byte key.
+	if interned, ok := st.strs[string(b)]; ok {
+		return interned
+	}
+	s := string(b)
+	st.add(s)
+	return s
+}
+
+// add adds s to st if st is not full. The caller must hold st.mu.
+func (st *StringTable) add(s string) {
+	if st.maxSize > 0 && len(st.strs) >= st.maxSize {
+		return
+	}
+	st.strs[s] = s
+}
+
+// Len returns the number of strings in st.
+func (st *StringTable) Len() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return len(st.strs)
+}
+
+// Reset removes all strings from st.
+func (st *StringTable) Reset() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.strs = make(map[string]string)
+}
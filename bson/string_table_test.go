@@ -0,0 +1,124 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
+	"go.mongodb.org/mongo-driver/v2/internal/require"
+)
+
+type stringTableOrder struct {
+	ID       int32             `bson:"_id"`
+	Status   string            `bson:"status"`
+	Category string            `bson:"category"`
+	Tags     []string          `bson:"tags"`
+	Extra    map[string]string `bson:"extra"`
+	Any      any               `bson:"any"`
+}
+
+// stringData returns the address of the bytes of s.
+func stringData(s string) uintptr {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+}
+
+func TestStringTable(t *testing.T) {
+	t.Parallel()
+
+	t.Run("decoder", func(t *testing.T) {
+		t.Parallel()
+
+		st := NewStringTable(0)
+		decode := func(doc D) stringTableOrder {
+			dec := NewDecoder(NewDocumentReader(bytes.NewReader(mustMarshal(t, doc))))
+			dec.SetStringTable(st)
+			var got stringTableOrder
+			require.NoError(t, dec.Decode(&got), "Decode error")
+			return got
+		}
+		doc := D{
+			{"_id", int32(1)},
+			{"status", "shipped"},
+			{"category", "books"},
+			{"tags", A{"shipped"}},
+			{"extra", D{{"k", "books"}}},
+			{"any", "shipped"},
+		}
+		first, second := decode(doc), decode(doc)
+
+		assert.Equal(t, first, second)
+		assert.Equal(t, stringData(first.Status), stringData(second.Status), "expected a shared status")
+		assert.Equal(t, stringData(first.Status), stringData(second.Tags[0]), "expected a shared slice element")
+		assert.Equal(t, stringData(first.Category), stringData(second.Extra["k"]), "expected a shared map value")
+		assert.Equal(t, stringData(first.Status), stringData(second.Any.(string)), "expected a shared interface value")
+		assert.Equal(t, 2, st.Len())
+	})
+	t.Run("max size", func(t *testing.T) {
+		t.Parallel()
+
+		st := NewStringTable(1)
+		a := st.Intern(string([]byte("a")))
+		assert.Equal(t, stringData(a), stringData(st.Intern(string([]byte("a")))), "expected an interned string")
+		b := string([]byte("b"))
+		assert.Equal(t, stringData(b), stringData(st.Intern(b)), "expected the string itself when full")
+		assert.Equal(t, 1, st.Len())
+
+		st.Reset()
+		assert.Equal(t, 0, st.Len())
+		assert.Equal(t, stringData(b), stringData(st.Intern(b)), "expected the string to be added after Reset")
+		assert.Equal(t, 1, st.Len())
+	})
+}
+
+func BenchmarkStringTable(b *testing.B) {
+	statuses := []string{"pending", "shipped", "delivered", "returned"}
+	categories := []string{"books", "music", "garden", "toys", "games"}
+
+	docs := make([][]byte, 1000)
+	for i := range docs {
+		doc, err := Marshal(D{
+			{"_id", int32(i)},
+			{"status", statuses[i%len(statuses)]},
+			{"category", categories[i%len(categories)]},
+			{"tags", A{fmt.Sprintf("priority-%d", i%3)}},
+		})
+		require.NoError(b, err, "Marshal error")
+		docs[i] = doc
+	}
+
+	for _, bm := range []struct {
+		name string
+		st   func() *StringTable
+	}{
+		{"without table", func() *StringTable { return nil }},
+		{"with table", func() *StringTable { return NewStringTable(64) }},
+	} {
+		bm := bm
+
+		b.Run(bm.name, func(b *testing.B) {
+			st := bm.st()
+			orders := make([]stringTableOrder, len(docs))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j, doc := range docs {
+					dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+					dec.SetStringTable(st)
+					orders[j] = stringTableOrder{}
+					if err := dec.Decode(&orders[j]); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
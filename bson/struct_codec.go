@@ -7,18 +7,25 @@
 package bson
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
+	"path"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
 )
 
 // DecodeError represents an error that occurs when unmarshalling BSON bytes into a native Go type.
 type DecodeError struct {
 	keys    []string
+	fields  []string // Go struct field names parallel to keys, "" for keys that are not struct fields
 	wrapped error
 }
 
@@ -32,6 +39,20 @@ func (de *DecodeError) Error() string {
 	// The keys are stored in reverse order because the de.keys slice is builtup while propagating the error up the
 	// stack of BSON keys, so we call de.Keys(), which reverses them.
 	keyPath := strings.Join(de.Keys(), ".")
+
+	// If any key differs from its struct field name, also report the path of Go field names, using
+	// the keys for elements that are not struct fields.
+	fieldPath := make([]string, 0, len(de.keys))
+	for idx := len(de.keys) - 1; idx >= 0; idx-- {
+		if idx < len(de.fields) && de.fields[idx] != "" {
+			fieldPath = append(fieldPath, de.fields[idx])
+		} else {
+			fieldPath = append(fieldPath, de.keys[idx])
+		}
+	}
+	if fields := strings.Join(fieldPath, "."); fields != keyPath {
+		return fmt.Sprintf("error decoding key %s (field %s): %v", keyPath, fields, de.wrapped)
+	}
 	return fmt.Sprintf("error decoding key %s: %v", keyPath, de.wrapped)
 }
 
@@ -47,14 +68,129 @@ func (de *DecodeError) Keys() []string {
 	return reversedKeys
 }
 
-// mapElementsEncoder handles encoding of the values of an inline  map.
+// FieldNames returns the Go struct field names of the keys returned by Keys, in the same order.
+// The name is an empty string for keys that are not struct fields, such as array indexes and map
+// keys. For example, if a struct field CreatedAt has the BSON key "createdAt", the field name for
+// the key "createdAt" is "CreatedAt".
+func (de *DecodeError) FieldNames() []string {
+	reversedFields := make([]string, 0, len(de.keys))
+	for idx := len(de.keys) - 1; idx >= 0; idx-- {
+		var field string
+		if idx < len(de.fields) {
+			field = de.fields[idx]
+		}
+		reversedFields = append(reversedFields, field)
+	}
+
+	return reversedFields
+}
+
+// EncodeError represents an error that occurs when marshaling a value of a struct field, or an
+// element of a slice or map inside one, to BSON. Like DecodeError, it reports the BSON key path of
+// the value that could not be encoded.
+type EncodeError struct {
+	keys    []string
+	fields  []string // Go struct field names parallel to keys, "" for keys that are not struct fields
+	wrapped error
+}
+
+// Unwrap returns the underlying error.
+func (ee *EncodeError) Unwrap() error {
+	return ee.wrapped
+}
+
+// Error implements the error interface.
+func (ee *EncodeError) Error() string {
+	keyPath := strings.Join(ee.Keys(), ".")
+
+	// As for DecodeError, also report the path of Go field names if it differs from the keys.
+	fieldPath := make([]string, 0, len(ee.keys))
+	for idx := len(ee.keys) - 1; idx >= 0; idx-- {
+		if ee.fields[idx] != "" {
+			fieldPath = append(fieldPath, ee.fields[idx])
+		} else {
+			fieldPath = append(fieldPath, ee.keys[idx])
+		}
+	}
+	if fields := strings.Join(fieldPath, "."); fields != keyPath {
+		return fmt.Sprintf("error encoding key %s (field %s): %v", keyPath, fields, ee.wrapped)
+	}
+	return fmt.Sprintf("error encoding key %s: %v", keyPath, ee.wrapped)
+}
+
+// Keys returns the BSON key path of the value that could not be encoded, in top-down order. For
+// example, if the struct field with the key "c" in the document {a: {b: {c: ...}}} could not be
+// encoded, the keys are ["a", "b", "c"].
+func (ee *EncodeError) Keys() []string {
+	keys := make([]string, 0, len(ee.keys))
+	for idx := len(ee.keys) - 1; idx >= 0; idx-- {
+		keys = append(keys, ee.keys[idx])
+	}
+	return keys
+}
+
+// FieldNames returns the Go struct field names of the keys returned by Keys, in the same order.
+// The name is an empty string for keys that are not struct fields, such as array indexes and map
+// keys.
+func (ee *EncodeError) FieldNames() []string {
+	fields := make([]string, 0, len(ee.keys))
+	for idx := len(ee.keys) - 1; idx >= 0; idx-- {
+		fields = append(fields, ee.fields[idx])
+	}
+	return fields
+}
+
+// decodeErrors holds the errors of the elements of a BSON document that could not be decoded into
+// a struct when DecodeContext.accumulateErrors is set. Like the errors returned by errors.Join, its
+// message joins the messages of the errors with newlines and the errors are returned by Unwrap.
+type decodeErrors []error
+
+// Error implements the error interface.
+func (errs decodeErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the accumulated errors.
+func (errs decodeErrors) Unwrap() []error {
+	return errs
+}
+
+// PositionalArray is a marker type that causes a struct embedding it to be encoded as a BSON array
+// instead of a BSON document. Either every other field of the struct sets its position in the
+// array using the "pos=<N>" struct tag option, or none does and the fields are written in
+// declaration order. Positions that are not assigned to a field are written as BSON null. When
+// decoding, a BSON array is read positionally into the fields of the struct. The "omitempty" and
+// "omitzero" struct tag options cannot be used, since omitting a field would shift the positions
+// of the following fields.
+//
+// For example:
+//
+//	type Point struct {
+//		bson.PositionalArray
+//		X int `bson:"x,pos=0"`
+//		Y int `bson:"y,pos=1"`
+//	}
+//
+// encodes Point{X: 1, Y: 2} as the BSON array [1, 2], as does the same struct without the "pos"
+// struct tag options.
+type PositionalArray struct{}
+
+var tPositionalArray = reflect.TypeOf(PositionalArray{})
+
+// mapElementsEncoder handles encoding of the values of an inline  map. The mapKeyCollisionFunc
+// receives each key as its original value as well as its encoded string.
 type mapElementsEncoder interface {
-	encodeMapElements(EncodeContext, DocumentWriter, reflect.Value, func(string) bool) error
+	encodeMapElements(EncodeContext, DocumentWriter, reflect.Value, string, mapKeyCollisionFunc) error
 }
 
 // structCodec is the Codec used for struct values.
 type structCodec struct {
-	cache            sync.Map // map[reflect.Type]*structDescription
+	cache            sync.Map // map[reflect.Type or describeKey]*structDescription
+	inflight         sync.Map // map[reflect.Type or describeKey]*describeCall
 	inlineMapEncoder mapElementsEncoder
 
 	// decodeZeroStruct causes DecodeValue to delete any existing values from Go structs in the
@@ -97,41 +233,286 @@ func (sc *structCodec) EncodeValue(ec EncodeContext, vw ValueWriter, val reflect
 	if !val.IsValid() || val.Kind() != reflect.Struct {
 		return ValueEncoderError{Name: "StructCodec.EncodeValue", Kinds: []reflect.Kind{reflect.Struct}, Received: val}
 	}
+	discriminator := ec.discriminator
+	ec.discriminator = ""
+
+	sd, err := sc.describeStruct(ec.Registry, val.Type(), ec.useJSONStructTags, ec.errorOnInlineDuplicates, ec.nameTransformer)
+	if err != nil {
+		return err
+	}
+
+	if sd.skipEncode(val) {
+		return writeEmptyDocument(vw)
+	}
+	if m, ok := sd.rawBSONMarshaler(val); ok {
+		return encodeRawBSON(vw, m)
+	}
+
+	if sd.positions != nil {
+		return sc.encodePositional(ec, vw, val, sd)
+	}
+	return sc.encodeDocument(ec, vw, val, sd, discriminator, sd.collisionFn(discriminator, ec.ttl > 0))
+}
+
+// encodeSlice encodes each element of the slice or array of structs val to aw. It is used by the
+// slice and array encoders when the element type is encoded by sc, so that the struct description
+// and the collision function are resolved once for the whole slice instead of once per element.
+// The output is identical to calling EncodeValue for each element.
+func (sc *structCodec) encodeSlice(ec EncodeContext, aw ArrayWriter, val reflect.Value) error {
+	ec.discriminator = ""
+
+	sd, err := sc.describeStruct(ec.Registry, val.Type().Elem(), ec.useJSONStructTags, ec.errorOnInlineDuplicates, ec.nameTransformer)
+	if err != nil {
+		return err
+	}
+	collisionFn := sd.collisionFn("", ec.ttl > 0)
+
+	for idx := 0; idx < val.Len(); idx++ {
+		vw, err := aw.WriteArrayElement()
+		if err != nil {
+			return err
+		}
+		if sd.skipEncode(val.Index(idx)) {
+			err = writeEmptyDocument(vw)
+		} else if m, ok := sd.rawBSONMarshaler(val.Index(idx)); ok {
+			err = encodeRawBSON(vw, m)
+		} else if sd.positions != nil {
+			err = sc.encodePositional(ec, vw, val.Index(idx), sd)
+		} else {
+			err = sc.encodeDocument(ec, vw, val.Index(idx), sd, "", collisionFn)
+		}
+		if err != nil {
+			return newEncodeError(strconv.Itoa(idx), err)
+		}
+	}
+	return aw.WriteArrayEnd()
+}
+
+// skipEncode reports whether the struct val described by sd implements EncodeSkipper, directly or
+// through a pointer if val is addressable, and its ShouldEncode method returns false.
+func (sd *structDescription) skipEncode(val reflect.Value) bool {
+	if sd.skipper {
+		return !val.Interface().(EncodeSkipper).ShouldEncode()
+	}
+	if sd.ptrSkipper && val.CanAddr() {
+		return !val.Addr().Interface().(EncodeSkipper).ShouldEncode()
+	}
+	return false
+}
+
+// rawBSONMarshaler returns the struct val described by sd as a RawBSONMarshaler if it implements
+// the interface, directly or through a pointer if val is addressable.
+func (sd *structDescription) rawBSONMarshaler(val reflect.Value) (RawBSONMarshaler, bool) {
+	if sd.rawMarshaler {
+		return val.Interface().(RawBSONMarshaler), true
+	}
+	if sd.ptrRawMarshaler && val.CanAddr() {
+		return val.Addr().Interface().(RawBSONMarshaler), true
+	}
+	return nil, false
+}
+
+// encodeRawBSON writes the document returned by the MarshalRawBSON method of m to vw. It returns an
+// error if the length prefix of the document does not match its length or the document does not
+// end with a null byte.
+func encodeRawBSON(vw ValueWriter, m RawBSONMarshaler) error {
+	data, err := m.MarshalRawBSON()
+	if err != nil {
+		return err
+	}
+	length, _, ok := bsoncore.ReadLength(data)
+	if !ok || length < 5 || int(length) != len(data) || data[len(data)-1] != 0x00 {
+		return fmt.Errorf("MarshalRawBSON returned an invalid BSON document of %d bytes", len(data))
+	}
+	return copyValueFromBytes(vw, TypeEmbeddedDocument, data)
+}
 
-	sd, err := sc.describeStruct(ec.Registry, val.Type(), ec.useJSONStructTags, ec.errorOnInlineDuplicates)
+// writeEmptyDocument writes an empty BSON document to vw.
+func writeEmptyDocument(vw ValueWriter) error {
+	dw, err := vw.WriteDocument()
 	if err != nil {
 		return err
 	}
+	return dw.WriteDocumentEnd()
+}
+
+// collisionFn returns the function used to check whether a key of an inline or glob map collides
+// with a field of the struct, with the discriminator key, if discriminator is set, or with the
+// key of a companion expiry, if ttl is set.
+func (sd *structDescription) collisionFn(discriminator string, ttl bool) func(key string) bool {
+	return func(key string) bool {
+		if _, exists := sd.fm[key]; exists {
+			return true
+		}
+		if ttl {
+			for _, ttlKey := range sd.ttlKeys {
+				if key == ttlKey {
+					return true
+				}
+			}
+		}
+		return discriminator != "" && key == discriminatorKey
+	}
+}
+
+// contextCheckInterval is the number of fields or elements that the struct codec encodes or
+// decodes between checks of the context set using Encoder.SetContext or Decoder.SetContext.
+const contextCheckInterval = 64
+
+// checkContext returns the error of ctx if it is done and n, the number of fields or elements
+// processed so far in a document, is a multiple of contextCheckInterval. It is a no-op if ctx is
+// nil.
+func checkContext(ctx context.Context, n int) error {
+	if ctx == nil || n%contextCheckInterval != 0 {
+		return nil
+	}
+	return ctx.Err()
+}
 
+// encodeDocument encodes the struct val described by sd as a BSON document, writing discriminator
+// as its first element if it is set.
+func (sc *structCodec) encodeDocument(
+	ec EncodeContext,
+	vw ValueWriter,
+	val reflect.Value,
+	sd *structDescription,
+	discriminator string,
+	collisionFn func(key string) bool,
+) error {
 	dw, err := vw.WriteDocument()
 	if err != nil {
 		return err
 	}
+	if discriminator != "" {
+		if _, exists := sd.fm[discriminatorKey]; exists {
+			return fmt.Errorf("discriminator key %q collides with a field of %s", discriminatorKey, val.Type())
+		}
+		vw2, err := dw.WriteDocumentElement(discriminatorKey)
+		if err != nil {
+			return err
+		}
+		if err := vw2.WriteString(discriminator); err != nil {
+			return err
+		}
+	}
+
+	// hashed holds the encoded values of the fields hashed by "hashof" fields.
+	var hashed map[string]RawValue
+	if sd.hashes {
+		hashed = make(map[string]RawValue)
+	}
+
+	base := documentEncodeContext(ec, val)
+
 	var rv reflect.Value
-	for _, desc := range sd.fl {
+	for i, desc := range sd.fl {
+		if err := checkContext(ec.ctx, i); err != nil {
+			return err
+		}
+		if desc.projector != nil {
+			if err := sc.encodeProjected(ec, dw, val, desc); err != nil {
+				return err
+			}
+			continue
+		}
+		if desc.synthetic {
+			if desc.encoder == nil {
+				continue
+			}
+			if err := encodeFieldHook(ec, desc, val.Type()); err != nil {
+				return err
+			}
+			vw2, err := dw.WriteDocumentElement(desc.name)
+			if err != nil {
+				return err
+			}
+			if err := desc.encoder.EncodeValue(ec, vw2, val); err != nil {
+				return newFieldEncodeError(desc.name, desc.fieldName, err)
+			}
+			continue
+		}
+		if desc.mirrored || desc.readOnly {
+			// The value is derived from the field it mirrors, or is never encoded.
+			continue
+		}
+		if desc.ttlCompanion && ec.ttl > 0 {
+			// The value is computed when encoding the field the expiry belongs to.
+			continue
+		}
+		if desc.hashOf != nil {
+			t, data, err := fieldHash(ec.newHash, desc, hashed)
+			if err != nil {
+				return newFieldEncodeError(desc.name, desc.fieldName, err)
+			}
+			if err := encodeFieldHook(ec, desc, fieldType(val.Type(), desc)); err != nil {
+				return err
+			}
+			vw2, err := dw.WriteDocumentElement(desc.name)
+			if err != nil {
+				return err
+			}
+			if err := copyValueFromBytes(vw2, t, data); err != nil {
+				return err
+			}
+			continue
+		}
+
 		if desc.inline == nil {
 			rv = val.Field(desc.idx)
 		} else {
 			rv, err = fieldByIndexErr(val, desc.inline)
 			if err != nil {
-				continue
+				// The field is in an inline struct behind a nil pointer.
+				if !ec.nilInlineAsZero {
+					continue
+				}
+				rv = reflect.Zero(val.Type().FieldByIndex(desc.inline).Type)
 			}
 		}
 
+		if desc.omitZero && isZero(rv) {
+			continue
+		}
+
+		if ec.omitNilPointers && rv.Kind() == reflect.Ptr && rv.IsNil() {
+			continue
+		}
+
 		if ec.omitEmpty {
 			desc.omitEmpty = true
 		}
 
+		if desc.glob {
+			// Keys that don't match the pattern could not be decoded back into the map.
+			for _, key := range rv.MapKeys() {
+				if ok, _ := path.Match(desc.name, key.String()); !ok {
+					return newFieldEncodeError(desc.name, desc.fieldName,
+						fmt.Errorf("key %q does not match the glob pattern", key.String()))
+				}
+			}
+			if err := encodeFieldHook(ec, desc, rv.Type()); err != nil {
+				return err
+			}
+			gec := fieldEncodeContext(base, desc)
+			if err := sc.inlineMapEncoder.encodeMapElements(gec, dw, rv, "", stringKeyCollision(collisionFn)); err != nil {
+				return err
+			}
+			continue
+		}
+
 		desc.encoder, rv, err = lookupElementEncoder(ec, desc.encoder, rv)
 
 		if err != nil && !errors.Is(err, errInvalidValue) {
-			return err
+			return newFieldEncodeError(desc.name, desc.fieldName, err)
 		}
 
 		if errors.Is(err, errInvalidValue) {
 			if desc.omitEmpty {
 				continue
 			}
+			if err := encodeFieldHook(ec, desc, fieldType(val.Type(), desc)); err != nil {
+				return err
+			}
 			vw2, err := dw.WriteDocumentElement(desc.name)
 			if err != nil {
 				return err
@@ -140,152 +521,584 @@ func (sc *structCodec) EncodeValue(ec EncodeContext, vw ValueWriter, val reflect
 			if err != nil {
 				return err
 			}
+			if desc.hashed {
+				hashed[desc.name] = RawValue{Type: TypeNull}
+			}
 			continue
 		}
 
 		if desc.encoder == nil {
-			return errNoEncoder{Type: rv.Type()}
+			return newFieldEncodeError(desc.name, desc.fieldName, errNoEncoder{Type: rv.Type()})
 		}
 
 		encoder := desc.encoder
 
-		var empty bool
-		if rv.Kind() == reflect.Interface {
-			// isEmpty will not treat an interface rv as an interface, so we need to check for the
-			// nil interface separately.
-			empty = rv.IsNil()
-		} else {
-			empty = isEmpty(rv, sc.encodeOmitDefaultStruct || ec.omitZeroStruct)
+		if desc.generation {
+			rv, err = nextGeneration(rv)
+			if err != nil {
+				return newFieldEncodeError(desc.name, desc.fieldName, err)
+			}
+		}
+
+		// Emptiness is only checked for omitempty fields, because isEmpty can allocate, e.g. when
+		// calling IsZero on an addressable time.Time field of a slice element.
+		if desc.omitEmpty {
+			var empty bool
+			if rv.Kind() == reflect.Interface {
+				// isEmpty will not treat an interface rv as an interface, so we need to check for the
+				// nil interface separately.
+				empty = rv.IsNil()
+			} else {
+				empty = isEmpty(rv, sc.omitZeroStruct(ec))
+			}
+			if empty {
+				continue
+			}
 		}
-		if desc.omitEmpty && empty {
+
+		if ec.omitFunc != nil && ec.omitFunc(desc.fieldName, rv) {
 			continue
 		}
 
+		if ec.encodeEmptyStringAsNull && rv.Kind() == reflect.String && rv.Len() == 0 {
+			encoder = nullEncoder
+		}
+
+		if err := encodeFieldHook(ec, desc, rv.Type()); err != nil {
+			return err
+		}
+
 		vw2, err := dw.WriteDocumentElement(desc.name)
 		if err != nil {
 			return err
 		}
 
-		ectx := EncodeContext{
-			Registry:                ec.Registry,
-			minSize:                 desc.minSize || ec.minSize,
-			errorOnInlineDuplicates: ec.errorOnInlineDuplicates,
-			stringifyMapKeysWithFmt: ec.stringifyMapKeysWithFmt,
-			nilMapAsEmpty:           ec.nilMapAsEmpty,
-			nilSliceAsEmpty:         ec.nilSliceAsEmpty,
-			nilByteSliceAsEmpty:     ec.nilByteSliceAsEmpty,
-			omitZeroStruct:          ec.omitZeroStruct,
-			useJSONStructTags:       ec.useJSONStructTags,
+		if desc.hashed {
+			t, data, err := encodeToBytes(fieldEncodeContext(base, desc), encoder, rv)
+			if err != nil {
+				return newFieldEncodeError(desc.name, desc.fieldName, err)
+			}
+			hashed[desc.name] = RawValue{Type: t, Value: data}
+			err = copyValueFromBytes(vw2, t, data)
+		} else {
+			err = encoder.EncodeValue(fieldEncodeContext(base, desc), vw2, rv)
 		}
-		err = encoder.EncodeValue(ectx, vw2, rv)
 		if err != nil {
-			return err
+			return newFieldEncodeError(desc.name, desc.fieldName, err)
+		}
+
+		if desc.ttlKey != "" && ec.ttl > 0 {
+			if err := encodeExpiry(ec, dw, desc.ttlKey); err != nil {
+				return err
+			}
 		}
 	}
 
 	if sd.inlineMap >= 0 {
 		rv := val.Field(sd.inlineMap)
-		collisionFn := func(key string) bool {
-			_, exists := sd.fm[key]
-			return exists
+		mapEC := ec
+		if sd.inlineMinSize {
+			mapEC.minSize = true
 		}
-
-		err = sc.inlineMapEncoder.encodeMapElements(ec, dw, rv, collisionFn)
+		err = sc.inlineMapEncoder.encodeMapElements(mapEC, dw, rv, sd.inlinePrefix, stringKeyCollision(collisionFn))
 		if err != nil {
 			return err
 		}
 	}
 
-	return dw.WriteDocumentEnd()
-}
-
-func newDecodeError(key string, original error) error {
-	var de *DecodeError
-	if !errors.As(original, &de) {
-		return &DecodeError{
-			keys:    []string{key},
-			wrapped: original,
+	if sd.inlineRaw >= 0 {
+		if err := encodeInlineRaw(dw, val.Field(sd.inlineRaw).Bytes(), collisionFn); err != nil {
+			return err
 		}
 	}
 
-	de.keys = append(de.keys, key)
-	return de
+	return dw.WriteDocumentEnd()
 }
 
-// DecodeValue implements the Codec interface.
-// By default, map types in val will not be cleared. If a map has existing key/value pairs, it will be extended with the new ones from vr.
-// For slices, the decoder will set the length of the slice to zero and append all elements. The underlying array will not be cleared.
-func (sc *structCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
-	if !val.CanSet() || val.Kind() != reflect.Struct {
-		return ValueDecoderError{Name: "StructCodec.DecodeValue", Kinds: []reflect.Kind{reflect.Struct}, Received: val}
+// encodeProjected encodes the value produced by calling the projector of the field described by
+// desc with the struct value val.
+func (sc *structCodec) encodeProjected(ec EncodeContext, dw DocumentWriter, val reflect.Value, desc fieldDescription) error {
+	if !val.CanInterface() {
+		return newFieldEncodeError(desc.name, desc.fieldName,
+			fmt.Errorf("cannot project from unexported value of type %s", val.Type()))
+	}
+	v, err := desc.projector(val.Interface())
+	if err != nil {
+		return newFieldEncodeError(desc.name, desc.fieldName, err)
 	}
 
-	switch vrType := vr.Type(); vrType {
-	case Type(0), TypeEmbeddedDocument:
-	case TypeNull:
-		if err := vr.ReadNull(); err != nil {
+	omitEmpty := desc.omitEmpty || ec.omitEmpty
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		if omitEmpty || desc.omitZero {
+			return nil
+		}
+		if err := encodeFieldHook(ec, desc, fieldType(val.Type(), desc)); err != nil {
 			return err
 		}
-
-		val.Set(reflect.Zero(val.Type()))
-		return nil
-	case TypeUndefined:
-		if err := vr.ReadUndefined(); err != nil {
+		vw, err := dw.WriteDocumentElement(desc.name)
+		if err != nil {
 			return err
 		}
-
-		val.Set(reflect.Zero(val.Type()))
+		return vw.WriteNull()
+	}
+	if omitEmpty && isEmpty(rv, sc.omitZeroStruct(ec)) {
+		return nil
+	}
+	if desc.omitZero && isZero(rv) {
+		return nil
+	}
+	if ec.omitFunc != nil && ec.omitFunc(desc.fieldName, rv) {
 		return nil
-	default:
-		return fmt.Errorf("cannot decode %v into a %s", vrType, val.Type())
 	}
 
-	sd, err := sc.describeStruct(dc.Registry, val.Type(), dc.useJSONStructTags, false)
+	encoder, err := ec.LookupEncoder(rv.Type())
 	if err != nil {
+		return newFieldEncodeError(desc.name, desc.fieldName, err)
+	}
+	if err := encodeFieldHook(ec, desc, rv.Type()); err != nil {
 		return err
 	}
-
-	if sc.decodeZeroStruct || dc.zeroStructs {
-		val.Set(reflect.Zero(val.Type()))
+	vw, err := dw.WriteDocumentElement(desc.name)
+	if err != nil {
+		return err
 	}
-	if sc.decodeDeepZeroInline && sd.inline {
-		val.Set(deepZero(val.Type()))
+	if err := encoder.EncodeValue(fieldEncodeContext(documentEncodeContext(ec, val), desc), vw, rv); err != nil {
+		return newFieldEncodeError(desc.name, desc.fieldName, err)
 	}
+	return nil
+}
 
-	var decoder ValueDecoder
-	var inlineMap reflect.Value
-	if sd.inlineMap >= 0 {
-		inlineMap = val.Field(sd.inlineMap)
-		decoder, err = dc.LookupDecoder(inlineMap.Type().Elem())
-		if err != nil {
-			return err
+// nextGeneration returns a new value of the integer type of rv holding the value of rv plus one.
+func nextGeneration(rv reflect.Value) (reflect.Value, error) {
+	next := reflect.New(rv.Type()).Elem()
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := rv.Int()
+		if i == math.MaxInt64 || next.OverflowInt(i+1) {
+			return emptyValue, fmt.Errorf("generation %d overflows %s", i, rv.Type())
 		}
+		next.SetInt(i + 1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := rv.Uint()
+		if u == math.MaxUint64 || next.OverflowUint(u+1) {
+			return emptyValue, fmt.Errorf("generation %d overflows %s", u, rv.Type())
+		}
+		next.SetUint(u + 1)
+	default:
+		return emptyValue, fmt.Errorf("generation requires an integer, got %s", rv.Type())
 	}
+	return next, nil
+}
 
-	dr, err := vr.ReadDocument()
+// encodeExpiry writes the key with the expiry time computed from the TTL and clock of ec.
+func encodeExpiry(ec EncodeContext, dw DocumentWriter, key string) error {
+	now := time.Now
+	if ec.now != nil {
+		now = ec.now
+	}
+	vw, err := dw.WriteDocumentElement(key)
 	if err != nil {
 		return err
 	}
+	return vw.WriteDateTime(now().Add(ec.ttl).UnixMilli())
+}
+
+// nullEncoder is the ValueEncoder used for the empty string fields written as BSON null.
+var nullEncoder = ValueEncoderFunc(func(_ EncodeContext, vw ValueWriter, _ reflect.Value) error {
+	return vw.WriteNull()
+})
+
+// documentEncodeContext returns the EncodeContext that the contexts used to encode the fields of the
+// struct val are derived from by fieldEncodeContext. It is built once per document.
+func documentEncodeContext(ec EncodeContext, val reflect.Value) EncodeContext {
+	return EncodeContext{
+		Registry:                ec.Registry,
+		minSize:                 ec.minSize,
+		errorOnInlineDuplicates: ec.errorOnInlineDuplicates,
+		stringifyMapKeysWithFmt: ec.stringifyMapKeysWithFmt,
+		nilMapAsEmpty:           ec.nilMapAsEmpty,
+		nilSliceAsEmpty:         ec.nilSliceAsEmpty,
+		nilByteSliceAsEmpty:     ec.nilByteSliceAsEmpty,
+		omitZeroStruct:          ec.omitZeroStruct,
+		keepZeroStruct:          ec.keepZeroStruct,
+		omitNilPointers:         ec.omitNilPointers,
+		encodeEmptyStringAsNull: ec.encodeEmptyStringAsNull,
+		ipAsString:              ec.ipAsString,
+		useJSONStructTags:       ec.useJSONStructTags,
+		escapeKeys:              ec.escapeKeys,
+		sortMapKeys:             ec.sortMapKeys,
+		ttl:                     ec.ttl,
+		now:                     ec.now,
+		packArraysOver:          ec.packArraysOver,
+		uuidSubtype:             ec.uuidSubtype,
+		decimalRounding:         ec.decimalRounding,
+		nilInlineAsZero:         ec.nilInlineAsZero,
+		newHash:                 ec.newHash,
+		ctx:                     ec.ctx,
+		fieldHook:               ec.fieldHook,
+		omitFunc:                ec.omitFunc,
+		nameTransformer:         ec.nameTransformer,
+		owner:                   val,
+	}
+}
+
+// fieldEncodeContext returns the EncodeContext used to encode the field described by desc, derived
+// from the context base returned by documentEncodeContext.
+func fieldEncodeContext(base EncodeContext, desc fieldDescription) EncodeContext {
+	if desc.minSize {
+		base.minSize = true
+	}
+	base.round, base.roundDigits = desc.round, desc.roundDigits
+	base.ownerField = desc.fieldName
+	return base
+}
+
+// encodePositional encodes val as a BSON array, writing each field at the position given by its
+// "pos" struct tag option.
+func (sc *structCodec) encodePositional(ec EncodeContext, vw ValueWriter, val reflect.Value, sd *structDescription) error {
+	aw, err := vw.WriteArray()
+	if err != nil {
+		return err
+	}
+
+	base := documentEncodeContext(ec, val)
+
+	for pos, fi := range sd.positions {
+		vw2, err := aw.WriteArrayElement()
+		if err != nil {
+			return err
+		}
+		if fi < 0 || sd.fl[fi].readOnly {
+			if err := vw2.WriteNull(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		desc := sd.fl[fi]
+		var rv reflect.Value
+		if desc.inline == nil {
+			rv = val.Field(desc.idx)
+		} else if rv, err = fieldByIndexErr(val, desc.inline); err != nil {
+			if err := encodePositionalNull(ec, vw2, val, pos, desc); err != nil {
+				return err
+			}
+			continue
+		}
+
+		encoder, rv, err := lookupElementEncoder(ec, desc.encoder, rv)
+		if errors.Is(err, errInvalidValue) {
+			if err := encodePositionalNull(ec, vw2, val, pos, desc); err != nil {
+				return err
+			}
+			continue
+		}
+		if err == nil && encoder == nil {
+			err = errNoEncoder{Type: rv.Type()}
+		}
+		if err == nil && ec.fieldHook != nil {
+			err = ec.fieldHook(desc.name, desc.fieldName, rv.Type())
+		}
+		if err == nil {
+			err = encoder.EncodeValue(fieldEncodeContext(base, desc), vw2, rv)
+		}
+		if err != nil {
+			return newFieldEncodeError(strconv.Itoa(pos), desc.fieldName, err)
+		}
+	}
+
+	return aw.WriteArrayEnd()
+}
+
+// encodePositionalNull writes BSON null to vw for the field of the positional struct val described
+// by desc, which is behind a nil pointer or holds a nil value.
+func encodePositionalNull(ec EncodeContext, vw ValueWriter, val reflect.Value, pos int, desc fieldDescription) error {
+	if ec.fieldHook != nil {
+		if err := ec.fieldHook(desc.name, desc.fieldName, fieldType(val.Type(), desc)); err != nil {
+			return newFieldEncodeError(strconv.Itoa(pos), desc.fieldName, err)
+		}
+	}
+	return vw.WriteNull()
+}
+
+func newEncodeError(key string, original error) error {
+	return newFieldEncodeError(key, "", original)
+}
+
+// newFieldEncodeError is like newEncodeError for the key of the struct field named field.
+func newFieldEncodeError(key, field string, original error) error {
+	var ee *EncodeError
+	if !errors.As(original, &ee) {
+		return &EncodeError{
+			keys:    []string{key},
+			fields:  []string{field},
+			wrapped: original,
+		}
+	}
+
+	ee.keys = append(ee.keys, key)
+	ee.fields = append(ee.fields, field)
+	return ee
+}
+
+func newDecodeError(key string, original error) error {
+	return newFieldDecodeError(key, "", original)
+}
+
+// newFieldDecodeError is like newDecodeError for the key of the struct field named field.
+func newFieldDecodeError(key, field string, original error) error {
+	// The errors accumulated while decoding a nested struct each get the key prepended.
+	var errs decodeErrors
+	if errors.As(original, &errs) {
+		for i, err := range errs {
+			errs[i] = newFieldDecodeError(key, field, err)
+		}
+		return errs
+	}
+
+	var de *DecodeError
+	if !errors.As(original, &de) {
+		return &DecodeError{
+			keys:    []string{key},
+			fields:  []string{field},
+			wrapped: original,
+		}
+	}
+
+	de.keys = append(de.keys, key)
+	de.fields = append(de.fields, field)
+	return de
+}
+
+// DecodeValue implements the Codec interface.
+// By default, map types in val will not be cleared. If a map has existing key/value pairs, it will be extended with the new ones from vr.
+// For slices, the decoder will set the length of the slice to zero and append all elements. The underlying array will not be cleared.
+func (sc *structCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Kind() != reflect.Struct {
+		return ValueDecoderError{Name: "StructCodec.DecodeValue", Kinds: []reflect.Kind{reflect.Struct}, Received: val}
+	}
+
+	switch vrType := vr.Type(); vrType {
+	case Type(0), TypeEmbeddedDocument:
+	case TypeNull:
+		if err := vr.ReadNull(); err != nil {
+			return err
+		}
+
+		val.Set(reflect.Zero(val.Type()))
+		return nil
+	case TypeUndefined:
+		if err := vr.ReadUndefined(); err != nil {
+			return err
+		}
+
+		val.Set(reflect.Zero(val.Type()))
+		return nil
+	case TypeArray:
+		sd, err := sc.describeStruct(dc.Registry, val.Type(), dc.useJSONStructTags, false, dc.nameTransformer)
+		if err != nil {
+			return err
+		}
+		if sd.positions == nil {
+			return fmt.Errorf("cannot decode %v into a %s", vrType, val.Type())
+		}
+		return sc.decodePositional(dc, vr, val, sd)
+	default:
+		return fmt.Errorf("cannot decode %v into a %s", vrType, val.Type())
+	}
+
+	sd, err := sc.describeStruct(dc.Registry, val.Type(), dc.useJSONStructTags, false, dc.nameTransformer)
+	if err != nil {
+		return err
+	}
+
+	// In patch mode, fields that are not present in the document must not be modified.
+	if !dc.patchMode {
+		if sc.zeroStructs(dc) {
+			val.Set(reflect.Zero(val.Type()))
+		}
+		if sc.decodeDeepZeroInline && sd.inline {
+			val.Set(deepZero(val.Type()))
+		}
+	}
+
+	var decoder ValueDecoder
+	var inlineMap reflect.Value
+	var keyCodec *mapCodec // decodes the keys of inline maps without string keys
+	if sd.inlineMap >= 0 {
+		inlineMap = val.Field(sd.inlineMap)
+		decoder, err = dc.LookupDecoder(inlineMap.Type().Elem())
+		if err != nil {
+			return err
+		}
+		if inlineMap.Type().Key() != tString {
+			mapDecoder, _ := dc.LookupDecoder(inlineMap.Type())
+			if keyCodec, _ = mapDecoder.(*mapCodec); keyCodec == nil {
+				keyCodec = &mapCodec{}
+			}
+		}
+	}
+
+	aliases, vr, err := lookupSchemaAliases(dc, val.Type(), vr)
+	if err != nil {
+		return err
+	}
+
+	dc.typeKeyValue, vr, err = lookupTypeKey(dc, val.Type(), sd, vr)
+	if err != nil {
+		return err
+	}
+
+	// The raw field sink only applies to the elements of the top-level document.
+	rawFieldSink := dc.rawFieldSink
+	dc.rawFieldSink = nil
+
+	discriminated := dc.discriminated
+	dc.discriminated = false
+
+	dr, err := vr.ReadDocument()
+	if err != nil {
+		return err
+	}
+
+	var seen map[string]struct{}
+	if (len(sd.onMissing) > 0 || len(sd.required) > 0) && !dc.patchMode || len(sd.mirrors) > 0 {
+		seen = make(map[string]struct{}, len(sd.fl))
+	}
+
+	// keys holds the keys that have been read, if duplicate keys are not decoded.
+	var keys map[string]struct{}
+	if dc.duplicateKeys != DuplicateKeyLast {
+		keys = make(map[string]struct{}, len(sd.fl))
+	}
+
+	// extras holds the elements stored in the inline Raw field.
+	var extras inlineRawDocument
+
+	// setter is the inline MapSetter field, which is looked up when the first element is stored in
+	// it.
+	var setter MapSetter
+
+	// hashed holds the stored values of the "hashof" fields and the fields they hash.
+	var hashed map[string]RawValue
+	if sd.hashes && dc.verifyHashes {
+		hashed = make(map[string]RawValue)
+	}
+
+	// When accumulating errors, the errors of the elements are recorded in errs and decoding
+	// continues with the next element.
+	var errs decodeErrors
+	fail := func(err error) error {
+		if !dc.accumulateErrors {
+			return err
+		}
+		var nested decodeErrors
+		if errors.As(err, &nested) {
+			errs = append(errs, nested...)
+		} else {
+			errs = append(errs, err)
+		}
+		return nil
+	}
+
+	for n := 0; ; n++ {
+		if err := checkContext(dc.ctx, n); err != nil {
+			return err
+		}
+		name, vr, err := dr.ReadElement()
+		if errors.Is(err, ErrEOD) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// Accumulating errors requires each value to be read in full before it is decoded, so
+		// that the next element can be read after a value fails to decode.
+		if rawFieldSink != nil || dc.accumulateErrors {
+			bt, raw, err := copyValueToBytes(vr)
+			if err != nil {
+				return newDecodeError(name, err)
+			}
+			if rawFieldSink != nil {
+				rawFieldSink(name, raw)
+			}
+			vr = newBufferedValueReader(bt, raw)
+		}
+
+		if alias, ok := aliases[name]; ok {
+			name = alias
+		}
 
-	for {
-		name, vr, err := dr.ReadElement()
-		if errors.Is(err, ErrEOD) {
-			break
-		}
-		if err != nil {
-			return err
-		}
-
 		fd, exists := sd.fm[name]
-		if !exists {
+		if !exists && !dc.caseSensitive && !(dc.caseSensitiveInline && sd.inlineMap >= 0) {
 			// if the original name isn't found in the struct description, try again with the name in lowercase
 			// this could match if a BSON tag isn't specified because by default, describeStruct lowercases all field
 			// names
 			fd, exists = sd.fm[strings.ToLower(name)]
 		}
 
+		if keys != nil {
+			key := name
+			if exists {
+				key = fd.name
+			}
+			if _, ok := keys[key]; ok {
+				if dc.duplicateKeys == DuplicateKeyError {
+					if err := fail(newFieldDecodeError(name, fd.fieldName, ErrDuplicateKey)); err != nil {
+						return err
+					}
+				}
+				if err := vr.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			keys[key] = struct{}{}
+		}
+
+		if !exists && discriminated && name == discriminatorKey {
+			// The discriminator selected the type being decoded into.
+			if err := vr.Skip(); err != nil {
+				return newDecodeError(name, err)
+			}
+			continue
+		}
+
 		if !exists {
-			if sd.inlineMap < 0 {
+			if glob, ok := matchGlob(sd.globs, name); ok {
+				if err := sc.decodeGlob(dc, vr, val, glob, name); err != nil {
+					if err := fail(newDecodeError(name, err)); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if sd.inlineRaw >= 0 {
+				if err := extras.appendElement(name, vr); err != nil {
+					return newDecodeError(name, err)
+				}
+				continue
+			}
+			if sd.inlineSetter >= 0 {
+				if setter == nil {
+					setter = inlineMapSetter(val.Field(sd.inlineSetter))
+				}
+				bt, data, err := copyValueToBytes(vr)
+				if err != nil {
+					return newDecodeError(name, err)
+				}
+				setter.SetKey(name, RawValue{Type: bt, Value: data})
+				continue
+			}
+			if sd.inlineMap < 0 || !strings.HasPrefix(name, sd.inlinePrefix) {
+				if dc.disallowUnknownFields {
+					if err := fail(newDecodeError(name, ErrUnknownField)); err != nil {
+						return err
+					}
+					continue
+				}
 				// The encoding/json package requires a flag to return on error for non-existent fields.
 				// This functionality seems appropriate for the struct codec.
 				err = vr.Skip()
@@ -295,83 +1108,497 @@ func (sc *structCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect
 				continue
 			}
 
+			// The inline map is only allocated once an element is stored in it, so a nil map
+			// stays nil when the document has no such element.
 			if inlineMap.IsNil() {
 				inlineMap.Set(reflect.MakeMap(inlineMap.Type()))
 			}
+			name = strings.TrimPrefix(name, sd.inlinePrefix)
 
 			elem := reflect.New(inlineMap.Type().Elem()).Elem()
-			err = decoder.DecodeValue(dc, vr, elem)
+			inlineDC := dc
+			if dc.orderedInlineMapValues {
+				inlineDC.defaultDocumentType = tD
+			}
+			err = decoder.DecodeValue(inlineDC, vr, elem)
 			if err != nil {
-				return err
+				if err := fail(err); err != nil {
+					return err
+				}
+				continue
+			}
+			if dc.unescapeKeys {
+				name = unescapeKey(name)
+			}
+			key := reflect.ValueOf(name)
+			if keyCodec != nil {
+				key, err = keyCodec.decodeKey(name, inlineMap.Type().Key())
+				if err != nil {
+					if err := fail(newDecodeError(name, err)); err != nil {
+						return err
+					}
+					continue
+				}
 			}
-			inlineMap.SetMapIndex(reflect.ValueOf(name), elem)
+			inlineMap.SetMapIndex(key, elem)
 			continue
 		}
 
-		var field reflect.Value
-		if fd.inline == nil {
-			field = val.Field(fd.idx)
-		} else {
-			field, err = getInlineField(val, fd.inline)
+		if fd.synthetic {
+			if fd.decoder == nil {
+				err = vr.Skip()
+			} else {
+				err = fd.decoder.DecodeValue(dc, vr, val)
+			}
 			if err != nil {
+				if err := fail(newFieldDecodeError(fd.name, fd.fieldName, err)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if fd.mirrored || fd.writeOnly {
+			// The value is derived from the field it mirrors, or is never decoded.
+			if err := vr.Skip(); err != nil {
 				return err
 			}
+			continue
+		}
+
+		if seen != nil {
+			seen[fd.name] = struct{}{}
 		}
 
-		if field.Kind() == reflect.Interface && !field.IsNil() && field.Elem().Kind() == reflect.Ptr {
-			v := field.Elem().Elem()
-			decoder, err = dc.LookupDecoder(v.Type())
+		if hashed != nil && (fd.hashed || fd.hashOf != nil) {
+			bt, data, err := copyValueToBytes(vr)
 			if err != nil {
+				return newFieldDecodeError(fd.name, fd.fieldName, err)
+			}
+			hashed[fd.name] = RawValue{Type: bt, Value: data}
+			vr = newBufferedValueReader(bt, data)
+		}
+
+		if dc.ignoreNullFields && vr.Type() == TypeNull {
+			if err := vr.ReadNull(); err != nil {
+				return newFieldDecodeError(fd.name, fd.fieldName, err)
+			}
+			continue
+		}
+
+		if err := sc.decodeField(dc, vr, val, fd); err != nil {
+			if err := fail(newFieldDecodeError(fd.name, fd.fieldName, err)); err != nil {
 				return err
 			}
-			err = decoder.DecodeValue(dc, vr, v)
-			if err != nil {
-				return newDecodeError(fd.name, err)
+			continue
+		}
+		if fd.mirror != nil {
+			if err := setMirror(val, fd); err != nil {
+				if err := fail(newFieldDecodeError(fd.name, fd.fieldName, err)); err != nil {
+					return err
+				}
 			}
+		}
+	}
+
+	if sd.inlineRaw >= 0 {
+		raw, err := extras.finish()
+		if err != nil {
+			return err
+		}
+		if raw != nil {
+			val.Field(sd.inlineRaw).SetBytes(raw)
+		}
+	}
+
+	// The mirrors of fields that were not decoded are derived from the values the fields kept.
+	for _, fd := range sd.mirrors {
+		if _, ok := seen[fd.name]; ok {
 			continue
 		}
+		if err := setMirror(val, fd); err != nil {
+			if err := fail(newFieldDecodeError(fd.name, fd.fieldName, err)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if hashed != nil {
+		if err := verifyHashes(dc, sd, hashed); err != nil {
+			if err := fail(err); err != nil {
+				return err
+			}
+		}
+	}
 
-		if !field.CanSet() { // Being settable is a super set of being addressable.
-			innerErr := fmt.Errorf("field %v is not settable", field)
-			return newDecodeError(fd.name, innerErr)
+	for _, fd := range sd.onMissing {
+		if dc.patchMode {
+			break
+		}
+		if _, ok := seen[fd.name]; ok {
+			continue
 		}
-		if field.Kind() == reflect.Ptr && field.IsNil() {
-			field.Set(reflect.New(field.Type().Elem()))
+		if err := callOnMissing(val, fd); err != nil {
+			if err := fail(newFieldDecodeError(fd.name, fd.fieldName, err)); err != nil {
+				return err
+			}
 		}
-		field = field.Addr()
+	}
 
-		dctx := DecodeContext{
-			Registry:            dc.Registry,
-			truncate:            fd.truncate || dc.truncate,
-			defaultDocumentType: dc.defaultDocumentType,
-			binaryAsSlice:       dc.binaryAsSlice,
-			objectIDAsHexString: dc.objectIDAsHexString,
-			useJSONStructTags:   dc.useJSONStructTags,
-			useLocalTimeZone:    dc.useLocalTimeZone,
-			zeroMaps:            dc.zeroMaps,
-			zeroStructs:         dc.zeroStructs,
+	if !dc.patchMode {
+		if err := missingRequired(sd, seen); err != nil {
+			if err := fail(err); err != nil {
+				return err
+			}
 		}
+	}
 
-		if fd.decoder == nil {
-			return newDecodeError(fd.name, errNoDecoder{Type: field.Elem().Type()})
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// missingRequired returns an error wrapping ErrRequiredFieldMissing for each field of sd with the
+// "required" struct tag option whose key is not in seen. Multiple errors are joined.
+func missingRequired(sd *structDescription, seen map[string]struct{}) error {
+	var missing decodeErrors
+	for _, fd := range sd.required {
+		if _, ok := seen[fd.name]; !ok {
+			missing = append(missing, newFieldDecodeError(fd.name, fd.fieldName, ErrRequiredFieldMissing))
+		}
+	}
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return missing[0]
+	}
+	return missing
+}
+
+// matchGlob returns the glob field whose pattern matches name.
+func matchGlob(globs []fieldDescription, name string) (fieldDescription, bool) {
+	for _, fd := range globs {
+		if ok, _ := path.Match(fd.name, name); ok {
+			return fd, true
 		}
+	}
+	return fieldDescription{}, false
+}
+
+// decodeGlob decodes the value read from vr into the map field of val described by fd, using name
+// as the map key.
+func (sc *structCodec) decodeGlob(dc DecodeContext, vr ValueReader, val reflect.Value, fd fieldDescription, name string) error {
+	var field reflect.Value
+	if fd.inline == nil {
+		field = val.Field(fd.idx)
+	} else {
+		var err error
+		field, err = getInlineField(val, fd.inline)
+		if err != nil {
+			return err
+		}
+	}
+
+	decoder, err := dc.LookupDecoder(field.Type().Elem())
+	if err != nil {
+		return err
+	}
+	elem := reflect.New(field.Type().Elem()).Elem()
+	if err := decoder.DecodeValue(dc, vr, elem); err != nil {
+		return err
+	}
+
+	if field.IsNil() {
+		field.Set(reflect.MakeMap(field.Type()))
+	}
+	field.SetMapIndex(reflect.ValueOf(name).Convert(field.Type().Key()), elem)
+	return nil
+}
+
+// setMirror sets the mirror field of the time field of val described by fd to the value of the
+// time field formatted with the layout of fd. A zero or nil time is formatted as an empty string.
+func setMirror(val reflect.Value, fd fieldDescription) error {
+	index := fd.inline
+	if index == nil {
+		index = []int{fd.idx}
+	}
+	field, err := fieldByIndexErr(val, index)
+	if err != nil {
+		return err
+	}
+	mirror, err := getInlineField(val, fd.mirror)
+	if err != nil {
+		return err
+	}
+
+	var tm time.Time
+	if field.Kind() == reflect.Ptr {
+		if !field.IsNil() {
+			tm = field.Elem().Interface().(time.Time)
+		}
+	} else {
+		tm = field.Interface().(time.Time)
+	}
+	if tm.IsZero() {
+		mirror.SetString("")
+	} else {
+		mirror.SetString(tm.Format(fd.layout))
+	}
+	return nil
+}
+
+// decodeField decodes the value read from vr into the field of val described by fd.
+func (sc *structCodec) decodeField(dc DecodeContext, vr ValueReader, val reflect.Value, fd fieldDescription) error {
+	if dc.fieldHook != nil {
+		if err := dc.fieldHook(fd.name, fd.fieldName, fieldType(val.Type(), fd)); err != nil {
+			return err
+		}
+	}
+
+	var field reflect.Value
+	if fd.inline == nil {
+		field = val.Field(fd.idx)
+	} else {
+		var err error
+		field, err = getInlineField(val, fd.inline)
+		if err != nil {
+			return err
+		}
+	}
+
+	if field.Kind() == reflect.Interface && !field.IsNil() && field.Elem().Kind() == reflect.Ptr {
+		v := field.Elem().Elem()
+		decoder, err := dc.LookupDecoder(v.Type())
+		if err != nil {
+			return err
+		}
+		return decoder.DecodeValue(dc, vr, v)
+	}
+
+	_, hasFactory := fd.decoder.(*interfaceFactoryDecoder)
+	if field.Kind() == reflect.Interface && dc.typeKeyValue.Type != 0 && !hasFactory &&
+		vr.Type() != TypeNull && vr.Type() != TypeUndefined {
+		if decoded, err := decodeResolved(dc, vr, field, fd.fieldName); err != nil || decoded {
+			return err
+		}
+	}
+	if field.Kind() == reflect.Interface && vr.Type() == TypeEmbeddedDocument && !hasFactory &&
+		dc.Registry != nil && dc.hasDiscriminators {
+		decoded, dvr, err := decodeDiscriminated(dc, vr, field)
+		if err != nil || decoded {
+			return err
+		}
+		vr = dvr
+	}
+
+	if !field.CanSet() { // Being settable is a super set of being addressable.
+		return fmt.Errorf("field %v is not settable", field)
+	}
+	if field.Kind() == reflect.Ptr && field.IsNil() {
+		field.Set(reflect.New(field.Type().Elem()))
+	}
+	field = field.Addr()
+
+	dctx := DecodeContext{
+		Registry:               dc.Registry,
+		truncate:               fd.truncate || dc.truncate,
+		doubleToIntExactOnly:   dc.doubleToIntExactOnly,
+		wideningOnly:           dc.wideningOnly,
+		strictNumbers:          dc.strictNumbers,
+		defaultDocumentType:    dc.defaultDocumentType,
+		binaryAsSlice:          dc.binaryAsSlice,
+		objectIDAsHexString:    dc.objectIDAsHexString,
+		useJSONStructTags:      dc.useJSONStructTags,
+		useLocalTimeZone:       fd.localTime || dc.useLocalTimeZone,
+		zeroMaps:               dc.zeroMaps,
+		zeroStructs:            dc.zeroStructs,
+		preserveStructs:        dc.preserveStructs,
+		patchMode:              dc.patchMode,
+		orderedInlineMapValues: dc.orderedInlineMapValues,
+		emptyDocAsNil:          dc.emptyDocAsNil,
+		readRepair:             dc.readRepair,
+		caseSensitive:          dc.caseSensitive,
+		caseSensitiveInline:    dc.caseSensitiveInline,
+		disallowUnknownFields:  dc.disallowUnknownFields,
+		ignoreNullFields:       dc.ignoreNullFields,
+		accumulateErrors:       dc.accumulateErrors,
+		unknownEnums:           dc.unknownEnums,
+		duplicateKeys:          dc.duplicateKeys,
+		reuseSliceElements:     dc.reuseSliceElements,
+		stringTable:            dc.stringTable,
+		fallbackDecoder:        dc.fallbackDecoder,
+		verifyHashes:           dc.verifyHashes,
+		newHash:                dc.newHash,
+		ctx:                    dc.ctx,
+		fieldHook:              dc.fieldHook,
+		nameTransformer:        dc.nameTransformer,
+		unescapeKeys:           dc.unescapeKeys,
+		typeKey:                dc.typeKey,
+		typeResolver:           dc.typeResolver,
+		owner:                  val,
+		ownerField:             fd.fieldName,
+	}
+
+	if fd.decoder == nil {
+		if dc.fallbackDecoder != nil {
+			return dc.fallbackDecoder.DecodeValue(dctx, vr, field.Elem())
+		}
+		if fd.decodeErr != nil {
+			return fd.decodeErr
+		}
+		return errNoDecoder{Type: field.Elem().Type()}
+	}
+
+	return fd.decoder.DecodeValue(dctx, vr, field.Elem())
+}
+
+// omitZeroStruct reports whether EncodeValue considers the zero value of a struct empty. The
+// settings take precedence in the following order:
+//
+//  1. Encoder.SetOmitZeroStruct or Encoder.OmitZeroStruct, whichever was called last.
+//  2. The default set using Registry.SetOmitZeroStruct.
+//  3. The codec's encodeOmitDefaultStruct field, which is set by NewMgoRegistry.
+func (sc *structCodec) omitZeroStruct(ec EncodeContext) bool {
+	switch {
+	case ec.omitZeroStruct:
+		return true
+	case ec.keepZeroStruct:
+		return false
+	case ec.Registry != nil && ec.hasOmitZeroStructDefault:
+		return ec.omitZeroStructDefault
+	}
+	return sc.encodeOmitDefaultStruct
+}
+
+// zeroStructs reports whether DecodeValue deletes any existing values from a Go struct before
+// decoding into it. The settings take precedence in the following order:
+//
+//  1. Decoder.ZeroStructs or Decoder.PreserveStructs, whichever was called last.
+//  2. The default set using Registry.SetZeroStructs.
+//  3. The codec's decodeZeroStruct field, which is set by NewMgoRegistry.
+func (sc *structCodec) zeroStructs(dc DecodeContext) bool {
+	switch {
+	case dc.zeroStructs:
+		return true
+	case dc.preserveStructs:
+		return false
+	case dc.Registry != nil && dc.hasZeroStructsDefault:
+		return dc.zeroStructsDefault
+	}
+	return sc.decodeZeroStruct
+}
+
+// decodePositional decodes a BSON array into val, assigning each element to the field whose "pos"
+// struct tag option matches the element's index. Elements without a matching field are skipped.
+func (sc *structCodec) decodePositional(dc DecodeContext, vr ValueReader, val reflect.Value, sd *structDescription) error {
+	if sc.zeroStructs(dc) && !dc.patchMode {
+		val.Set(reflect.Zero(val.Type()))
+	}
+
+	ar, err := vr.ReadArray()
+	if err != nil {
+		return err
+	}
+
+	for pos := 0; ; pos++ {
+		vr, err := ar.ReadValue()
+		if errors.Is(err, ErrEOA) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if pos >= len(sd.positions) || sd.positions[pos] < 0 || sd.fl[sd.positions[pos]].writeOnly {
+			if err := vr.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fd := sd.fl[sd.positions[pos]]
+		if err := sc.decodeField(dc, vr, val, fd); err != nil {
+			return newFieldDecodeError(strconv.Itoa(pos), fd.fieldName, err)
+		}
+	}
+
+	return nil
+}
+
+// callOnMissing sets the field described by fd to the value returned by its "onmissing" method.
+// The method is called on the struct that declares the field, which may be an inlined struct.
+func callOnMissing(val reflect.Value, fd fieldDescription) error {
+	var owner, field reflect.Value
+	if fd.inline == nil {
+		owner, field = val, val.Field(fd.idx)
+	} else {
+		var err error
+		if owner, err = getInlineField(val, fd.inline[:len(fd.inline)-1]); err != nil {
+			return err
+		}
+		if field, err = getInlineField(val, fd.inline); err != nil {
+			return err
+		}
+	}
+	if owner.Kind() == reflect.Ptr {
+		if owner.IsNil() {
+			owner.Set(reflect.New(owner.Type().Elem()))
+		}
+	} else {
+		owner = owner.Addr()
+	}
+
+	out := owner.MethodByName(fd.onMissing).Call(nil)
+	if err, _ := out[1].Interface().(error); err != nil {
+		return err
+	}
+	field.Set(out[0])
+	return nil
+}
 
-		err = fd.decoder.DecodeValue(dctx, vr, field.Elem())
-		if err != nil {
-			return newDecodeError(fd.name, err)
+// isZero reports whether v is the zero value for its type for the "omitzero" struct tag option. If
+// the type implements Zeroer, directly or through a pointer if v is addressable, its IsZero method
+// is used instead of reflect.Value.IsZero.
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return true
 		}
 	}
-
-	return nil
+	if v.Type().Implements(tZeroer) {
+		return v.Interface().(Zeroer).IsZero()
+	}
+	if v.CanAddr() && reflect.PtrTo(v.Type()).Implements(tZeroer) {
+		return v.Addr().Interface().(Zeroer).IsZero()
+	}
+	return v.IsZero()
 }
 
 func isEmpty(v reflect.Value, omitZeroStruct bool) bool {
 	kind := v.Kind()
-	if (kind != reflect.Ptr || !v.IsNil()) && v.Type().Implements(tZeroer) {
+	// Types without methods, such as the predeclared types, cannot implement Zeroer. Checking the
+	// number of methods is much cheaper than Implements.
+	if vt := v.Type(); vt.NumMethod() > 0 && (kind != reflect.Ptr || !v.IsNil()) && vt.Implements(tZeroer) {
 		return v.Interface().(Zeroer).IsZero()
 	}
 	switch kind {
-	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+	case reflect.Array:
+		if v.Len() == 0 {
+			return true
+		}
+		if !omitZeroStruct {
+			return false
+		}
+		for i := 0; i < v.Len(); i++ {
+			if !isEmpty(v.Index(i), omitZeroStruct) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map, reflect.Slice, reflect.String:
 		return v.Len() == 0
 	case reflect.Struct:
 		if !omitZeroStruct {
@@ -401,6 +1628,38 @@ type structDescription struct {
 	fl        []fieldDescription
 	inlineMap int
 	inline    bool
+	onMissing []fieldDescription // fields with an "onmissing" method
+	required  []fieldDescription // fields with the "required" struct tag option
+	globs     []fieldDescription // fields with the "glob" struct tag option, not included in fm
+	ttlKeys   []string           // keys of the companion expiries of fields with a "ttlkey"
+	mirrors   []fieldDescription // fields with the "mirror" struct tag option
+
+	// positions maps each BSON array index to an index in fl, or -1 if no field is at that
+	// position. It is nil unless the struct embeds PositionalArray.
+	positions []int
+
+	// hashes is whether a field has the "hashof" struct tag option.
+	hashes bool
+
+	// inlineRaw is the index of the bson.Raw field with the "inline" struct tag option that holds
+	// the elements that do not match a field, or -1 if there is none.
+	inlineRaw int
+
+	// skipper and rawMarshaler are whether the struct type implements EncodeSkipper and
+	// RawBSONMarshaler, and ptrSkipper and ptrRawMarshaler whether only its pointer type does.
+	skipper, ptrSkipper           bool
+	rawMarshaler, ptrRawMarshaler bool
+
+	// inlineSetter is the index of the field with the "inline" struct tag option whose type
+	// implements MapSetter, directly or through a pointer, or -1 if there is none.
+	inlineSetter int
+
+	// inlinePrefix is the prefix of the keys of the inline map, set with the "prefix" struct tag
+	// option.
+	inlinePrefix string
+
+	// inlineMinSize is whether the inline map has the "minsize" struct tag option.
+	inlineMinSize bool
 }
 
 type fieldDescription struct {
@@ -408,13 +1667,66 @@ type fieldDescription struct {
 	fieldName string // struct field name
 	idx       int
 	omitEmpty bool
+	omitZero  bool
 	minSize   bool
 	truncate  bool
+	localTime bool   // whether time.Time values are decoded in the local time zone
+	tagged    bool   // whether the BSON key was set by a struct tag
+	onMissing string // method called to produce the value if the field is absent
+	required  bool   // whether decoding fails if the field is absent
+	pos       int    // position in the BSON array if the struct embeds PositionalArray, -1 otherwise
+	order     int    // encoding order set by the "order" struct tag option, -1 otherwise
 	inline    []int
 	encoder   ValueEncoder
 	decoder   ValueDecoder
+	projector Projector // produces the value to encode from the struct, if set
+	glob      bool      // whether name is a glob pattern matching the keys of a map field
+	ttlKey    string    // key of the companion expiry written after the field
+	// ttlCompanion is whether the field holds the expiry of another field with a "ttlkey" struct
+	// tag option.
+	ttlCompanion bool
+	// synthetic is whether the field was added by an OnDescribeFunc. Its encoder and decoder
+	// are called with the struct value.
+	synthetic bool
+	// round is whether floats are rounded to roundDigits decimal places when encoding.
+	round       bool
+	roundDigits int
+	// generation is whether the field is an integer that is encoded incremented by one.
+	generation bool
+	// mirror is the index of the string field set to the value of the field formatted with
+	// layout when decoding. mirrored is whether the field is the mirror of another field.
+	mirror   []int
+	layout   string
+	mirrored bool
+	// hashOf is the BSON keys of the fields hashed into the value of the field. hashString is
+	// whether the hash is written as a hex string. hashed is whether the field is in the hashOf
+	// of another field.
+	hashOf     []string
+	hashString bool
+	hashed     bool
+	// writeOnly is whether the field is encoded but not decoded, and readOnly whether it is
+	// decoded but not encoded.
+	writeOnly bool
+	readOnly  bool
+	// decodeErr is returned when decoding into the field if decoder is nil. It is set for embedded
+	// interfaces without a registered decoder.
+	decodeErr error
+}
+
+// sortByOrder stably moves the fields with the "order" struct tag option to the front of fl, in
+// increasing order. The other fields keep their relative order after them.
+func sortByOrder(fl []fieldDescription) {
+	sort.SliceStable(fl, func(i, j int) bool {
+		if fl[j].order < 0 {
+			return fl[i].order >= 0
+		}
+		return fl[i].order >= 0 && fl[i].order < fl[j].order
+	})
 }
 
+// byIndex sorts fields by their index path, which is the order they are declared in when walking
+// the struct depth-first through inline fields. Fields are encoded in this order, regardless of
+// which of the fields with the same name dominates.
 type byIndex []fieldDescription
 
 func (bi byIndex) Len() int { return len(bi) }
@@ -449,22 +1761,106 @@ func (sc *structCodec) describeStruct(
 	t reflect.Type,
 	useJSONStructTags bool,
 	errorOnDuplicates bool,
+	nameTransformer NameTransformer,
+) (*structDescription, error) {
+	return sc.describeInlined(r, t, useJSONStructTags, errorOnDuplicates, nameTransformer, nil)
+}
+
+// describeInlined is like describeStruct for a struct type t that is inlined by the types in
+// inlining, which are being described.
+func (sc *structCodec) describeInlined(
+	r *Registry,
+	t reflect.Type,
+	useJSONStructTags bool,
+	errorOnDuplicates bool,
+	nameTransformer NameTransformer,
+	inlining []reflect.Type,
 ) (*structDescription, error) {
 	// We need to analyze the struct, including getting the tags, collecting
 	// information about inlining, and create a map of the field name to the field.
-	if v, ok := sc.cache.Load(t); ok {
+	key := describeCacheKey(t, nameTransformer)
+	if v, ok := sc.cache.Load(key); ok {
 		return v.(*structDescription), nil
 	}
-	// TODO(charlie): Only describe the struct once when called
-	// concurrently with the same type.
-	ds, err := sc.describeStructSlow(r, t, useJSONStructTags, errorOnDuplicates)
-	if err != nil {
-		return nil, err
+
+	// A struct inlined by a struct being described is described without waiting for another
+	// goroutine describing it. That goroutine may be describing a struct that inlines the struct
+	// being described here, e.g. for two structs that inline each other, and would wait for this
+	// goroutine in turn instead of detecting the inline cycle.
+	if len(inlining) > 0 {
+		sd, err := sc.describeStructSlow(r, t, useJSONStructTags, errorOnDuplicates, nameTransformer, inlining)
+		if err != nil {
+			return nil, err
+		}
+		if v, loaded := sc.cache.LoadOrStore(key, sd); loaded {
+			sd = v.(*structDescription)
+		}
+		return sd, nil
 	}
-	if v, loaded := sc.cache.LoadOrStore(t, ds); loaded {
-		ds = v.(*structDescription)
+
+	// Only describe the struct once when called concurrently with the same type. Callers that
+	// arrive while the description is computed wait for it, unless they use different options,
+	// which can produce a different result.
+	call := &describeCall{useJSONStructTags: useJSONStructTags, errorOnDuplicates: errorOnDuplicates}
+	call.wg.Add(1)
+	if v, loaded := sc.inflight.LoadOrStore(key, call); loaded {
+		other := v.(*describeCall)
+		if other.useJSONStructTags == useJSONStructTags && other.errorOnDuplicates == errorOnDuplicates {
+			other.wg.Wait()
+			return other.sd, other.err
+		}
+		return sc.describeStructSlow(r, t, useJSONStructTags, errorOnDuplicates, nameTransformer, inlining)
+	}
+
+	defer func() {
+		sc.inflight.Delete(key)
+		call.wg.Done()
+	}()
+	// Waiting callers see this error if describeStructSlow panics.
+	call.err = fmt.Errorf("(struct %s) failed to describe struct", t)
+	call.sd, call.err = sc.describeStructSlow(r, t, useJSONStructTags, errorOnDuplicates, nameTransformer, inlining)
+	if call.err == nil {
+		if v, loaded := sc.cache.LoadOrStore(key, call.sd); loaded {
+			call.sd = v.(*structDescription)
+		}
+	}
+	return call.sd, call.err
+}
+
+// describeCall is an in-flight call to describeStructSlow that concurrent callers of
+// describeStruct with the same type and options wait for.
+type describeCall struct {
+	wg                sync.WaitGroup
+	useJSONStructTags bool
+	errorOnDuplicates bool
+	sd                *structDescription
+	err               error
+}
+
+// NameTransformer derives the BSON key of a struct field from the name of the Go struct field, e.g.
+// to use snake_case keys, for fields whose struct tag does not set a key. It is set using
+// Encoder.SetNameTransformer or Decoder.SetNameTransformer.
+//
+// Struct descriptions are cached per NameTransformer, which is identified by its function pointer.
+// Closures created from the same function literal are therefore treated as the same
+// NameTransformer and must produce the same keys.
+type NameTransformer func(fieldName string) string
+
+// describeKey is the key of the description of the struct type t created using a NameTransformer
+// in the cache of the struct codec. Descriptions created without a NameTransformer are keyed by
+// the type.
+type describeKey struct {
+	t               reflect.Type
+	nameTransformer uintptr
+}
+
+// describeCacheKey returns the key of the description of t created using nameTransformer in the
+// cache of the struct codec.
+func describeCacheKey(t reflect.Type, nameTransformer NameTransformer) any {
+	if nameTransformer == nil {
+		return t
 	}
-	return ds, nil
+	return describeKey{t: t, nameTransformer: reflect.ValueOf(nameTransformer).Pointer()}
 }
 
 func (sc *structCodec) describeStructSlow(
@@ -472,14 +1868,23 @@ func (sc *structCodec) describeStructSlow(
 	t reflect.Type,
 	useJSONStructTags bool,
 	errorOnDuplicates bool,
+	nameTransformer NameTransformer,
+	inlining []reflect.Type,
 ) (*structDescription, error) {
 	numFields := t.NumField()
 	sd := &structDescription{
-		fm:        make(map[string]fieldDescription, numFields),
-		fl:        make([]fieldDescription, 0, numFields),
-		inlineMap: -1,
+		fm:           make(map[string]fieldDescription, numFields),
+		fl:           make([]fieldDescription, 0, numFields),
+		inlineMap:    -1,
+		inlineRaw:    -1,
+		inlineSetter: -1,
 	}
+	sd.skipper = t.Implements(tEncodeSkipper)
+	sd.ptrSkipper = !sd.skipper && reflect.PtrTo(t).Implements(tEncodeSkipper)
+	sd.rawMarshaler = t.Implements(tRawBSONMarshaler)
+	sd.ptrRawMarshaler = !sd.rawMarshaler && reflect.PtrTo(t).Implements(tRawBSONMarshaler)
 
+	var positional bool
 	var fields []fieldDescription
 	for i := 0; i < numFields; i++ {
 		sf := t.Field(i)
@@ -487,6 +1892,10 @@ func (sc *structCodec) describeStructSlow(
 			// field is private or unexported fields aren't allowed, ignore
 			continue
 		}
+		if sf.Anonymous && sf.Type == tPositionalArray {
+			positional = true
+			continue
+		}
 
 		sfType := sf.Type
 		encoder, err := r.LookupEncoder(sfType)
@@ -501,6 +1910,8 @@ func (sc *structCodec) describeStructSlow(
 		description := fieldDescription{
 			fieldName: sf.Name,
 			idx:       i,
+			pos:       -1,
+			order:     -1,
 			encoder:   encoder,
 			decoder:   decoder,
 		}
@@ -514,27 +1925,307 @@ func (sc *structCodec) describeStructSlow(
 			stags, err = parseStructTags(sf)
 		}
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("(struct %s) field %s: %w", t.String(), sf.Name, err)
 		}
 		if stags.Skip {
 			continue
 		}
 		description.name = stags.Name
+		description.tagged = stags.NameTagged
+		if !stags.NameTagged && nameTransformer != nil {
+			description.name = nameTransformer(sf.Name)
+		}
+		// Embedded fields of a non-struct type, such as a named slice, map, or string type, are
+		// regular fields keyed by the name of their type unless tagged, as with encoding/json.
+		// Unexported embedded types are ignored like other unexported fields, and only maps can be
+		// inlined.
+		if sf.Anonymous && sfType.Kind() == reflect.Interface {
+			// The value of an embedded interface is encoded using the encoder of its dynamic type,
+			// but there is no type to decode into unless a decoder is registered for the interface.
+			if stags.Inline {
+				return nil, fmt.Errorf("(struct %s) embedded interface %s cannot be inlined", t.String(), sfType)
+			}
+			if decoder == nil {
+				description.decodeErr = fmt.Errorf("(struct %s) cannot decode embedded interface %s: %w; "+
+					"register a decoder for it using Registry.RegisterInterfaceFactory", t.String(), sfType,
+					errNoDecoder{Type: sfType})
+			}
+		}
 		description.omitEmpty = stags.OmitEmpty
+		description.omitZero = stags.OmitZero
 		description.minSize = stags.MinSize
 		description.truncate = stags.Truncate
+		if stags.LocalTime {
+			if sfType != tTime && sfType != reflect.PtrTo(tTime) {
+				return nil, fmt.Errorf("(struct %s) localtime requires a time.Time or *time.Time field, but %s is a %s",
+					t.String(), sf.Name, sfType)
+			}
+			description.localTime = true
+		}
+		description.onMissing = stags.OnMissing
+		description.required = stags.Required
+		if stags.Pos != "" {
+			pos, err := strconv.Atoi(stags.Pos)
+			if err != nil || pos < 0 {
+				return nil, fmt.Errorf("(struct %s) invalid position %q for field %s", t.String(), stags.Pos, sf.Name)
+			}
+			description.pos = pos
+		}
+		if stags.Order != "" {
+			order, err := strconv.Atoi(stags.Order)
+			if err != nil || order < 0 {
+				return nil, fmt.Errorf("(struct %s) invalid order %q for field %s", t.String(), stags.Order, sf.Name)
+			}
+			if stags.Inline {
+				return nil, fmt.Errorf("(struct %s) order cannot be set on inline field %s", t.String(), sf.Name)
+			}
+			description.order = order
+		}
+
+		if stags.Encoding != "" {
+			enc, ok := r.lookupTextEncoding(stags.Encoding)
+			if !ok {
+				return nil, fmt.Errorf("(struct %s) unknown encoding %q for field %s", t.String(), stags.Encoding, sf.Name)
+			}
+			if sfType.Kind() != reflect.String && (sfType.Kind() != reflect.Slice || sfType.Elem().Kind() != reflect.Uint8) {
+				return nil, fmt.Errorf("(struct %s) encoding %q requires a []byte or string field, but %s is a %s",
+					t.String(), stags.Encoding, sf.Name, sfType)
+			}
+			codec := &textEncodingCodec{name: stags.Encoding, enc: enc}
+			description.encoder, description.decoder = codec, codec
+		}
+
+		if stags.Codec != "" {
+			codec, ok := r.lookupNamedCodec(stags.Codec)
+			if !ok {
+				return nil, fmt.Errorf("(struct %s) unknown codec %q for field %s", t.String(), stags.Codec, sf.Name)
+			}
+			if codec.enc != nil {
+				description.encoder = codec.enc
+			}
+			if codec.dec != nil {
+				description.decoder = codec.dec
+			}
+		}
+
+		if stags.PairArray {
+			if sfType.Kind() != reflect.Map {
+				return nil, fmt.Errorf("(struct %s) pairarray requires a map field, but %s is a %s", t.String(), sf.Name, sfType)
+			}
+			codec := &pairArrayCodec{}
+			description.encoder, description.decoder = codec, codec
+		}
+
+		if stags.Binary {
+			if sfType != tIP && sfType != tHardwareAddr {
+				return nil, fmt.Errorf("(struct %s) binary requires a net.IP or net.HardwareAddr field, but %s is a %s",
+					t.String(), sf.Name, sfType)
+			}
+			description.encoder = ValueEncoderFunc(netBinaryEncodeValue)
+		}
+
+		if stags.Packed != "" {
+			codec, err := newPackedCodec(stags.Packed, sfType)
+			if err != nil {
+				return nil, fmt.Errorf("(struct %s) field %s: %w", t.String(), sf.Name, err)
+			}
+			description.encoder, description.decoder = codec, codec
+		}
+
+		if stags.TimeLayout != "" {
+			if sfType != tTime {
+				return nil, fmt.Errorf("(struct %s) timelayout requires a time.Time field, but %s is a %s", t.String(), sf.Name, sfType)
+			}
+			codec := &timeLayoutCodec{layout: stags.TimeLayout}
+			description.encoder, description.decoder = codec, codec
+		}
+
+		if stags.BSONType != "" {
+			bc, ok := bsonTypeCodecs[stags.BSONType]
+			if !ok {
+				return nil, fmt.Errorf("(struct %s) unknown bsontype %q for field %s", t.String(), stags.BSONType, sf.Name)
+			}
+			if !bc.accepts(sfType) {
+				return nil, fmt.Errorf("(struct %s) bsontype %q cannot be used with field %s of type %s",
+					t.String(), stags.BSONType, sf.Name, sfType)
+			}
+			description.encoder, description.decoder = bc.codec, bc.codec
+		}
+
+		if stags.Bitset {
+			if !isBitsetType(sfType) {
+				return nil, fmt.Errorf("(struct %s) bitset requires a []bool or [N]bool field, but %s is a %s",
+					t.String(), sf.Name, sfType)
+			}
+			description.encoder, description.decoder = bitsetCodec{}, bitsetCodec{}
+		}
+
+		if stags.Try != "" {
+			codec, err := newTryCodec(stags.Try, sfType)
+			if err != nil {
+				return nil, fmt.Errorf("(struct %s) field %s: %w", t.String(), sf.Name, err)
+			}
+			description.decoder = codec
+		}
+
+		if stags.HashOf != "" {
+			if sfType != tString && sfType != tByteSlice {
+				return nil, fmt.Errorf("(struct %s) hashof requires a string or []byte field, but %s is a %s",
+					t.String(), sf.Name, sfType)
+			}
+			description.hashOf = strings.Split(stags.HashOf, "|")
+			description.hashString = sfType == tString
+		}
+
+		if stags.ScalarAs != "" {
+			codec, err := newScalarAsCodec(r, sfType, stags.ScalarAs, description.decoder)
+			if err != nil {
+				return nil, fmt.Errorf("(struct %s) field %s: %w", t.String(), sf.Name, err)
+			}
+			description.decoder = codec
+		}
+
+		if stags.Project != "" {
+			projector, ok := r.lookupProjector(stags.Project)
+			if !ok {
+				return nil, fmt.Errorf("(struct %s) unknown projector %q for field %s", t.String(), stags.Project, sf.Name)
+			}
+			description.projector = projector
+		}
+
+		if stags.Transform != "" {
+			if sfType.Kind() != reflect.String {
+				return nil, fmt.Errorf("(struct %s) transform requires a string field, but %s is a %s",
+					t.String(), sf.Name, sfType)
+			}
+			codec := &transformCodec{
+				names:   strings.Split(stags.Transform, "|"),
+				encoder: description.encoder,
+				decoder: description.decoder,
+			}
+			for _, name := range codec.names {
+				tr, ok := r.lookupTransform(name)
+				if !ok {
+					return nil, fmt.Errorf("(struct %s) unknown transform %q for field %s", t.String(), name, sf.Name)
+				}
+				codec.transforms = append(codec.transforms, tr)
+			}
+			description.encoder, description.decoder = codec, codec
+		}
+
+		if description.onMissing != "" {
+			if err := validateOnMissing(t, sfType, description.onMissing); err != nil {
+				return nil, err
+			}
+		}
+
+		description.ttlKey = stags.TTLKey
+
+		if stags.Generation {
+			switch sfType.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			default:
+				return nil, fmt.Errorf("(struct %s) generation requires an integer field, but %s is a %s",
+					t.String(), sf.Name, sfType)
+			}
+			description.generation = true
+		}
+
+		if stags.Round != "" {
+			digits, err := strconv.Atoi(stags.Round)
+			if err != nil || digits < 0 {
+				return nil, fmt.Errorf("(struct %s) invalid round %q for field %s", t.String(), stags.Round, sf.Name)
+			}
+			if k := sfType.Kind(); k != reflect.Float32 && k != reflect.Float64 &&
+				(k != reflect.Ptr || (sfType.Elem().Kind() != reflect.Float32 && sfType.Elem().Kind() != reflect.Float64)) {
+				return nil, fmt.Errorf("(struct %s) round requires a float field, but %s is a %s", t.String(), sf.Name, sfType)
+			}
+			description.round = true
+			description.roundDigits = digits
+		}
+
+		if stags.Mirror != "" {
+			if sfType != tTime && sfType != reflect.PtrTo(tTime) {
+				return nil, fmt.Errorf("(struct %s) mirror requires a time.Time or *time.Time field, but %s is a %s",
+					t.String(), sf.Name, sfType)
+			}
+			mf, ok := t.FieldByName(stags.Mirror)
+			if !ok || len(mf.Index) != 1 || mf.PkgPath != "" {
+				return nil, fmt.Errorf("(struct %s) mirror field %s of field %s does not exist", t.String(), stags.Mirror, sf.Name)
+			}
+			if mf.Type.Kind() != reflect.String {
+				return nil, fmt.Errorf("(struct %s) mirror field %s of field %s must be a string, but is a %s",
+					t.String(), stags.Mirror, sf.Name, mf.Type)
+			}
+			description.mirror = mf.Index
+			description.layout = stags.Layout
+			if description.layout == "" {
+				description.layout = time.RFC3339
+			}
+		}
+
+		if stags.WriteOnly || stags.ReadOnly {
+			if stags.WriteOnly && stags.ReadOnly {
+				return nil, fmt.Errorf("(struct %s) field %s cannot be both writeonly and readonly", t.String(), sf.Name)
+			}
+			if stags.Inline {
+				return nil, fmt.Errorf("(struct %s) writeonly and readonly cannot be used with inline on field %s", t.String(), sf.Name)
+			}
+			if stags.WriteOnly && (stags.Required || stags.OnMissing != "") {
+				return nil, fmt.Errorf("(struct %s) writeonly cannot be used with required or onmissing on field %s", t.String(), sf.Name)
+			}
+			description.writeOnly = stags.WriteOnly
+			description.readOnly = stags.ReadOnly
+		}
+
+		if stags.Required && (stags.Glob || stags.Inline) {
+			return nil, fmt.Errorf("(struct %s) required cannot be used with glob or inline on field %s", t.String(), sf.Name)
+		}
+
+		if stags.Glob {
+			if sfType.Kind() != reflect.Map || sfType.Key().Kind() != reflect.String {
+				return nil, fmt.Errorf("(struct %s) glob requires a map field with string keys, but %s is a %s",
+					t.String(), sf.Name, sfType)
+			}
+			if _, err := path.Match(stags.Name, ""); err != nil {
+				return nil, fmt.Errorf("(struct %s) invalid glob pattern %q for field %s: %w", t.String(), stags.Name, sf.Name, err)
+			}
+			description.glob = true
+		}
+
+		if stags.Prefix != "" && (!stags.Inline || sfType.Kind() != reflect.Map) {
+			return nil, fmt.Errorf("(struct %s) prefix requires an inline map field, but %s is not", t.String(), sf.Name)
+		}
 
 		if stags.Inline {
 			sd.inline = true
+			if sfType == tRaw {
+				if sd.inlineMap >= 0 || sd.inlineRaw >= 0 || sd.inlineSetter >= 0 {
+					return nil, errors.New("(struct " + t.String() + ") multiple inline maps")
+				}
+				sd.inlineRaw = description.idx
+				continue
+			}
+			if sfType.Implements(tMapSetter) || reflect.PtrTo(sfType).Implements(tMapSetter) {
+				if sd.inlineMap >= 0 || sd.inlineRaw >= 0 || sd.inlineSetter >= 0 {
+					return nil, errors.New("(struct " + t.String() + ") multiple inline maps")
+				}
+				sd.inlineSetter = description.idx
+				continue
+			}
 			switch sfType.Kind() {
 			case reflect.Map:
-				if sd.inlineMap >= 0 {
+				if sd.inlineMap >= 0 || sd.inlineRaw >= 0 || sd.inlineSetter >= 0 {
 					return nil, errors.New("(struct " + t.String() + ") multiple inline maps")
 				}
-				if sfType.Key() != tString {
-					return nil, errors.New("(struct " + t.String() + ") inline map must have a string keys")
+				if !isStringKeyType(sfType.Key()) {
+					return nil, fmt.Errorf("(struct %s) inline map must have string keys or keys that implement "+
+						"KeyMarshaler or encoding.TextMarshaler, got %s", t.String(), sfType.Key())
 				}
 				sd.inlineMap = description.idx
+				sd.inlinePrefix = stags.Prefix
+				sd.inlineMinSize = stags.MinSize
 			case reflect.Ptr:
 				sfType = sfType.Elem()
 				if sfType.Kind() != reflect.Struct {
@@ -542,16 +2233,33 @@ func (sc *structCodec) describeStructSlow(
 				}
 				fallthrough
 			case reflect.Struct:
-				inlinesf, err := sc.describeStruct(r, sfType, useJSONStructTags, errorOnDuplicates)
+				// A struct that inlines itself, directly or through other inlined structs, would be
+				// described forever.
+				inlining := append(inlining[:len(inlining):len(inlining)], t)
+				for _, it := range inlining {
+					if it == sfType {
+						return nil, fmt.Errorf("inline cycle detected in struct %s: field %s inlines %s", t.String(), sf.Name, sfType)
+					}
+				}
+				inlinesf, err := sc.describeInlined(r, sfType, useJSONStructTags, errorOnDuplicates, nameTransformer, inlining)
 				if err != nil {
 					return nil, err
 				}
 				for _, fd := range inlinesf.fl {
+					if fd.synthetic {
+						// Synthetic fields are added by describing the outer struct.
+						continue
+					}
 					if fd.inline == nil {
 						fd.inline = []int{i, fd.idx}
 					} else {
 						fd.inline = append([]int{i}, fd.inline...)
 					}
+					if fd.mirror != nil {
+						fd.mirror = append([]int{i}, fd.mirror...)
+					}
+					// The "minsize" option of an inline struct applies to all of its fields.
+					fd.minSize = fd.minSize || stags.MinSize
 					fields = append(fields, fd)
 
 				}
@@ -577,6 +2285,7 @@ func (sc *structCodec) describeStructSlow(
 		return byIndex(x).Less(i, j)
 	})
 
+	var renamed []fieldDescription
 	for advance, i := 0, 0; i < len(fields); i += advance {
 		// One iteration per name.
 		// Find the sequence of fields with the name of this first field.
@@ -593,19 +2302,323 @@ func (sc *structCodec) describeStructSlow(
 			sd.fm[name] = fi
 			continue
 		}
-		dominant, ok := dominantField(fields[i : i+advance])
-		if !ok || !sc.overwriteDuplicatedInlinedFields || errorOnDuplicates {
+		var dominant fieldDescription
+		var ok bool
+		if r.dominanceFunc != nil {
+			dominant, ok = resolveDominance(r.dominanceFunc, fields[i:i+advance])
+		} else {
+			dominant, ok = dominantField(fields[i : i+advance])
+		}
+		if r.conflictRename != nil {
+			if !ok {
+				dominant = fi
+			}
+			for _, fd := range fields[i : i+advance] {
+				if sameIndex(fd, dominant) {
+					continue
+				}
+				info := newFieldInfo(fd)
+				fd.name = r.conflictRename(info, fieldPath(t, info.Index))
+				if fd.name == "" || fd.name == name {
+					return nil, fmt.Errorf("struct %s has duplicated key %s", t.String(), name)
+				}
+				renamed = append(renamed, fd)
+			}
+		} else if !ok || !sc.overwriteDuplicatedInlinedFields || errorOnDuplicates {
 			return nil, fmt.Errorf("struct %s has duplicated key %s", t.String(), name)
 		}
 		sd.fl = append(sd.fl, dominant)
 		sd.fm[name] = dominant
 	}
+	for _, fd := range renamed {
+		if _, exists := sd.fm[fd.name]; exists {
+			return nil, fmt.Errorf("(struct %s) key %s of renamed field %s conflicts with another field",
+				t.String(), fd.name, fd.fieldName)
+		}
+		sd.fl = append(sd.fl, fd)
+		sd.fm[fd.name] = fd
+	}
 
 	sort.Sort(byIndex(sd.fl))
+	sortByOrder(sd.fl)
+
+	for _, fd := range sd.fl {
+		if fd.onMissing != "" {
+			sd.onMissing = append(sd.onMissing, fd)
+		}
+		if fd.required {
+			sd.required = append(sd.required, fd)
+		}
+		if fd.ttlKey != "" {
+			if err := describeTTLCompanion(t, sd, fd); err != nil {
+				return nil, err
+			}
+			sd.ttlKeys = append(sd.ttlKeys, fd.ttlKey)
+		}
+		if fd.mirror != nil {
+			describeMirror(sd, fd)
+			sd.mirrors = append(sd.mirrors, fd)
+		}
+		if fd.glob {
+			for _, other := range sd.globs {
+				if globsOverlap(other.name, fd.name) {
+					return nil, fmt.Errorf("(struct %s) glob patterns %q of field %s and %q of field %s overlap",
+						t.String(), other.name, other.fieldName, fd.name, fd.fieldName)
+				}
+			}
+			delete(sd.fm, fd.name)
+			sd.globs = append(sd.globs, fd)
+		}
+	}
+
+	if positional {
+		if err := describePositions(t, sd); err != nil {
+			return nil, err
+		}
+	} else if err := describeSynthetic(r, t, sd); err != nil {
+		return nil, err
+	}
+
+	// Hashed fields are validated once the synthetic fields are known, since those cannot be hashed.
+	for fi, fd := range sd.fl {
+		if fd.hashOf != nil {
+			if err := describeHashOf(t, sd, fi, fd); err != nil {
+				return nil, err
+			}
+			sd.hashes = true
+		}
+	}
+
+	if r != nil && r.errorOnEmptyStruct && len(sd.fl) == 0 && sd.inlineMap < 0 && sd.inlineRaw < 0 && sd.inlineSetter < 0 &&
+		!sd.rawMarshaler && !sd.ptrRawMarshaler {
+		return nil, fmt.Errorf("(struct %s) has no fields to encode or decode; are its fields exported?", t.String())
+	}
 
 	return sd, nil
 }
 
+// describeTTLCompanion checks that the "ttlkey" struct tag option of fd does not collide with the
+// key of another field. A time.Time or *time.Time field with the same key is marked as the field's
+// companion, which receives the expiry when decoding.
+func describeTTLCompanion(t reflect.Type, sd *structDescription, fd fieldDescription) error {
+	other, exists := sd.fm[fd.ttlKey]
+	if !exists {
+		return nil
+	}
+	index := other.inline
+	if index == nil {
+		index = []int{other.idx}
+	}
+	ft := t.FieldByIndex(index).Type
+	if other.ttlCompanion || other.glob || (ft != tTime && ft != reflect.PtrTo(tTime)) {
+		return fmt.Errorf("(struct %s) ttlkey %q of field %s collides with field %s",
+			t.String(), fd.ttlKey, fd.fieldName, other.fieldName)
+	}
+
+	other.ttlCompanion = true
+	sd.fm[other.name] = other
+	for i := range sd.fl {
+		if sd.fl[i].name == other.name {
+			sd.fl[i].ttlCompanion = true
+		}
+	}
+	return nil
+}
+
+// describeMirror marks the field that is the mirror of fd, if it is encoded and decoded, as
+// mirrored.
+func describeMirror(sd *structDescription, fd fieldDescription) {
+	for i, other := range sd.fl {
+		index := other.inline
+		if index == nil {
+			index = []int{other.idx}
+		}
+		if reflect.DeepEqual(index, fd.mirror) {
+			sd.fl[i].mirrored = true
+			other.mirrored = true
+			sd.fm[other.name] = other
+		}
+	}
+}
+
+// inlineMapSetter returns the MapSetter of the inline field val, allocating it if it is a nil
+// pointer.
+func inlineMapSetter(val reflect.Value) MapSetter {
+	if val.Kind() == reflect.Ptr && val.IsNil() {
+		val.Set(reflect.New(val.Type().Elem()))
+	}
+	if val.Type().Implements(tMapSetter) {
+		return val.Interface().(MapSetter)
+	}
+	return val.Addr().Interface().(MapSetter)
+}
+
+// describePositions populates sd.positions from the "pos" struct tag options of the fields in
+// sd.fl. Every field must have a unique position. If no field has a position, the fields are
+// assigned positions in declaration order.
+func describePositions(t reflect.Type, sd *structDescription) error {
+	if sd.inlineMap >= 0 || sd.inlineRaw >= 0 || sd.inlineSetter >= 0 {
+		return fmt.Errorf("(struct %s) inline maps cannot be used with PositionalArray", t.String())
+	}
+
+	declarationOrder := true
+	for _, fd := range sd.fl {
+		if fd.pos >= 0 {
+			declarationOrder = false
+			break
+		}
+	}
+	if declarationOrder {
+		for fi := range sd.fl {
+			sd.fl[fi].pos = fi
+			sd.fm[sd.fl[fi].name] = sd.fl[fi]
+		}
+	}
+
+	sd.positions = []int{}
+	for fi, fd := range sd.fl {
+		if fd.pos < 0 {
+			return fmt.Errorf("(struct %s) field %s has no position, required by PositionalArray", t.String(), fd.fieldName)
+		}
+		if fd.omitEmpty {
+			return fmt.Errorf("(struct %s) field %s cannot use omitempty with PositionalArray", t.String(), fd.fieldName)
+		}
+		if fd.omitZero {
+			return fmt.Errorf("(struct %s) field %s cannot use omitzero with PositionalArray", t.String(), fd.fieldName)
+		}
+		for len(sd.positions) <= fd.pos {
+			sd.positions = append(sd.positions, -1)
+		}
+		if sd.positions[fd.pos] >= 0 {
+			return fmt.Errorf("(struct %s) fields %s and %s have the same position %d",
+				t.String(), sd.fl[sd.positions[fd.pos]].fieldName, fd.fieldName, fd.pos)
+		}
+		sd.positions[fd.pos] = fi
+	}
+	return nil
+}
+
+var tError = reflect.TypeOf((*error)(nil)).Elem()
+
+// validateOnMissing checks that *t has a method with the given name and the signature
+// func() (T, error), where T is assignable to a field of type ft.
+func validateOnMissing(t, ft reflect.Type, name string) error {
+	m, ok := reflect.PtrTo(t).MethodByName(name)
+	if !ok {
+		return fmt.Errorf("(struct %s) onmissing method %s not found", t.String(), name)
+	}
+	mt := m.Type
+	if mt.NumIn() != 1 || mt.NumOut() != 2 || !mt.Out(0).AssignableTo(ft) || mt.Out(1) != tError {
+		return fmt.Errorf("(struct %s) onmissing method %s must have signature func() (%s, error)",
+			t.String(), name, ft.String())
+	}
+	return nil
+}
+
+// FieldInfo describes a struct field that is a candidate for a BSON key.
+type FieldInfo struct {
+	Name      string // BSON key
+	FieldName string // struct field name
+	Index     []int  // index sequence of the field, including the indexes of inlined structs
+	Tagged    bool   // whether the BSON key was set by a struct tag
+}
+
+// DominanceFunc chooses which of multiple struct fields with the same BSON key is encoded and
+// decoded. The candidates are ordered by increasing depth, then by index sequence. DominanceFunc
+// returns the index of the chosen candidate, or false if the fields conflict, which is reported
+// as a duplicated key error.
+type DominanceFunc func(candidates []FieldInfo) (int, bool)
+
+// PreferTaggedFields is a DominanceFunc that applies the rules of encoding/json: the shallowest
+// candidates win and, if there are several, the only one whose BSON key was set by a struct tag
+// wins. Candidates at the same depth that are all tagged or all untagged conflict.
+func PreferTaggedFields(candidates []FieldInfo) (int, bool) {
+	depth := len(candidates[0].Index)
+	winner := -1
+	for i, c := range candidates {
+		if len(c.Index) != depth {
+			break
+		}
+		if !c.Tagged {
+			continue
+		}
+		if winner >= 0 {
+			return 0, false
+		}
+		winner = i
+	}
+	if winner >= 0 {
+		return winner, true
+	}
+	if len(candidates) > 1 && len(candidates[1].Index) == depth {
+		return 0, false
+	}
+	return 0, true
+}
+
+// ConflictRenameFunc returns a new BSON key for a struct field whose BSON key conflicts with the
+// key of a dominant field, e.g. a field of an inlined struct with the same key as a field of the
+// outer struct. path holds the names of the struct fields leading to the field, starting with the
+// field of the outer struct, and ending with the field's own name. Returning an empty string or
+// the conflicting key is reported as a duplicated key error.
+type ConflictRenameFunc func(field FieldInfo, path []string) string
+
+// PrefixFieldPath is a ConflictRenameFunc that prefixes the BSON key of the field with the
+// lowercased names of the inlined struct fields it is reached through, separated by "_". For
+// example, an "id" field of a struct inlined by a field named Parent is renamed to "parent_id".
+func PrefixFieldPath(field FieldInfo, path []string) string {
+	if len(path) < 2 {
+		return ""
+	}
+	return strings.ToLower(strings.Join(path[:len(path)-1], "_")) + "_" + field.Name
+}
+
+// newFieldInfo returns the FieldInfo of fd.
+func newFieldInfo(fd fieldDescription) FieldInfo {
+	index := fd.inline
+	if index == nil {
+		index = []int{fd.idx}
+	}
+	return FieldInfo{
+		Name:      fd.name,
+		FieldName: fd.fieldName,
+		Index:     append([]int(nil), index...),
+		Tagged:    fd.tagged,
+	}
+}
+
+// sameIndex reports whether fd1 and fd2 describe the same struct field.
+func sameIndex(fd1, fd2 fieldDescription) bool {
+	return fd1.idx == fd2.idx && reflect.DeepEqual(fd1.inline, fd2.inline)
+}
+
+// fieldPath returns the names of the struct fields of t along index.
+func fieldPath(t reflect.Type, index []int) []string {
+	path := make([]string, 0, len(index))
+	for _, i := range index {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		sf := t.Field(i)
+		path = append(path, sf.Name)
+		t = sf.Type
+	}
+	return path
+}
+
+// resolveDominance chooses the dominant field from fields using fn.
+func resolveDominance(fn DominanceFunc, fields []fieldDescription) (fieldDescription, bool) {
+	candidates := make([]FieldInfo, len(fields))
+	for i, fd := range fields {
+		candidates[i] = newFieldInfo(fd)
+	}
+	winner, ok := fn(candidates)
+	if !ok || winner < 0 || winner >= len(fields) {
+		return fieldDescription{}, false
+	}
+	return fields[winner], true
+}
+
 // dominantField looks through the fields, all of which are known to
 // have the same name, to find the single field that dominates the
 // others using Go's inlining rules. If there are multiple top-level
@@ -7,11 +7,25 @@
 package bson
 
 import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unicode"
 
 	"go.mongodb.org/mongo-driver/v2/internal/assert"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
 )
 
 func TestIsZero(t *testing.T) {
@@ -145,6 +159,28 @@ func TestIsZero(t *testing.T) {
 			value:       "",
 			want:        true,
 		},
+		{
+			description: "zero-length array",
+			value:       [0]int{},
+			want:        true,
+		},
+		{
+			description: "zero array",
+			value:       [4]byte{},
+			want:        false,
+		},
+		{
+			description:    "zero array with omitZeroStruct",
+			value:          [4]byte{},
+			omitZeroStruct: true,
+			want:           true,
+		},
+		{
+			description:    "partially-filled array with omitZeroStruct",
+			value:          [4]byte{0, 7, 0, 0},
+			omitZeroStruct: true,
+			want:           false,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -158,3 +194,3786 @@ func TestIsZero(t *testing.T) {
 		})
 	}
 }
+
+type onMissingTest struct {
+	ID   string `bson:"id,onmissing=NewID"`
+	Name string `bson:"name"`
+}
+
+func (*onMissingTest) NewID() (string, error) { return "generated", nil }
+
+type onMissingErrTest struct {
+	ID string `bson:"id,onmissing=NewID"`
+}
+
+func (*onMissingErrTest) NewID() (string, error) { return "", errors.New("no id available") }
+
+type onMissingInlineTest struct {
+	A, B int
+	C    string `bson:"c,onmissing=NewC"`
+}
+
+func (*onMissingInlineTest) NewC() (string, error) { return "generated", nil }
+
+type onMissingBadSignatureTest struct {
+	ID string `bson:"id,onmissing=NewID"`
+}
+
+func (*onMissingBadSignatureTest) NewID() int { return 0 }
+
+func TestStructCodecOnMissing(t *testing.T) {
+	t.Parallel()
+
+	t.Run("absent field is constructed", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"name", "foo"}})
+		assert.NoError(t, err)
+
+		var got onMissingTest
+		err = Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, onMissingTest{ID: "generated", Name: "foo"}, got)
+	})
+	t.Run("present field is decoded", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"id", "stored"}})
+		assert.NoError(t, err)
+
+		var got onMissingTest
+		err = Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, onMissingTest{ID: "stored"}, got)
+	})
+	t.Run("constructor error", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{})
+		assert.NoError(t, err)
+
+		var got onMissingErrTest
+		err = Unmarshal(doc, &got)
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"id"}, de.Keys())
+	})
+	t.Run("not called in patch mode", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"name", "foo"}})
+		assert.NoError(t, err)
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.PatchMode()
+		got := onMissingTest{ID: "existing"}
+		err = dec.Decode(&got)
+		assert.NoError(t, err)
+		assert.Equal(t, onMissingTest{ID: "existing", Name: "foo"}, got)
+	})
+	t.Run("inline field", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"A", 1}})
+		assert.NoError(t, err)
+
+		var got struct {
+			In onMissingInlineTest `bson:",inline"`
+		}
+		err = Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, onMissingInlineTest{A: 1, C: "generated"}, got.In)
+	})
+	t.Run("invalid signature", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{})
+		assert.NoError(t, err)
+
+		var got onMissingBadSignatureTest
+		err = Unmarshal(doc, &got)
+		assert.ErrorContains(t, err, "onmissing method NewID must have signature")
+	})
+}
+
+type positionalPoint struct {
+	PositionalArray
+	X    int     `bson:"x,pos=0"`
+	Y    int     `bson:"y,pos=1"`
+	Name *string `bson:"name,pos=3"`
+}
+
+func TestStructCodecPositionalArray(t *testing.T) {
+	t.Parallel()
+
+	type wrapper struct {
+		P positionalPoint `bson:"p"`
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		name := "origin"
+		in := wrapper{P: positionalPoint{X: 1, Y: 2, Name: &name}}
+		doc, err := Marshal(in)
+		assert.NoError(t, err)
+
+		want, err := Marshal(D{{"p", A{1, 2, nil, "origin"}}})
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(want), Raw(doc))
+
+		var got wrapper
+		err = Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, in, got)
+	})
+	t.Run("decode error reports index", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"p", A{1, "two"}}})
+		assert.NoError(t, err)
+
+		var got wrapper
+		err = Unmarshal(doc, &got)
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"p", "1"}, de.Keys())
+	})
+	t.Run("missing position", func(t *testing.T) {
+		t.Parallel()
+
+		type missing struct {
+			PositionalArray
+			X int `bson:"x,pos=0"`
+			Y int `bson:"y"`
+		}
+		_, err := Marshal(struct{ M missing }{})
+		assert.ErrorContains(t, err, "field Y has no position")
+	})
+	t.Run("declaration order", func(t *testing.T) {
+		t.Parallel()
+
+		type inner struct {
+			Z int `bson:"z"`
+		}
+		type record struct {
+			PositionalArray
+			Name  string `bson:"name"`
+			Inner inner  `bson:",inline"`
+			Score float64
+		}
+
+		in := record{Name: "a", Inner: inner{Z: 3}, Score: 1.5}
+		doc, err := Marshal(struct {
+			R record `bson:"r"`
+		}{R: in})
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(mustMarshal(t, D{{"r", A{"a", 3, 1.5}}})), Raw(doc))
+
+		var got struct {
+			R record `bson:"r"`
+		}
+		err = Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, in, got.R)
+	})
+	t.Run("omitempty", func(t *testing.T) {
+		t.Parallel()
+
+		type omitted struct {
+			PositionalArray
+			X int `bson:"x"`
+			Y int `bson:"y,omitempty"`
+		}
+		_, err := Marshal(struct{ O omitted }{})
+		assert.ErrorContains(t, err, "field Y cannot use omitempty with PositionalArray")
+	})
+	t.Run("duplicate position", func(t *testing.T) {
+		t.Parallel()
+
+		type duplicate struct {
+			PositionalArray
+			X int `bson:"x,pos=0"`
+			Y int `bson:"y,pos=0"`
+		}
+		_, err := Marshal(struct{ D duplicate }{})
+		assert.ErrorContains(t, err, "fields X and Y have the same position 0")
+	})
+}
+
+func TestStructCodecTextEncoding(t *testing.T) {
+	t.Parallel()
+
+	type encoded struct {
+		Sig  []byte `bson:"sig,encoding=base64"`
+		Hash string `bson:"hash,encoding=hex"`
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		in := encoded{Sig: []byte{0xde, 0xad, 0xbe, 0xef}, Hash: "\x01\x02"}
+		doc, err := Marshal(in)
+		assert.NoError(t, err)
+
+		want, err := Marshal(D{{"sig", "3q2+7w=="}, {"hash", "0102"}})
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(want), Raw(doc))
+
+		var got encoded
+		err = Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, in, got)
+	})
+	t.Run("invalid encoded value", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"sig", "not base64!"}})
+		assert.NoError(t, err)
+
+		var got encoded
+		err = Unmarshal(doc, &got)
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"sig"}, de.Keys())
+	})
+	t.Run("registered encoding", func(t *testing.T) {
+		t.Parallel()
+
+		reg := NewRegistry()
+		reg.RegisterTextEncoding("base64url", base64.RawURLEncoding)
+
+		type custom struct {
+			Token []byte `bson:"token,encoding=base64url"`
+		}
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetRegistry(reg)
+		err := enc.Encode(custom{Token: []byte{0xfb, 0xff}})
+		assert.NoError(t, err)
+		assert.Equal(t, "-_8", Raw(buf.Bytes()).Lookup("token").StringValue())
+	})
+	t.Run("unknown encoding", func(t *testing.T) {
+		t.Parallel()
+
+		type unknown struct {
+			Data []byte `bson:"data,encoding=base32"`
+		}
+		_, err := Marshal(unknown{})
+		assert.ErrorContains(t, err, `unknown encoding "base32" for field Data`)
+	})
+}
+
+func TestStructCodecPairArray(t *testing.T) {
+	t.Parallel()
+
+	type pairs struct {
+		M map[int64]string `bson:"m,pairarray"`
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		in := pairs{M: map[int64]string{7: "seven"}}
+		doc, err := Marshal(in)
+		assert.NoError(t, err)
+
+		want, err := Marshal(D{{"m", A{A{int64(7), "seven"}}}})
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(want), Raw(doc))
+
+		var got pairs
+		err = Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, in, got)
+	})
+	t.Run("malformed pair", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"m", A{A{int64(1), "one"}, A{int64(2)}}}})
+		assert.NoError(t, err)
+
+		var got pairs
+		err = Unmarshal(doc, &got)
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"m", "1"}, de.Keys())
+		assert.ErrorContains(t, err, "pair must be a two-element array")
+	})
+	t.Run("non-comparable key", func(t *testing.T) {
+		t.Parallel()
+
+		type anyKeys struct {
+			M map[any]string `bson:"m,pairarray"`
+		}
+		for _, key := range []any{A{int32(1)}, D{{"a", int32(1)}}} {
+			doc := mustMarshal(t, D{{"m", A{A{"ok", "one"}, A{key, "two"}}}})
+
+			var got anyKeys
+			err := Unmarshal(doc, &got)
+			var de *DecodeError
+			if assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err) {
+				assert.Equal(t, []string{"m", "1"}, de.Keys())
+			}
+			assert.ErrorContains(t, err, "is not comparable")
+		}
+	})
+	t.Run("non-map field", func(t *testing.T) {
+		t.Parallel()
+
+		type invalid struct {
+			S []string `bson:"s,pairarray"`
+		}
+		_, err := Marshal(invalid{})
+		assert.ErrorContains(t, err, "pairarray requires a map field")
+	})
+}
+
+type declarationOrderLeaf struct {
+	P string `bson:"p"`
+	Q string `bson:"q"`
+}
+
+type declarationOrderMiddle struct {
+	X    string               `bson:"x"`
+	Leaf declarationOrderLeaf `bson:",inline"`
+	Y    string               `bson:"y"`
+}
+
+func TestStructCodecDeclarationOrder(t *testing.T) {
+	t.Parallel()
+
+	type outer struct {
+		A      string                  `bson:"a"`
+		Middle *declarationOrderMiddle `bson:",inline"`
+		B      string                  `bson:"b"`
+		P      string                  `bson:"p"` // dominates Leaf.P
+	}
+
+	val := outer{A: "a", Middle: &declarationOrderMiddle{X: "x", Leaf: declarationOrderLeaf{P: "lost", Q: "q"}, Y: "y"}, B: "b", P: "p"}
+	want := mustMarshal(t, D{{"a", "a"}, {"x", "x"}, {"q", "q"}, {"y", "y"}, {"b", "b"}, {"p", "p"}})
+
+	doc := mustMarshal(t, val)
+	assert.Equal(t, Raw(want), Raw(doc))
+
+	// Re-encoding the decoded value produces the same bytes.
+	for i := 0; i < 3; i++ {
+		var got outer
+		err := Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		doc = mustMarshal(t, got)
+		assert.Equal(t, Raw(want), Raw(doc))
+	}
+}
+
+func TestStructCodecDominanceFunc(t *testing.T) {
+	t.Parallel()
+
+	type inner struct {
+		Key string `bson:"key"`
+	}
+	type outer struct {
+		Inner inner  `bson:",inline"`
+		Key   string `bson:"key"`
+	}
+
+	encode := func(t *testing.T, reg *Registry, val any) (Raw, error) {
+		t.Helper()
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetRegistry(reg)
+		err := enc.Encode(val)
+		return buf.Bytes(), err
+	}
+
+	in := outer{Inner: inner{Key: "inner"}, Key: "outer"}
+
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := encode(t, NewRegistry(), in)
+		assert.NoError(t, err)
+		assert.Equal(t, "outer", doc.Lookup("key").StringValue())
+	})
+	t.Run("deepest wins", func(t *testing.T) {
+		t.Parallel()
+
+		reg := NewRegistry()
+		reg.SetDominanceFunc(func(candidates []FieldInfo) (int, bool) {
+			return len(candidates) - 1, true
+		})
+		doc, err := encode(t, reg, in)
+		assert.NoError(t, err)
+		assert.Equal(t, "inner", doc.Lookup("key").StringValue())
+	})
+	t.Run("conflict", func(t *testing.T) {
+		t.Parallel()
+
+		reg := NewRegistry()
+		reg.SetDominanceFunc(func(candidates []FieldInfo) (int, bool) {
+			assert.Equal(t, []int{1}, candidates[0].Index)
+			assert.Equal(t, []int{0, 0}, candidates[1].Index)
+			return 0, false
+		})
+		_, err := encode(t, reg, in)
+		assert.ErrorContains(t, err, "has duplicated key key")
+	})
+	t.Run("prefer tagged fields", func(t *testing.T) {
+		t.Parallel()
+
+		type tagged struct {
+			Label string `bson:"Name"`
+		}
+		type untagged struct {
+			Name string
+		}
+		type both struct {
+			Untagged untagged `bson:",inline"`
+			Tagged   tagged   `bson:",inline"`
+		}
+		type twice struct {
+			A tagged `bson:",inline"`
+			B tagged `bson:",inline"`
+		}
+
+		reg := NewRegistry()
+		reg.SetDominanceFunc(PreferTaggedFields)
+
+		_, err := encode(t, NewRegistry(), both{})
+		assert.ErrorContains(t, err, "has duplicated key Name")
+
+		doc, err := encode(t, reg, both{Untagged: untagged{Name: "untagged"}, Tagged: tagged{Label: "tagged"}})
+		assert.NoError(t, err)
+		assert.Equal(t, "tagged", doc.Lookup("Name").StringValue())
+
+		doc, err = encode(t, reg, in)
+		assert.NoError(t, err)
+		assert.Equal(t, "outer", doc.Lookup("key").StringValue())
+
+		_, err = encode(t, reg, twice{})
+		assert.ErrorContains(t, err, "has duplicated key Name")
+
+		// A tag that sets the key to the field name still tags the field.
+		type sameName struct {
+			Name string `bson:"Name"`
+		}
+		type same struct {
+			Untagged untagged `bson:",inline"`
+			Tagged   sameName `bson:",inline"`
+		}
+		doc, err = encode(t, reg, same{Untagged: untagged{Name: "untagged"}, Tagged: sameName{Name: "tagged"}})
+		assert.NoError(t, err)
+		assert.Equal(t, "tagged", doc.Lookup("Name").StringValue())
+	})
+}
+
+type prefixTransform string
+
+func (p prefixTransform) Apply(s string) (string, error) {
+	if !strings.HasPrefix(s, string(p)) {
+		return "", fmt.Errorf("missing prefix %q", string(p))
+	}
+	return strings.TrimPrefix(s, string(p)), nil
+}
+
+func (p prefixTransform) Reverse(s string) (string, error) {
+	return string(p) + s, nil
+}
+
+func TestStructCodecTransform(t *testing.T) {
+	t.Parallel()
+
+	type account struct {
+		Email string `bson:"email,transform=trim|lower"`
+		ID    string `bson:"id,transform=trim|acct"`
+	}
+
+	reg := NewRegistry()
+	reg.RegisterTransform("acct", prefixTransform("acct-"))
+
+	decode := func(t *testing.T, doc []byte, val any) error {
+		t.Helper()
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.SetRegistry(reg)
+		return dec.Decode(val)
+	}
+
+	t.Run("applied on decode", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"email", "  Foo@Example.COM "}, {"id", " acct-42"}})
+		assert.NoError(t, err)
+
+		var got account
+		err = decode(t, doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, account{Email: "foo@example.com", ID: "42"}, got)
+	})
+	t.Run("reversed on encode", func(t *testing.T) {
+		t.Parallel()
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetRegistry(reg)
+		err := enc.Encode(account{Email: "foo@example.com", ID: "42"})
+		assert.NoError(t, err)
+
+		want, err := Marshal(D{{"email", "foo@example.com"}, {"id", "acct-42"}})
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(want), Raw(buf.Bytes()))
+	})
+	t.Run("transform error", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"email", "a@b.c"}, {"id", "42"}})
+		assert.NoError(t, err)
+
+		var got account
+		err = decode(t, doc, &got)
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"id"}, de.Keys())
+		assert.ErrorContains(t, err, `transform "acct"`)
+	})
+	t.Run("unknown transform", func(t *testing.T) {
+		t.Parallel()
+
+		type invalid struct {
+			S string `bson:"s,transform=trim|nope"`
+		}
+		_, err := Marshal(invalid{})
+		assert.ErrorContains(t, err, `unknown transform "nope"`)
+	})
+}
+
+type discriminatorShape interface {
+	area() float64
+}
+
+type discriminatorCircle struct {
+	Radius float64 `bson:"radius"`
+}
+
+func (c discriminatorCircle) area() float64 { return 3 * c.Radius * c.Radius }
+
+type discriminatorSquare struct {
+	Side float64 `bson:"side"`
+}
+
+func (s *discriminatorSquare) area() float64 { return s.Side * s.Side }
+
+func TestStructCodecDiscriminator(t *testing.T) {
+	t.Parallel()
+
+	type drawing struct {
+		Shape discriminatorShape `bson:"shape"`
+		Any   any                `bson:"any"`
+	}
+
+	reg := NewRegistry()
+	reg.RegisterTypeDiscriminator(reflect.TypeOf(discriminatorCircle{}), "circle")
+	reg.RegisterTypeDiscriminator(reflect.TypeOf(discriminatorSquare{}), "square")
+
+	encode := func(t *testing.T, val any) (Raw, error) {
+		t.Helper()
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetRegistry(reg)
+		err := enc.Encode(val)
+		return buf.Bytes(), err
+	}
+	decode := func(t *testing.T, doc []byte, val any) error {
+		t.Helper()
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.SetRegistry(reg)
+		return dec.Decode(val)
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		in := drawing{Shape: &discriminatorSquare{Side: 2}, Any: discriminatorCircle{Radius: 1}}
+		doc, err := encode(t, in)
+		assert.NoError(t, err)
+
+		want, err := Marshal(D{
+			{"shape", D{{"_type", "square"}, {"side", 2.0}}},
+			{"any", D{{"_type", "circle"}, {"radius", 1.0}}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(want), doc)
+
+		var got drawing
+		err = decode(t, doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, in, got)
+	})
+	t.Run("disallow unknown fields", func(t *testing.T) {
+		t.Parallel()
+
+		in := drawing{Shape: &discriminatorSquare{Side: 2}, Any: discriminatorCircle{Radius: 1}}
+		doc, err := encode(t, in)
+		assert.NoError(t, err)
+
+		var got drawing
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.SetRegistry(reg)
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&got)
+		assert.NoError(t, err)
+		assert.Equal(t, in, got)
+
+		// The discriminator key is only expected in documents whose type it selected.
+		doc, err = Marshal(D{{"_type", "square"}, {"side", 2.0}})
+		assert.NoError(t, err)
+		dec = NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.SetRegistry(reg)
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&discriminatorSquare{})
+		assert.ErrorIs(t, err, ErrUnknownField)
+	})
+	t.Run("concrete field has no discriminator", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := encode(t, struct {
+			C discriminatorCircle `bson:"c"`
+		}{C: discriminatorCircle{Radius: 1}})
+		assert.NoError(t, err)
+
+		want, err := Marshal(D{{"c", D{{"radius", 1.0}}}})
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(want), doc)
+	})
+	t.Run("unknown discriminator", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"shape", D{{"_type", "triangle"}}}})
+		assert.NoError(t, err)
+
+		var got drawing
+		err = decode(t, doc, &got)
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"shape"}, de.Keys())
+		assert.ErrorContains(t, err, `unknown discriminator "triangle"`)
+	})
+	t.Run("malformed document", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"any", D{{"side", "x"}, {"_type", "square"}}}})
+		assert.NoError(t, err)
+		// Corrupt the length of the "side" string so that the lookup cannot reach "_type".
+		doc[19] = 0x7f
+
+		var got drawing
+		err = decode(t, doc, &got)
+		assert.ErrorContains(t, err, "too few bytes to read next component")
+	})
+	t.Run("key collision", func(t *testing.T) {
+		t.Parallel()
+
+		type typed struct {
+			Type string `bson:"_type"`
+		}
+		reg := NewRegistry()
+		reg.RegisterTypeDiscriminator(reflect.TypeOf(typed{}), "typed")
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetRegistry(reg)
+		err := enc.Encode(struct {
+			V any `bson:"v"`
+		}{V: typed{}})
+		assert.ErrorContains(t, err, `discriminator key "_type" collides`)
+	})
+	t.Run("conflicting registration", func(t *testing.T) {
+		t.Parallel()
+
+		register := func(name string, typ reflect.Type, wantErr string) {
+			t.Helper()
+
+			reg := NewRegistry()
+			reg.RegisterTypeDiscriminator(reflect.TypeOf(discriminatorCircle{}), "circle")
+			defer func() {
+				err, _ := recover().(error)
+				if wantErr == "" {
+					assert.NoError(t, err)
+				} else {
+					assert.ErrorContains(t, err, wantErr)
+				}
+			}()
+			reg.RegisterTypeDiscriminator(typ, name)
+		}
+		register("circle", reflect.TypeOf(discriminatorCircle{}), "")
+		register("circle", reflect.TypeOf(discriminatorSquare{}),
+			`discriminator "circle" is already registered for type bson.discriminatorCircle`)
+		register("round", reflect.TypeOf(discriminatorCircle{}),
+			`type bson.discriminatorCircle is already registered with discriminator "circle"`)
+	})
+}
+
+func TestStructCodecInterfaceFactory(t *testing.T) {
+	t.Parallel()
+
+	type drawing struct {
+		Shapes []discriminatorShape `bson:"shapes"`
+	}
+
+	decode := func(t *testing.T, reg *Registry, doc []byte, val any) error {
+		t.Helper()
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.SetRegistry(reg)
+		return dec.Decode(val)
+	}
+
+	t.Run("discriminator", func(t *testing.T) {
+		t.Parallel()
+
+		reg := NewRegistry()
+		reg.RegisterTypeDiscriminator(reflect.TypeOf(discriminatorCircle{}), "circle")
+		reg.RegisterTypeDiscriminator(reflect.TypeOf(discriminatorSquare{}), "square")
+		reg.RegisterInterfaceFactory(reflect.TypeOf((*discriminatorShape)(nil)).Elem(), nil)
+
+		doc, err := Marshal(D{{"shapes", A{
+			D{{"_type", "circle"}, {"radius", 1.0}},
+			D{{"_type", "square"}, {"side", 2.0}},
+			nil,
+		}}})
+		assert.NoError(t, err)
+
+		var got drawing
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.SetRegistry(reg)
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&got)
+		assert.NoError(t, err)
+		want := drawing{Shapes: []discriminatorShape{
+			discriminatorCircle{Radius: 1},
+			&discriminatorSquare{Side: 2},
+			nil,
+		}}
+		assert.Equal(t, want, got)
+	})
+	t.Run("factory", func(t *testing.T) {
+		t.Parallel()
+
+		reg := NewRegistry()
+		reg.RegisterInterfaceFactory(reflect.TypeOf((*discriminatorShape)(nil)).Elem(), func(rv RawValue) (any, error) {
+			if _, err := rv.Document().LookupErr("radius"); err == nil {
+				return &discriminatorCircle{}, nil
+			}
+			return nil, nil
+		})
+
+		doc, err := Marshal(D{{"shapes", A{D{{"radius", 1.0}}}}})
+		assert.NoError(t, err)
+
+		var got drawing
+		err = decode(t, reg, doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, drawing{Shapes: []discriminatorShape{discriminatorCircle{Radius: 1}}}, got)
+	})
+	t.Run("unresolvable element", func(t *testing.T) {
+		t.Parallel()
+
+		reg := NewRegistry()
+		reg.RegisterTypeDiscriminator(reflect.TypeOf(discriminatorCircle{}), "circle")
+		reg.RegisterInterfaceFactory(reflect.TypeOf((*discriminatorShape)(nil)).Elem(), nil)
+
+		doc, err := Marshal(D{{"shapes", A{D{{"_type", "circle"}}, D{{"side", 2.0}}}}})
+		assert.NoError(t, err)
+
+		var got drawing
+		err = decode(t, reg, doc, &got)
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"shapes", "1"}, de.Keys())
+		assert.ErrorContains(t, err, "cannot determine the concrete type")
+	})
+}
+
+func TestStructCodecTypeResolver(t *testing.T) {
+	t.Parallel()
+
+	type event struct {
+		Type    string             `bson:"type"`
+		Payload discriminatorShape `bson:"payload"`
+		Extra   any                `bson:"extra"`
+	}
+
+	resolve := func(fieldName string, discriminator RawValue) (reflect.Type, error) {
+		if fieldName != "Payload" {
+			return nil, nil
+		}
+		switch kind := discriminator.StringValue(); kind {
+		case "circle":
+			return reflect.TypeOf(discriminatorCircle{}), nil
+		case "square":
+			return reflect.TypeOf(discriminatorSquare{}), nil
+		default:
+			return nil, fmt.Errorf("unknown event type %q", kind)
+		}
+	}
+	decode := func(t *testing.T, doc D, val any) error {
+		t.Helper()
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(mustMarshal(t, doc))))
+		dec.SetTypeResolver("type", resolve)
+		return dec.Decode(val)
+	}
+
+	testCases := []struct {
+		name string
+		doc  D
+		want event
+	}{
+		{
+			name: "key before payload",
+			doc:  D{{"type", "circle"}, {"payload", D{{"radius", 1.0}}}},
+			want: event{Type: "circle", Payload: discriminatorCircle{Radius: 1}},
+		},
+		{
+			name: "key after payload",
+			doc:  D{{"payload", D{{"side", 2.0}}}, {"extra", D{{"a", 1}}}, {"type", "square"}},
+			want: event{Type: "square", Payload: &discriminatorSquare{Side: 2}, Extra: D{{"a", int32(1)}}},
+		},
+		{
+			name: "no key",
+			doc:  D{{"extra", "x"}},
+			want: event{Extra: "x"},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got event
+			err := decode(t, tc.doc, &got)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	t.Run("nested", func(t *testing.T) {
+		t.Parallel()
+
+		type envelope struct {
+			Type  string `bson:"type"`
+			Event event  `bson:"event"`
+		}
+		doc := D{{"type", "square"}, {"event", D{{"payload", D{{"radius", 3.0}}}, {"type", "circle"}}}}
+
+		var got envelope
+		err := decode(t, doc, &got)
+		assert.NoError(t, err)
+		want := envelope{Type: "square", Event: event{Type: "circle", Payload: discriminatorCircle{Radius: 3}}}
+		assert.Equal(t, want, got)
+	})
+	t.Run("resolver error", func(t *testing.T) {
+		t.Parallel()
+
+		var got event
+		err := decode(t, D{{"payload", D{}}, {"type", "triangle"}}, &got)
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"payload"}, de.Keys())
+		assert.ErrorContains(t, err, `unknown event type "triangle"`)
+	})
+}
+
+func TestStructCodecProjector(t *testing.T) {
+	t.Parallel()
+
+	type person struct {
+		First    string `bson:"first"`
+		Last     string `bson:"last"`
+		FullName string `bson:"fullName,project=joinName,omitempty"`
+	}
+
+	reg := NewRegistry()
+	reg.RegisterProjector("joinName", func(v any) (any, error) {
+		p := v.(person)
+		if p.Last == "" {
+			return nil, errors.New("last name is required")
+		}
+		return p.First + " " + p.Last, nil
+	})
+
+	encode := func(t *testing.T, val any) (Raw, error) {
+		t.Helper()
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetRegistry(reg)
+		err := enc.Encode(val)
+		return buf.Bytes(), err
+	}
+
+	t.Run("computed value", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := encode(t, person{First: "Ada", Last: "Lovelace", FullName: "ignored"})
+		assert.NoError(t, err)
+
+		want, err := Marshal(D{{"first", "Ada"}, {"last", "Lovelace"}, {"fullName", "Ada Lovelace"}})
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(want), doc)
+	})
+	t.Run("projector error", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := encode(t, person{First: "Ada"})
+		assert.EqualError(t, err, "error encoding key fullName (field FullName): last name is required")
+		var ee *EncodeError
+		if assert.True(t, errors.As(err, &ee), "expected an EncodeError, got %v", err) {
+			assert.Equal(t, []string{"fullName"}, ee.Keys())
+			assert.Equal(t, []string{"FullName"}, ee.FieldNames())
+		}
+	})
+	t.Run("unknown projector", func(t *testing.T) {
+		t.Parallel()
+
+		type invalid struct {
+			S string `bson:"s,project=nope"`
+		}
+		_, err := encode(t, invalid{})
+		assert.ErrorContains(t, err, `unknown projector "nope"`)
+	})
+}
+
+func TestStructCodecGlob(t *testing.T) {
+	t.Parallel()
+
+	type metrics struct {
+		Name    string             `bson:"name"`
+		Metrics map[string]float64 `bson:"metric_*,glob"`
+		Extra   map[string]any     `bson:",inline"`
+	}
+
+	t.Run("decode", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"name", "cpu"}, {"metric_avg", 1.5}, {"other", "x"}, {"metric_max", 3.0}})
+		assert.NoError(t, err)
+
+		var got metrics
+		err = Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		want := metrics{
+			Name:    "cpu",
+			Metrics: map[string]float64{"metric_avg": 1.5, "metric_max": 3.0},
+			Extra:   map[string]any{"other": "x"},
+		}
+		assert.Equal(t, want, got)
+	})
+	t.Run("encode", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(metrics{Name: "cpu", Metrics: map[string]float64{"metric_avg": 1.5}})
+		assert.NoError(t, err)
+
+		want, err := Marshal(D{{"name", "cpu"}, {"metric_avg", 1.5}})
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(want), Raw(doc))
+	})
+	t.Run("encode non-matching key", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := Marshal(metrics{Name: "cpu", Metrics: map[string]float64{"avg": 1.5}})
+		assert.ErrorContains(t, err, `key "avg" does not match the glob pattern`)
+		var ee *EncodeError
+		assert.True(t, errors.As(err, &ee), "expected an EncodeError, got %v", err)
+	})
+	t.Run("decode error", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"metric_avg", "high"}})
+		assert.NoError(t, err)
+
+		var got metrics
+		err = Unmarshal(doc, &got)
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"metric_avg"}, de.Keys())
+	})
+	t.Run("overlapping globs", func(t *testing.T) {
+		t.Parallel()
+
+		type overlapping struct {
+			A map[string]int `bson:"metric_*,glob"`
+			B map[string]int `bson:"*_max,glob"`
+		}
+		_, err := Marshal(overlapping{})
+		assert.ErrorContains(t, err, `glob patterns "metric_*" of field A and "*_max" of field B overlap`)
+	})
+	t.Run("non-map field", func(t *testing.T) {
+		t.Parallel()
+
+		type invalid struct {
+			S string `bson:"s_*,glob"`
+		}
+		_, err := Marshal(invalid{})
+		assert.ErrorContains(t, err, "glob requires a map field with string keys")
+	})
+}
+
+func TestStructCodecInlinePrefix(t *testing.T) {
+	t.Parallel()
+
+	type tagged struct {
+		Name     string         `bson:"name"`
+		MetaName string         `bson:"meta_name"`
+		Meta     map[string]any `bson:",inline,prefix=meta_"`
+	}
+
+	t.Run("encode", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(tagged{Name: "a", Meta: map[string]any{"owner": "ops"}})
+		assert.NoError(t, err)
+
+		want, err := Marshal(D{{"name", "a"}, {"meta_name", ""}, {"meta_owner", "ops"}})
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(want), Raw(doc))
+	})
+	t.Run("decode", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"name", "a"}, {"meta_owner", "ops"}, {"other", "x"}, {"meta_name", "b"}})
+		assert.NoError(t, err)
+
+		var got tagged
+		err = Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		want := tagged{Name: "a", MetaName: "b", Meta: map[string]any{"owner": "ops"}}
+		assert.Equal(t, want, got)
+	})
+	t.Run("prefixed key collides with field", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := Marshal(tagged{Meta: map[string]any{"name": "x"}})
+		assert.ErrorContains(t, err, "conflicts with a struct field name")
+	})
+	t.Run("non-inline field", func(t *testing.T) {
+		t.Parallel()
+
+		type invalid struct {
+			Meta map[string]any `bson:"meta,prefix=meta_"`
+		}
+		_, err := Marshal(invalid{})
+		assert.ErrorContains(t, err, "prefix requires an inline map field")
+	})
+}
+
+func TestStructCodecInlineMapOmitEmpty(t *testing.T) {
+	t.Parallel()
+
+	type withExtras struct {
+		Name   string         `bson:"name"`
+		Extras map[string]any `bson:",inline,omitempty"`
+	}
+	type withoutOmitEmpty struct {
+		Name   string         `bson:"name"`
+		Extras map[string]any `bson:",inline"`
+	}
+
+	nameOnly, err := Marshal(D{{"name", "a"}})
+	assert.NoError(t, err)
+
+	encodeCases := []struct {
+		name string
+		val  any
+		want D
+	}{
+		{"nil map", withExtras{Name: "a"}, D{{"name", "a"}}},
+		{"empty map", withExtras{Name: "a", Extras: map[string]any{}}, D{{"name", "a"}}},
+		{"non-empty map", withExtras{Name: "a", Extras: map[string]any{"x": "y"}}, D{{"name", "a"}, {"x", "y"}}},
+		{"empty map without omitempty", withoutOmitEmpty{Name: "a", Extras: map[string]any{}}, D{{"name", "a"}}},
+	}
+	for _, tc := range encodeCases {
+		tc := tc
+
+		t.Run("encode "+tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc, err := Marshal(tc.val)
+			assert.NoError(t, err)
+			assert.Equal(t, Raw(mustMarshal(t, tc.want)), Raw(doc))
+		})
+	}
+
+	t.Run("decode leaves map nil", func(t *testing.T) {
+		t.Parallel()
+
+		var got withExtras
+		err := Unmarshal(nameOnly, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, withExtras{Name: "a"}, got)
+		assert.Nil(t, got.Extras)
+	})
+	t.Run("decode allocates map for unknown key", func(t *testing.T) {
+		t.Parallel()
+
+		var got withExtras
+		err := Unmarshal(mustMarshal(t, D{{"name", "a"}, {"x", "y"}}), &got)
+		assert.NoError(t, err)
+		assert.Equal(t, withExtras{Name: "a", Extras: map[string]any{"x": "y"}}, got)
+	})
+}
+
+func TestStructCodecInlineMapNull(t *testing.T) {
+	t.Parallel()
+
+	type withExtras struct {
+		Name   string         `bson:"name"`
+		Extras map[string]any `bson:",inline"`
+	}
+	type withPointers struct {
+		Extras map[string]*int32 `bson:",inline"`
+	}
+
+	doc := mustMarshal(t, D{{"a", nil}, {"name", "x"}})
+
+	t.Run("interface values", func(t *testing.T) {
+		t.Parallel()
+
+		var got withExtras
+		err := Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, withExtras{Name: "x", Extras: map[string]any{"a": nil}}, got)
+		v, ok := got.Extras["a"]
+		assert.True(t, ok, "expected key a to be present")
+		assert.Nil(t, v)
+	})
+	t.Run("pointer values", func(t *testing.T) {
+		t.Parallel()
+
+		var got withPointers
+		err := Unmarshal(mustMarshal(t, D{{"a", nil}}), &got)
+		assert.NoError(t, err)
+		v, ok := got.Extras["a"]
+		assert.True(t, ok, "expected key a to be present")
+		assert.Nil(t, v)
+	})
+	t.Run("ignore null fields", func(t *testing.T) {
+		t.Parallel()
+
+		// IgnoreNullFields only applies to struct fields.
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.IgnoreNullFields()
+		var got withExtras
+		assert.NoError(t, dec.Decode(&got))
+		assert.Equal(t, withExtras{Name: "x", Extras: map[string]any{"a": nil}}, got)
+	})
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		got, err := Marshal(withExtras{Name: "x", Extras: map[string]any{"a": nil}})
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(mustMarshal(t, D{{"name", "x"}, {"a", nil}})), Raw(got))
+	})
+}
+
+func TestStructCodecInlineRaw(t *testing.T) {
+	t.Parallel()
+
+	type catchAll struct {
+		Name   string `bson:"name"`
+		Extras Raw    `bson:",inline"`
+	}
+
+	dec, err := ParseDecimal128("1.50")
+	assert.NoError(t, err)
+	doc, err := Marshal(D{
+		{"name", "a"},
+		{"price", dec},
+		{"blob", Binary{Subtype: 0x80, Data: []byte{1, 2}}},
+		{"at", DateTime(1700000000123)},
+	})
+	assert.NoError(t, err)
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		var got catchAll
+		err := Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, "a", got.Name)
+		assert.Equal(t, TypeDecimal128, got.Extras.Lookup("price").Type)
+
+		out, err := Marshal(got)
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(doc), Raw(out))
+	})
+	t.Run("map of RawValue", func(t *testing.T) {
+		t.Parallel()
+
+		type catchAllMap struct {
+			Name   string              `bson:"name"`
+			Extras map[string]RawValue `bson:",inline"`
+		}
+		var got catchAllMap
+		err := Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, TypeDecimal128, got.Extras["price"].Type)
+		assert.Equal(t, TypeDateTime, got.Extras["at"].Type)
+		subtype, _ := got.Extras["blob"].Binary()
+		assert.Equal(t, byte(0x80), subtype)
+	})
+	t.Run("key collides with field", func(t *testing.T) {
+		t.Parallel()
+
+		extras, err := Marshal(D{{"name", "b"}})
+		assert.NoError(t, err)
+		_, err = Marshal(catchAll{Extras: extras})
+		assert.ErrorContains(t, err, "conflicts with a struct field name")
+	})
+	t.Run("multiple catch-alls", func(t *testing.T) {
+		t.Parallel()
+
+		type invalid struct {
+			Extras Raw            `bson:",inline"`
+			More   map[string]any `bson:",inline"`
+		}
+		_, err := Marshal(invalid{})
+		assert.ErrorContains(t, err, "multiple inline maps")
+	})
+}
+
+// syncExtras stores the elements of a document that do not match a struct field in a sync.Map.
+type syncExtras struct {
+	m sync.Map
+}
+
+func (e *syncExtras) SetKey(key string, val RawValue) {
+	e.m.Store(key, val)
+}
+
+func (e *syncExtras) load(key string) RawValue {
+	val, _ := e.m.Load(key)
+	rv, _ := val.(RawValue)
+	return rv
+}
+
+func TestStructCodecInlineMapSetter(t *testing.T) {
+	t.Parallel()
+
+	doc := mustMarshal(t, D{{"name", "a"}, {"count", int32(3)}, {"tags", A{"x"}}})
+
+	t.Run("value", func(t *testing.T) {
+		t.Parallel()
+
+		var got struct {
+			Name   string     `bson:"name"`
+			Extras syncExtras `bson:",inline"`
+		}
+		if assert.NoError(t, Unmarshal(doc, &got), "Unmarshal error") {
+			assert.Equal(t, "a", got.Name)
+			assert.Equal(t, int32(3), got.Extras.load("count").Int32())
+			assert.Equal(t, TypeArray, got.Extras.load("tags").Type)
+			_, ok := got.Extras.m.Load("name")
+			assert.False(t, ok, "expected the name field to not be stored")
+		}
+		// The MapSetter field is not marshaled.
+		assert.Equal(t, mustMarshal(t, D{{"name", "a"}}), mustMarshal(t, &got))
+	})
+	t.Run("pointer", func(t *testing.T) {
+		t.Parallel()
+
+		type catchAll struct {
+			Name   string      `bson:"name"`
+			Extras *syncExtras `bson:",inline"`
+		}
+		var got catchAll
+		if assert.NoError(t, Unmarshal(doc, &got), "Unmarshal error") {
+			assert.Equal(t, int32(3), got.Extras.load("count").Int32())
+		}
+
+		got = catchAll{}
+		if assert.NoError(t, Unmarshal(mustMarshal(t, D{{"name", "b"}}), &got), "Unmarshal error") {
+			assert.Nil(t, got.Extras, "expected a nil MapSetter without extra elements")
+		}
+	})
+	t.Run("multiple catch-alls", func(t *testing.T) {
+		t.Parallel()
+
+		type invalid struct {
+			Extras syncExtras     `bson:",inline"`
+			More   map[string]any `bson:",inline"`
+		}
+		err := Unmarshal(doc, &invalid{})
+		assert.ErrorContains(t, err, "multiple inline maps")
+	})
+}
+
+type inlineKeyID struct {
+	n int
+}
+
+func (id inlineKeyID) MarshalText() ([]byte, error) {
+	return []byte("id-" + strconv.Itoa(id.n)), nil
+}
+
+func (id *inlineKeyID) UnmarshalText(text []byte) error {
+	n, err := strconv.Atoi(strings.TrimPrefix(string(text), "id-"))
+	id.n = n
+	return err
+}
+
+func TestStructCodecInlineMapKeys(t *testing.T) {
+	t.Parallel()
+
+	type label string
+
+	t.Run("string kind", func(t *testing.T) {
+		t.Parallel()
+
+		type labels struct {
+			Name   string           `bson:"name"`
+			Labels map[label]string `bson:",inline"`
+		}
+		val := labels{Name: "a", Labels: map[label]string{"env": "prod"}}
+		doc := mustMarshal(t, val)
+		assert.Equal(t, Raw(mustMarshal(t, D{{"name", "a"}, {"env", "prod"}})), Raw(doc))
+
+		var got labels
+		err := Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, val, got)
+	})
+	t.Run("TextMarshaler", func(t *testing.T) {
+		t.Parallel()
+
+		type counts struct {
+			Name   string              `bson:"name"`
+			Counts map[inlineKeyID]int `bson:",inline"`
+		}
+		val := counts{Name: "a", Counts: map[inlineKeyID]int{{n: 7}: 3}}
+		doc := mustMarshal(t, val)
+		assert.Equal(t, Raw(mustMarshal(t, D{{"name", "a"}, {"id-7", 3}})), Raw(doc))
+
+		var got counts
+		err := Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, val, got)
+
+		err = Unmarshal(mustMarshal(t, D{{"name", "a"}, {"id-x", 3}}), &got)
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"id-x"}, de.Keys())
+	})
+	t.Run("unsupported key", func(t *testing.T) {
+		t.Parallel()
+
+		type invalid struct {
+			Extra map[float64]int `bson:",inline"`
+		}
+		_, err := Marshal(invalid{})
+		assert.ErrorContains(t, err, "inline map must have string keys")
+	})
+}
+
+type rawPoint struct {
+	X, Y int32
+	raw  []byte
+}
+
+func (p rawPoint) MarshalRawBSON() ([]byte, error) {
+	if p.raw != nil {
+		return p.raw, nil
+	}
+	return bsoncore.NewDocumentBuilder().AppendInt32("x", p.X).AppendInt32("y", p.Y).Build(), nil
+}
+
+func TestStructCodecRawBSONMarshaler(t *testing.T) {
+	t.Parallel()
+
+	type shape struct {
+		Origin rawPoint   `bson:"origin"`
+		Points []rawPoint `bson:"points"`
+	}
+
+	t.Run("encode", func(t *testing.T) {
+		t.Parallel()
+
+		doc := mustMarshal(t, shape{Origin: rawPoint{X: 1, Y: 2}, Points: []rawPoint{{X: 3, Y: 4}}})
+		want := mustMarshal(t, D{
+			{"origin", D{{"x", int32(1)}, {"y", int32(2)}}},
+			{"points", A{D{{"x", int32(3)}, {"y", int32(4)}}}},
+		})
+		assert.Equal(t, Raw(want), Raw(doc))
+	})
+
+	invalid := []struct {
+		name string
+		raw  []byte
+	}{
+		{"too short", []byte{0x04, 0x00, 0x00, 0x00}},
+		{"length mismatch", []byte{0x06, 0x00, 0x00, 0x00, 0x00}},
+		{"missing trailing null", []byte{0x05, 0x00, 0x00, 0x00, 0x01}},
+	}
+	for _, tc := range invalid {
+		tc := tc // Capture range variable.
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Marshal(shape{Origin: rawPoint{raw: tc.raw}})
+			assert.ErrorContains(t, err, "MarshalRawBSON returned an invalid BSON document")
+		})
+	}
+}
+
+// snakeCase converts a Go field name such as "UserID" or "CreatedAt" to snake_case.
+func snakeCase(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 && !unicode.IsUpper(rune(name[i-1])) {
+				sb.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func TestStructCodecNameTransformer(t *testing.T) {
+	t.Parallel()
+
+	type account struct {
+		UserID    string
+		CreatedAt int64
+		Nickname  string `bson:"nick"`
+	}
+
+	encode := func(t *testing.T, fn NameTransformer, val any) []byte {
+		t.Helper()
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetNameTransformer(fn)
+		err := enc.Encode(val)
+		assert.NoError(t, err, "Encode error")
+		return buf.Bytes()
+	}
+
+	val := account{UserID: "u1", CreatedAt: 42, Nickname: "ada"}
+
+	doc := encode(t, snakeCase, val)
+	want := mustMarshal(t, D{{"user_id", "u1"}, {"created_at", int64(42)}, {"nick", "ada"}})
+	assert.Equal(t, Raw(want), Raw(doc))
+
+	var got account
+	dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+	dec.SetNameTransformer(snakeCase)
+	err := dec.Decode(&got)
+	assert.NoError(t, err, "Decode error")
+	assert.Equal(t, val, got)
+
+	// Descriptions created with different transformers, or none, are cached separately.
+	doc = encode(t, strings.ToUpper, val)
+	want = mustMarshal(t, D{{"USERID", "u1"}, {"CREATEDAT", int64(42)}, {"nick", "ada"}})
+	assert.Equal(t, Raw(want), Raw(doc))
+
+	doc = encode(t, nil, val)
+	want = mustMarshal(t, D{{"UserID", "u1"}, {"CreatedAt", int64(42)}, {"nick", "ada"}})
+	assert.Equal(t, Raw(want), Raw(doc))
+
+	// A key set by a struct tag is not transformed, even if it is the field name.
+	type tagged struct {
+		UserID    string `bson:"UserID"`
+		CreatedAt int64
+	}
+	doc = encode(t, snakeCase, tagged{UserID: "u1", CreatedAt: 42})
+	want = mustMarshal(t, D{{"UserID", "u1"}, {"created_at", int64(42)}})
+	assert.Equal(t, Raw(want), Raw(doc))
+}
+
+type inlineCycleNode struct {
+	Value int32            `bson:"value"`
+	Next  *inlineCycleNode `bson:",inline"`
+}
+
+type inlineCycleA struct {
+	A  string        `bson:"a"`
+	To *inlineCycleB `bson:",inline"`
+}
+
+type inlineCycleB struct {
+	B  string        `bson:"b"`
+	To *inlineCycleA `bson:",inline"`
+}
+
+type selfReference struct {
+	Value int32          `bson:"value"`
+	Next  *selfReference `bson:"next,omitempty"`
+}
+
+func TestStructCodecInlineCycle(t *testing.T) {
+	t.Parallel()
+
+	t.Run("self", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := Marshal(inlineCycleNode{})
+		assert.ErrorContains(t, err, "inline cycle detected in struct bson.inlineCycleNode")
+	})
+	t.Run("through another struct", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := Marshal(inlineCycleA{})
+		assert.ErrorContains(t, err, "inline cycle detected in struct bson.inlineCycleB: field To inlines bson.inlineCycleA")
+	})
+	t.Run("concurrent", func(t *testing.T) {
+		t.Parallel()
+
+		// A slow NameTransformer widens the window in which both structs are being described.
+		slow := func(name string) string {
+			time.Sleep(10 * time.Millisecond)
+			return name
+		}
+		reg := NewRegistry()
+		errs := make(chan error, 2)
+		for _, val := range []any{inlineCycleA{}, inlineCycleB{}} {
+			val := val
+			go func() {
+				enc := NewEncoder(NewDocumentWriter(new(bytes.Buffer)))
+				enc.SetRegistry(reg)
+				enc.SetNameTransformer(slow)
+				errs <- enc.Encode(val)
+			}()
+		}
+		for i := 0; i < 2; i++ {
+			select {
+			case err := <-errs:
+				assert.ErrorContains(t, err, "inline cycle detected")
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out describing structs that inline each other")
+			}
+		}
+	})
+	t.Run("non-inline self reference", func(t *testing.T) {
+		t.Parallel()
+
+		val := selfReference{Value: 1, Next: &selfReference{Value: 2}}
+		var got selfReference
+		err := Unmarshal(mustMarshal(t, val), &got)
+		assert.NoError(t, err)
+		assert.Equal(t, val, got)
+	})
+}
+
+func TestStructCodecNamedCodec(t *testing.T) {
+	t.Parallel()
+
+	// The "e164" codec stores phone numbers as "+<digits>" and decodes them without the "+".
+	reg := NewRegistry()
+	reg.RegisterNamedCodec("e164",
+		ValueEncoderFunc(func(_ EncodeContext, vw ValueWriter, val reflect.Value) error {
+			return vw.WriteString("+" + val.String())
+		}),
+		ValueDecoderFunc(func(_ DecodeContext, vr ValueReader, val reflect.Value) error {
+			s, err := vr.ReadString()
+			if err != nil {
+				return err
+			}
+			if !strings.HasPrefix(s, "+") {
+				return fmt.Errorf("%q is not an E.164 number", s)
+			}
+			val.SetString(s[1:])
+			return nil
+		}))
+
+	type contact struct {
+		Name  string `bson:"name"`
+		Phone string `bson:"phone,codec=e164"`
+	}
+
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(NewDocumentWriter(buf))
+	enc.SetRegistry(reg)
+	err := enc.Encode(contact{Name: "ada", Phone: "442071234567"})
+	assert.NoError(t, err)
+	want := mustMarshal(t, D{{"name", "ada"}, {"phone", "+442071234567"}})
+	assert.Equal(t, Raw(want), Raw(buf.Bytes()))
+
+	var got contact
+	dec := NewDecoder(NewDocumentReader(bytes.NewReader(buf.Bytes())))
+	dec.SetRegistry(reg)
+	err = dec.Decode(&got)
+	assert.NoError(t, err)
+	assert.Equal(t, contact{Name: "ada", Phone: "442071234567"}, got)
+
+	_, err = Marshal(contact{})
+	assert.ErrorContains(t, err, `(struct bson.contact) unknown codec "e164" for field Phone`)
+}
+
+func TestStructCodecErrorOnEmptyStruct(t *testing.T) {
+	t.Parallel()
+
+	type unexported struct {
+		name string
+		age  int
+	}
+	type skipped struct {
+		Name string `bson:"-"`
+	}
+	type marker struct{}
+	type withInline struct {
+		Extras map[string]any `bson:",inline"`
+	}
+	type wrapper struct {
+		Inner unexported `bson:"inner"`
+	}
+
+	encode := func(reg *Registry, val any) error {
+		enc := NewEncoder(NewDocumentWriter(new(bytes.Buffer)))
+		enc.SetRegistry(reg)
+		return enc.Encode(val)
+	}
+
+	reg := NewRegistry()
+	reg.SetErrorOnEmptyStruct(true)
+
+	testCases := []struct {
+		name    string
+		val     any
+		wantErr string
+	}{
+		{"unexported fields", unexported{name: "a"}, "has no fields to encode or decode"},
+		{"skipped fields", skipped{Name: "a"}, "has no fields to encode or decode"},
+		{"nested", wrapper{}, "has no fields to encode or decode"},
+		{"inline map", withInline{}, ""},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := encode(reg, tc.val)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+
+	t.Run("decode", func(t *testing.T) {
+		t.Parallel()
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(mustMarshal(t, D{{"name", "a"}}))))
+		dec.SetRegistry(reg)
+		err := dec.Decode(&unexported{})
+		assert.ErrorContains(t, err, "has no fields to encode or decode")
+	})
+	t.Run("disabled by default", func(t *testing.T) {
+		t.Parallel()
+
+		assert.NoError(t, encode(NewRegistry(), marker{}))
+		assert.NoError(t, encode(NewRegistry(), unexported{name: "a"}))
+	})
+}
+
+func TestStructCodecLocalTime(t *testing.T) {
+	t.Parallel()
+
+	type event struct {
+		Local   time.Time  `bson:"local,localtime"`
+		LocalP  *time.Time `bson:"localp,localtime"`
+		Default time.Time  `bson:"default"`
+	}
+
+	ts := time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC)
+	doc := mustMarshal(t, event{Local: ts, LocalP: &ts, Default: ts})
+
+	decode := func(t *testing.T, useLocal bool) event {
+		t.Helper()
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		if useLocal {
+			dec.UseLocalTimeZone()
+		}
+		var got event
+		err := dec.Decode(&got)
+		assert.NoError(t, err, "Decode error")
+		return got
+	}
+
+	t.Run("default UTC", func(t *testing.T) {
+		t.Parallel()
+
+		got := decode(t, false)
+		assert.Equal(t, time.Local, got.Local.Location())
+		assert.Equal(t, time.Local, got.LocalP.Location())
+		assert.Equal(t, time.UTC, got.Default.Location())
+		assert.True(t, got.Local.Equal(ts), "expected %v, got %v", ts, got.Local)
+		assert.True(t, got.Default.Equal(ts), "expected %v, got %v", ts, got.Default)
+	})
+	t.Run("default local", func(t *testing.T) {
+		t.Parallel()
+
+		got := decode(t, true)
+		assert.Equal(t, time.Local, got.Local.Location())
+		assert.Equal(t, time.Local, got.Default.Location())
+	})
+	t.Run("invalid field type", func(t *testing.T) {
+		t.Parallel()
+
+		type invalid struct {
+			TS int64 `bson:"ts,localtime"`
+		}
+		_, err := Marshal(invalid{})
+		assert.ErrorContains(t, err, "localtime requires a time.Time or *time.Time field")
+	})
+}
+
+// EmbeddedShape is exported so that structs embedding it have an exported field.
+type EmbeddedShape interface {
+	area() float64
+}
+
+func TestStructCodecEmbeddedInterface(t *testing.T) {
+	t.Parallel()
+
+	type drawing struct {
+		EmbeddedShape `bson:"shape"`
+		Name          string `bson:"name"`
+	}
+
+	doc := mustMarshal(t, D{{"shape", D{{"radius", 2.0}}}, {"name", "c"}})
+
+	t.Run("encode dynamic type", func(t *testing.T) {
+		t.Parallel()
+
+		got, err := Marshal(drawing{EmbeddedShape: discriminatorCircle{Radius: 2}, Name: "c"})
+		assert.NoError(t, err, "Marshal error")
+		assert.Equal(t, doc, got)
+	})
+	t.Run("encode nil", func(t *testing.T) {
+		t.Parallel()
+
+		got, err := Marshal(drawing{Name: "c"})
+		assert.NoError(t, err, "Marshal error")
+		assert.Equal(t, mustMarshal(t, D{{"shape", nil}, {"name", "c"}}), got)
+	})
+	t.Run("decode without decoder", func(t *testing.T) {
+		t.Parallel()
+
+		err := Unmarshal(doc, &drawing{})
+		assert.ErrorContains(t, err, "cannot decode embedded interface bson.EmbeddedShape")
+		var end errNoDecoder
+		assert.True(t, errors.As(err, &end), "expected errNoDecoder, got %v", err)
+	})
+	t.Run("decode with factory", func(t *testing.T) {
+		t.Parallel()
+
+		reg := NewRegistry()
+		reg.RegisterInterfaceFactory(reflect.TypeOf((*EmbeddedShape)(nil)).Elem(), func(RawValue) (any, error) {
+			return &discriminatorCircle{}, nil
+		})
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.SetRegistry(reg)
+		var got drawing
+		err := dec.Decode(&got)
+		assert.NoError(t, err, "Decode error")
+		assert.Equal(t, drawing{EmbeddedShape: discriminatorCircle{Radius: 2}, Name: "c"}, got)
+	})
+	t.Run("inline", func(t *testing.T) {
+		t.Parallel()
+
+		type inlined struct {
+			EmbeddedShape `bson:",inline"`
+		}
+		_, err := Marshal(inlined{})
+		assert.ErrorContains(t, err, "embedded interface bson.EmbeddedShape cannot be inlined")
+	})
+}
+
+// EmbeddedTags, EmbeddedAttrs, and EmbeddedLabel are exported non-struct types so that structs
+// embedding them have an exported field.
+type (
+	EmbeddedTags  []string
+	EmbeddedAttrs map[string]string
+	EmbeddedLabel string
+)
+
+type embeddedNote string
+
+func TestStructCodecEmbeddedNonStruct(t *testing.T) {
+	t.Parallel()
+
+	type item struct {
+		EmbeddedTags
+		EmbeddedAttrs
+		EmbeddedLabel
+		embeddedNote
+		Name string `bson:"name"`
+	}
+	type tagged struct {
+		EmbeddedTags   `bson:"tags"`
+		*EmbeddedAttrs `bson:"attrs"`
+		EmbeddedLabel  `bson:"label,omitempty"`
+	}
+
+	testCases := []struct {
+		name string
+		val  any
+		want D
+	}{
+		{
+			name: "type names",
+			val: item{
+				EmbeddedTags:  EmbeddedTags{"a"},
+				EmbeddedAttrs: EmbeddedAttrs{"k": "v"},
+				EmbeddedLabel: "l",
+				embeddedNote:  "ignored",
+				Name:          "n",
+			},
+			want: D{
+				{"EmbeddedTags", A{"a"}},
+				{"EmbeddedAttrs", D{{"k", "v"}}},
+				{"EmbeddedLabel", "l"},
+				{"name", "n"},
+			},
+		},
+		{
+			name: "tagged",
+			val:  tagged{EmbeddedTags: EmbeddedTags{"a"}, EmbeddedAttrs: &EmbeddedAttrs{"k": "v"}},
+			want: D{{"tags", A{"a"}}, {"attrs", D{{"k", "v"}}}},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc := mustMarshal(t, tc.val)
+			assert.Equal(t, mustMarshal(t, tc.want), doc)
+
+			got := reflect.New(reflect.TypeOf(tc.val))
+			if assert.NoError(t, Unmarshal(doc, got.Interface()), "Unmarshal error") {
+				assert.Equal(t, doc, mustMarshal(t, got.Elem().Interface()), "expected the decoded value to round trip")
+			}
+		})
+	}
+	t.Run("inline", func(t *testing.T) {
+		t.Parallel()
+
+		type inlineMap struct {
+			EmbeddedAttrs `bson:",inline"`
+			Name          string `bson:"name"`
+		}
+		doc := mustMarshal(t, inlineMap{EmbeddedAttrs: EmbeddedAttrs{"k": "v"}, Name: "n"})
+		assert.Equal(t, mustMarshal(t, D{{"name", "n"}, {"k", "v"}}), doc)
+
+		type inlineSlice struct {
+			EmbeddedTags `bson:",inline"`
+		}
+		_, err := Marshal(inlineSlice{})
+		assert.ErrorContains(t, err, "inline fields must be a struct, a struct pointer, or a map")
+	})
+}
+
+func TestStructCodecRequired(t *testing.T) {
+	t.Parallel()
+
+	type account struct {
+		ID    string `bson:"id,required"`
+		Email string `bson:"email,required"`
+		Name  string `bson:"name"`
+	}
+
+	testCases := []struct {
+		name    string
+		doc     D
+		missing []string
+	}{
+		{"all present", D{{"id", "a"}, {"email", "b"}}, nil},
+		{"null is present", D{{"id", nil}, {"email", "b"}}, nil},
+		{"one missing", D{{"email", "b"}, {"name", "c"}}, []string{"id"}},
+		{"all missing", D{{"name", "c"}}, []string{"id", "email"}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := Unmarshal(mustMarshal(t, tc.doc), &account{})
+			if tc.missing == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrRequiredFieldMissing)
+			for _, key := range tc.missing {
+				assert.ErrorContains(t, err, "error decoding key "+key+" ")
+			}
+			var de *DecodeError
+			assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+			assert.Equal(t, []string{tc.missing[0]}, de.Keys())
+		})
+	}
+	t.Run("nested", func(t *testing.T) {
+		t.Parallel()
+
+		type wrapper struct {
+			Account account `bson:"account"`
+		}
+		err := Unmarshal(mustMarshal(t, D{{"account", D{{"id", "a"}}}}), &wrapper{})
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"account", "email"}, de.Keys())
+	})
+	t.Run("patch mode", func(t *testing.T) {
+		t.Parallel()
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(mustMarshal(t, D{{"name", "c"}}))))
+		dec.PatchMode()
+		assert.NoError(t, dec.Decode(&account{}))
+	})
+	t.Run("invalid with inline", func(t *testing.T) {
+		t.Parallel()
+
+		type invalid struct {
+			Extra map[string]any `bson:",inline,required"`
+		}
+		_, err := Marshal(invalid{})
+		assert.ErrorContains(t, err, "required cannot be used with glob or inline")
+	})
+}
+
+func TestStructCodecOrder(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reorders encoding", func(t *testing.T) {
+		t.Parallel()
+
+		type record struct {
+			C    string `bson:"c,order=3"`
+			Note string `bson:"note"`
+			A    string `bson:"a,order=1"`
+			B    string `bson:"b,order=2"`
+			Tail string `bson:"tail"`
+		}
+		val := record{C: "c", Note: "n", A: "a", B: "b", Tail: "t"}
+		got := mustMarshal(t, val)
+		want := mustMarshal(t, D{{"a", "a"}, {"b", "b"}, {"c", "c"}, {"note", "n"}, {"tail", "t"}})
+		assert.Equal(t, want, got)
+
+		// Decoding does not depend on the order of the keys.
+		var decoded record
+		err := Unmarshal(mustMarshal(t, D{{"tail", "t"}, {"c", "c"}, {"a", "a"}, {"note", "n"}, {"b", "b"}}), &decoded)
+		assert.NoError(t, err, "Unmarshal error")
+		assert.Equal(t, val, decoded)
+	})
+	t.Run("inlined fields", func(t *testing.T) {
+		t.Parallel()
+
+		type inner struct {
+			X string `bson:"x,order=0"`
+			Y string `bson:"y"`
+		}
+		type outer struct {
+			Z     string `bson:"z"`
+			Inner inner  `bson:",inline"`
+		}
+		got := mustMarshal(t, outer{Z: "z", Inner: inner{X: "x", Y: "y"}})
+		assert.Equal(t, mustMarshal(t, D{{"x", "x"}, {"z", "z"}, {"y", "y"}}), got)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		type negative struct {
+			A string `bson:"a,order=-1"`
+		}
+		_, err := Marshal(negative{})
+		assert.ErrorContains(t, err, `invalid order "-1" for field A`)
+
+		type inline struct {
+			Inner struct{ X string } `bson:",inline,order=1"`
+		}
+		_, err = Marshal(inline{})
+		assert.ErrorContains(t, err, "order cannot be set on inline field Inner")
+	})
+}
+
+func TestStructCodecConflictRename(t *testing.T) {
+	t.Parallel()
+
+	type parent struct {
+		ID   string `bson:"id"`
+		Name string `bson:"name"`
+	}
+	type child struct {
+		ID string `bson:"id"`
+	}
+	type shadowed struct {
+		ID     string `bson:"id"`
+		Parent parent `bson:",inline"`
+	}
+	type sameDepth struct {
+		Parent parent `bson:",inline"`
+		Child  child  `bson:",inline"`
+	}
+
+	encode := func(t *testing.T, reg *Registry, val any) ([]byte, error) {
+		t.Helper()
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetRegistry(reg)
+		err := enc.Encode(val)
+		return buf.Bytes(), err
+	}
+
+	t.Run("shadowed field", func(t *testing.T) {
+		t.Parallel()
+
+		reg := NewRegistry()
+		reg.SetConflictRenameFunc(PrefixFieldPath)
+		val := shadowed{ID: "c1", Parent: parent{ID: "p1", Name: "n"}}
+		got, err := encode(t, reg, val)
+		assert.NoError(t, err, "Encode error")
+		assert.Equal(t, mustMarshal(t, D{{"id", "c1"}, {"parent_id", "p1"}, {"name", "n"}}), got)
+
+		var decoded shadowed
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(got)))
+		dec.SetRegistry(reg)
+		assert.NoError(t, dec.Decode(&decoded), "Decode error")
+		assert.Equal(t, val, decoded)
+	})
+	t.Run("same depth", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := encode(t, NewRegistry(), sameDepth{})
+		assert.ErrorContains(t, err, "duplicated key id")
+
+		reg := NewRegistry()
+		var paths [][]string
+		reg.SetConflictRenameFunc(func(field FieldInfo, path []string) string {
+			paths = append(paths, path)
+			return PrefixFieldPath(field, path)
+		})
+		got, err := encode(t, reg, sameDepth{Parent: parent{ID: "p1"}, Child: child{ID: "c1"}})
+		assert.NoError(t, err, "Encode error")
+		assert.Equal(t, mustMarshal(t, D{{"id", "p1"}, {"name", ""}, {"child_id", "c1"}}), got)
+		assert.Equal(t, [][]string{{"Child", "ID"}}, paths)
+	})
+	t.Run("conflicting rename", func(t *testing.T) {
+		t.Parallel()
+
+		reg := NewRegistry()
+		reg.SetConflictRenameFunc(func(FieldInfo, []string) string { return "name" })
+		_, err := encode(t, reg, shadowed{})
+		assert.ErrorContains(t, err, "key name of renamed field ID conflicts with another field")
+
+		reg = NewRegistry()
+		reg.SetConflictRenameFunc(func(FieldInfo, []string) string { return "" })
+		_, err = encode(t, reg, shadowed{})
+		assert.ErrorContains(t, err, "duplicated key id")
+	})
+}
+
+func TestStructCodecSymbolString(t *testing.T) {
+	t.Parallel()
+
+	type status string
+	type legacy struct {
+		Name   string  `bson:"name"`
+		Status status  `bson:"status"`
+		Note   *string `bson:"note"`
+	}
+
+	doc := bsoncore.NewDocumentBuilder().
+		AppendSymbol("name", "ada").
+		AppendSymbol("status", "active").
+		AppendSymbol("note", "legacy").
+		Build()
+
+	var got legacy
+	err := Unmarshal(doc, &got)
+	assert.NoError(t, err, "Unmarshal error")
+	note := "legacy"
+	assert.Equal(t, legacy{Name: "ada", Status: "active", Note: &note}, got)
+}
+
+func TestStructCodecMinSize(t *testing.T) {
+	t.Parallel()
+
+	type inner struct {
+		N int64 `bson:"n"`
+	}
+	type sizes struct {
+		Plain   int64            `bson:"plain"`
+		Min     int64            `bson:"min,minsize"`
+		Ptr     *int64           `bson:"ptr,minsize"`
+		Slice   []int64          `bson:"slice,minsize"`
+		Any     any              `bson:"any,minsize"`
+		Uint    uint64           `bson:"uint,minsize"`
+		Inline  inner            `bson:",inline,minsize"`
+		Glob    map[string]int64 `bson:"g_*,glob,minsize"`
+		Extra   map[string]int64 `bson:",inline,minsize"`
+		Nested  inner            `bson:"nested,minsize"`
+		Control inner            `bson:"control"`
+	}
+
+	testCases := []struct {
+		name string
+		v    int64
+	}{
+		{name: "MaxInt32", v: math.MaxInt32},
+		{name: "MaxInt32+1", v: math.MaxInt32 + 1},
+		{name: "MinInt32", v: math.MinInt32},
+		{name: "MinInt32-1", v: math.MinInt32 - 1},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			v := tc.v
+			val := sizes{
+				Plain:   v,
+				Min:     v,
+				Ptr:     &v,
+				Slice:   []int64{v},
+				Any:     v,
+				Inline:  inner{N: v},
+				Glob:    map[string]int64{"g_1": v},
+				Extra:   map[string]int64{"x": v},
+				Nested:  inner{N: v},
+				Control: inner{N: v},
+			}
+			if v >= 0 {
+				val.Uint = uint64(v)
+			}
+			doc := bsoncore.Document(mustMarshal(t, val))
+
+			minType := bsoncore.TypeInt64
+			if fitsIn32Bits(v) {
+				minType = bsoncore.TypeInt32
+			}
+			for _, path := range [][]string{
+				{"min"}, {"ptr"}, {"slice", "0"}, {"any"}, {"n"}, {"g_1"}, {"x"}, {"nested", "n"},
+			} {
+				got, err := doc.LookupErr(path...)
+				if assert.NoError(t, err, "LookupErr(%v) error", path) {
+					assert.Equal(t, minType, got.Type, "unexpected type for %v", path)
+				}
+			}
+			if v >= 0 {
+				assert.Equal(t, minType, doc.Lookup("uint").Type, "unexpected type for uint")
+			}
+			assert.Equal(t, bsoncore.TypeInt64, doc.Lookup("plain").Type, "unexpected type for plain")
+			assert.Equal(t, bsoncore.TypeInt64, doc.Lookup("control", "n").Type, "unexpected type for control")
+		})
+	}
+}
+
+func TestStructCodecReadWriteOnly(t *testing.T) {
+	t.Parallel()
+
+	type account struct {
+		Name     string `bson:"name"`
+		Secret   string `bson:"secret,writeonly"`
+		Computed int32  `bson:"computed,readonly"`
+	}
+
+	t.Run("encode", func(t *testing.T) {
+		t.Parallel()
+
+		got := mustMarshal(t, account{Name: "ada", Secret: "s3cr3t", Computed: 7})
+		assert.Equal(t, mustMarshal(t, D{{"name", "ada"}, {"secret", "s3cr3t"}}), got)
+	})
+	t.Run("decode", func(t *testing.T) {
+		t.Parallel()
+
+		doc := mustMarshal(t, D{{"name", "ada"}, {"secret", "leaked"}, {"computed", int32(7)}})
+		got := account{Secret: "kept"}
+		if assert.NoError(t, Unmarshal(doc, &got), "Unmarshal error") {
+			assert.Equal(t, account{Name: "ada", Secret: "kept", Computed: 7}, got)
+		}
+	})
+	t.Run("positional", func(t *testing.T) {
+		t.Parallel()
+
+		type point struct {
+			PositionalArray
+			X     int32 `bson:"x,pos=0"`
+			Y     int32 `bson:"y,pos=1,writeonly"`
+			Label int32 `bson:"label,pos=2,readonly"`
+		}
+		doc, err := Marshal(D{{"p", point{X: 1, Y: 2, Label: 3}}})
+		if assert.NoError(t, err, "Marshal error") {
+			assert.Equal(t, mustMarshal(t, D{{"p", A{int32(1), int32(2), nil}}}), []byte(doc))
+		}
+
+		var got struct {
+			P point `bson:"p"`
+		}
+		doc = mustMarshal(t, D{{"p", A{int32(4), int32(5), int32(6)}}})
+		if assert.NoError(t, Unmarshal(doc, &got), "Unmarshal error") {
+			assert.Equal(t, point{X: 4, Label: 6}, got.P)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		testCases := []struct {
+			name string
+			val  any
+			want string
+		}{
+			{
+				name: "both",
+				val: &struct {
+					A int32 `bson:"a,writeonly,readonly"`
+				}{},
+				want: "cannot be both writeonly and readonly",
+			},
+			{
+				name: "inline",
+				val: &struct {
+					A struct{ B int32 } `bson:",inline,readonly"`
+				}{},
+				want: "cannot be used with inline",
+			},
+			{
+				name: "required",
+				val: &struct {
+					A int32 `bson:"a,writeonly,required"`
+				}{},
+				want: "writeonly cannot be used with required",
+			},
+		}
+		for _, tc := range testCases {
+			tc := tc
+
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+
+				err := Unmarshal(mustMarshal(t, D{}), tc.val)
+				if assert.Error(t, err, "expected an error") {
+					assert.Contains(t, err.Error(), tc.want)
+				}
+			})
+		}
+	})
+}
+
+type fieldContextAmount int64
+
+func TestStructCodecFieldContext(t *testing.T) {
+	t.Parallel()
+
+	type price struct {
+		Currency string             `bson:"currency"`
+		Amount   fieldContextAmount `bson:"amount"`
+	}
+
+	// The encoder writes the amount in major units for currencies that have them, which
+	// requires reading the sibling Currency field.
+	reg := NewRegistry()
+	reg.RegisterTypeEncoder(reflect.TypeOf(fieldContextAmount(0)), ValueEncoderFunc(
+		func(ec EncodeContext, vw ValueWriter, val reflect.Value) error {
+			owner, field, ok := ec.Owner()
+			if !ok || field != "Amount" {
+				return errors.New("expected to encode the Amount field of a struct")
+			}
+			if owner.FieldByName("Currency").String() == "JPY" {
+				return vw.WriteInt64(val.Int())
+			}
+			return vw.WriteDouble(float64(val.Int()) / 100)
+		}))
+	reg.RegisterTypeDecoder(reflect.TypeOf(fieldContextAmount(0)), ValueDecoderFunc(
+		func(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+			owner, _, ok := dc.Owner()
+			if !ok {
+				return errors.New("expected to decode a struct field")
+			}
+			if owner.FieldByName("Currency").String() == "JPY" {
+				i, err := vr.ReadInt64()
+				val.SetInt(i)
+				return err
+			}
+			f, err := vr.ReadDouble()
+			val.SetInt(int64(f * 100))
+			return err
+		}))
+
+	for _, in := range []price{{Currency: "USD", Amount: 1250}, {Currency: "JPY", Amount: 1250}} {
+		in := in // Capture range variable.
+
+		t.Run(in.Currency, func(t *testing.T) {
+			t.Parallel()
+
+			buf := new(bytes.Buffer)
+			enc := NewEncoder(NewDocumentWriter(buf))
+			enc.SetRegistry(reg)
+			err := enc.Encode(in)
+			assert.NoError(t, err)
+
+			var got price
+			dec := NewDecoder(NewDocumentReader(bytes.NewReader(buf.Bytes())))
+			dec.SetRegistry(reg)
+			err = dec.Decode(&got)
+			assert.NoError(t, err)
+			assert.Equal(t, in, got)
+		})
+	}
+	t.Run("not a struct field", func(t *testing.T) {
+		t.Parallel()
+
+		_, _, ok := EncodeContext{Registry: reg}.Owner()
+		assert.False(t, ok, "expected no owner outside of a struct")
+	})
+}
+
+type constructorMoney struct {
+	amount   int64
+	currency string
+}
+
+func newConstructorMoney(m struct {
+	Amount   int64  `bson:"amount"`
+	Currency string `bson:"currency"`
+}) (constructorMoney, error) {
+	if m.Currency == "" {
+		return constructorMoney{}, errors.New("currency is required")
+	}
+	return constructorMoney{amount: m.Amount, currency: m.Currency}, nil
+}
+
+func TestStructCodecConstructor(t *testing.T) {
+	t.Parallel()
+
+	type order struct {
+		Total constructorMoney  `bson:"total"`
+		Tax   *constructorMoney `bson:"tax"`
+	}
+
+	reg := NewRegistry()
+	reg.RegisterConstructor(reflect.TypeOf(constructorMoney{}), newConstructorMoney)
+
+	decode := func(t *testing.T, doc []byte, val any) error {
+		t.Helper()
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.SetRegistry(reg)
+		return dec.Decode(val)
+	}
+
+	t.Run("constructs value", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{
+			{"total", D{{"amount", int64(1250)}, {"currency", "USD"}}},
+			{"tax", D{{"amount", int64(100)}, {"currency", "USD"}}},
+		})
+		assert.NoError(t, err)
+
+		var got order
+		err = decode(t, doc, &got)
+		assert.NoError(t, err)
+		want := order{
+			Total: constructorMoney{amount: 1250, currency: "USD"},
+			Tax:   &constructorMoney{amount: 100, currency: "USD"},
+		}
+		assert.Equal(t, want, got)
+	})
+	t.Run("constructor error", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"total", D{{"amount", int64(1250)}}}})
+		assert.NoError(t, err)
+
+		var got order
+		err = decode(t, doc, &got)
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"total"}, de.Keys())
+		assert.ErrorContains(t, err, "currency is required")
+	})
+	t.Run("intermediate decode error", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"total", D{{"amount", "lots"}}}})
+		assert.NoError(t, err)
+
+		var got order
+		err = decode(t, doc, &got)
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"total", "amount"}, de.Keys())
+	})
+	t.Run("invalid signature", func(t *testing.T) {
+		t.Parallel()
+
+		defer func() {
+			err, _ := recover().(error)
+			assert.ErrorContains(t, err, "must have signature func(In) (bson.constructorMoney, error)")
+		}()
+		NewRegistry().RegisterConstructor(reflect.TypeOf(constructorMoney{}), func(M) constructorMoney {
+			return constructorMoney{}
+		})
+	})
+}
+
+func TestStructCodecTTLKey(t *testing.T) {
+	t.Parallel()
+
+	type quote struct {
+		Price        float64   `bson:"price,ttlkey=price_expires"`
+		PriceExpires time.Time `bson:"price_expires"`
+		Symbol       string    `bson:"symbol"`
+	}
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	encode := func(t *testing.T, ttl time.Duration, val any) (Raw, error) {
+		t.Helper()
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetTTL(ttl, func() time.Time { return now })
+		err := enc.Encode(val)
+		return buf.Bytes(), err
+	}
+
+	t.Run("emits expiry", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := encode(t, time.Minute, quote{Price: 9.5, Symbol: "ABC"})
+		assert.NoError(t, err)
+
+		want, err := Marshal(D{
+			{"price", 9.5},
+			{"price_expires", NewDateTimeFromTime(now.Add(time.Minute))},
+			{"symbol", "ABC"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(want), doc)
+
+		var got quote
+		err = Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.True(t, got.PriceExpires.Equal(now.Add(time.Minute)), "unexpected expiry %v", got.PriceExpires)
+	})
+	t.Run("no ttl", func(t *testing.T) {
+		t.Parallel()
+
+		in := quote{Price: 9.5, PriceExpires: now, Symbol: "ABC"}
+		doc, err := encode(t, 0, in)
+		assert.NoError(t, err)
+
+		want, err := Marshal(D{{"price", 9.5}, {"price_expires", NewDateTimeFromTime(now)}, {"symbol", "ABC"}})
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(want), doc)
+	})
+	t.Run("key collision", func(t *testing.T) {
+		t.Parallel()
+
+		type invalid struct {
+			Price  float64 `bson:"price,ttlkey=symbol"`
+			Symbol string  `bson:"symbol"`
+		}
+		_, err := encode(t, time.Minute, invalid{})
+		assert.ErrorContains(t, err, `ttlkey "symbol" of field Price collides with field Symbol`)
+	})
+	t.Run("inline map collision", func(t *testing.T) {
+		t.Parallel()
+
+		type extended struct {
+			Price float64        `bson:"price,ttlkey=price_expires"`
+			Extra map[string]any `bson:",inline"`
+		}
+		in := extended{Price: 9.5, Extra: map[string]any{"price_expires": "never"}}
+		_, err := encode(t, time.Minute, in)
+		assert.ErrorContains(t, err, "Key price_expires of inlined map conflicts with a struct field name")
+
+		// Without a TTL the expiry is not written, so the key does not collide.
+		_, err = encode(t, 0, in)
+		assert.NoError(t, err)
+	})
+}
+
+func TestStructCodecOnDescribe(t *testing.T) {
+	t.Parallel()
+
+	type widget struct {
+		Name string `bson:"name"`
+	}
+
+	newRegistry := func(classes map[string]string) *Registry {
+		reg := NewRegistry()
+		reg.SetOnDescribe(func(t reflect.Type, b *StructDescriptionBuilder) {
+			_ = b.AddField(SyntheticField{
+				Name: "__class",
+				Encoder: ValueEncoderFunc(func(_ EncodeContext, vw ValueWriter, val reflect.Value) error {
+					return vw.WriteString(val.Type().Name())
+				}),
+				Decoder: ValueDecoderFunc(func(_ DecodeContext, vr ValueReader, val reflect.Value) error {
+					class, err := vr.ReadString()
+					classes[val.Type().Name()] = class
+					return err
+				}),
+			})
+		})
+		return reg
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		classes := map[string]string{}
+		reg := newRegistry(classes)
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetRegistry(reg)
+		err := enc.Encode(widget{Name: "w"})
+		assert.NoError(t, err)
+
+		want, err := Marshal(D{{"name", "w"}, {"__class", "widget"}})
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(want), Raw(buf.Bytes()))
+
+		var got widget
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(buf.Bytes())))
+		dec.SetRegistry(reg)
+		err = dec.Decode(&got)
+		assert.NoError(t, err)
+		assert.Equal(t, widget{Name: "w"}, got)
+		assert.Equal(t, map[string]string{"widget": "widget"}, classes)
+	})
+	t.Run("collision", func(t *testing.T) {
+		t.Parallel()
+
+		type classed struct {
+			Class string `bson:"__class"`
+		}
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetRegistry(newRegistry(map[string]string{}))
+		err := enc.Encode(classed{})
+		assert.ErrorContains(t, err, "synthetic field __class collides with an existing field")
+	})
+}
+
+func TestStructCodecStringEnum(t *testing.T) {
+	t.Parallel()
+
+	type color string
+	type shirt struct {
+		Color color   `bson:"color"`
+		Trim  []color `bson:"trim"`
+	}
+
+	colorType := reflect.TypeOf(color(""))
+
+	newRegistry := func(withFallback bool) *Registry {
+		reg := NewRegistry()
+		reg.RegisterStringEnum(colorType, []string{"red", "green", "unknown"})
+		if withFallback {
+			reg.RegisterStringEnumFallback(colorType, "unknown")
+		}
+		return reg
+	}
+
+	encode := func(reg *Registry, val any) ([]byte, error) {
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetRegistry(reg)
+		err := enc.Encode(val)
+		return buf.Bytes(), err
+	}
+	decode := func(reg *Registry, doc []byte, val any) error {
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.SetRegistry(reg)
+		return dec.Decode(val)
+	}
+
+	t.Run("encode allowed values", func(t *testing.T) {
+		t.Parallel()
+
+		got, err := encode(newRegistry(false), shirt{Color: "red", Trim: []color{"green"}})
+		assert.NoError(t, err)
+		want, err := Marshal(D{{"color", "red"}, {"trim", A{"green"}}})
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+	t.Run("encode invalid value", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := encode(newRegistry(true), shirt{Color: "blue"})
+		assert.ErrorContains(t, err, `invalid value "blue" for enum bson.color in field Color`)
+	})
+	t.Run("decode allowed values", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"color", "green"}, {"trim", A{"red", nil}}})
+		assert.NoError(t, err)
+
+		var got shirt
+		err = decode(newRegistry(false), doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, shirt{Color: "green", Trim: []color{"red", ""}}, got)
+	})
+	t.Run("decode invalid value", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"color", "blue"}})
+		assert.NoError(t, err)
+
+		var got shirt
+		err = decode(newRegistry(false), doc, &got)
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"color"}, de.Keys())
+		assert.ErrorContains(t, err, `invalid value "blue" for enum bson.color in field Color`)
+	})
+	t.Run("decode fallback", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"color", "blue"}, {"trim", A{"purple", "red"}}})
+		assert.NoError(t, err)
+
+		var got shirt
+		err = decode(newRegistry(true), doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, shirt{Color: "unknown", Trim: []color{"unknown", "red"}}, got)
+	})
+	t.Run("unknown enum policy", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"color", "blue"}, {"trim", A{"purple", "red"}}})
+		assert.NoError(t, err)
+
+		testCases := []struct {
+			name   string
+			policy UnknownEnumPolicy
+			want   shirt
+		}{
+			{"zero", UnknownEnumZero, shirt{Color: "", Trim: []color{"", "red"}}},
+			{"skip", UnknownEnumSkip, shirt{Color: "green", Trim: []color{"", "red"}}},
+		}
+		for _, tc := range testCases {
+			tc := tc
+
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+
+				dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+				dec.SetRegistry(newRegistry(false))
+				dec.SetUnknownEnumPolicy(tc.policy)
+				got := shirt{Color: "green"}
+				err := dec.Decode(&got)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.want, got)
+			})
+		}
+	})
+	t.Run("fallback not allowed", func(t *testing.T) {
+		t.Parallel()
+
+		defer func() {
+			err, _ := recover().(error)
+			assert.ErrorContains(t, err, `fallback "blue" is not an allowed value of bson.color`)
+		}()
+		newRegistry(false).RegisterStringEnumFallback(colorType, "blue")
+	})
+}
+
+type enumLevel int
+
+var enumLevels = map[string]enumLevel{"low": 1, "high": 2}
+
+// decodeEnumLevel decodes the name of an enumLevel, handling unknown names according to the
+// UnknownEnumPolicy of dc.
+func decodeEnumLevel(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	name, err := vr.ReadString()
+	if err != nil {
+		return err
+	}
+	level, ok := enumLevels[name]
+	if !ok {
+		switch dc.UnknownEnums() {
+		case UnknownEnumZero:
+		case UnknownEnumSkip:
+			return nil
+		default:
+			return fmt.Errorf("unknown level %q", name)
+		}
+	}
+	val.SetInt(int64(level))
+	return nil
+}
+
+func TestDecodeContextUnknownEnums(t *testing.T) {
+	t.Parallel()
+
+	type alert struct {
+		Level enumLevel `bson:"level"`
+	}
+	type incident struct {
+		Alerts []alert `bson:"alerts"`
+	}
+
+	reg := NewRegistry()
+	reg.RegisterTypeDecoder(reflect.TypeOf(enumLevel(0)), ValueDecoderFunc(decodeEnumLevel))
+	doc := mustMarshal(t, D{{"alerts", A{D{{"level", "high"}}, D{{"level", "severe"}}}}})
+
+	decode := func(policy UnknownEnumPolicy, val any) error {
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.SetRegistry(reg)
+		dec.SetUnknownEnumPolicy(policy)
+		return dec.Decode(val)
+	}
+
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+
+		err := decode(UnknownEnumError, &incident{})
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"alerts", "1", "level"}, de.Keys())
+		assert.ErrorContains(t, err, `unknown level "severe"`)
+	})
+	t.Run("zero", func(t *testing.T) {
+		t.Parallel()
+
+		var got incident
+		err := decode(UnknownEnumZero, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, incident{Alerts: []alert{{Level: 2}, {Level: 0}}}, got)
+	})
+}
+
+func TestStructCodecRound(t *testing.T) {
+	t.Parallel()
+
+	type measurement struct {
+		Price  float64  `bson:"price,round=2"`
+		Weight *float32 `bson:"weight,round=1"`
+		Count  float64  `bson:"count,round=0"`
+		Raw    float64  `bson:"raw"`
+	}
+
+	weight := float32(2.46)
+	got, err := Marshal(measurement{Price: 19.98765, Weight: &weight, Count: 2.7, Raw: 0.123456})
+	assert.NoError(t, err)
+	want, err := Marshal(D{{"price", 19.99}, {"weight", 2.5}, {"count", 3.0}, {"raw", 0.123456}})
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	var decoded measurement
+	err = Unmarshal(want, &decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, 19.99, decoded.Price)
+
+	doc, err := Marshal(D{{"price", 1.23456}})
+	assert.NoError(t, err)
+	err = Unmarshal(doc, &decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.23456, decoded.Price, "expected decoding to be unaffected by round")
+
+	testCases := []struct {
+		name    string
+		val     any
+		wantErr string
+	}{
+		{
+			name: "invalid digits",
+			val: struct {
+				Price float64 `bson:"price,round=two"`
+			}{},
+			wantErr: `invalid round "two" for field Price`,
+		},
+		{
+			name: "negative digits",
+			val: struct {
+				Price float64 `bson:"price,round=-1"`
+			}{},
+			wantErr: `invalid round "-1" for field Price`,
+		},
+		{
+			name: "non-float field",
+			val: struct {
+				Price int `bson:"price,round=2"`
+			}{},
+			wantErr: "round requires a float field, but Price is a int",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Marshal(tc.val)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestStructCodecZeroStructsDefault(t *testing.T) {
+	t.Parallel()
+
+	type inner struct {
+		A string `bson:"a"`
+		B string `bson:"b"`
+	}
+	type outer struct {
+		Inner inner  `bson:"inner"`
+		C     string `bson:"c"`
+	}
+
+	doc, err := Marshal(D{{"inner", D{{"a", "new"}}}})
+	assert.NoError(t, err)
+
+	existing := outer{Inner: inner{A: "old", B: "old"}, C: "old"}
+	zeroed := outer{Inner: inner{A: "new"}}
+	merged := outer{Inner: inner{A: "new", B: "old"}, C: "old"}
+
+	testCases := []struct {
+		name      string
+		registry  func() *Registry
+		configure func(dec *Decoder)
+		want      outer
+	}{
+		{
+			name:     "no default",
+			registry: NewRegistry,
+			want:     merged,
+		},
+		{
+			name: "registry default",
+			registry: func() *Registry {
+				reg := NewRegistry()
+				reg.SetZeroStructs(true)
+				return reg
+			},
+			want: zeroed,
+		},
+		{
+			name: "registry default overridden by PreserveStructs",
+			registry: func() *Registry {
+				reg := NewRegistry()
+				reg.SetZeroStructs(true)
+				return reg
+			},
+			configure: func(dec *Decoder) {
+				dec.PreserveStructs()
+			},
+			want: merged,
+		},
+		{
+			name: "registry default overridden by ZeroStructs",
+			registry: func() *Registry {
+				reg := NewRegistry()
+				reg.SetZeroStructs(false)
+				return reg
+			},
+			configure: func(dec *Decoder) {
+				dec.ZeroStructs()
+			},
+			want: zeroed,
+		},
+		{
+			name: "registry default overrides codec",
+			registry: func() *Registry {
+				reg := NewMgoRegistry()
+				reg.SetZeroStructs(false)
+				return reg
+			},
+			want: merged,
+		},
+		{
+			name:     "last call wins",
+			registry: NewRegistry,
+			configure: func(dec *Decoder) {
+				dec.ZeroStructs()
+				dec.PreserveStructs()
+			},
+			want: merged,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+			dec.SetRegistry(tc.registry())
+			if tc.configure != nil {
+				tc.configure(dec)
+			}
+
+			got := existing
+			err := dec.Decode(&got)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestStructCodecOmitZeroStructDefault(t *testing.T) {
+	t.Parallel()
+
+	type inner struct {
+		A string `bson:"a"`
+	}
+	type outer struct {
+		Inner inner  `bson:"inner,omitempty"`
+		C     string `bson:"c"`
+	}
+
+	omitted := D{{"c", ""}}
+	kept := D{{"inner", D{{"a", ""}}}, {"c", ""}}
+
+	testCases := []struct {
+		name      string
+		registry  func() *Registry
+		configure func(enc *Encoder)
+		want      D
+	}{
+		{
+			name:     "no default",
+			registry: NewRegistry,
+			want:     kept,
+		},
+		{
+			name:     "codec default",
+			registry: NewMgoRegistry,
+			want:     omitted,
+		},
+		{
+			name: "registry default",
+			registry: func() *Registry {
+				reg := NewRegistry()
+				reg.SetOmitZeroStruct(true)
+				return reg
+			},
+			want: omitted,
+		},
+		{
+			name: "registry default overrides codec",
+			registry: func() *Registry {
+				reg := NewMgoRegistry()
+				reg.SetOmitZeroStruct(false)
+				return reg
+			},
+			want: kept,
+		},
+		{
+			name:     "encoder overrides codec",
+			registry: NewMgoRegistry,
+			configure: func(enc *Encoder) {
+				enc.SetOmitZeroStruct(false)
+			},
+			want: kept,
+		},
+		{
+			name: "encoder overrides registry default",
+			registry: func() *Registry {
+				reg := NewRegistry()
+				reg.SetOmitZeroStruct(false)
+				return reg
+			},
+			configure: func(enc *Encoder) {
+				enc.SetOmitZeroStruct(true)
+			},
+			want: omitted,
+		},
+		{
+			name:     "last call wins",
+			registry: NewRegistry,
+			configure: func(enc *Encoder) {
+				enc.OmitZeroStruct()
+				enc.SetOmitZeroStruct(false)
+			},
+			want: kept,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := new(bytes.Buffer)
+			enc := NewEncoder(NewDocumentWriter(buf))
+			enc.SetRegistry(tc.registry())
+			if tc.configure != nil {
+				tc.configure(enc)
+			}
+			err := enc.Encode(outer{})
+			assert.NoError(t, err)
+			assert.Equal(t, Raw(mustMarshal(t, tc.want)), Raw(buf.Bytes()))
+		})
+	}
+}
+
+func TestStructCodecGeneration(t *testing.T) {
+	t.Parallel()
+
+	type record struct {
+		ID      string `bson:"_id"`
+		Name    string `bson:"name"`
+		Version int64  `bson:"version,generation,omitempty"`
+	}
+
+	t.Run("read-modify-write", func(t *testing.T) {
+		t.Parallel()
+
+		// A new record is written with the first generation.
+		stored, err := Marshal(record{ID: "a", Name: "first"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), Raw(stored).Lookup("version").Int64())
+
+		for want := int64(1); want <= 3; want++ {
+			var rec record
+			err = Unmarshal(stored, &rec)
+			assert.NoError(t, err)
+			assert.Equal(t, want, rec.Version, "expected decoding to record the stored generation")
+
+			rec.Name = "updated"
+			stored, err = Marshal(rec)
+			assert.NoError(t, err)
+			assert.Equal(t, want+1, Raw(stored).Lookup("version").Int64())
+			assert.Equal(t, want, rec.Version, "expected encoding not to modify the struct")
+		}
+	})
+	t.Run("overflow", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := Marshal(struct {
+			Version uint8 `bson:"version,generation"`
+		}{Version: math.MaxUint8})
+		assert.ErrorContains(t, err, "error encoding key version (field Version): generation 255 overflows uint8")
+		var ee *EncodeError
+		if assert.True(t, errors.As(err, &ee), "expected an EncodeError, got %v", err) {
+			assert.Equal(t, []string{"version"}, ee.Keys())
+		}
+	})
+	t.Run("non-integer field", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := Marshal(struct {
+			Version string `bson:"version,generation"`
+		}{})
+		assert.ErrorContains(t, err, "generation requires an integer field, but Version is a string")
+	})
+}
+
+func TestStructCodecSchemaAliases(t *testing.T) {
+	t.Parallel()
+
+	type event struct {
+		Schema string `bson:"schema"`
+		User   string `bson:"user"`
+		Amount int32  `bson:"amount"`
+	}
+
+	reg := NewRegistry()
+	reg.RegisterSchemaAliases(reflect.TypeOf(event{}), "schema", map[string]map[string]string{
+		"v2": {"userId": "user", "total": "amount"},
+		"v3": {"uid": "user"},
+	})
+
+	testCases := []struct {
+		name    string
+		doc     D
+		want    event
+		wantErr string
+	}{
+		{
+			name: "no schema key",
+			doc:  D{{"user", "a"}, {"amount", int32(1)}},
+			want: event{User: "a", Amount: 1},
+		},
+		{
+			name: "schema key first",
+			doc:  D{{"schema", "v2"}, {"userId", "b"}, {"total", int32(2)}},
+			want: event{Schema: "v2", User: "b", Amount: 2},
+		},
+		{
+			name: "schema key last",
+			doc:  D{{"uid", "c"}, {"amount", int32(3)}, {"schema", "v3"}},
+			want: event{Schema: "v3", User: "c", Amount: 3},
+		},
+		{
+			name: "unregistered variant",
+			doc:  D{{"schema", "v9"}, {"user", "d"}, {"total", int32(4)}},
+			want: event{Schema: "v9", User: "d"},
+		},
+		{
+			name:    "non-string schema key",
+			doc:     D{{"schema", int32(2)}, {"user", "e"}},
+			wantErr: `schema key "schema" must be a string, got 32-bit integer`,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc, err := Marshal(tc.doc)
+			assert.NoError(t, err)
+
+			dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+			dec.SetRegistry(reg)
+			var got event
+			err = dec.Decode(&got)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+	t.Run("nested struct", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"events", A{
+			D{{"schema", "v2"}, {"userId", "f"}},
+			D{{"schema", "v3"}, {"uid", "g"}},
+		}}})
+		assert.NoError(t, err)
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.SetRegistry(reg)
+		var got struct {
+			Events []event `bson:"events"`
+		}
+		err = dec.Decode(&got)
+		assert.NoError(t, err)
+		assert.Equal(t, []event{{Schema: "v2", User: "f"}, {Schema: "v3", User: "g"}}, got.Events)
+	})
+	t.Run("malformed document", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"user", "h"}, {"schema", "v2"}})
+		assert.NoError(t, err)
+		// Corrupt the length of the "user" string so that the lookup cannot reach "schema".
+		doc[10] = 0x7f
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+		dec.SetRegistry(reg)
+		err = dec.Decode(&event{})
+		assert.ErrorContains(t, err, "too few bytes to read next component")
+	})
+}
+
+type structSliceInner struct {
+	C string `bson:"c"`
+}
+
+type structSliceElem struct {
+	A      int32            `bson:"a"`
+	B      string           `bson:"b,omitempty"`
+	Inner  structSliceInner `bson:",inline"`
+	Ptr    *int64           `bson:"ptr"`
+	Any    any              `bson:"any"`
+	Extras map[string]any   `bson:",inline"`
+}
+
+func TestStructCodecSlice(t *testing.T) {
+	t.Parallel()
+
+	i64 := int64(7)
+	elems := []structSliceElem{
+		{A: 1, B: "one", Inner: structSliceInner{C: "c"}, Ptr: &i64, Any: "x"},
+		{A: 2, Extras: map[string]any{"extra": int32(3)}},
+		{},
+	}
+	points := []positionalPoint{{X: 1, Y: 2}, {X: 3, Y: 4}}
+	type event struct {
+		At    time.Time `bson:"at"`
+		Until time.Time `bson:"until,omitempty"`
+	}
+	at := time.Date(2024, 3, 15, 9, 30, 0, 0, time.UTC)
+	events := []event{{At: at, Until: at.Add(time.Hour)}, {At: at}}
+
+	// Encoding elements through []any uses the per-element path, so the specialized slice path
+	// must produce the same bytes.
+	toAny := func(s any) []any {
+		v := reflect.ValueOf(s)
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = v.Index(i).Interface()
+		}
+		return out
+	}
+
+	testCases := []struct {
+		name string
+		val  any
+	}{
+		{name: "documents", val: elems},
+		{name: "positional arrays", val: points},
+		{name: "empty", val: []structSliceElem{}},
+		{name: "array", val: [3]structSliceElem{elems[0], elems[1], elems[2]}},
+		{name: "addressable times", val: events},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Marshal(D{{"v", tc.val}})
+			assert.NoError(t, err)
+			want, err := Marshal(D{{"v", toAny(tc.val)}})
+			assert.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+	t.Run("element error", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := Marshal(D{{"v", []structSliceElem{{Any: make(chan int)}}}})
+		assert.ErrorContains(t, err, "no encoder found for chan int")
+	})
+}
+
+func TestStructCodecMirror(t *testing.T) {
+	t.Parallel()
+
+	type schedule struct {
+		When     time.Time  `bson:"when,mirror=WhenStr,layout=2006-01-02 15:04"`
+		WhenStr  string     `bson:"whenStr"`
+		Until    *time.Time `bson:"until,mirror=UntilStr"`
+		UntilStr string     `bson:"-"`
+	}
+	type wrapper struct {
+		Schedule schedule `bson:",inline"`
+		Name     string   `bson:"name"`
+	}
+
+	when := time.Date(2024, 3, 15, 9, 30, 0, 0, time.UTC)
+	until := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("decode sets mirror", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"whenStr", "stale"}, {"when", when}, {"until", until}})
+		assert.NoError(t, err)
+
+		var got schedule
+		err = Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, "2024-03-15 09:30", got.WhenStr)
+		assert.Equal(t, "2024-04-01T00:00:00Z", got.UntilStr)
+	})
+	t.Run("decode null", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"until", nil}})
+		assert.NoError(t, err)
+
+		got := schedule{UntilStr: "old"}
+		err = Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, "", got.UntilStr)
+	})
+	t.Run("decode absent", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"whenStr", "stale"}})
+		assert.NoError(t, err)
+
+		got := schedule{When: when, WhenStr: "old", UntilStr: "old"}
+		err = Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, "2024-03-15 09:30", got.WhenStr)
+		assert.Equal(t, "", got.UntilStr)
+	})
+	t.Run("encode skips mirror", func(t *testing.T) {
+		t.Parallel()
+
+		got, err := Marshal(schedule{When: when, WhenStr: "ignored", Until: &until, UntilStr: "ignored"})
+		assert.NoError(t, err)
+		want, err := Marshal(D{{"when", when}, {"until", until}})
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+	t.Run("inline", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"when", when}, {"name", "standup"}})
+		assert.NoError(t, err)
+
+		var got wrapper
+		err = Unmarshal(doc, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, "2024-03-15 09:30", got.Schedule.WhenStr)
+		assert.Equal(t, "standup", got.Name)
+	})
+
+	describeErrs := []struct {
+		name    string
+		val     any
+		wantErr string
+	}{
+		{
+			name: "missing mirror field",
+			val: struct {
+				When time.Time `bson:"when,mirror=WhenStr"`
+			}{},
+			wantErr: "mirror field WhenStr of field When does not exist",
+		},
+		{
+			name: "non-string mirror field",
+			val: struct {
+				When    time.Time `bson:"when,mirror=WhenStr"`
+				WhenStr int       `bson:"-"`
+			}{},
+			wantErr: "mirror field WhenStr of field When must be a string, but is a int",
+		},
+		{
+			name: "non-time field",
+			val: struct {
+				When    string `bson:"when,mirror=WhenStr"`
+				WhenStr string `bson:"-"`
+			}{},
+			wantErr: "mirror requires a time.Time or *time.Time field, but When is a string",
+		},
+	}
+	for _, tc := range describeErrs {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Marshal(tc.val)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+type softDeleteTest struct {
+	Name    string `bson:"name"`
+	Deleted bool   `bson:"deleted"`
+}
+
+func (s *softDeleteTest) ShouldEncode() bool {
+	return !s.Deleted
+}
+
+func TestStructCodecShouldEncode(t *testing.T) {
+	t.Parallel()
+
+	t.Run("top-level value", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(&softDeleteTest{Name: "a", Deleted: true})
+		assert.ErrorIs(t, err, ErrEncodeSkipped)
+		assert.Nil(t, doc)
+
+		doc, err = Marshal(&softDeleteTest{Name: "a"})
+		assert.NoError(t, err, "Marshal error")
+		assert.Equal(t, "a", Raw(doc).Lookup("name").StringValue())
+	})
+	t.Run("nested values", func(t *testing.T) {
+		t.Parallel()
+
+		type batch struct {
+			One  softDeleteTest   `bson:"one"`
+			Ptr  *softDeleteTest  `bson:"ptr"`
+			Many []softDeleteTest `bson:"many"`
+		}
+		doc, err := Marshal(&batch{
+			One:  softDeleteTest{Name: "a", Deleted: true},
+			Ptr:  &softDeleteTest{Name: "b", Deleted: true},
+			Many: []softDeleteTest{{Name: "c"}, {Name: "d", Deleted: true}},
+		})
+		assert.NoError(t, err, "Marshal error")
+
+		want, err := Marshal(D{
+			{"one", D{}},
+			{"ptr", D{}},
+			{"many", A{D{{"name", "c"}, {"deleted", false}}, D{}}},
+		})
+		assert.NoError(t, err, "Marshal error")
+		assert.Equal(t, Raw(want).String(), Raw(doc).String())
+	})
+}
+
+func TestStructCodecHashOf(t *testing.T) {
+	t.Parallel()
+
+	type contact struct {
+		Name  string `bson:"name"`
+		Email string `bson:"email,omitempty"`
+		Notes string `bson:"notes"`
+		Hash  string `bson:"_hash,hashof=name|email"`
+		Sum   []byte `bson:"_sum,hashof=email"`
+	}
+
+	hashOf := func(t *testing.T, doc D) string {
+		sum := sha256.Sum256(mustMarshal(t, doc))
+		return hex.EncodeToString(sum[:])
+	}
+
+	t.Run("encode", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(contact{Name: "Ada", Email: "ada@example.com", Notes: "x", Hash: "ignored"})
+		assert.NoError(t, err, "Marshal error")
+
+		want := hashOf(t, D{{"name", "Ada"}, {"email", "ada@example.com"}})
+		assert.Equal(t, want, Raw(doc).Lookup("_hash").StringValue())
+		_, sum := Raw(doc).Lookup("_sum").Binary()
+		wantSum := sha256.Sum256(mustMarshal(t, D{{"email", "ada@example.com"}}))
+		assert.Equal(t, wantSum[:], sum)
+
+		// Fields that are not hashed do not change the hash, and omitted fields are skipped.
+		doc, err = Marshal(contact{Name: "Ada", Notes: "y"})
+		assert.NoError(t, err, "Marshal error")
+		assert.Equal(t, hashOf(t, D{{"name", "Ada"}}), Raw(doc).Lookup("_hash").StringValue())
+	})
+	t.Run("custom hash", func(t *testing.T) {
+		t.Parallel()
+
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(NewDocumentWriter(buf))
+		enc.SetHashFunc(md5.New)
+		err := enc.Encode(contact{Name: "Ada"})
+		assert.NoError(t, err, "Encode error")
+
+		sum := md5.Sum(mustMarshal(t, D{{"name", "Ada"}}))
+		assert.Equal(t, hex.EncodeToString(sum[:]), Raw(buf.Bytes()).Lookup("_hash").StringValue())
+	})
+	t.Run("verify", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(contact{Name: "Ada", Email: "ada@example.com"})
+		assert.NoError(t, err, "Marshal error")
+
+		decode := func(doc []byte) error {
+			dec := NewDecoder(NewDocumentReader(bytes.NewReader(doc)))
+			dec.VerifyHashes(nil)
+			return dec.Decode(&contact{})
+		}
+		assert.NoError(t, decode(doc), "Decode error")
+
+		var tampered D
+		err = Unmarshal(doc, &tampered)
+		assert.NoError(t, err, "Unmarshal error")
+		tampered[0].Value = "Eve"
+		err = decode(mustMarshal(t, tampered))
+		assert.ErrorIs(t, err, ErrHashMismatch)
+		var de *DecodeError
+		assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"_hash"}, de.Keys())
+
+		// Without VerifyHashes, mismatches are not reported.
+		err = Unmarshal(mustMarshal(t, tampered), &contact{})
+		assert.NoError(t, err, "Unmarshal error")
+	})
+
+	describeErrs := []struct {
+		name    string
+		val     any
+		wantErr string
+	}{
+		{
+			name: "unknown key",
+			val: struct {
+				Name string `bson:"name"`
+				Hash string `bson:"_hash,hashof=name|phone"`
+			}{},
+			wantErr: "hashof key phone of field Hash does not exist",
+		},
+		{
+			name: "hashed field after hash",
+			val: struct {
+				Hash string `bson:"_hash,hashof=name"`
+				Name string `bson:"name"`
+			}{},
+			wantErr: "hashed field Name must come before field Hash",
+		},
+		{
+			name: "non-string field",
+			val: struct {
+				Name string `bson:"name"`
+				Hash int64  `bson:"_hash,hashof=name"`
+			}{},
+			wantErr: "hashof requires a string or []byte field, but Hash is a int64",
+		},
+	}
+	for _, tc := range describeErrs {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Marshal(tc.val)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+	t.Run("synthetic field", func(t *testing.T) {
+		t.Parallel()
+
+		type stamped struct {
+			Name string `bson:"name"`
+			Hash string `bson:"_hash,hashof=name|__class"`
+		}
+
+		reg := NewRegistry()
+		reg.SetOnDescribe(func(_ reflect.Type, b *StructDescriptionBuilder) {
+			_ = b.AddField(SyntheticField{
+				Name: "__class",
+				Encoder: ValueEncoderFunc(func(_ EncodeContext, vw ValueWriter, val reflect.Value) error {
+					return vw.WriteString(val.Type().Name())
+				}),
+			})
+		})
+
+		enc := NewEncoder(NewDocumentWriter(new(bytes.Buffer)))
+		enc.SetRegistry(reg)
+		err := enc.Encode(stamped{Name: "Ada"})
+		assert.ErrorContains(t, err, "field __class cannot be hashed by field Hash")
+
+		dec := NewDecoder(NewDocumentReader(bytes.NewReader(mustMarshal(t, D{{"name", "Ada"}}))))
+		dec.SetRegistry(reg)
+		err = dec.Decode(&stamped{})
+		assert.ErrorContains(t, err, "field __class cannot be hashed by field Hash")
+	})
+}
+
+func mustMarshal(t *testing.T, val any) []byte {
+	t.Helper()
+
+	raw, err := Marshal(val)
+	assert.NoError(t, err, "Marshal error")
+	return raw
+}
+
+type omitZeroCounter struct {
+	N int64 `bson:"n"`
+}
+
+// IsZero reports counters with a negative value as zero, so that the Zeroer takes precedence
+// over reflect.Value.IsZero in TestStructCodecOmitZero.
+func (c *omitZeroCounter) IsZero() bool { return c.N < 0 }
+
+func TestStructCodecOmitZero(t *testing.T) {
+	t.Parallel()
+
+	type omitZeroTest struct {
+		Int     int64           `bson:"int,omitzero"`
+		Slice   []string        `bson:"slice,omitzero"`
+		Map     map[string]int  `bson:"map,omitzero"`
+		Ptr     *int64          `bson:"ptr,omitzero"`
+		Time    time.Time       `bson:"time,omitzero"`
+		Zeroer  zeroTest        `bson:"zeroer,omitzero"`
+		Counter omitZeroCounter `bson:"counter,omitzero"`
+	}
+
+	zero := int64(0)
+	testCases := []struct {
+		name string
+		val  *omitZeroTest
+		want []string
+	}{
+		{
+			name: "zero values",
+			val:  &omitZeroTest{Zeroer: zeroTest{reportZero: true}},
+			want: []string{"counter"},
+		},
+		{
+			name: "empty slices and maps are kept",
+			val: &omitZeroTest{
+				Slice:  []string{},
+				Map:    map[string]int{},
+				Ptr:    &zero,
+				Zeroer: zeroTest{reportZero: true},
+			},
+			want: []string{"slice", "map", "ptr", "counter"},
+		},
+		{
+			name: "Zeroer takes precedence",
+			val: &omitZeroTest{
+				Int:     1,
+				Time:    time.Unix(0, 0).UTC(),
+				Zeroer:  zeroTest{reportZero: false},
+				Counter: omitZeroCounter{N: -1},
+			},
+			want: []string{"int", "time", "zeroer"},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc, err := Marshal(tc.val)
+			assert.NoError(t, err, "Marshal error")
+
+			elems, err := Raw(doc).Elements()
+			assert.NoError(t, err, "Elements error")
+			keys := []string{}
+			for _, elem := range elems {
+				keys = append(keys, elem.Key())
+			}
+			assert.Equal(t, tc.want, keys)
+		})
+	}
+}
+
+func TestStructCodecDescribeOnce(t *testing.T) {
+	t.Parallel()
+
+	type describeOnceTest struct {
+		A string `bson:"a"`
+		B int64  `bson:"b"`
+	}
+
+	var describes int32
+	reg := NewRegistry()
+	reg.SetOnDescribe(func(t reflect.Type, _ *StructDescriptionBuilder) {
+		if t == reflect.TypeOf(describeOnceTest{}) {
+			atomic.AddInt32(&describes, 1)
+		}
+	})
+
+	const goroutines = 64
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	start := make(chan struct{})
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			enc := NewEncoder(NewDocumentWriter(new(bytes.Buffer)))
+			enc.SetRegistry(reg)
+			errs <- enc.Encode(describeOnceTest{A: "a", B: 1})
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err, "Encode error")
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&describes), "expected the struct to be described once")
+}
+
+func TestDecodeErrorFieldNames(t *testing.T) {
+	t.Parallel()
+
+	type item struct {
+		CreatedAt int64 `bson:"createdAt"`
+	}
+	type order struct {
+		Items []item `bson:"items"`
+	}
+
+	doc, err := Marshal(D{{"items", A{D{{"createdAt", "yesterday"}}}}})
+	assert.NoError(t, err, "Marshal error")
+
+	err = Unmarshal(doc, &order{})
+	var de *DecodeError
+	assert.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+	assert.Equal(t, []string{"items", "0", "createdAt"}, de.Keys())
+	assert.Equal(t, []string{"Items", "", "CreatedAt"}, de.FieldNames())
+	assert.ErrorContains(t, err, "error decoding key items.0.createdAt (field Items.0.CreatedAt): ")
+
+	// The field path is omitted if it is the same as the key path.
+	de = &DecodeError{keys: []string{"Count"}, fields: []string{"Count"}, wrapped: errors.New("bad")}
+	assert.EqualError(t, de, "error decoding key Count: bad")
+}
+
+var errEncodeErrorValue = errors.New("cannot marshal")
+
+type encodeErrorValue struct{}
+
+func (encodeErrorValue) MarshalBSONValue() (byte, []byte, error) {
+	return 0, nil, errEncodeErrorValue
+}
+
+func TestEncodeError(t *testing.T) {
+	t.Parallel()
+
+	type audit struct {
+		CreatedAt encodeErrorValue `bson:"createdAt"`
+	}
+	type meta struct {
+		Audit audit `bson:"audit"`
+	}
+	type item struct {
+		Meta meta `bson:",inline"`
+	}
+	type order struct {
+		Items []item                      `bson:"items"`
+		Tags  map[string]encodeErrorValue `bson:"tags"`
+	}
+
+	testCases := []struct {
+		name   string
+		val    any
+		keys   []string
+		fields []string
+		msg    string
+	}{
+		{
+			name:   "field",
+			val:    audit{},
+			keys:   []string{"createdAt"},
+			fields: []string{"CreatedAt"},
+			msg:    "error encoding key createdAt (field CreatedAt): cannot marshal",
+		},
+		{
+			name:   "nested inline slice",
+			val:    order{Items: []item{{}}},
+			keys:   []string{"items", "0", "audit", "createdAt"},
+			fields: []string{"Items", "", "Audit", "CreatedAt"},
+			msg:    "error encoding key items.0.audit.createdAt (field Items.0.Audit.CreatedAt): cannot marshal",
+		},
+		{
+			name:   "map",
+			val:    order{Tags: map[string]encodeErrorValue{"a": {}}},
+			keys:   []string{"tags", "a"},
+			fields: []string{"Tags", ""},
+			msg:    "error encoding key tags.a (field Tags.a): cannot marshal",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Marshal(tc.val)
+			assert.ErrorIs(t, err, errEncodeErrorValue)
+			var ee *EncodeError
+			assert.True(t, errors.As(err, &ee), "expected an EncodeError, got %v", err)
+			assert.Equal(t, tc.keys, ee.Keys())
+			assert.Equal(t, tc.fields, ee.FieldNames())
+			assert.EqualError(t, err, tc.msg)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// StructDescription describes how the struct codec maps the fields of a struct type to the
+// elements of a BSON document. It is returned by DescribeStruct.
+type StructDescription struct {
+	// Fields holds the fields of the struct in the order they are marshaled, including the
+	// fields of inline structs and the fields added by an OnDescribeFunc.
+	Fields []FieldDescription
+
+	// InlineMap is the name of the map field with the "inline" struct tag option that holds the
+	// elements that do not match a field, or "" if there is none. InlinePrefix is the prefix of
+	// its keys set using the "prefix" struct tag option.
+	InlineMap    string
+	InlinePrefix string
+
+	// InlineRaw is the name of the bson.Raw field with the "inline" struct tag option that holds
+	// the elements that do not match a field, or "" if there is none.
+	InlineRaw string
+
+	// InlineSetter is the name of the field with the "inline" struct tag option whose type
+	// implements MapSetter and receives the elements that do not match a field, or "" if there is
+	// none.
+	InlineSetter string
+
+	// Positional is whether the struct embeds PositionalArray and is marshaled as a BSON array.
+	Positional bool
+}
+
+// FieldDescription describes how a struct field is marshaled and unmarshaled.
+type FieldDescription struct {
+	// Name is the BSON key of the field, or the pattern of its keys if Glob is set.
+	Name string
+
+	// FieldName is the name of the Go struct field.
+	FieldName string
+
+	// Index is the index sequence of the field for reflect.Value.FieldByIndex, including the
+	// indexes of the inline structs it belongs to. It is nil for synthetic fields.
+	Index []int
+
+	// Inline is whether the field belongs to an inline struct.
+	Inline bool
+
+	// Position is the index of the field in the BSON array if the struct is positional, or -1.
+	Position int
+
+	// OmitEmpty, OmitZero, MinSize, Truncate, and Glob report whether the corresponding struct
+	// tag options are set.
+	OmitEmpty bool
+	OmitZero  bool
+	MinSize   bool
+	Truncate  bool
+	Glob      bool
+
+	// Synthetic is whether the field was added by an OnDescribeFunc and does not exist in the Go
+	// struct.
+	Synthetic bool
+}
+
+// DescribeStruct returns how the struct codec registered in r for the struct type t maps its fields
+// to BSON, using the same cached description as Marshal and Unmarshal. It returns an error if t is
+// not encoded by the struct codec or if t cannot be described (e.g. because of invalid struct tags).
+//
+// The description reflects the default configuration. Options such as Encoder.SetNameTransformer
+// and Encoder.UseJSONStructTags may change the keys used by an Encoder or Decoder.
+func DescribeStruct(r *Registry, t reflect.Type) (StructDescription, error) {
+	if r == nil {
+		return StructDescription{}, ErrNilRegistry
+	}
+	encoder, err := r.LookupEncoder(t)
+	if err != nil {
+		return StructDescription{}, err
+	}
+	sc, ok := encoder.(*structCodec)
+	if !ok {
+		return StructDescription{}, fmt.Errorf("DescribeStruct requires a type encoded by the struct codec, got %s", t)
+	}
+	sd, err := sc.describeStruct(r, t, false, false, nil)
+	if err != nil {
+		return StructDescription{}, err
+	}
+
+	desc := StructDescription{
+		Fields:       make([]FieldDescription, 0, len(sd.fl)),
+		InlinePrefix: sd.inlinePrefix,
+		Positional:   sd.positions != nil,
+	}
+	if sd.inlineMap >= 0 {
+		desc.InlineMap = t.Field(sd.inlineMap).Name
+	}
+	if sd.inlineRaw >= 0 {
+		desc.InlineRaw = t.Field(sd.inlineRaw).Name
+	}
+	if sd.inlineSetter >= 0 {
+		desc.InlineSetter = t.Field(sd.inlineSetter).Name
+	}
+	for _, fd := range sd.fl {
+		field := FieldDescription{
+			Name:      fd.name,
+			FieldName: fd.fieldName,
+			Inline:    fd.inline != nil,
+			Position:  fd.pos,
+			OmitEmpty: fd.omitEmpty,
+			OmitZero:  fd.omitZero,
+			MinSize:   fd.minSize,
+			Truncate:  fd.truncate,
+			Glob:      fd.glob,
+			Synthetic: fd.synthetic,
+		}
+		switch {
+		case fd.synthetic:
+		case fd.inline != nil:
+			field.Index = append([]int(nil), fd.inline...)
+		default:
+			field.Index = []int{fd.idx}
+		}
+		desc.Fields = append(desc.Fields, field)
+	}
+	return desc, nil
+}
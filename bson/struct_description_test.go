@@ -0,0 +1,109 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
+	"go.mongodb.org/mongo-driver/v2/internal/require"
+)
+
+type describedAddress struct {
+	Street string `bson:"street,omitempty"`
+	City   string
+}
+
+type describedUser struct {
+	ID      int64 `bson:"_id"`
+	Name    string
+	Address describedAddress `bson:",inline"`
+	Extra   map[string]any   `bson:",inline,prefix=x_"`
+	Count   int64            `bson:"count,minsize,truncate"`
+}
+
+func TestDescribeStruct(t *testing.T) {
+	t.Parallel()
+
+	t.Run("fields", func(t *testing.T) {
+		t.Parallel()
+
+		desc, err := DescribeStruct(NewRegistry(), reflect.TypeOf(describedUser{}))
+		require.NoError(t, err, "DescribeStruct error")
+
+		want := StructDescription{
+			Fields: []FieldDescription{
+				{Name: "_id", FieldName: "ID", Index: []int{0}, Position: -1},
+				{Name: "Name", FieldName: "Name", Index: []int{1}, Position: -1},
+				{Name: "street", FieldName: "Street", Index: []int{2, 0}, Inline: true, Position: -1, OmitEmpty: true},
+				{Name: "City", FieldName: "City", Index: []int{2, 1}, Inline: true, Position: -1},
+				{Name: "count", FieldName: "Count", Index: []int{4}, Position: -1, MinSize: true, Truncate: true},
+			},
+			InlineMap:    "Extra",
+			InlinePrefix: "x_",
+		}
+		assert.Equal(t, want, desc)
+	})
+	t.Run("synthetic", func(t *testing.T) {
+		t.Parallel()
+
+		type document struct {
+			Body string `bson:"body"`
+		}
+
+		reg := NewRegistry()
+		reg.SetOnDescribe(func(_ reflect.Type, b *StructDescriptionBuilder) {
+			_ = b.AddField(SyntheticField{Name: "version"})
+		})
+		desc, err := DescribeStruct(reg, reflect.TypeOf(document{}))
+		require.NoError(t, err, "DescribeStruct error")
+
+		want := StructDescription{
+			Fields: []FieldDescription{
+				{Name: "body", FieldName: "Body", Index: []int{0}, Position: -1},
+				{Name: "version", FieldName: "version", Position: -1, Synthetic: true},
+			},
+		}
+		assert.Equal(t, want, desc)
+	})
+	t.Run("positional", func(t *testing.T) {
+		t.Parallel()
+
+		type point struct {
+			PositionalArray
+			X float64 `bson:"x,pos=0"`
+			Y float64 `bson:"y,pos=1"`
+		}
+
+		desc, err := DescribeStruct(NewRegistry(), reflect.TypeOf(point{}))
+		require.NoError(t, err, "DescribeStruct error")
+
+		want := StructDescription{
+			Fields: []FieldDescription{
+				{Name: "x", FieldName: "X", Index: []int{1}, Position: 0},
+				{Name: "y", FieldName: "Y", Index: []int{2}, Position: 1},
+			},
+			Positional: true,
+		}
+		assert.Equal(t, want, desc)
+	})
+	t.Run("not a struct", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := DescribeStruct(NewRegistry(), reflect.TypeOf(M{}))
+		assert.ErrorContains(t, err, "DescribeStruct requires a type encoded by the struct codec")
+	})
+	t.Run("invalid struct tags", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := DescribeStruct(NewRegistry(), reflect.TypeOf(struct {
+			A string `bson:"-,omitempty"`
+		}{}))
+		assert.ErrorContains(t, err, "ambiguous struct tag")
+	})
+}
@@ -7,6 +7,7 @@
 package bson
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 )
@@ -23,25 +24,181 @@ import (
 //	OmitEmpty  Only include the field if it's not set to the zero value for the type or to
 //	           empty slices or maps.
 //
+//	OmitZero   Only include the field if it's not set to the zero value for the type, as
+//	           reported by reflect.Value.IsZero or by the IsZero method if the type implements
+//	           Zeroer. Unlike OmitEmpty, empty slices and maps are included.
+//
 //	MinSize    Marshal an integer of a type larger than 32 bits value as an int32, if that's
-//	           feasible while preserving the numeric value.
+//	           feasible while preserving the numeric value. It applies to the values held by
+//	           the field, e.g. slice elements, and to all fields of an inline struct or map.
 //
 //	Truncate   When unmarshaling a BSON double, it is permitted to lose precision to fit within
 //	           a float32.
 //
+//	LocalTime  Unmarshal a time.Time or *time.Time field in the local time zone, regardless of
+//	           Decoder.UseLocalTimeZone. Marshaling is not affected.
+//
 //	Inline     Inline the field, which must be a struct or a map, causing all of its fields
 //	           or keys to be processed as if they were part of the outer struct. For maps,
-//	           keys must not conflict with the bson keys of other struct fields.
+//	           keys must not conflict with the bson keys of other struct fields. Map keys
+//	           must be of a string type or of a type that implements KeyMarshaler or
+//	           encoding.TextMarshaler and the matching unmarshaler. A bson.Raw
+//	           field can be inlined instead of a map to hold the elements that do not match
+//	           a struct field as an undecoded document, preserving their BSON types. A nil
+//	           or empty inline map adds no elements whether or not OmitEmpty is set, and a
+//	           nil inline map is only allocated when unmarshaling a document with an element
+//	           that is stored in it. BSON null elements are stored in the map as the zero
+//	           value of its value type, e.g. a nil interface, so that their keys are kept.
+//
+//	Prefix     A prefix added to the keys of an inline map when marshaling and removed when
+//	           unmarshaling. Only keys with the prefix are unmarshaled into the map. The
+//	           prefixed keys must not conflict with the bson keys of other struct fields. It
+//	           is set using the "prefix=<prefix>" flag.
 //
 //	Skip       This struct field should be skipped. This is usually denoted by parsing a "-"
 //	           for the name.
+//
+//	OnMissing  The name of a method on the struct that is called to produce a value for the
+//	           field when the field is absent from the BSON document being unmarshaled. It
+//	           is set using the "onmissing=<Method>" flag.
+//
+//	Required   Unmarshaling fails with an error wrapping ErrRequiredFieldMissing if the field is
+//	           absent from the BSON document. It is not checked by Decoder.PatchMode.
+//
+//	Pos        The index of the field in the BSON array when the struct embeds PositionalArray.
+//	           It is set using the "pos=<N>" flag. If no field of the struct sets it, the
+//	           fields are positioned in declaration order.
+//
+//	Order      The position of the field in marshaled documents. Fields with the flag are
+//	           marshaled first, in increasing order, followed by the other fields in
+//	           declaration order. Fields with the same order keep their declaration order.
+//	           Unmarshaling is not affected. It is set using the "order=<N>" flag.
+//
+//	Encoding   The name of a TextEncoding registered on the Registry used to store a []byte or
+//	           string field as a BSON string. It is set using the "encoding=<name>" flag.
+//
+//	Codec      The name of a codec registered on the Registry using RegisterNamedCodec that is
+//	           used to marshal and unmarshal the field instead of the codec for its type. It
+//	           is set using the "codec=<name>" flag.
+//
+//	PairArray  Marshal a map field as a BSON array of two-element [key, value] arrays instead of
+//	           a BSON document, and unmarshal it from that form.
+//
+//	Binary     Marshal a net.IP or net.HardwareAddr field as BSON binary containing its raw
+//	           bytes instead of its canonical string representation, which is used for
+//	           net.HardwareAddr and, with Encoder.IPAsString, for net.IP.
+//
+//	Transform  The names of Transforms registered on the Registry, separated by "|", that are
+//	           applied in order to a string field after it is unmarshaled. It is set using the
+//	           "transform=<name>|<name>" flag.
+//
+//	Project    The name of a Projector registered on the Registry that computes the value
+//	           marshaled for the field from the whole struct. The field's own value is not
+//	           marshaled. It is set using the "project=<name>" flag.
+//
+//	Glob       Treat the name as a glob pattern (see path.Match). The field must be a map with
+//	           string keys. When unmarshaling, every key that matches the pattern and no other
+//	           struct field is stored in the map. When marshaling, the keys of the map are
+//	           written as keys of the enclosing document; a key that does not match the
+//	           pattern is an error.
+//
+//	TTLKey     The key of a companion BSON datetime written after the field holding the time the
+//	           field expires, computed from the TTL and clock set with Encoder.SetTTL. A
+//	           time.Time or *time.Time field with that key receives the expiry when
+//	           unmarshaling. It is set using the "ttlkey=<key>" flag.
+//
+//	Round      The number of decimal places a float field is rounded to before it is
+//	           marshaled. Unmarshaling is not affected. It is set using the "round=<N>" flag.
+//
+//	Generation Marshal an integer field as its value plus one. The field holds the generation
+//	           of the document that was unmarshaled into the struct, so marshaling the struct
+//	           again writes the next generation for a compare-and-swap update.
+//
+//	Mirror     The name of a string field of the same struct that is set to the value of a
+//	           time.Time or *time.Time field formatted with Layout when the struct is
+//	           unmarshaled, even if the document does not contain the field. The mirror field
+//	           is derived, so it is neither marshaled nor unmarshaled from its own key. It is
+//	           set using the "mirror=<Field>" flag.
+//
+//	Layout     The time layout used to format the mirror field, time.RFC3339 by default. It
+//	           is set using the "layout=<layout>" flag and cannot contain a comma.
+//
+//	TimeLayout Marshal a time.Time field as a BSON string formatted with a time layout, and
+//	           unmarshal it from a BSON string in that layout. BSON datetimes are still
+//	           unmarshaled as usual. It is set using the "timelayout=<layout>" flag, and the
+//	           layout cannot contain a comma.
+//
+//	Packed     Marshal a numeric slice field as a single BSON binary value holding its elements
+//	           as fixed-size numbers, and unmarshal it from that form. It is set using the
+//	           "packed=<order>-<type>" flag, where order is "le" or "be" and type is one of
+//	           "i16", "i32", "i64", "u16", "u32", "u64", "f32", or "f64".
+//
+//	Try        Unmarshal an interface field into the first of a list of types the value can be
+//	           decoded into without an error. It is set using the "try=<Type>|<Type>..." flag,
+//	           where each type is one of "Int32", "Int64", "Int", "Float64", "Decimal128",
+//	           "String", "Bool", "Time", "DateTime", "ObjectID", "Binary", "D", "M", or "A".
+//
+//	Bitset     Marshal a []bool or [N]bool field as BSON binary holding the number of elements
+//	           as a 4-byte little-endian integer followed by one bit per element, and
+//	           unmarshal it from that form.
+//
+//	ScalarAs   The name of a field of a struct or struct pointer field that a BSON value other
+//	           than a document is unmarshaled into, so that e.g. 5 unmarshals like {amount: 5}.
+//	           Marshaling is not affected. It is set using the "scalaras=<Field>" flag.
+//
+//	HashOf     The BSON keys of fields, separated by "|", whose encoded values are hashed into
+//	           the value marshaled for a string (hex) or []byte field. The field's own value
+//	           is not marshaled. The hashed fields must come before the field. It is set using
+//	           the "hashof=<key>|<key>" flag. See Encoder.SetHashFunc and Decoder.VerifyHashes.
+//
+//	WriteOnly  Marshal the field but never unmarshal it. The value of its key is skipped when
+//	           unmarshaling, leaving the field unchanged.
+//
+//	ReadOnly   Unmarshal the field but never marshal it, e.g. for a value computed by the
+//	           database that is returned to clients.
+//
+//	BSONType   The BSON type a field is marshaled as and unmarshaled from instead of the default
+//	           for its Go type. It is set using the "bsontype=<type>" flag, where type is
+//	           "datetime" for an int, int32, or int64 field holding milliseconds since the Unix
+//	           epoch, or "uuid" for a []byte or [16]byte field stored as binary subtype 4.
 type structTags struct {
-	Name      string
-	OmitEmpty bool
-	MinSize   bool
-	Truncate  bool
-	Inline    bool
-	Skip      bool
+	Name       string
+	OmitEmpty  bool
+	OmitZero   bool
+	MinSize    bool
+	Truncate   bool
+	LocalTime  bool
+	Inline     bool
+	Prefix     string
+	Skip       bool
+	OnMissing  string
+	Required   bool
+	Pos        string
+	Order      string
+	Encoding   string
+	Codec      string
+	PairArray  bool
+	Binary     bool
+	Transform  string
+	Project    string
+	Glob       bool
+	TTLKey     string
+	Round      string
+	Generation bool
+	Mirror     string
+	Layout     string
+	TimeLayout string
+	Packed     string
+	Try        string
+	Bitset     bool
+	ScalarAs   string
+	HashOf     string
+	WriteOnly  bool
+	ReadOnly   bool
+	BSONType   string
+	// NameTagged is whether Name was set by the tag rather than taken from the field name, even if
+	// it is equal to the field name.
+	NameTagged bool
 }
 
 // DefaultStructTagParser is the StructTagParser used by the StructCodec by default.
@@ -68,7 +225,9 @@ type structTags struct {
 //
 // A struct tag either consisting entirely of '-' or with a bson key with a
 // value consisting entirely of '-' will return a StructTags with Skip true and
-// the remaining fields will be their default values.
+// the remaining fields will be their default values. As with encoding/json, a
+// value of "-," names the field "-". Any other value starting with "-," (e.g.
+// "-,omitempty") is ambiguous and returns an error.
 func parseStructTags(sf reflect.StructField) (*structTags, error) {
 	// key := strings.ToLower(sf.Name)
 	tag, ok := sf.Tag.Lookup("bson")
@@ -100,20 +259,94 @@ func parseTags(key string, tag string) (*structTags, error) {
 		st.Skip = true
 		return &st, nil
 	}
+	if strings.HasPrefix(tag, "-,") && tag != "-," {
+		return nil, fmt.Errorf("ambiguous struct tag %q: use \"-\" to skip the field or \"-,\" to name it \"-\"", tag)
+	}
 
 	for idx, str := range strings.Split(tag, ",") {
 		if idx == 0 && str != "" {
 			key = str
+			st.NameTagged = true
+		}
+		if opt, val, ok := strings.Cut(str, "="); ok && idx > 0 {
+			switch opt {
+			case "onmissing":
+				st.OnMissing = val
+			case "pos":
+				st.Pos = val
+			case "order":
+				st.Order = val
+			case "encoding":
+				st.Encoding = val
+			case "codec":
+				st.Codec = val
+			case "transform":
+				st.Transform = val
+			case "project":
+				st.Project = val
+			case "ttlkey":
+				st.TTLKey = val
+			case "round":
+				st.Round = val
+			case "mirror":
+				st.Mirror = val
+			case "layout":
+				st.Layout = val
+			case "timelayout":
+				st.TimeLayout = val
+			case "packed":
+				st.Packed = val
+			case "try":
+				st.Try = val
+			case "scalaras":
+				st.ScalarAs = val
+			case "hashof":
+				st.HashOf = val
+			case "bsontype":
+				st.BSONType = val
+			case "prefix":
+				st.Prefix = val
+			default:
+				return nil, fmt.Errorf("unknown struct tag option %q in %q", opt, tag)
+			}
+			continue
 		}
 		switch str {
 		case "omitempty":
 			st.OmitEmpty = true
+		case "omitzero":
+			st.OmitZero = true
 		case "minsize":
 			st.MinSize = true
 		case "truncate":
 			st.Truncate = true
+		case "localtime":
+			st.LocalTime = true
+		case "required":
+			st.Required = true
 		case "inline":
 			st.Inline = true
+		case "pairarray":
+			st.PairArray = true
+		case "binary":
+			st.Binary = true
+		case "glob":
+			st.Glob = true
+		case "generation":
+			st.Generation = true
+		case "bitset":
+			st.Bitset = true
+		case "writeonly":
+			st.WriteOnly = true
+		case "readonly":
+			st.ReadOnly = true
+		case "string":
+			// The encoding/json "string" option, which may be read by parseJSONStructTags, has no
+			// effect.
+		default:
+			if idx > 0 && str != "" {
+				return nil, fmt.Errorf("unknown struct tag option %q in %q", str, tag)
+			}
 		}
 	}
 
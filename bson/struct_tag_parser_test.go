@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
 )
 
 func TestStructTagParsers(t *testing.T) {
@@ -23,7 +24,7 @@ func TestStructTagParsers(t *testing.T) {
 		{
 			"default no bson tag",
 			reflect.StructField{Name: "foo", Tag: reflect.StructTag("bar")},
-			&structTags{Name: "bar"},
+			&structTags{Name: "bar", NameTagged: true},
 			parseStructTags,
 		},
 		{
@@ -44,10 +45,16 @@ func TestStructTagParsers(t *testing.T) {
 			&structTags{Skip: true},
 			parseStructTags,
 		},
+		{
+			"default bson tag dash comma",
+			reflect.StructField{Name: "foo", Tag: reflect.StructTag(`bson:"-,"`)},
+			&structTags{Name: "-", NameTagged: true},
+			parseStructTags,
+		},
 		{
 			"default all options",
 			reflect.StructField{Name: "foo", Tag: reflect.StructTag(`bar,omitempty,minsize,truncate,inline`)},
-			&structTags{Name: "bar", OmitEmpty: true, MinSize: true, Truncate: true, Inline: true},
+			&structTags{Name: "bar", NameTagged: true, OmitEmpty: true, MinSize: true, Truncate: true, Inline: true},
 			parseStructTags,
 		},
 		{
@@ -59,7 +66,7 @@ func TestStructTagParsers(t *testing.T) {
 		{
 			"default bson tag all options",
 			reflect.StructField{Name: "foo", Tag: reflect.StructTag(`bson:"bar,omitempty,minsize,truncate,inline"`)},
-			&structTags{Name: "bar", OmitEmpty: true, MinSize: true, Truncate: true, Inline: true},
+			&structTags{Name: "bar", NameTagged: true, OmitEmpty: true, MinSize: true, Truncate: true, Inline: true},
 			parseStructTags,
 		},
 		{
@@ -68,6 +75,12 @@ func TestStructTagParsers(t *testing.T) {
 			&structTags{Name: "foo", OmitEmpty: true, MinSize: true, Truncate: true, Inline: true},
 			parseStructTags,
 		},
+		{
+			"default bson tag field name",
+			reflect.StructField{Name: "foo", Tag: reflect.StructTag(`bson:"foo"`)},
+			&structTags{Name: "foo", NameTagged: true},
+			parseStructTags,
+		},
 		{
 			"default ignore xml",
 			reflect.StructField{Name: "foo", Tag: reflect.StructTag(`xml:"bar"`)},
@@ -77,7 +90,7 @@ func TestStructTagParsers(t *testing.T) {
 		{
 			"JSONFallback no bson tag",
 			reflect.StructField{Name: "foo", Tag: reflect.StructTag("bar")},
-			&structTags{Name: "bar"},
+			&structTags{Name: "bar", NameTagged: true},
 			parseStructTags,
 		},
 		{
@@ -101,7 +114,7 @@ func TestStructTagParsers(t *testing.T) {
 		{
 			"JSONFallback all options",
 			reflect.StructField{Name: "foo", Tag: reflect.StructTag(`bar,omitempty,minsize,truncate,inline`)},
-			&structTags{Name: "bar", OmitEmpty: true, MinSize: true, Truncate: true, Inline: true},
+			&structTags{Name: "bar", NameTagged: true, OmitEmpty: true, MinSize: true, Truncate: true, Inline: true},
 			parseJSONStructTags,
 		},
 		{
@@ -113,7 +126,7 @@ func TestStructTagParsers(t *testing.T) {
 		{
 			"JSONFallback bson tag all options",
 			reflect.StructField{Name: "foo", Tag: reflect.StructTag(`bson:"bar,omitempty,minsize,truncate,inline"`)},
-			&structTags{Name: "bar", OmitEmpty: true, MinSize: true, Truncate: true, Inline: true},
+			&structTags{Name: "bar", NameTagged: true, OmitEmpty: true, MinSize: true, Truncate: true, Inline: true},
 			parseJSONStructTags,
 		},
 		{
@@ -125,7 +138,7 @@ func TestStructTagParsers(t *testing.T) {
 		{
 			"JSONFallback json tag all options",
 			reflect.StructField{Name: "foo", Tag: reflect.StructTag(`json:"bar,omitempty,minsize,truncate,inline"`)},
-			&structTags{Name: "bar", OmitEmpty: true, MinSize: true, Truncate: true, Inline: true},
+			&structTags{Name: "bar", NameTagged: true, OmitEmpty: true, MinSize: true, Truncate: true, Inline: true},
 			parseJSONStructTags,
 		},
 		{
@@ -137,7 +150,7 @@ func TestStructTagParsers(t *testing.T) {
 		{
 			"JSONFallback bson tag overrides other tags",
 			reflect.StructField{Name: "foo", Tag: reflect.StructTag(`bson:"bar" json:"qux,truncate"`)},
-			&structTags{Name: "bar"},
+			&structTags{Name: "bar", NameTagged: true},
 			parseJSONStructTags,
 		},
 		{
@@ -158,3 +171,35 @@ func TestStructTagParsers(t *testing.T) {
 		})
 	}
 }
+
+func TestStructTagParsersDashOptions(t *testing.T) {
+	sf := reflect.StructField{Name: "foo", Tag: reflect.StructTag(`bson:"-,omitempty"`)}
+	_, err := parseStructTags(sf)
+	assert.ErrorContains(t, err, `ambiguous struct tag "-,omitempty"`)
+
+	type dashOptions struct {
+		Foo string `bson:"-,omitempty"`
+	}
+	_, err = Marshal(dashOptions{})
+	assert.ErrorContains(t, err, "(struct bson.dashOptions) field Foo: ambiguous struct tag")
+}
+
+func TestStructTagParsersUnknownOption(t *testing.T) {
+	sf := reflect.StructField{Name: "foo", Tag: reflect.StructTag(`bson:"foo,rund=2"`)}
+	_, err := parseStructTags(sf)
+	assert.ErrorContains(t, err, `unknown struct tag option "rund" in "foo,rund=2"`)
+
+	sf = reflect.StructField{Name: "foo", Tag: reflect.StructTag(`bson:"foo,omitempy"`)}
+	_, err = parseStructTags(sf)
+	assert.ErrorContains(t, err, `unknown struct tag option "omitempy" in "foo,omitempy"`)
+
+	sf = reflect.StructField{Name: "foo", Tag: reflect.StructTag(`json:"foo,string"`)}
+	_, err = parseJSONStructTags(sf)
+	assert.NoError(t, err)
+
+	type typo struct {
+		Price float64 `bson:"price,rund=2"`
+	}
+	_, err = Marshal(typo{})
+	assert.ErrorContains(t, err, "(struct bson.typo) field Price: unknown struct tag option")
+}
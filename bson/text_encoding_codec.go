@@ -0,0 +1,110 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+)
+
+// TextEncoding converts binary data to and from a text representation. TextEncodings are
+// registered by name on a Registry using RegisterTextEncoding and are selected for a []byte or
+// string struct field using the "encoding=<name>" struct tag option. The field is then stored as a
+// BSON string containing the text representation of its bytes.
+//
+// The *base64.Encoding types in the standard library implement TextEncoding.
+type TextEncoding interface {
+	EncodeToString(src []byte) string
+	DecodeString(s string) ([]byte, error)
+}
+
+// hexEncoding is the TextEncoding for hexadecimal strings.
+type hexEncoding struct{}
+
+func (hexEncoding) EncodeToString(src []byte) string {
+	return hex.EncodeToString(src)
+}
+
+func (hexEncoding) DecodeString(s string) ([]byte, error) {
+	return hex.DecodeString(s)
+}
+
+func registerDefaultTextEncodings(reg *Registry) {
+	reg.RegisterTextEncoding("base64", base64.StdEncoding)
+	reg.RegisterTextEncoding("hex", hexEncoding{})
+}
+
+// textEncodingCodec is the Codec used for []byte and string struct fields with the "encoding"
+// struct tag option.
+type textEncodingCodec struct {
+	name string
+	enc  TextEncoding
+}
+
+// EncodeValue encodes the bytes of val as a BSON string using the text encoding.
+func (tc *textEncodingCodec) EncodeValue(_ EncodeContext, vw ValueWriter, val reflect.Value) error {
+	var b []byte
+	switch {
+	case val.Kind() == reflect.String:
+		b = []byte(val.String())
+	case val.Kind() == reflect.Slice && val.Type().Elem().Kind() == reflect.Uint8:
+		if val.IsNil() {
+			return vw.WriteNull()
+		}
+		b = val.Bytes()
+	default:
+		return ValueEncoderError{
+			Name:     "TextEncodingEncodeValue",
+			Kinds:    []reflect.Kind{reflect.String, reflect.Slice},
+			Received: val,
+		}
+	}
+
+	return vw.WriteString(tc.enc.EncodeToString(b))
+}
+
+// DecodeValue decodes a BSON string using the text encoding and stores the bytes in val.
+func (tc *textEncodingCodec) DecodeValue(_ DecodeContext, vr ValueReader, val reflect.Value) error {
+	if !val.CanSet() ||
+		(val.Kind() != reflect.String && (val.Kind() != reflect.Slice || val.Type().Elem().Kind() != reflect.Uint8)) {
+		return ValueDecoderError{
+			Name:     "TextEncodingDecodeValue",
+			Kinds:    []reflect.Kind{reflect.String, reflect.Slice},
+			Received: val,
+		}
+	}
+
+	switch vrType := vr.Type(); vrType {
+	case TypeString:
+	case TypeNull:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadNull()
+	case TypeUndefined:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadUndefined()
+	default:
+		return fmt.Errorf("cannot decode %v into a %s encoded %s", vrType, tc.name, val.Type())
+	}
+
+	str, err := vr.ReadString()
+	if err != nil {
+		return err
+	}
+	b, err := tc.enc.DecodeString(str)
+	if err != nil {
+		return fmt.Errorf("invalid %s encoded value %q: %w", tc.name, str, err)
+	}
+
+	if val.Kind() == reflect.String {
+		val.SetString(string(b))
+	} else {
+		val.SetBytes(b)
+	}
+	return nil
+}
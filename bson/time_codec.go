@@ -103,7 +103,13 @@ func (tc *timeCodec) EncodeValue(_ EncodeContext, vw ValueWriter, val reflect.Va
 	if !val.IsValid() || val.Type() != tTime {
 		return ValueEncoderError{Name: "TimeEncodeValue", Types: []reflect.Type{tTime}, Received: val}
 	}
-	tt := val.Interface().(time.Time)
+	var tt time.Time
+	if val.CanAddr() {
+		// Boxing an addressable time.Time copies it to the heap, while boxing a pointer does not.
+		tt = *val.Addr().Interface().(*time.Time)
+	} else {
+		tt = val.Interface().(time.Time)
+	}
 	dt := NewDateTimeFromTime(tt)
 	return vw.WriteDateTime(int64(dt))
 }
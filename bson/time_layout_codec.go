@@ -0,0 +1,51 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"reflect"
+	"time"
+)
+
+// timeLayoutCodec is the Codec used for time.Time fields with the "timelayout" struct tag option.
+// It encodes the time as a BSON string formatted with the layout.
+type timeLayoutCodec struct {
+	layout string
+}
+
+// EncodeValue encodes the time.Time val as a BSON string formatted with the layout.
+func (tlc *timeLayoutCodec) EncodeValue(_ EncodeContext, vw ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != tTime {
+		return ValueEncoderError{Name: "TimeLayoutEncodeValue", Types: []reflect.Type{tTime}, Received: val}
+	}
+	return vw.WriteString(val.Interface().(time.Time).Format(tlc.layout))
+}
+
+// DecodeValue decodes a BSON string in the layout into the time.Time val. Other BSON values, such
+// as datetimes, are decoded as by the default time.Time decoder.
+func (tlc *timeLayoutCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != tTime {
+		return ValueDecoderError{Name: "TimeLayoutDecodeValue", Types: []reflect.Type{tTime}, Received: val}
+	}
+	if vr.Type() != TypeString {
+		return (&timeCodec{}).DecodeValue(dc, vr, val)
+	}
+
+	str, err := vr.ReadString()
+	if err != nil {
+		return err
+	}
+	tt, err := time.Parse(tlc.layout, str)
+	if err != nil {
+		return err
+	}
+	if !dc.useLocalTimeZone {
+		tt = tt.UTC()
+	}
+	val.Set(reflect.ValueOf(tt))
+	return nil
+}
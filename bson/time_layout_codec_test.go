@@ -0,0 +1,87 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
+	"go.mongodb.org/mongo-driver/v2/internal/require"
+)
+
+func TestTimeLayoutCodec(t *testing.T) {
+	t.Parallel()
+
+	type legacyEvent struct {
+		TS  time.Time `bson:"ts,timelayout=2006-01-02T15:04:05Z07:00"`
+		Day time.Time `bson:"day,timelayout=2006-01-02"`
+	}
+
+	ts := time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC)
+	day := time.Date(2021, time.March, 4, 0, 0, 0, 0, time.UTC)
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		in := legacyEvent{TS: ts, Day: day}
+		doc, err := Marshal(in)
+		require.NoError(t, err, "Marshal error")
+		assert.Equal(t, "2021-03-04T05:06:07Z", Raw(doc).Lookup("ts").StringValue())
+		assert.Equal(t, "2021-03-04", Raw(doc).Lookup("day").StringValue())
+
+		var got legacyEvent
+		err = Unmarshal(doc, &got)
+		require.NoError(t, err, "Unmarshal error")
+		assert.Equal(t, in, got)
+	})
+	t.Run("offset string", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"ts", "2021-03-04T07:06:07+02:00"}})
+		require.NoError(t, err, "Marshal error")
+
+		var got legacyEvent
+		err = Unmarshal(doc, &got)
+		require.NoError(t, err, "Unmarshal error")
+		assert.Equal(t, ts, got.TS)
+	})
+	t.Run("datetime", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"ts", NewDateTimeFromTime(ts)}, {"day", nil}})
+		require.NoError(t, err, "Marshal error")
+
+		got := legacyEvent{Day: day}
+		err = Unmarshal(doc, &got)
+		require.NoError(t, err, "Unmarshal error")
+		assert.Equal(t, legacyEvent{TS: ts}, got)
+	})
+	t.Run("invalid string", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"day", "04/03/2021"}})
+		require.NoError(t, err, "Marshal error")
+
+		var got legacyEvent
+		err = Unmarshal(doc, &got)
+		var de *DecodeError
+		require.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"day"}, de.Keys())
+		var pe *time.ParseError
+		assert.True(t, errors.As(err, &pe), "expected a time.ParseError, got %v", err)
+	})
+	t.Run("non-time field", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := Marshal(struct {
+			TS string `bson:"ts,timelayout=2006-01-02"`
+		}{})
+		assert.ErrorContains(t, err, "timelayout requires a time.Time field, but TS is a string")
+	})
+}
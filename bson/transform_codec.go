@@ -0,0 +1,110 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Transform is a string transformation applied to a string struct field after it is unmarshaled.
+// Transforms are registered by name on a Registry using RegisterTransform and are selected for a
+// field using the "transform=<name>|<name>..." struct tag option, which applies the named
+// Transforms in order.
+type Transform interface {
+	Apply(s string) (string, error)
+}
+
+// ReversibleTransform is a Transform that can be undone. When a field with a transform pipeline is
+// marshaled, the Reverse methods of the ReversibleTransforms in the pipeline are applied in the
+// opposite order. Transforms in the pipeline that are not reversible are skipped on marshal.
+type ReversibleTransform interface {
+	Transform
+	Reverse(s string) (string, error)
+}
+
+// TransformFunc is an adapter to allow the use of ordinary functions as Transforms.
+type TransformFunc func(s string) (string, error)
+
+// Apply calls fn(s).
+func (fn TransformFunc) Apply(s string) (string, error) {
+	return fn(s)
+}
+
+func registerDefaultTransforms(reg *Registry) {
+	reg.RegisterTransform("trim", TransformFunc(func(s string) (string, error) {
+		return strings.TrimSpace(s), nil
+	}))
+	reg.RegisterTransform("lower", TransformFunc(func(s string) (string, error) {
+		return strings.ToLower(s), nil
+	}))
+	reg.RegisterTransform("upper", TransformFunc(func(s string) (string, error) {
+		return strings.ToUpper(s), nil
+	}))
+}
+
+// transformCodec is the Codec used for string struct fields with the "transform" struct tag option.
+// It wraps the encoder and decoder that would otherwise be used for the field.
+type transformCodec struct {
+	names      []string
+	transforms []Transform
+	encoder    ValueEncoder
+	decoder    ValueDecoder
+}
+
+// EncodeValue reverses the reversible transforms in the pipeline and encodes the result.
+func (tc *transformCodec) EncodeValue(ec EncodeContext, vw ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Kind() != reflect.String {
+		return ValueEncoderError{Name: "TransformEncodeValue", Kinds: []reflect.Kind{reflect.String}, Received: val}
+	}
+	if tc.encoder == nil {
+		return errNoEncoder{Type: val.Type()}
+	}
+
+	s := val.String()
+	for i := len(tc.transforms) - 1; i >= 0; i-- {
+		rt, ok := tc.transforms[i].(ReversibleTransform)
+		if !ok {
+			continue
+		}
+		var err error
+		if s, err = rt.Reverse(s); err != nil {
+			return fmt.Errorf("transform %q: %w", tc.names[i], err)
+		}
+	}
+
+	out := reflect.New(val.Type()).Elem()
+	out.SetString(s)
+	return tc.encoder.EncodeValue(ec, vw, out)
+}
+
+// DecodeValue decodes a string and applies the transforms in the pipeline in order.
+func (tc *transformCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Kind() != reflect.String {
+		return ValueDecoderError{Name: "TransformDecodeValue", Kinds: []reflect.Kind{reflect.String}, Received: val}
+	}
+	if tc.decoder == nil {
+		return errNoDecoder{Type: val.Type()}
+	}
+
+	out := reflect.New(val.Type()).Elem()
+	if err := tc.decoder.DecodeValue(dc, vr, out); err != nil {
+		return err
+	}
+
+	s := out.String()
+	for i, t := range tc.transforms {
+		var err error
+		if s, err = t.Apply(s); err != nil {
+			return fmt.Errorf("transform %q: %w", tc.names[i], err)
+		}
+	}
+
+	val.SetString(s)
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/internal/errutil"
+)
+
+// tryTypes maps the type names accepted by the "try" struct tag option to Go types.
+var tryTypes = map[string]reflect.Type{
+	"Int32":      tInt32,
+	"Int64":      tInt64,
+	"Int":        tInt,
+	"Float64":    tFloat64,
+	"Decimal128": tDecimal,
+	"String":     tString,
+	"Bool":       tBool,
+	"Time":       tTime,
+	"DateTime":   tDateTime,
+	"ObjectID":   tOID,
+	"Binary":     tBinary,
+	"D":          tD,
+	"M":          tM,
+	"A":          tA,
+}
+
+// tryCodec is the ValueDecoder used for interface fields with the "try" struct tag option. It
+// decodes a BSON value into the first of a list of Go types that it can be decoded into.
+type tryCodec struct {
+	names []string
+	types []reflect.Type
+}
+
+// newTryCodec parses a "try" struct tag option value, a list of type names separated by "|", and
+// returns a tryCodec for fields of the interface type t.
+func newTryCodec(spec string, t reflect.Type) (*tryCodec, error) {
+	if t.Kind() != reflect.Interface {
+		return nil, fmt.Errorf("try requires an interface field, got %s", t)
+	}
+	tc := &tryCodec{names: strings.Split(spec, "|")}
+	for _, name := range tc.names {
+		rt, ok := tryTypes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown try type %q", name)
+		}
+		if !rt.AssignableTo(t) {
+			return nil, fmt.Errorf("try type %s does not implement %s", name, t)
+		}
+		tc.types = append(tc.types, rt)
+	}
+	return tc, nil
+}
+
+// DecodeValue decodes the BSON value read from vr into each of the types of tc in order, setting
+// val to the first value that is decoded without an error. It returns an error if the value
+// cannot be decoded into any of the types. BSON null and undefined values set val to nil.
+func (tc *tryCodec) DecodeValue(dc DecodeContext, vr ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Kind() != reflect.Interface {
+		return ValueDecoderError{Name: "TryDecodeValue", Kinds: []reflect.Kind{reflect.Interface}, Received: val}
+	}
+
+	switch vr.Type() {
+	case TypeNull:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadNull()
+	case TypeUndefined:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadUndefined()
+	}
+
+	bt, data, err := copyValueToBytes(vr)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, 0, len(tc.types))
+	for i, rt := range tc.types {
+		decoder, err := dc.LookupDecoder(rt)
+		if err != nil {
+			return err
+		}
+		elem := reflect.New(rt).Elem()
+		err = decoder.DecodeValue(dc, newBufferedValueReader(bt, data), elem)
+		if err == nil {
+			val.Set(elem)
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", tc.names[i], err))
+	}
+	return fmt.Errorf("cannot decode %v into any of %s: %w", bt, strings.Join(tc.names, ", "), errutil.Join(errs...))
+}
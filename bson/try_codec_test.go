@@ -0,0 +1,103 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bson
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/internal/assert"
+	"go.mongodb.org/mongo-driver/v2/internal/require"
+)
+
+func TestTryCodec(t *testing.T) {
+	t.Parallel()
+
+	type reading struct {
+		Val any `bson:"val,try=Int64|Decimal128|String"`
+	}
+
+	dec, err := ParseDecimal128("1.25")
+	require.NoError(t, err, "ParseDecimal128 error")
+
+	testCases := []struct {
+		name string
+		val  any
+		want any
+	}{
+		{"int32", int32(42), int64(42)},
+		{"integral double", 2.0, int64(2)},
+		{"decimal", dec, dec},
+		{"string", "n/a", "n/a"},
+		{"null", nil, nil},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc, err := Marshal(D{{"val", tc.val}})
+			require.NoError(t, err, "Marshal error")
+
+			got := reading{Val: "stale"}
+			err = Unmarshal(doc, &got)
+			require.NoError(t, err, "Unmarshal error")
+			assert.Equal(t, tc.want, got.Val)
+		})
+	}
+	t.Run("no type matches", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := Marshal(D{{"val", 1.5}})
+		require.NoError(t, err, "Marshal error")
+
+		var got reading
+		err = Unmarshal(doc, &got)
+		var de *DecodeError
+		require.True(t, errors.As(err, &de), "expected a DecodeError, got %v", err)
+		assert.Equal(t, []string{"val"}, de.Keys())
+		assert.ErrorContains(t, err, "cannot decode double into any of Int64, Decimal128, String")
+		assert.Nil(t, got.Val)
+	})
+
+	describeErrs := []struct {
+		name    string
+		val     any
+		wantErr string
+	}{
+		{
+			name: "unknown type",
+			val: &struct {
+				Val any `bson:"val,try=Int64|Float"`
+			}{},
+			wantErr: `unknown try type "Float"`,
+		},
+		{
+			name: "not an interface",
+			val: &struct {
+				Val int64 `bson:"val,try=Int64"`
+			}{},
+			wantErr: "try requires an interface field",
+		},
+		{
+			name: "not assignable",
+			val: &struct {
+				Val error `bson:"val,try=String"`
+			}{},
+			wantErr: "try type String does not implement error",
+		},
+	}
+	for _, tc := range describeErrs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := Unmarshal([]byte{0x05, 0x00, 0x00, 0x00, 0x00}, tc.val)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
@@ -8,6 +8,7 @@ package bson
 
 import (
 	"encoding/json"
+	"net"
 	"net/url"
 	"reflect"
 	"time"
@@ -87,6 +88,8 @@ var tEmpty = reflect.TypeOf((*any)(nil)).Elem()
 var tByteSlice = reflect.TypeOf([]byte(nil))
 var tByte = reflect.TypeOf(byte(0x00))
 var tURL = reflect.TypeOf(url.URL{})
+var tIP = reflect.TypeOf(net.IP(nil))
+var tHardwareAddr = reflect.TypeOf(net.HardwareAddr(nil))
 var tJSONNumber = reflect.TypeOf(json.Number(""))
 
 var tValueMarshaler = reflect.TypeOf((*ValueMarshaler)(nil)).Elem()
@@ -94,6 +97,9 @@ var tValueUnmarshaler = reflect.TypeOf((*ValueUnmarshaler)(nil)).Elem()
 var tMarshaler = reflect.TypeOf((*Marshaler)(nil)).Elem()
 var tUnmarshaler = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
 var tZeroer = reflect.TypeOf((*Zeroer)(nil)).Elem()
+var tEncodeSkipper = reflect.TypeOf((*EncodeSkipper)(nil)).Elem()
+var tMapSetter = reflect.TypeOf((*MapSetter)(nil)).Elem()
+var tRawBSONMarshaler = reflect.TypeOf((*RawBSONMarshaler)(nil)).Elem()
 
 var tBinary = reflect.TypeOf(Binary{})
 var tUndefined = reflect.TypeOf(Undefined{})
@@ -51,6 +51,10 @@ func (uic *uintCodec) EncodeValue(ec EncodeContext, vw ValueWriter, val reflect.
 }
 
 func (uic *uintCodec) decodeType(dc DecodeContext, vr ValueReader, t reflect.Type) (reflect.Value, error) {
+	if err := checkWidening(dc, vr.Type(), t); err != nil {
+		return emptyValue, err
+	}
+	checkLegacy(dc, vr.Type(), t)
 	var i64 int64
 	var err error
 	switch vrType := vr.Type(); vrType {
@@ -70,13 +74,9 @@ func (uic *uintCodec) decodeType(dc DecodeContext, vr ValueReader, t reflect.Typ
 		if err != nil {
 			return emptyValue, err
 		}
-		if !dc.truncate && math.Floor(f64) != f64 {
-			return emptyValue, errCannotTruncate
-		}
-		if f64 > float64(math.MaxInt64) {
-			return emptyValue, fmt.Errorf("%g overflows int64", f64)
+		if i64, err = doubleToInt64(dc, f64); err != nil {
+			return emptyValue, err
 		}
-		i64 = int64(f64)
 	case TypeBoolean:
 		b, err := vr.ReadBoolean()
 		if err != nil {
@@ -100,35 +100,35 @@ func (uic *uintCodec) decodeType(dc DecodeContext, vr ValueReader, t reflect.Typ
 	switch t.Kind() {
 	case reflect.Uint8:
 		if i64 < 0 || i64 > math.MaxUint8 {
-			return emptyValue, fmt.Errorf("%d overflows uint8", i64)
+			return emptyValue, overflowError(dc, i64, t)
 		}
 
 		return reflect.ValueOf(uint8(i64)), nil
 	case reflect.Uint16:
 		if i64 < 0 || i64 > math.MaxUint16 {
-			return emptyValue, fmt.Errorf("%d overflows uint16", i64)
+			return emptyValue, overflowError(dc, i64, t)
 		}
 
 		return reflect.ValueOf(uint16(i64)), nil
 	case reflect.Uint32:
 		if i64 < 0 || i64 > math.MaxUint32 {
-			return emptyValue, fmt.Errorf("%d overflows uint32", i64)
+			return emptyValue, overflowError(dc, i64, t)
 		}
 
 		return reflect.ValueOf(uint32(i64)), nil
 	case reflect.Uint64:
 		if i64 < 0 {
-			return emptyValue, fmt.Errorf("%d overflows uint64", i64)
+			return emptyValue, overflowError(dc, i64, t)
 		}
 
 		return reflect.ValueOf(uint64(i64)), nil
 	case reflect.Uint:
 		if i64 < 0 {
-			return emptyValue, fmt.Errorf("%d overflows uint", i64)
+			return emptyValue, overflowError(dc, i64, t)
 		}
 		v := uint64(i64)
 		if v > math.MaxUint { // Can we fit this inside of an uint
-			return emptyValue, fmt.Errorf("%d overflows uint", i64)
+			return emptyValue, overflowError(dc, i64, t)
 		}
 
 		return reflect.ValueOf(uint(v)), nil
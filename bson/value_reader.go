@@ -752,6 +752,24 @@ func (vr *valueReader) ReadString() (string, error) {
 	return s, nil
 }
 
+// readInternedString is like ReadString but returns the string in st that is equal to the value,
+// which avoids allocating a string for values already in st.
+func (vr *valueReader) readInternedString(st *StringTable) (string, error) {
+	if err := vr.ensureElementValue(TypeString, 0, "ReadString"); err != nil {
+		return "", err
+	}
+	raw, err := vr.readStringBytes()
+	if err != nil {
+		return "", err
+	}
+	s := st.internBytes(raw)
+
+	if err := vr.pop(); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
 // ReadSymbol reads a BSON Symbol value, advancing the reader position to the
 // end of the Symbol value.
 func (vr *valueReader) ReadSymbol() (string, error) {
@@ -888,27 +906,36 @@ func (vr *valueReader) readCString() (string, error) {
 }
 
 func (vr *valueReader) readString() (string, error) {
-	length, err := vr.readLength()
+	raw, err := vr.readStringBytes()
 	if err != nil {
 		return "", err
 	}
+	return string(raw), nil
+}
+
+// readStringBytes reads a length-prefixed string and returns its bytes without the trailing NUL.
+func (vr *valueReader) readStringBytes() ([]byte, error) {
+	length, err := vr.readLength()
+	if err != nil {
+		return nil, err
+	}
 
 	if length <= 0 {
-		return "", fmt.Errorf("invalid string length: %d", length)
+		return nil, fmt.Errorf("invalid string length: %d", length)
 	}
 
 	raw, err := readBytes(vr.src, int(length))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Check that the last byte is the NUL terminator.
 	if raw[len(raw)-1] != 0x00 {
-		return "", fmt.Errorf("string does not end with null byte, but with %v", raw[len(raw)-1])
+		return nil, fmt.Errorf("string does not end with null byte, but with %v", raw[len(raw)-1])
 	}
 
-	// Convert and strip the trailing NUL.
-	return string(raw[:len(raw)-1]), nil
+	// Strip the trailing NUL.
+	return raw[:len(raw)-1], nil
 }
 
 func (vr *valueReader) peekLength() (int32, error) {